@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// detachedProcAttr is a no-op on Windows, which has no Unix sessions.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -18,8 +18,10 @@ import (
 	"github.com/user/agenterm/internal/parser"
 	"github.com/user/agenterm/internal/pty"
 	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/sandbox"
 	"github.com/user/agenterm/internal/server"
 	"github.com/user/agenterm/internal/session"
+	"github.com/user/agenterm/internal/tmux"
 )
 
 var version = "0.1.0"
@@ -29,9 +31,19 @@ type sessionRuntime struct {
 	parser *parser.Parser
 }
 
+// terminalBackend is the terminal runtime driven by the server: the
+// in-process PTY backend, a client of the ptyd supervisor, or tmux.
+type terminalBackend interface {
+	session.TerminalBackend
+	session.ScreenBackend
+	Events(id string) <-chan pty.Event
+	ListSessions() []pty.SessionInfo
+	Close()
+}
+
 type runtimeState struct {
 	cfg       *config.Config
-	backend   *pty.Backend
+	backend   terminalBackend
 	hub       *hub.Hub
 	lifecycle *session.Manager
 
@@ -39,7 +51,7 @@ type runtimeState struct {
 	sessions map[string]*sessionRuntime
 }
 
-func newRuntimeState(cfg *config.Config, backend *pty.Backend, h *hub.Hub, lifecycle *session.Manager) *runtimeState {
+func newRuntimeState(cfg *config.Config, backend terminalBackend, h *hub.Hub, lifecycle *session.Manager) *runtimeState {
 	return &runtimeState{
 		cfg:       cfg,
 		backend:   backend,
@@ -136,7 +148,7 @@ func (s *runtimeState) ensureSessionLoop(ctx context.Context, sessionID string)
 }
 
 func (s *runtimeState) broadcastWindows() {
-	infos := s.backend.Manager().ListSessions()
+	infos := s.backend.ListSessions()
 	windows := make([]hub.WindowInfo, 0, len(infos))
 	for _, info := range infos {
 		if !info.Active {
@@ -201,7 +213,7 @@ func (s *runtimeState) watchManagedSessions(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			for _, info := range s.backend.Manager().ListSessions() {
+			for _, info := range s.backend.ListSessions() {
 				if info.Active {
 					s.ensureSessionLoop(ctx, info.ID)
 				}
@@ -210,6 +222,21 @@ func (s *runtimeState) watchManagedSessions(ctx context.Context) {
 	}
 }
 
+// newTerminalBackend builds the terminal runtime selected by
+// cfg.TerminalBackend.
+func newTerminalBackend(cfg *config.Config) (terminalBackend, error) {
+	switch cfg.TerminalBackend {
+	case config.TerminalBackendPtyd:
+		return connectPtyd(cfg)
+	case config.TerminalBackendTmux:
+		return tmux.NewBackend(cfg.TmuxSession)
+	default:
+		backend := pty.NewBackend()
+		backend.SetRecordingDir(cfg.RecordingsDir)
+		return backend, nil
+	}
+}
+
 func main() {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
 
@@ -217,6 +244,15 @@ func main() {
 		fmt.Printf("agenterm v%s\n", version)
 		os.Exit(0)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "ptyd" {
+		os.Exit(runPtyd(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == sandbox.HelperCommand {
+		// Only returns when the sandboxed command could not be started.
+		err := sandbox.Exec(os.Args[2:])
+		fmt.Fprintf(os.Stderr, "agenterm %s: %v\n", sandbox.HelperCommand, err)
+		os.Exit(126)
+	}
 
 	cfg, err := config.Load()
 	if err != nil {
@@ -240,9 +276,17 @@ func main() {
 		slog.Error("failed to initialize agent registry", "dir", cfg.AgentsDir, "error", err)
 		os.Exit(1)
 	}
-	backend := pty.NewBackend()
+	backend, err := newTerminalBackend(cfg)
+	if err != nil {
+		slog.Error("failed to initialize terminal backend", "backend", cfg.TerminalBackend, "error", err)
+		os.Exit(1)
+	}
 	h := hub.New(cfg.Token, nil)
 	lifecycleManager := session.NewManager(appDB.SQL(), backend, agentRegistry, h)
+	lifecycleManager.SetCgroupRoot(cfg.CgroupRoot)
+	lifecycleManager.SetMaxParallel(cfg.OrchestratorGlobalMaxParallel)
+	lifecycleManager.SetPlaybooksDir(cfg.PlaybooksDir)
+	lifecycleManager.SetPoliciesDir(cfg.PoliciesDir)
 	state := newRuntimeState(cfg, backend, h, lifecycleManager)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -251,11 +295,17 @@ func main() {
 	// --- Hub callbacks for terminal I/O ---
 
 	h.SetOnInputWithSession(func(sessionID string, windowID string, keys string) {
+		if lifecycleManager != nil {
+			lifecycleManager.NoteTerminalActivity(sessionID)
+		}
 		if err := state.sendKeys(ctx, sessionID, windowID, keys); err != nil {
 			slog.Error("failed to send keys", "session", sessionID, "window", windowID, "error", err)
 		}
 	})
 	h.SetOnTerminalInputWithSession(func(sessionID string, windowID string, keys string) {
+		if lifecycleManager != nil {
+			lifecycleManager.NoteTerminalActivity(sessionID)
+		}
 		if err := state.sendRaw(ctx, sessionID, windowID, keys); err != nil {
 			slog.Error("failed to send raw input", "session", sessionID, "window", windowID, "error", err)
 		}
@@ -303,7 +353,7 @@ func main() {
 		callCtx, callCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer callCancel()
 		if lifecycleManager != nil {
-			if err := lifecycleManager.SetTakeover(callCtx, sessionID, true); err != nil {
+			if _, err := lifecycleManager.AcquireTakeover(callCtx, sessionID, session.TakeoverOwnerTerminal, 0); err != nil {
 				slog.Debug("failed to set human takeover", "session", sessionID, "error", err)
 			}
 		}
@@ -316,11 +366,26 @@ func main() {
 		callCtx, callCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer callCancel()
 		if lifecycleManager != nil {
-			if err := lifecycleManager.SetTakeover(callCtx, sessionID, false); err != nil {
+			if _, err := lifecycleManager.ReleaseTakeover(callCtx, sessionID, session.TakeoverOwnerTerminal); err != nil {
 				slog.Debug("failed to clear human takeover", "session", sessionID, "error", err)
 			}
 		}
 	})
+	h.SetOnTerminalHeartbeat(func(sessionID string) {
+		if lifecycleManager != nil {
+			lifecycleManager.NoteTerminalActivity(sessionID)
+		}
+	})
+	h.SetTerminalSnapshotProvider(func(sessionID string) (string, bool) {
+		callCtx, callCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer callCancel()
+		snap, err := backend.Screen(callCtx, sessionID)
+		if err != nil {
+			slog.Debug("failed to render terminal snapshot", "session", sessionID, "error", err)
+			return "", false
+		}
+		return snap.ANSI, true
+	})
 
 	// --- Server ---
 
@@ -347,7 +412,7 @@ func main() {
 
 func printStartupBanner(cfg *config.Config) {
 	fmt.Printf("\nagenterm v%s\n", version)
-	fmt.Printf("  backend:      pty\n")
+	fmt.Printf("  backend:      %s\n", cfg.TerminalBackend)
 	fmt.Printf("  listening on: http://0.0.0.0:%d\n", cfg.Port)
 	if cfg.PrintToken {
 		fmt.Printf("  access URL:   http://localhost:%d?token=%s\n", cfg.Port, cfg.Token)
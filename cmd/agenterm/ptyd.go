@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/user/agenterm/internal/config"
+	"github.com/user/agenterm/internal/pty"
+	"github.com/user/agenterm/internal/ptyd"
+)
+
+const ptydStartTimeout = 5 * time.Second
+
+// runPtyd runs the PTY supervisor until it receives SIGINT or SIGTERM.
+// Stopping the supervisor terminates every session it owns.
+func runPtyd(args []string) int {
+	cfg, err := config.LoadPtyd(args)
+	if err != nil {
+		slog.Error("failed to load ptyd config", "error", err)
+		return 2
+	}
+
+	backend := pty.NewBackend()
+	backend.SetRecordingDir(cfg.RecordingsDir)
+	defer backend.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	slog.Info("starting ptyd", "socket", cfg.PtydSocket, "pid", os.Getpid())
+	if err := ptyd.NewServer(backend).Serve(ctx, cfg.PtydSocket); err != nil {
+		slog.Error("ptyd stopped", "error", err)
+		return 1
+	}
+	slog.Info("ptyd stopped")
+	return 0
+}
+
+// connectPtyd attaches to the supervisor on cfg.PtydSocket, starting a
+// detached one first if nothing is listening.
+func connectPtyd(cfg *config.Config) (*ptyd.Client, error) {
+	if client, err := ptyd.Dial(cfg.PtydSocket); err == nil {
+		return client, nil
+	}
+	if err := spawnPtyd(cfg); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(ptydStartTimeout)
+	for {
+		client, err := ptyd.Dial(cfg.PtydSocket)
+		if err == nil {
+			return client, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("ptyd did not start on %s: %w", cfg.PtydSocket, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// spawnPtyd starts "agenterm ptyd" in its own session so it outlives this
+// process. Its log is written next to the socket.
+func spawnPtyd(cfg *config.Config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate agenterm binary: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.PtydSocket), 0o700); err != nil {
+		return fmt.Errorf("create ptyd dir: %w", err)
+	}
+	logPath := strings.TrimSuffix(cfg.PtydSocket, filepath.Ext(cfg.PtydSocket)) + ".log"
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open ptyd log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "ptyd", "--socket", cfg.PtydSocket, "--recordings-dir", cfg.RecordingsDir)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start ptyd: %w", err)
+	}
+	slog.Info("started ptyd supervisor", "pid", cmd.Process.Pid, "socket", cfg.PtydSocket, "log", logPath)
+	return cmd.Process.Release()
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/user/agenterm/internal/db"
 	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/resources"
 )
 
 func (h *handler) listAgents(w http.ResponseWriter, r *http.Request) {
@@ -19,14 +20,15 @@ func (h *handler) listAgents(w http.ResponseWriter, r *http.Request) {
 }
 
 type agentAssignment struct {
-	SessionID      string `json:"session_id"`
-	ProjectID      string `json:"project_id,omitempty"`
-	ProjectName    string `json:"project_name,omitempty"`
-	TaskID         string `json:"task_id,omitempty"`
-	TaskTitle      string `json:"task_title,omitempty"`
-	Role           string `json:"role"`
-	Status         string `json:"status"`
-	LastActivityAt string `json:"last_activity_at,omitempty"`
+	SessionID      string           `json:"session_id"`
+	ProjectID      string           `json:"project_id,omitempty"`
+	ProjectName    string           `json:"project_name,omitempty"`
+	TaskID         string           `json:"task_id,omitempty"`
+	TaskTitle      string           `json:"task_title,omitempty"`
+	Role           string           `json:"role"`
+	Status         string           `json:"status"`
+	LastActivityAt string           `json:"last_activity_at,omitempty"`
+	Usage          *resources.Usage `json:"usage,omitempty"`
 }
 
 type agentRuntimeStatus struct {
@@ -39,6 +41,8 @@ type agentRuntimeStatus struct {
 	Idle         int               `json:"idle"`
 	Overflow     int               `json:"overflow"`
 	Assignments  []agentAssignment `json:"assignments"`
+	Limits       resources.Limits  `json:"limits"`
+	Usage        resources.Usage   `json:"usage"`
 }
 
 type agentStatusResponse struct {
@@ -104,6 +108,11 @@ func (h *handler) listAgentStatuses(w http.ResponseWriter, r *http.Request) {
 		if !session.LastActivityAt.IsZero() {
 			item.LastActivityAt = session.LastActivityAt.UTC().Format(time.RFC3339)
 		}
+		if h.lifecycle != nil {
+			if status, err := h.lifecycle.GetResourceStatus(r.Context(), session.ID); err == nil {
+				item.Usage = status.Usage
+			}
+		}
 		if task := taskByID[session.TaskID]; task != nil {
 			item.ProjectID = task.ProjectID
 			item.TaskTitle = task.Title
@@ -131,10 +140,19 @@ func (h *handler) listAgentStatuses(w http.ResponseWriter, r *http.Request) {
 			return assignments[i].LastActivityAt > assignments[j].LastActivityAt
 		})
 		orchestratorCount := 0
+		var usage resources.Usage
 		for _, assignment := range assignments {
 			if strings.EqualFold(strings.TrimSpace(assignment.Role), "orchestrator") {
 				orchestratorCount++
 			}
+			if assignment.Usage != nil {
+				usage.CPUPercent += assignment.Usage.CPUPercent
+				usage.RSSBytes += assignment.Usage.RSSBytes
+				usage.Processes += assignment.Usage.Processes
+				if assignment.Usage.SampledAt.After(usage.SampledAt) {
+					usage.SampledAt = assignment.Usage.SampledAt
+				}
+			}
 		}
 		assignedCount := len(assignments) - orchestratorCount
 		if assignedCount < 0 {
@@ -157,6 +175,8 @@ func (h *handler) listAgentStatuses(w http.ResponseWriter, r *http.Request) {
 			Idle:         idle,
 			Overflow:     overflow,
 			Assignments:  assignments,
+			Limits:       agent.Limits,
+			Usage:        usage,
 		})
 		resp.TotalCapacity += capacity
 		resp.TotalBusy += busy
@@ -175,7 +195,7 @@ func (h *handler) listAgentStatuses(w http.ResponseWriter, r *http.Request) {
 
 func isBusyAgentStatus(status string) bool {
 	switch strings.ToLower(strings.TrimSpace(status)) {
-	case "", "idle", "disconnected", "sleeping", "paused", "completed", "failed", "stopped", "terminated", "closed", "dead":
+	case "", "idle", "disconnected", "sleeping", "paused", "completed", "handed_off", "failed", "stopped", "terminated", "closed", "dead":
 		return false
 	default:
 		return true
@@ -267,3 +287,33 @@ func (h *handler) deleteAgent(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *handler) getAgentWaitlist(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	entries, err := h.lifecycle.Waitlist(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, entries)
+}
+
+// deleteAgentWaitlist cancels the entry named by ?entry_id, or the whole
+// waitlist without it.
+func (h *handler) deleteAgentWaitlist(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	removed, err := h.lifecycle.CancelWaitlist(r.Context(), r.PathValue("id"), strings.TrimSpace(r.URL.Query().Get("entry_id")))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"removed": removed})
+}
@@ -62,6 +62,7 @@ func (h *handler) launchExecution(w http.ResponseWriter, r *http.Request) {
 
 	var tasks []*db.Task
 	var worktrees []*db.Worktree
+	taskIDs := map[string]string{}
 
 	for _, bpTask := range bp.Tasks {
 		task := &db.Task{
@@ -69,8 +70,8 @@ func (h *handler) launchExecution(w http.ResponseWriter, r *http.Request) {
 			Title:         bpTask.Title,
 			Description:   bpTask.Description,
 			Status:        "pending",
-			DependsOn:     bpTask.DependsOn,
 			RequirementID: requirementID,
+			AgentType:     strings.TrimSpace(bpTask.AgentType),
 		}
 		if err := h.taskRepo.Create(r.Context(), task); err != nil {
 			jsonError(w, http.StatusInternalServerError, err.Error())
@@ -96,6 +97,29 @@ func (h *handler) launchExecution(w http.ResponseWriter, r *http.Request) {
 
 		tasks = append(tasks, task)
 		worktrees = append(worktrees, wt)
+		if bpTask.ID != "" {
+			taskIDs[bpTask.ID] = task.ID
+		}
+	}
+
+	// Blueprint dependencies name blueprint task ids; the scheduler
+	// resolves them against the created tasks.
+	for i, bpTask := range bp.Tasks {
+		if len(bpTask.DependsOn) == 0 {
+			continue
+		}
+		task := tasks[i]
+		task.DependsOn = make([]string, 0, len(bpTask.DependsOn))
+		for _, dep := range bpTask.DependsOn {
+			if id, ok := taskIDs[dep]; ok {
+				dep = id
+			}
+			task.DependsOn = append(task.DependsOn, dep)
+		}
+		if err := h.taskRepo.Update(r.Context(), task); err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
 
 	run, err := h.runRepo.EnsureActive(r.Context(), project.ID, "build", "launch")
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	sessionpkg "github.com/user/agenterm/internal/session"
+)
+
+type createHeadlessRunRequest struct {
+	AgentType string `json:"agent_type"`
+	Prompt    string `json:"prompt"`
+	TimeoutMS int64  `json:"timeout_ms"`
+}
+
+func (h *handler) createHeadlessRun(w http.ResponseWriter, r *http.Request) {
+	var req createHeadlessRunRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.TimeoutMS < 0 {
+		jsonError(w, http.StatusBadRequest, "timeout_ms must be >= 0")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	run, err := h.lifecycle.StartHeadlessRun(r.Context(), r.PathValue("id"), sessionpkg.HeadlessRunRequest{
+		AgentType: strings.TrimSpace(req.AgentType),
+		Prompt:    req.Prompt,
+		Timeout:   time.Duration(req.TimeoutMS) * time.Millisecond,
+	})
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, run)
+}
+
+func (h *handler) listHeadlessRuns(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	runs, err := h.lifecycle.ListHeadlessRuns(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, runs)
+}
+
+func (h *handler) getHeadlessRun(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	run, err := h.lifecycle.GetHeadlessRun(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, run)
+}
+
+func (h *handler) cancelHeadlessRun(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	if err := h.lifecycle.CancelHeadlessRun(r.Context(), r.PathValue("id")); err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
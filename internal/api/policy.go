@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+type evaluatePolicyRequest struct {
+	Command string `json:"command"`
+	Role    string `json:"role"`
+	TaskID  string `json:"task_id"`
+}
+
+// evaluateProjectPolicy reports the decision the project's command policy
+// would make on a command without sending it anywhere.
+func (h *handler) evaluateProjectPolicy(w http.ResponseWriter, r *http.Request) {
+	var req evaluatePolicyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	eval, err := h.lifecycle.EvaluateCommandPolicy(r.Context(), r.PathValue("id"), strings.TrimSpace(req.Role), strings.TrimSpace(req.TaskID), req.Command)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, eval)
+}
+
+func (h *handler) listProjectPolicyEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), 100)
+	if err != nil || limit <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid limit query parameter")
+		return
+	}
+	since, err := parseSince(strings.TrimSpace(query.Get("since")))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid since query parameter")
+		return
+	}
+	until, err := parseSince(strings.TrimSpace(query.Get("until")))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid until query parameter")
+		return
+	}
+	action := strings.TrimSpace(query.Get("action"))
+	if action != "" && action != "block" && action != "warn" {
+		jsonError(w, http.StatusBadRequest, "action must be block or warn")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	events, err := h.lifecycle.ListPolicyEvents(r.Context(), r.PathValue("id"), db.PolicyEventFilter{
+		TaskID:    strings.TrimSpace(query.Get("task_id")),
+		SessionID: strings.TrimSpace(query.Get("session_id")),
+		Action:    action,
+		Rule:      strings.TrimSpace(query.Get("rule")),
+		Since:     since,
+		Until:     until,
+		Limit:     limit,
+	})
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
@@ -4,20 +4,31 @@ import (
 	"net/http"
 
 	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/responder"
 )
 
 type createProjectRequest struct {
-	Name     string `json:"name"`
-	RepoPath string `json:"repo_path"`
-	Playbook string `json:"playbook"`
-	Status   string `json:"status"`
+	Name           string           `json:"name"`
+	RepoPath       string           `json:"repo_path"`
+	Playbook       string           `json:"playbook"`
+	Status         string           `json:"status"`
+	ResourceLimits resources.Limits `json:"resource_limits"`
+	Env            environ.Map      `json:"env"`
+	ResponderRules responder.Rules  `json:"responder_rules"`
+	AutoSchedule   bool             `json:"auto_schedule"`
 }
 
 type updateProjectRequest struct {
-	Name     *string `json:"name"`
-	RepoPath *string `json:"repo_path"`
-	Playbook *string `json:"playbook"`
-	Status   *string `json:"status"`
+	Name           *string           `json:"name"`
+	RepoPath       *string           `json:"repo_path"`
+	Playbook       *string           `json:"playbook"`
+	Status         *string           `json:"status"`
+	ResourceLimits *resources.Limits `json:"resource_limits"`
+	Env            *environ.Map      `json:"env"`
+	ResponderRules *responder.Rules  `json:"responder_rules"`
+	AutoSchedule   *bool             `json:"auto_schedule"`
 }
 
 type projectDetailResponse struct {
@@ -37,16 +48,32 @@ func (h *handler) createProject(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "name and repo_path are required")
 		return
 	}
+	if err := req.ResourceLimits.Validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := req.Env.Validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := req.ResponderRules.Validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	status := req.Status
 	if status == "" {
 		status = "active"
 	}
 
 	project := &db.Project{
-		Name:     req.Name,
-		RepoPath: req.RepoPath,
-		Status:   status,
-		Playbook: req.Playbook,
+		Name:           req.Name,
+		RepoPath:       req.RepoPath,
+		Status:         status,
+		Playbook:       req.Playbook,
+		ResourceLimits: req.ResourceLimits,
+		Env:            req.Env,
+		ResponderRules: req.ResponderRules,
+		AutoSchedule:   req.AutoSchedule,
 	}
 	if err := h.projectRepo.Create(r.Context(), project); err != nil {
 		jsonError(w, http.StatusInternalServerError, err.Error())
@@ -136,6 +163,30 @@ func (h *handler) updateProject(w http.ResponseWriter, r *http.Request) {
 	if req.Status != nil {
 		project.Status = *req.Status
 	}
+	if req.ResourceLimits != nil {
+		if err := req.ResourceLimits.Validate(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		project.ResourceLimits = *req.ResourceLimits
+	}
+	if req.Env != nil {
+		if err := req.Env.Validate(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		project.Env = *req.Env
+	}
+	if req.ResponderRules != nil {
+		if err := req.ResponderRules.Validate(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		project.ResponderRules = *req.ResponderRules
+	}
+	if req.AutoSchedule != nil {
+		project.AutoSchedule = *req.AutoSchedule
+	}
 
 	if project.Name == "" || project.RepoPath == "" {
 		jsonError(w, http.StatusBadRequest, "name and repo_path cannot be empty")
@@ -64,6 +64,13 @@ func NewRouter(conn *sql.DB, lifecycle *session.Manager, hubInst *hub.Hub, token
 
 	mux.HandleFunc("POST /api/projects/{id}/tasks", handler.createTask)
 	mux.HandleFunc("GET /api/projects/{id}/tasks", handler.listTasks)
+	mux.HandleFunc("GET /api/projects/{id}/schedule", handler.getProjectSchedule)
+	mux.HandleFunc("GET /api/projects/{id}/usage", handler.getProjectUsage)
+	mux.HandleFunc("POST /api/projects/{id}/policy/evaluate", handler.evaluateProjectPolicy)
+	mux.HandleFunc("GET /api/projects/{id}/policy-events", handler.listProjectPolicyEvents)
+	mux.HandleFunc("GET /api/projects/{id}/budgets", handler.listProjectBudgets)
+	mux.HandleFunc("PUT /api/projects/{id}/budgets", handler.setProjectBudget)
+	mux.HandleFunc("DELETE /api/projects/{id}/budgets/{budget_id}", handler.deleteProjectBudget)
 	mux.HandleFunc("GET /api/tasks/{id}", handler.getTask)
 	mux.HandleFunc("PATCH /api/tasks/{id}", handler.updateTask)
 
@@ -75,6 +82,10 @@ func NewRouter(conn *sql.DB, lifecycle *session.Manager, hubInst *hub.Hub, token
 	mux.HandleFunc("DELETE /api/worktrees/{id}", handler.deleteWorktree)
 
 	mux.HandleFunc("POST /api/tasks/{id}/sessions", handler.createSession)
+	mux.HandleFunc("POST /api/tasks/{id}/headless-runs", handler.createHeadlessRun)
+	mux.HandleFunc("GET /api/tasks/{id}/headless-runs", handler.listHeadlessRuns)
+	mux.HandleFunc("GET /api/headless-runs/{id}", handler.getHeadlessRun)
+	mux.HandleFunc("DELETE /api/headless-runs/{id}", handler.cancelHeadlessRun)
 	mux.HandleFunc("GET /api/sessions", handler.listSessions)
 	mux.HandleFunc("GET /api/sessions/{id}", handler.getSession)
 	mux.HandleFunc("POST /api/sessions/{id}/send", handler.sendSessionCommand)
@@ -82,11 +93,23 @@ func NewRouter(conn *sql.DB, lifecycle *session.Manager, hubInst *hub.Hub, token
 	mux.HandleFunc("POST /api/sessions/{id}/commands", handler.enqueueSessionCommand)
 	mux.HandleFunc("GET /api/sessions/{id}/commands", handler.listSessionCommands)
 	mux.HandleFunc("GET /api/sessions/{id}/commands/{command_id}", handler.getSessionCommand)
+	mux.HandleFunc("POST /api/sessions/{id}/commands/{command_id}/cancel", handler.cancelSessionCommand)
 	mux.HandleFunc("GET /api/sessions/{id}/output", handler.getSessionOutput)
+	mux.HandleFunc("GET /api/sessions/{id}/recording", handler.getSessionRecording)
+	mux.HandleFunc("GET /api/sessions/{id}/screen", handler.getSessionScreen)
+	mux.HandleFunc("GET /api/sessions/{id}/processes", handler.getSessionProcesses)
+	mux.HandleFunc("POST /api/sessions/{id}/processes/{pid}/signal", handler.signalSessionProcess)
 	mux.HandleFunc("GET /api/sessions/{id}/idle", handler.getSessionIdle)
 	mux.HandleFunc("GET /api/sessions/{id}/ready", handler.getSessionReady)
 	mux.HandleFunc("GET /api/sessions/{id}/close-check", handler.getSessionCloseCheck)
+	mux.HandleFunc("GET /api/sessions/{id}/events", handler.listSessionEvents)
+	mux.HandleFunc("GET /api/sessions/{id}/transcript", handler.getSessionTranscript)
+	mux.HandleFunc("GET /api/sessions/{id}/usage", handler.getSessionUsage)
 	mux.HandleFunc("PATCH /api/sessions/{id}/takeover", handler.patchSessionTakeover)
+	mux.HandleFunc("POST /api/sessions/{id}/takeover", handler.acquireSessionTakeover)
+	mux.HandleFunc("POST /api/sessions/{id}/takeover/heartbeat", handler.heartbeatSessionTakeover)
+	mux.HandleFunc("POST /api/sessions/{id}/handback", handler.handBackSessionToAutomation)
+	mux.HandleFunc("POST /api/sessions/{id}/handoff", handler.handoffSession)
 	mux.HandleFunc("DELETE /api/sessions/{id}", handler.deleteSession)
 
 	mux.HandleFunc("GET /api/agents", handler.listAgents)
@@ -95,7 +118,10 @@ func NewRouter(conn *sql.DB, lifecycle *session.Manager, hubInst *hub.Hub, token
 	mux.HandleFunc("POST /api/agents", handler.createAgent)
 	mux.HandleFunc("PUT /api/agents/{id}", handler.updateAgent)
 	mux.HandleFunc("DELETE /api/agents/{id}", handler.deleteAgent)
+	mux.HandleFunc("GET /api/agents/{id}/waitlist", handler.getAgentWaitlist)
+	mux.HandleFunc("DELETE /api/agents/{id}/waitlist", handler.deleteAgentWaitlist)
 	mux.HandleFunc("GET /api/fs/directories", handler.listDirectories)
+	mux.HandleFunc("GET /api/search/transcripts", handler.searchTranscripts)
 
 	mux.HandleFunc("GET /api/projects/{id}/runs/current", handler.getCurrentProjectRun)
 	mux.HandleFunc("POST /api/projects/{id}/runs/{run_id}/transition", handler.transitionProjectRun)
@@ -1,21 +1,37 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"os"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/user/agenterm/internal/asciicast"
 	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/resources"
 	sessionpkg "github.com/user/agenterm/internal/session"
 )
 
 type createSessionRequest struct {
 	AgentType string `json:"agent_type"`
 	Role      string `json:"role"`
+	Priority  int    `json:"priority"`
+}
+
+// waitlistedSessionResponse answers a session request that was queued
+// because its agent is at capacity.
+type waitlistedSessionResponse struct {
+	Status   string            `json:"status"`
+	Position int               `json:"position"`
+	Entry    *db.WaitlistEntry `json:"entry"`
 }
 
 type sendCommandRequest struct {
@@ -32,6 +48,19 @@ type enqueueSessionCommandRequest struct {
 	Key  string `json:"key,omitempty"`
 	Cols int    `json:"cols,omitempty"`
 	Rows int    `json:"rows,omitempty"`
+	// WaitFor and NotBefore keep the command pending until the session is
+	// ready, idle or at its prompt, and until the time has passed.
+	WaitFor   string    `json:"wait_for,omitempty"`
+	TimeoutMS int       `json:"timeout_ms,omitempty"`
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// Steps are the steps of a "script" command.
+	Steps []sessionpkg.ScriptStep `json:"steps,omitempty"`
+}
+
+type handoffSessionRequest struct {
+	AgentType string `json:"agent_type"`
+	Role      string `json:"role"`
+	Note      string `json:"note,omitempty"`
 }
 
 type patchTakeoverRequest struct {
@@ -80,7 +109,17 @@ func (h *handler) createSession(w http.ResponseWriter, r *http.Request) {
 		TaskID:    taskID,
 		AgentType: req.AgentType,
 		Role:      req.Role,
+		Priority:  req.Priority,
 	})
+	var waitlisted *sessionpkg.WaitlistedError
+	if errors.As(err, &waitlisted) {
+		jsonResponse(w, http.StatusAccepted, waitlistedSessionResponse{
+			Status:   "waitlisted",
+			Position: waitlisted.Position,
+			Entry:    waitlisted.Entry,
+		})
+		return
+	}
 	if err != nil {
 		status, msg := mapSessionError(err)
 		jsonError(w, status, msg)
@@ -144,7 +183,16 @@ func (h *handler) getSession(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	jsonResponse(w, http.StatusOK, session)
+	resp := struct {
+		*db.Session
+		Resources *sessionpkg.ResourceStatus `json:"resources,omitempty"`
+	}{Session: session}
+	if h.lifecycle != nil {
+		if status, err := h.lifecycle.GetResourceStatus(r.Context(), session.ID); err == nil {
+			resp.Resources = status
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
 }
 
 func (h *handler) sendSessionCommand(w http.ResponseWriter, r *http.Request) {
@@ -190,12 +238,20 @@ func (h *handler) enqueueSessionCommand(w http.ResponseWriter, r *http.Request)
 		jsonError(w, http.StatusBadRequest, "op is required")
 		return
 	}
+	if req.TimeoutMS < 0 {
+		jsonError(w, http.StatusBadRequest, "timeout_ms must not be negative")
+		return
+	}
 	h.enqueueAndRespond(w, r, sessionpkg.CommandRequest{
-		Op:   op,
-		Text: req.Text,
-		Key:  req.Key,
-		Cols: req.Cols,
-		Rows: req.Rows,
+		Op:        op,
+		Text:      req.Text,
+		Key:       req.Key,
+		Cols:      req.Cols,
+		Rows:      req.Rows,
+		WaitFor:   sessionpkg.CommandWait(strings.TrimSpace(strings.ToLower(req.WaitFor))),
+		Timeout:   time.Duration(req.TimeoutMS) * time.Millisecond,
+		NotBefore: req.NotBefore,
+		Steps:     req.Steps,
 	}, true)
 }
 
@@ -231,6 +287,25 @@ func (h *handler) getSessionCommand(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, cmd)
 }
 
+func (h *handler) cancelSessionCommand(w http.ResponseWriter, r *http.Request) {
+	commandID := strings.TrimSpace(r.PathValue("command_id"))
+	if commandID == "" {
+		jsonError(w, http.StatusBadRequest, "command_id is required")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	cmd, err := h.lifecycle.CancelCommand(r.Context(), r.PathValue("id"), commandID)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, cmd)
+}
+
 func (h *handler) listSessionCommands(w http.ResponseWriter, r *http.Request) {
 	limit := 50
 	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
@@ -301,7 +376,11 @@ func (h *handler) enqueueAndRespond(w http.ResponseWriter, r *http.Request, req
 		return
 	}
 	if richResponse {
-		jsonResponse(w, http.StatusOK, cmd)
+		status := http.StatusOK
+		if cmd.CompletedAt.IsZero() {
+			status = http.StatusAccepted
+		}
+		jsonResponse(w, status, cmd)
 		return
 	}
 	resp := map[string]any{
@@ -357,6 +436,11 @@ func (h *handler) getSessionOutput(w http.ResponseWriter, r *http.Request) {
 	// Add summary metadata via ready state.
 	sessionID := r.PathValue("id")
 	resp := map[string]any{"lines": result}
+	// The rendered screen shows what a human sees right now; lines above
+	// is the classified output history.
+	if snap, err := h.lifecycle.GetScreen(r.Context(), sessionID); err == nil {
+		resp["screen"] = snap.Lines
+	}
 	if h.lifecycle != nil {
 		state, err := h.lifecycle.GetSessionReadyState(r.Context(), sessionID)
 		if err == nil {
@@ -370,6 +454,182 @@ func (h *handler) getSessionOutput(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, resp)
 }
 
+// getSessionScreen returns the session's rendered terminal screen. The ANSI
+// redraw sequence is only included with ?ansi=true since it roughly doubles
+// the payload.
+func (h *handler) getSessionScreen(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	withANSI := false
+	if raw := r.URL.Query().Get("ansi"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid ansi query parameter")
+			return
+		}
+		withANSI = v
+	}
+
+	snap, err := h.lifecycle.GetScreen(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	if !withANSI {
+		snap.ANSI = ""
+	}
+	jsonResponse(w, http.StatusOK, snap)
+}
+
+type sessionProcessesResponse struct {
+	SessionID string              `json:"session_id"`
+	RootPID   int                 `json:"root_pid"`
+	Processes []resources.Process `json:"processes"`
+}
+
+func (h *handler) getSessionProcesses(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	sessionID := r.PathValue("id")
+	tree, err := h.lifecycle.ListProcesses(r.Context(), sessionID)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, sessionProcessesResponse{
+		SessionID: sessionID,
+		RootPID:   tree[0].PID,
+		Processes: tree,
+	})
+}
+
+func (h *handler) listSessionEvents(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	events, err := h.lifecycle.ListSessionEvents(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
+
+type signalProcessRequest struct {
+	Signal string `json:"signal"`
+}
+
+func (h *handler) signalSessionProcess(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	pid, err := strconv.Atoi(r.PathValue("pid"))
+	if err != nil || pid <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid pid")
+		return
+	}
+	var req signalProcessRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	if err := h.lifecycle.SignalProcess(r.Context(), r.PathValue("id"), pid, req.Signal); err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	signal := strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(req.Signal), "SIG"))
+	if signal == "" {
+		signal = "TERM"
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"pid": pid, "signal": signal})
+}
+
+// getSessionRecording serves the asciicast v2 recording of a session. With
+// from/to (seconds from the start of the recording) it returns a standalone
+// recording covering only that window, rebased to start at zero.
+func (h *handler) getSessionRecording(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	from, err := parseRecordingOffset(r.URL.Query().Get("from"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid from query parameter")
+		return
+	}
+	to, err := parseRecordingOffset(r.URL.Query().Get("to"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid to query parameter")
+		return
+	}
+	if to > 0 && to < from {
+		jsonError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+
+	session, ok := h.mustGetSession(w, r)
+	if !ok {
+		return
+	}
+	path, err := h.lifecycle.RecordingPath(r.Context(), session.ID)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.ID+".cast"))
+	if from == 0 && to == 0 {
+		info, err := f.Stat()
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		http.ServeContent(w, r, session.ID+".cast", info.ModTime(), f)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := asciicast.Slice(&buf, f, from, to); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Del("Content-Disposition")
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+func parseRecordingOffset(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	secs, err := strconv.ParseFloat(raw, 64)
+	if err != nil || secs < 0 || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, fmt.Errorf("invalid offset %q", raw)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
 func (h *handler) getSessionIdle(w http.ResponseWriter, r *http.Request) {
 	session, ok := h.mustGetSession(w, r)
 	if !ok {
@@ -490,6 +750,29 @@ func (h *handler) deleteSession(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *handler) handoffSession(w http.ResponseWriter, r *http.Request) {
+	var req handoffSessionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	result, err := h.lifecycle.Handoff(r.Context(), r.PathValue("id"), sessionpkg.HandoffRequest{
+		AgentType: strings.TrimSpace(req.AgentType),
+		Role:      strings.TrimSpace(req.Role),
+		Note:      req.Note,
+	})
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusCreated, result)
+}
+
 func (h *handler) evaluateSessionCloseCheck(ctx context.Context, session *db.Session) (sessionCloseCheckResponse, error) {
 	result := sessionCloseCheckResponse{
 		CanClose: true,
@@ -688,10 +971,22 @@ func mapSessionError(err error) (int, string) {
 		return http.StatusNotFound, err.Error()
 	case sessionpkg.IsCommandPolicyError(err):
 		return http.StatusForbidden, err.Error()
+	case strings.Contains(err.Error(), "at capacity"),
+		strings.Contains(err.Error(), "is not running"),
+		strings.Contains(err.Error(), "is paused"),
+		strings.Contains(err.Error(), "budget exceeded"),
+		strings.Contains(err.Error(), "under human takeover"),
+		strings.Contains(err.Error(), "is not held by"),
+		strings.Contains(err.Error(), "is not pending"):
+		return http.StatusConflict, err.Error()
 	case strings.Contains(err.Error(), "required"),
 		strings.Contains(err.Error(), "unknown agent type"),
 		strings.Contains(err.Error(), "unsupported"),
-		strings.Contains(err.Error(), "op is"):
+		strings.Contains(err.Error(), "cannot be signaled"),
+		strings.Contains(err.Error(), "invalid script"),
+		strings.Contains(err.Error(), "op is"),
+		strings.Contains(err.Error(), "invalid budget"),
+		strings.Contains(err.Error(), "invalid takeover ttl"):
 		return http.StatusBadRequest, err.Error()
 	default:
 		return http.StatusInternalServerError, err.Error()
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultTakeoverOwner holds the leases taken through the API without an
+// owner.
+const defaultTakeoverOwner = "api"
+
+type takeoverRequest struct {
+	// Owner holds the lease; it defaults to "api" when taking over, and
+	// handing back without one releases any holder.
+	Owner string `json:"owner,omitempty"`
+	// TTLSeconds is how long the lease lasts without a heartbeat.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+func (h *handler) acquireSessionTakeover(w http.ResponseWriter, r *http.Request) {
+	var req takeoverRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	owner := strings.TrimSpace(req.Owner)
+	if owner == "" {
+		owner = defaultTakeoverOwner
+	}
+	session, err := h.lifecycle.AcquireTakeover(r.Context(), r.PathValue("id"), owner, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, session)
+}
+
+func (h *handler) heartbeatSessionTakeover(w http.ResponseWriter, r *http.Request) {
+	var req takeoverRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	owner := strings.TrimSpace(req.Owner)
+	if owner == "" {
+		owner = defaultTakeoverOwner
+	}
+	session, err := h.lifecycle.HeartbeatTakeover(r.Context(), r.PathValue("id"), owner, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, session)
+}
+
+// handBackSessionToAutomation ends the takeover of a session so queued
+// commands run again.
+func (h *handler) handBackSessionToAutomation(w http.ResponseWriter, r *http.Request) {
+	var req takeoverRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	session, err := h.lifecycle.ReleaseTakeover(r.Context(), r.PathValue("id"), req.Owner)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, session)
+}
@@ -5,20 +5,25 @@ import (
 	"strings"
 
 	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/environ"
 )
 
 type createTaskRequest struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	DependsOn   []string `json:"depends_on"`
-	Status      string   `json:"status"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	DependsOn   []string    `json:"depends_on"`
+	Status      string      `json:"status"`
+	Env         environ.Map `json:"env"`
+	AgentType   string      `json:"agent_type"`
 }
 
 type updateTaskRequest struct {
-	Title       *string `json:"title"`
-	Description *string `json:"description"`
-	Status      *string `json:"status"`
-	SpecPath    *string `json:"spec_path"`
+	Title       *string      `json:"title"`
+	Description *string      `json:"description"`
+	Status      *string      `json:"status"`
+	SpecPath    *string      `json:"spec_path"`
+	Env         *environ.Map `json:"env"`
+	AgentType   *string      `json:"agent_type"`
 }
 
 type taskDetailResponse struct {
@@ -47,6 +52,15 @@ func (h *handler) createTask(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "title is required")
 		return
 	}
+	if err := req.Env.Validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	agentType := strings.TrimSpace(req.AgentType)
+	if !h.knownAgentType(agentType) {
+		jsonError(w, http.StatusBadRequest, "unknown agent type")
+		return
+	}
 	status := req.Status
 	if status == "" {
 		status = "pending"
@@ -58,6 +72,8 @@ func (h *handler) createTask(w http.ResponseWriter, r *http.Request) {
 		Description: req.Description,
 		Status:      status,
 		DependsOn:   req.DependsOn,
+		Env:         req.Env,
+		AgentType:   agentType,
 	}
 	if err := h.taskRepo.Create(r.Context(), task); err != nil {
 		jsonError(w, http.StatusInternalServerError, err.Error())
@@ -148,6 +164,21 @@ func (h *handler) updateTask(w http.ResponseWriter, r *http.Request) {
 	if req.SpecPath != nil {
 		task.SpecPath = strings.TrimSpace(*req.SpecPath)
 	}
+	if req.Env != nil {
+		if err := req.Env.Validate(); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		task.Env = *req.Env
+	}
+	if req.AgentType != nil {
+		agentType := strings.TrimSpace(*req.AgentType)
+		if !h.knownAgentType(agentType) {
+			jsonError(w, http.StatusBadRequest, "unknown agent type")
+			return
+		}
+		task.AgentType = agentType
+	}
 	if task.Title == "" {
 		jsonError(w, http.StatusBadRequest, "title cannot be empty")
 		return
@@ -160,3 +191,25 @@ func (h *handler) updateTask(w http.ResponseWriter, r *http.Request) {
 
 	jsonResponse(w, http.StatusOK, task)
 }
+
+// knownAgentType reports whether agentType is empty or a registered agent.
+func (h *handler) getProjectSchedule(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	schedule, err := h.lifecycle.ProjectSchedule(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, schedule)
+}
+
+func (h *handler) knownAgentType(agentType string) bool {
+	if agentType == "" || h.registry == nil {
+		return true
+	}
+	return h.registry.Get(agentType) != nil
+}
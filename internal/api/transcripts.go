@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+func (h *handler) searchTranscripts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		jsonError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), 50)
+	if err != nil || limit <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid limit query parameter")
+		return
+	}
+	around, err := queryInt(query.Get("context"), 2)
+	if err != nil || around < 0 {
+		jsonError(w, http.StatusBadRequest, "invalid context query parameter")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	hits, err := h.lifecycle.SearchTranscripts(r.Context(), db.TranscriptFilter{
+		Query:     q,
+		ProjectID: strings.TrimSpace(query.Get("project_id")),
+		TaskID:    strings.TrimSpace(query.Get("task_id")),
+		SessionID: strings.TrimSpace(query.Get("session_id")),
+		Context:   around,
+		Limit:     limit,
+	})
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, hits)
+}
+
+func (h *handler) getSessionTranscript(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, err := queryInt(query.Get("after"), 0)
+	if err != nil || after < 0 {
+		jsonError(w, http.StatusBadRequest, "invalid after query parameter")
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), 1000)
+	if err != nil || limit <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid limit query parameter")
+		return
+	}
+	if limit > 5000 {
+		limit = 5000
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	entries, err := h.lifecycle.ListTranscript(r.Context(), r.PathValue("id"), int64(after), limit)
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, entries)
+}
+
+func queryInt(raw string, fallback int) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
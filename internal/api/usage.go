@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+type setBudgetRequest struct {
+	RequirementID string  `json:"requirement_id"`
+	MaxCostUSD    float64 `json:"max_cost_usd"`
+	MaxTokens     int64   `json:"max_tokens"`
+	Action        string  `json:"action"`
+}
+
+func (h *handler) getProjectUsage(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	report, err := h.lifecycle.ProjectUsage(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, report)
+}
+
+func (h *handler) getSessionUsage(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	totals, err := h.lifecycle.SessionUsage(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, totals)
+}
+
+func (h *handler) listProjectBudgets(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	budgets, err := h.lifecycle.ListBudgets(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, budgets)
+}
+
+func (h *handler) setProjectBudget(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	var req setBudgetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	if _, ok := h.mustGetProject(w, r, projectID); !ok {
+		return
+	}
+	req.RequirementID = strings.TrimSpace(req.RequirementID)
+	if req.RequirementID != "" {
+		requirement, err := h.requirementRepo.Get(r.Context(), req.RequirementID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if requirement == nil || requirement.ProjectID != projectID {
+			jsonError(w, http.StatusNotFound, "requirement not found")
+			return
+		}
+	}
+	status, err := h.lifecycle.SetBudget(r.Context(), &db.Budget{
+		ProjectID:     projectID,
+		RequirementID: req.RequirementID,
+		MaxCostUSD:    req.MaxCostUSD,
+		MaxTokens:     req.MaxTokens,
+		Action:        req.Action,
+	})
+	if err != nil {
+		code, msg := mapSessionError(err)
+		jsonError(w, code, msg)
+		return
+	}
+	jsonResponse(w, http.StatusOK, status)
+}
+
+func (h *handler) deleteProjectBudget(w http.ResponseWriter, r *http.Request) {
+	if h.lifecycle == nil {
+		jsonError(w, http.StatusNotImplemented, "session lifecycle manager unavailable")
+		return
+	}
+	if err := h.lifecycle.DeleteBudget(r.Context(), r.PathValue("id"), r.PathValue("budget_id")); err != nil {
+		status, msg := mapSessionError(err)
+		jsonError(w, status, msg)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
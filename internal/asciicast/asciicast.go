@@ -0,0 +1,326 @@
+// Package asciicast reads and writes terminal recordings in the asciicast v2
+// format (https://docs.asciinema.org/manual/asciicast/v2/).
+//
+// A recording is a newline-delimited JSON file: the first line is a Header
+// object, every following line is an event array [time, code, data] where
+// time is seconds since the header timestamp.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the asciicast format version written by this package.
+const Version = 2
+
+// Event codes defined by asciicast v2.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+	EventMarker = "m"
+)
+
+// maxLineSize bounds a single event line when reading recordings. PTY reads
+// are at most a few KiB, so 4 MiB leaves ample room for escaped output.
+const maxLineSize = 4 << 20
+
+// Header is the first line of an asciicast v2 recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a single timed entry in a recording.
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// MarshalJSON encodes the event as the [time, code, data] array form.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{roundTime(e.Time), e.Code, e.Data})
+}
+
+// UnmarshalJSON decodes the [time, code, data] array form.
+func (e *Event) UnmarshalJSON(raw []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return err
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("asciicast: event has %d fields, want 3", len(parts))
+	}
+	if err := json.Unmarshal(parts[0], &e.Time); err != nil {
+		return fmt.Errorf("asciicast: event time: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &e.Code); err != nil {
+		return fmt.Errorf("asciicast: event code: %w", err)
+	}
+	if err := json.Unmarshal(parts[2], &e.Data); err != nil {
+		return fmt.Errorf("asciicast: event data: %w", err)
+	}
+	return nil
+}
+
+// Size returns the dimensions carried by a resize event ("COLSxROWS").
+func (e Event) Size() (cols int, rows int, ok bool) {
+	if e.Code != EventResize {
+		return 0, 0, false
+	}
+	c, r, found := strings.Cut(e.Data, "x")
+	if !found {
+		return 0, 0, false
+	}
+	cols, errC := strconv.Atoi(strings.TrimSpace(c))
+	rows, errR := strconv.Atoi(strings.TrimSpace(r))
+	if errC != nil || errR != nil || cols <= 0 || rows <= 0 {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
+
+// Writer appends events to an asciicast v2 file.
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	start   time.Time
+	pending []byte // trailing bytes of an incomplete UTF-8 sequence
+	closed  bool
+}
+
+// Create opens path for recording. A new file gets a fresh header; an
+// existing recording is appended to so that a resumed session keeps a single
+// timeline, with the downtime showing up as a gap between events.
+func Create(path string, header Header) (*Writer, error) {
+	if existing, err := readHeaderFile(path); err == nil {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("asciicast: open %q: %w", path, err)
+		}
+		w := &Writer{f: f, start: time.Unix(existing.Timestamp, 0)}
+		if header.Width > 0 && header.Height > 0 {
+			_ = w.WriteResize(header.Width, header.Height)
+		}
+		return w, nil
+	} else if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("asciicast: create %q: %w", path, err)
+	}
+	now := time.Now()
+	header.Version = Version
+	header.Timestamp = now.Unix()
+	line, err := json.Marshal(header)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("asciicast: marshal header: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("asciicast: write header: %w", err)
+	}
+	return &Writer{f: f, start: time.Unix(header.Timestamp, 0)}, nil
+}
+
+// WriteOutput records terminal output observed at ts. Multi-byte characters
+// split across PTY reads are held back until the rest of the sequence arrives.
+func (w *Writer) WriteOutput(ts time.Time, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	buf := append(w.pending, data...)
+	cut := completeUTF8Prefix(buf)
+	w.pending = append([]byte(nil), buf[cut:]...)
+	if cut == 0 {
+		return nil
+	}
+	return w.writeLocked(Event{Time: w.elapsed(ts), Code: EventOutput, Data: string(buf[:cut])})
+}
+
+// WriteResize records a terminal size change.
+func (w *Writer) WriteResize(cols, rows int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.writeLocked(Event{Time: w.elapsed(time.Now()), Code: EventResize, Data: fmt.Sprintf("%dx%d", cols, rows)})
+}
+
+// Close flushes any held-back bytes and closes the file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.pending) > 0 {
+		_ = w.writeLocked(Event{Time: w.elapsed(time.Now()), Code: EventOutput, Data: string(w.pending)})
+		w.pending = nil
+	}
+	return w.f.Close()
+}
+
+func (w *Writer) elapsed(ts time.Time) float64 {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	d := ts.Sub(w.start).Seconds()
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (w *Writer) writeLocked(evt Event) error {
+	line, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("asciicast: marshal event: %w", err)
+	}
+	_, err = w.f.Write(append(line, '\n'))
+	return err
+}
+
+// ReadHeader reads the header line of a recording.
+func ReadHeader(r io.Reader) (Header, error) {
+	sc := newScanner(r)
+	return scanHeader(sc)
+}
+
+// Slice copies the part of a recording between from and to (both measured
+// from the start of the recording) to dst as a standalone, playable
+// recording. Event times are rebased so the slice starts at zero, and the
+// header carries the terminal size in effect at the start of the range.
+// A zero to means "until the end".
+func Slice(dst io.Writer, src io.Reader, from, to time.Duration) error {
+	if from < 0 || (to > 0 && to < from) {
+		return fmt.Errorf("asciicast: invalid range %s..%s", from, to)
+	}
+	sc := newScanner(src)
+	header, err := scanHeader(sc)
+	if err != nil {
+		return err
+	}
+	fromSec := from.Seconds()
+	toSec := to.Seconds()
+
+	var kept []Event
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var evt Event
+		if err := json.Unmarshal(line, &evt); err != nil {
+			// A crash can leave a truncated final line; ignore it.
+			continue
+		}
+		if evt.Time < fromSec {
+			if cols, rows, ok := evt.Size(); ok {
+				header.Width, header.Height = cols, rows
+			}
+			continue
+		}
+		if to > 0 && evt.Time > toSec {
+			break
+		}
+		evt.Time -= fromSec
+		kept = append(kept, evt)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("asciicast: read events: %w", err)
+	}
+
+	if header.Timestamp > 0 {
+		header.Timestamp += int64(fromSec)
+	}
+	enc := json.NewEncoder(dst)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, evt := range kept {
+		if err := enc.Encode(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readHeaderFile(path string) (Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, err
+	}
+	defer f.Close()
+	return ReadHeader(f)
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return sc
+}
+
+func scanHeader(sc *bufio.Scanner) (Header, error) {
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return Header{}, fmt.Errorf("asciicast: read header: %w", err)
+		}
+		return Header{}, io.EOF
+	}
+	var header Header
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		return Header{}, fmt.Errorf("asciicast: parse header: %w", err)
+	}
+	if header.Version != Version {
+		return Header{}, fmt.Errorf("asciicast: unsupported version %d", header.Version)
+	}
+	return header, nil
+}
+
+// completeUTF8Prefix returns the length of the longest prefix of b that does
+// not end in the middle of a multi-byte UTF-8 sequence.
+func completeUTF8Prefix(b []byte) int {
+	n := len(b)
+	// A UTF-8 sequence is at most 4 bytes, so only the tail needs checking.
+	for i := 1; i <= utf8.UTFMax && i <= n; i++ {
+		c := b[n-i]
+		if c < utf8.RuneSelf {
+			return n
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(b[n-i:]) {
+				return n
+			}
+			return n - i
+		}
+	}
+	return n
+}
+
+func roundTime(t float64) float64 {
+	return float64(int64(t*1e6+0.5)) / 1e6
+}
@@ -0,0 +1,162 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readEvents(t *testing.T, data []byte) (Header, []Event) {
+	t.Helper()
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() {
+		t.Fatalf("recording is empty")
+	}
+	var header Header
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	var events []Event
+	for sc.Scan() {
+		var evt Event
+		if err := json.Unmarshal(sc.Bytes(), &evt); err != nil {
+			t.Fatalf("parse event %q: %v", sc.Text(), err)
+		}
+		events = append(events, evt)
+	}
+	return header, events
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.cast")
+	w, err := Create(path, Header{Width: 120, Height: 40, Title: "demo"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	base := w.start
+	if err := w.WriteOutput(base.Add(500*time.Millisecond), []byte("hello\r\n")); err != nil {
+		t.Fatalf("write output: %v", err)
+	}
+	if err := w.WriteResize(80, 24); err != nil {
+		t.Fatalf("write resize: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	header, events := readEvents(t, data)
+	if header.Version != Version || header.Width != 120 || header.Height != 40 || header.Title != "demo" {
+		t.Fatalf("header=%+v", header)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events=%+v want 2", events)
+	}
+	if events[0].Code != EventOutput || events[0].Data != "hello\r\n" || events[0].Time != 0.5 {
+		t.Fatalf("output event=%+v", events[0])
+	}
+	if cols, rows, ok := events[1].Size(); !ok || cols != 80 || rows != 24 {
+		t.Fatalf("resize event=%+v", events[1])
+	}
+}
+
+func TestWriterHoldsBackSplitUTF8(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.cast")
+	w, err := Create(path, Header{Width: 80, Height: 24})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	euro := []byte("€") // 3 bytes
+	_ = w.WriteOutput(time.Now(), append([]byte("a"), euro[:2]...))
+	_ = w.WriteOutput(time.Now(), append(euro[2:], 'b'))
+	_ = w.Close()
+
+	data, _ := os.ReadFile(path)
+	_, events := readEvents(t, data)
+	var got strings.Builder
+	for _, evt := range events {
+		got.WriteString(evt.Data)
+	}
+	if got.String() != "a€b" {
+		t.Fatalf("output=%q want a€b", got.String())
+	}
+	if events[0].Data != "a" {
+		t.Fatalf("first event=%q want the incomplete rune held back", events[0].Data)
+	}
+}
+
+func TestCreateAppendsToExistingRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.cast")
+	w, err := Create(path, Header{Width: 80, Height: 24})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = w.WriteOutput(time.Now(), []byte("first"))
+	_ = w.Close()
+
+	w, err = Create(path, Header{Width: 100, Height: 30})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	_ = w.WriteOutput(time.Now(), []byte("second"))
+	_ = w.Close()
+
+	data, _ := os.ReadFile(path)
+	header, events := readEvents(t, data)
+	if header.Width != 80 {
+		t.Fatalf("header rewritten: %+v", header)
+	}
+	if len(events) != 3 || events[0].Data != "first" || events[1].Code != EventResize || events[2].Data != "second" {
+		t.Fatalf("events=%+v", events)
+	}
+}
+
+func TestSliceRebasesAndCarriesSize(t *testing.T) {
+	src := strings.Join([]string{
+		`{"version":2,"width":80,"height":24,"timestamp":1000}`,
+		`[0.5,"o","before"]`,
+		`[1.0,"r","100x30"]`,
+		`[2.0,"o","inside"]`,
+		`[3.5,"o","edge"]`,
+		`[4.0,"o","after"]`,
+		`[4.5,"o","trunc`,
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := Slice(&out, strings.NewReader(src), 1500*time.Millisecond, 3500*time.Millisecond); err != nil {
+		t.Fatalf("slice: %v", err)
+	}
+	header, events := readEvents(t, out.Bytes())
+	if header.Width != 100 || header.Height != 30 {
+		t.Fatalf("header size=%dx%d want 100x30", header.Width, header.Height)
+	}
+	if header.Timestamp != 1001 {
+		t.Fatalf("header timestamp=%d want 1001", header.Timestamp)
+	}
+	if len(events) != 2 || events[0].Data != "inside" || events[0].Time != 0.5 || events[1].Data != "edge" || events[1].Time != 2 {
+		t.Fatalf("events=%+v", events)
+	}
+
+	out.Reset()
+	if err := Slice(&out, strings.NewReader(src), 3*time.Second, 0); err != nil {
+		t.Fatalf("open-ended slice: %v", err)
+	}
+	if _, events := readEvents(t, out.Bytes()); len(events) != 2 || events[1].Data != "after" {
+		t.Fatalf("open-ended events=%+v", events)
+	}
+}
+
+func TestSliceRejectsInvalidRange(t *testing.T) {
+	src := `{"version":2,"width":80,"height":24}` + "\n"
+	if err := Slice(&bytes.Buffer{}, strings.NewReader(src), 2*time.Second, time.Second); err == nil {
+		t.Fatalf("expected error for to < from")
+	}
+}
@@ -0,0 +1,364 @@
+// Package completion evaluates declarative detectors that decide when an
+// agent session is done or ready for review.
+package completion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCommandTimeout bounds command detectors without a timeout.
+const defaultCommandTimeout = 5 * time.Minute
+
+// Detector is one completion check. Exactly one of FileExists,
+// CommitMessage, Output, Command, All or Any is set.
+type Detector struct {
+	// Name is reported when the detector fires; it defaults to a label
+	// derived from the check.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// FileExists fires when the path, relative to the worktree, exists.
+	FileExists string `yaml:"file_exists,omitempty" json:"file_exists,omitempty"`
+	// CommitMessage fires when the message of the worktree's last commit
+	// matches the regular expression.
+	CommitMessage string `yaml:"commit_message,omitempty" json:"commit_message,omitempty"`
+	// Output fires when a line of the session's recent output matches the
+	// regular expression.
+	Output string `yaml:"output,omitempty" json:"output,omitempty"`
+	// Command fires when the shell command exits 0 in the worktree.
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// TimeoutSeconds bounds Command; 0 uses five minutes.
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+	// All fires when every detector fires; Any when at least one does.
+	All []Detector `yaml:"all,omitempty" json:"all,omitempty"`
+	Any []Detector `yaml:"any,omitempty" json:"any,omitempty"`
+}
+
+// Detectors used when nothing else is configured.
+var (
+	DefaultDone   = Detector{Name: "done_marker", FileExists: ".orchestra/done"}
+	DefaultReview = Detector{Name: "ready_for_review_commit", CommitMessage: `\[READY_FOR_REVIEW\]`}
+)
+
+// Config declares the done and review-ready detectors of an agent, with
+// overrides per role.
+type Config struct {
+	Done   *Detector `yaml:"done,omitempty" json:"done,omitempty"`
+	Review *Detector `yaml:"review,omitempty" json:"review,omitempty"`
+	// Roles replaces Done or Review for sessions of a role.
+	Roles map[string]Config `yaml:"roles,omitempty" json:"roles,omitempty"`
+}
+
+// IsZero reports whether c configures nothing.
+func (c Config) IsZero() bool {
+	return c.Done == nil && c.Review == nil && len(c.Roles) == 0
+}
+
+// Validate checks every detector of c and its roles.
+func (c Config) Validate() error {
+	if c.Done != nil {
+		if err := c.Done.Validate(); err != nil {
+			return fmt.Errorf("done: %w", err)
+		}
+	}
+	if c.Review != nil {
+		if err := c.Review.Validate(); err != nil {
+			return fmt.Errorf("review: %w", err)
+		}
+	}
+	for role, rc := range c.Roles {
+		if strings.TrimSpace(role) == "" {
+			return errors.New("role name is required")
+		}
+		if len(rc.Roles) > 0 {
+			return fmt.Errorf("role %s: roles cannot be nested", role)
+		}
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the done and review detectors of role. configs are
+// ordered most specific first; in each, the role's override beats the
+// config's own detector. The defaults apply when no config sets one.
+func Resolve(role string, configs ...Config) (done, review Detector) {
+	var donePtr, reviewPtr *Detector
+	for _, c := range configs {
+		rc := c.Roles[role]
+		for _, candidate := range []*Detector{rc.Done, c.Done} {
+			if donePtr == nil && candidate != nil {
+				donePtr = candidate
+			}
+		}
+		for _, candidate := range []*Detector{rc.Review, c.Review} {
+			if reviewPtr == nil && candidate != nil {
+				reviewPtr = candidate
+			}
+		}
+	}
+	done, review = DefaultDone, DefaultReview
+	if donePtr != nil {
+		done = *donePtr
+	}
+	if reviewPtr != nil {
+		review = *reviewPtr
+	}
+	return done, review
+}
+
+// IsZero reports whether d configures nothing.
+func (d Detector) IsZero() bool {
+	return d.Name == "" && d.checks() == 0 && d.TimeoutSeconds == 0
+}
+
+func (d Detector) checks() int {
+	n := 0
+	for _, set := range []bool{d.FileExists != "", d.CommitMessage != "", d.Output != "", d.Command != "", d.All != nil, d.Any != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// Validate checks that d sets exactly one check and that its patterns
+// compile.
+func (d Detector) Validate() error {
+	if d.checks() != 1 {
+		return errors.New("detector must set exactly one of file_exists, commit_message, output, command, all, any")
+	}
+	switch {
+	case d.FileExists != "":
+		clean := filepath.Clean(d.FileExists)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("file_exists %q must be relative to the worktree", d.FileExists)
+		}
+	case d.CommitMessage != "":
+		if _, err := regexp.Compile(d.CommitMessage); err != nil {
+			return fmt.Errorf("commit_message: %w", err)
+		}
+	case d.Output != "":
+		if _, err := regexp.Compile(d.Output); err != nil {
+			return fmt.Errorf("output: %w", err)
+		}
+	case d.Command != "":
+		if d.TimeoutSeconds < 0 {
+			return errors.New("timeout_seconds must be >= 0")
+		}
+	default:
+		children := d.All
+		if d.Any != nil {
+			children = d.Any
+		}
+		if len(children) == 0 {
+			return errors.New("all and any need at least one detector")
+		}
+		for i, child := range children {
+			if err := child.Validate(); err != nil {
+				return fmt.Errorf("detector %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Label names d in reports.
+func (d Detector) Label() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	switch {
+	case d.FileExists != "":
+		return "file_exists:" + d.FileExists
+	case d.CommitMessage != "":
+		return "commit_message:" + d.CommitMessage
+	case d.Output != "":
+		return "output:" + d.Output
+	case d.Command != "":
+		return "command:" + d.Command
+	case d.All != nil:
+		return "all(" + joinLabels(d.All) + ")"
+	case d.Any != nil:
+		return "any(" + joinLabels(d.Any) + ")"
+	}
+	return ""
+}
+
+func joinLabels(detectors []Detector) string {
+	labels := make([]string, len(detectors))
+	for i, d := range detectors {
+		labels[i] = d.Label()
+	}
+	return strings.Join(labels, ", ")
+}
+
+// Input is what detectors are evaluated against.
+type Input struct {
+	WorkDir string
+	// Output is the session's recent output, oldest first.
+	Output []string
+	// RunCommands starts command detectors in the background; without it
+	// their last result is reused.
+	RunCommands bool
+	// Force runs command detectors now and waits for them.
+	Force bool
+}
+
+// Result tells which detector fired and why.
+type Result struct {
+	Detector string `json:"detector"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Evaluator evaluates detectors for one session. Command detectors run only
+// when asked to, in the background, and their last result is reused in
+// between, so that slow commands such as test suites do not stall the
+// caller.
+type Evaluator struct {
+	// Argv, when set, returns the command line a command detector runs
+	// as, e.g. inside the session's sandbox. By default it runs under sh.
+	Argv func(command string) ([]string, error)
+
+	mu       sync.Mutex
+	commands map[string]*commandRun
+}
+
+type commandRun struct {
+	at      time.Time
+	running bool
+	ok      bool
+	detail  string
+}
+
+func NewEvaluator() *Evaluator {
+	return &Evaluator{commands: make(map[string]*commandRun)}
+}
+
+// Evaluate reports whether d fires for in.
+func (e *Evaluator) Evaluate(ctx context.Context, d Detector, in Input) (Result, bool) {
+	detail, ok := e.evaluate(ctx, d, in)
+	if !ok {
+		return Result{}, false
+	}
+	return Result{Detector: d.Label(), Detail: detail}, true
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, d Detector, in Input) (string, bool) {
+	switch {
+	case d.FileExists != "":
+		if in.WorkDir == "" {
+			return "", false
+		}
+		if _, err := os.Stat(filepath.Join(in.WorkDir, filepath.FromSlash(d.FileExists))); err != nil {
+			return "", false
+		}
+		return d.FileExists + " exists", true
+	case d.CommitMessage != "":
+		if in.WorkDir == "" {
+			return "", false
+		}
+		re, err := regexp.Compile(d.CommitMessage)
+		if err != nil {
+			return "", false
+		}
+		out, err := exec.CommandContext(ctx, "git", "-C", in.WorkDir, "log", "-1", "--pretty=%B").Output()
+		if err != nil || !re.Match(out) {
+			return "", false
+		}
+		subject, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		return fmt.Sprintf("last commit %q", subject), true
+	case d.Output != "":
+		re, err := regexp.Compile(d.Output)
+		if err != nil {
+			return "", false
+		}
+		for i := len(in.Output) - 1; i >= 0; i-- {
+			if re.MatchString(in.Output[i]) {
+				return fmt.Sprintf("output %q", in.Output[i]), true
+			}
+		}
+		return "", false
+	case d.Command != "":
+		if in.WorkDir == "" {
+			return "", false
+		}
+		return e.command(d, in)
+	case d.All != nil:
+		details := make([]string, 0, len(d.All))
+		for _, child := range d.All {
+			detail, ok := e.evaluate(ctx, child, in)
+			if !ok {
+				return "", false
+			}
+			details = append(details, detail)
+		}
+		return strings.Join(details, "; "), true
+	case d.Any != nil:
+		for _, child := range d.Any {
+			if detail, ok := e.evaluate(ctx, child, in); ok {
+				return child.Label() + ": " + detail, true
+			}
+		}
+	}
+	return "", false
+}
+
+// command returns the last result of d's command, starting a new run when
+// in asks for one and none is in progress. A forced evaluation waits for
+// the run.
+func (e *Evaluator) command(d Detector, in Input) (string, bool) {
+	key := in.WorkDir + "\x00" + d.Command
+	e.mu.Lock()
+	run := e.commands[key]
+	if run == nil {
+		run = &commandRun{}
+		e.commands[key] = run
+	}
+	if in.Force && !run.running {
+		run.running = true
+		e.mu.Unlock()
+		e.runCommand(run, d, in.WorkDir)
+		e.mu.Lock()
+	} else if in.RunCommands && !run.running {
+		run.running = true
+		go e.runCommand(run, d, in.WorkDir)
+	}
+	detail, ok := run.detail, run.ok
+	e.mu.Unlock()
+	return detail, ok
+}
+
+func (e *Evaluator) runCommand(run *commandRun, d Detector, workDir string) {
+	timeout := defaultCommandTimeout
+	if d.TimeoutSeconds > 0 {
+		timeout = time.Duration(d.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	argv := []string{"sh", "-c", d.Command}
+	var err error
+	if e.Argv != nil {
+		argv, err = e.Argv(d.Command)
+	}
+	if err == nil {
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Dir = workDir
+		err = cmd.Run()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	run.at = time.Now()
+	run.running = false
+	run.ok = err == nil
+	run.detail = fmt.Sprintf("%q exited 0", d.Command)
+}
@@ -0,0 +1,192 @@
+package completion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gitRepo(t *testing.T, message string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", message},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v (%s)", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestEvaluateDetectors(t *testing.T) {
+	dir := gitRepo(t, "Add parser [READY_FOR_REVIEW]")
+	if err := os.MkdirAll(filepath.Join(dir, ".orchestra"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".orchestra", "done"), nil, 0o644); err != nil {
+		t.Fatalf("write marker: %v", err)
+	}
+	in := Input{WorkDir: dir, Output: []string{"ok  \tpkg/a", "PASS", "$ "}, Force: true}
+	e := NewEvaluator()
+
+	cases := []struct {
+		name   string
+		d      Detector
+		fires  bool
+		detail string
+	}{
+		{"default done", DefaultDone, true, ".orchestra/done exists"},
+		{"default review", DefaultReview, true, `last commit "Add parser [READY_FOR_REVIEW]"`},
+		{"missing file", Detector{FileExists: "DONE.md"}, false, ""},
+		{"output", Detector{Output: `^PASS$`}, true, `output "PASS"`},
+		{"command passes", Detector{Command: "test -d .orchestra"}, true, `"test -d .orchestra" exited 0`},
+		{"command fails", Detector{Command: "exit 1"}, false, ""},
+		{"all", Detector{All: []Detector{{Output: "PASS"}, {Command: "true"}}}, true, `output "PASS"; "true" exited 0`},
+		{"all short-circuits", Detector{All: []Detector{{Output: "FAIL"}, DefaultDone}}, false, ""},
+		{"any", Detector{Any: []Detector{{Output: "FAIL"}, {Name: "qa", CommitMessage: "parser"}}}, true, `qa: last commit "Add parser [READY_FOR_REVIEW]"`},
+	}
+	for _, tc := range cases {
+		res, ok := e.Evaluate(context.Background(), tc.d, in)
+		if ok != tc.fires || res.Detail != tc.detail {
+			t.Fatalf("%s: fired=%v detail=%q want %v %q", tc.name, ok, res.Detail, tc.fires, tc.detail)
+		}
+		if ok && res.Detector != tc.d.Label() {
+			t.Fatalf("%s: detector=%q want %q", tc.name, res.Detector, tc.d.Label())
+		}
+	}
+
+	if _, ok := e.Evaluate(context.Background(), DefaultDone, Input{}); ok {
+		t.Fatalf("file detector fired without a worktree")
+	}
+}
+
+func TestCommandDetectorRunsInBackground(t *testing.T) {
+	dir := t.TempDir()
+	e := NewEvaluator()
+	d := Detector{Command: "touch ran"}
+	if _, ok := e.Evaluate(context.Background(), d, Input{WorkDir: dir}); ok {
+		t.Fatalf("command detector fired without running")
+	}
+	if _, ok := e.Evaluate(context.Background(), d, Input{WorkDir: dir, RunCommands: true}); ok {
+		t.Fatalf("command detector fired before its first run finished")
+	}
+	for i := 0; ; i++ {
+		if _, ok := e.Evaluate(context.Background(), d, Input{WorkDir: dir}); ok {
+			break
+		}
+		if i > 200 {
+			t.Fatalf("background command result never reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := os.Remove(filepath.Join(dir, "ran")); err != nil {
+		t.Fatalf("command did not run in the worktree: %v", err)
+	}
+	if _, ok := e.Evaluate(context.Background(), d, Input{WorkDir: dir}); !ok {
+		t.Fatalf("last command result not reused")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Fatalf("command ran again without being asked to")
+	}
+}
+
+func TestCommandDetectorUsesArgv(t *testing.T) {
+	dir := t.TempDir()
+	e := NewEvaluator()
+	var got string
+	e.Argv = func(command string) ([]string, error) {
+		got = command
+		return []string{"sh", "-c", "touch wrapped && " + command}, nil
+	}
+	if _, ok := e.Evaluate(context.Background(), Detector{Command: "true"}, Input{WorkDir: dir, Force: true}); !ok {
+		t.Fatalf("wrapped command detector did not fire")
+	}
+	if got != "true" {
+		t.Fatalf("Argv got %q want the detector command", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "wrapped")); err != nil {
+		t.Fatalf("command did not run through Argv: %v", err)
+	}
+
+	e = NewEvaluator()
+	e.Argv = func(string) ([]string, error) { return nil, errors.New("no sandbox") }
+	if _, ok := e.Evaluate(context.Background(), Detector{Command: "true"}, Input{WorkDir: dir, Force: true}); ok {
+		t.Fatalf("command detector fired although Argv failed")
+	}
+}
+
+func TestValidateAndResolve(t *testing.T) {
+	for _, d := range []Detector{
+		{},
+		{FileExists: "a", Output: "b"},
+		{FileExists: "../outside"},
+		{FileExists: "/etc/passwd"},
+		{Output: "("},
+		{Any: []Detector{}},
+		{All: []Detector{{Command: "true", TimeoutSeconds: -1}}},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) expected error", d)
+		}
+	}
+	if err := (Config{Roles: map[string]Config{"qa": {Roles: map[string]Config{"x": {}}}}}).Validate(); err == nil {
+		t.Fatalf("nested roles should be rejected")
+	}
+
+	tests := Detector{Name: "tests", Command: "go test ./..."}
+	qa := Detector{Name: "qa", Output: "QA PASSED"}
+	agent := Config{Review: &tests, Roles: map[string]Config{"qa-reviewer": {Done: &qa}}}
+	playbook := Config{Review: &qa}
+
+	done, review := Resolve("qa-reviewer", agent)
+	if done.Name != "qa" || review.Name != "tests" {
+		t.Fatalf("agent role resolve done=%q review=%q", done.Name, review.Name)
+	}
+	done, review = Resolve("implementer", playbook, agent)
+	if done.Label() != DefaultDone.Label() || review.Name != "qa" {
+		t.Fatalf("playbook resolve done=%q review=%q", done.Label(), review.Name)
+	}
+}
+
+func TestPlaybookRoles(t *testing.T) {
+	data := []byte(`
+workflow:
+  build:
+    roles:
+    - name: implementer
+      completion:
+        done:
+          all:
+          - command: go test ./...
+          - file_exists: .orchestra/done
+    - name: refactorer
+  test:
+    roles:
+    - name: qa-reviewer
+      completion:
+        review:
+          output: QA (PASSED|APPROVED)
+`)
+	roles, err := PlaybookRoles(data)
+	if err != nil {
+		t.Fatalf("PlaybookRoles: %v", err)
+	}
+	if len(roles) != 2 || len(roles["implementer"].Done.All) != 2 || roles["qa-reviewer"].Review.Output == "" {
+		t.Fatalf("roles=%+v", roles)
+	}
+	if !strings.Contains(roles["implementer"].Done.Label(), "command:go test ./...") {
+		t.Fatalf("label=%q", roles["implementer"].Done.Label())
+	}
+
+	if _, err := PlaybookRoles([]byte("workflow:\n  build:\n    roles:\n    - name: x\n      completion:\n        done:\n          output: \"(\"\n")); err == nil {
+		t.Fatalf("invalid detector should be rejected")
+	}
+}
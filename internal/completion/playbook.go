@@ -0,0 +1,44 @@
+package completion
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// playbookFile is the part of a playbook that declares completion: each
+// workflow role may carry a completion block with done and review
+// detectors.
+type playbookFile struct {
+	Workflow map[string]struct {
+		Roles []struct {
+			Name       string `yaml:"name"`
+			Completion Config `yaml:"completion"`
+		} `yaml:"roles"`
+	} `yaml:"workflow"`
+}
+
+// PlaybookRoles returns the completion config of every role of a playbook
+// that declares one.
+func PlaybookRoles(data []byte) (map[string]Config, error) {
+	var pb playbookFile
+	if err := yaml.Unmarshal(data, &pb); err != nil {
+		return nil, fmt.Errorf("parse playbook: %w", err)
+	}
+	roles := make(map[string]Config)
+	for _, stage := range pb.Workflow {
+		for _, role := range stage.Roles {
+			if role.Completion.IsZero() {
+				continue
+			}
+			if len(role.Completion.Roles) > 0 {
+				return nil, fmt.Errorf("role %s: completion roles are only allowed on agents", role.Name)
+			}
+			if err := role.Completion.Validate(); err != nil {
+				return nil, fmt.Errorf("role %s: %w", role.Name, err)
+			}
+			roles[role.Name] = role.Completion
+		}
+	}
+	return roles, nil
+}
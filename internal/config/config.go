@@ -20,6 +20,11 @@ type Config struct {
 	DBPath                        string
 	AgentsDir                     string
 	PlaybooksDir                  string
+	PoliciesDir                   string
+	RecordingsDir                 string
+	TerminalBackend               string
+	PtydSocket                    string
+	CgroupRoot                    string
 	LLMAPIKey                     string
 	LLMModel                      string
 	LLMBaseURL                    string
@@ -27,24 +32,22 @@ type Config struct {
 	OrchestratorUserLanguage      string
 }
 
+// Terminal backends selectable with --terminal-backend.
+const (
+	// TerminalBackendPTY runs agent PTYs inside the server process.
+	TerminalBackendPTY = "pty"
+	// TerminalBackendPtyd delegates PTYs to the out-of-process supervisor
+	// (agenterm ptyd) so sessions survive server restarts.
+	TerminalBackendPtyd = "ptyd"
+	// TerminalBackendTmux runs each agent in a window of the TmuxSession
+	// tmux session, attachable with plain "tmux attach".
+	TerminalBackendTmux = "tmux"
+)
+
 func Load() (*Config, error) {
-	homeDir, err := os.UserHomeDir()
+	cfg, err := defaults()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	cfg := &Config{
-		Port:                          8765,
-		TmuxSession:                   "ai-coding",
-		DefaultDir:                    filepath.Join(homeDir, "08Coding"),
-		ConfigPath:                    filepath.Join(homeDir, ".config", "agenterm", "config"),
-		DBPath:                        filepath.Join(homeDir, ".config", "agenterm", "agenterm.db"),
-		AgentsDir:                     filepath.Join(homeDir, ".config", "agenterm", "agents"),
-		PlaybooksDir:                  filepath.Join(homeDir, ".config", "agenterm", "playbooks"),
-		LLMModel:                      "claude-sonnet-4-5",
-		LLMBaseURL:                    "https://api.anthropic.com/v1/messages",
-		OrchestratorGlobalMaxParallel: 32,
-		OrchestratorUserLanguage:      "en",
+		return nil, err
 	}
 
 	if err := cfg.loadFromFile(); err != nil && !os.IsNotExist(err) {
@@ -52,12 +55,17 @@ func Load() (*Config, error) {
 	}
 
 	flag.IntVar(&cfg.Port, "port", cfg.Port, "server port (1-65535)")
-	flag.StringVar(&cfg.TmuxSession, "session", cfg.TmuxSession, "tmux session name")
+	flag.StringVar(&cfg.TmuxSession, "session", cfg.TmuxSession, "tmux session name used by the tmux terminal backend")
 	flag.StringVar(&cfg.Token, "token", cfg.Token, "authentication token (auto-generated if empty)")
 	flag.StringVar(&cfg.DefaultDir, "dir", cfg.DefaultDir, "default directory for new windows")
 	flag.StringVar(&cfg.DBPath, "db-path", cfg.DBPath, "path to SQLite database")
 	flag.StringVar(&cfg.AgentsDir, "agents-dir", cfg.AgentsDir, "directory for agent YAML configs")
 	flag.StringVar(&cfg.PlaybooksDir, "playbooks-dir", cfg.PlaybooksDir, "directory for playbook YAML configs")
+	flag.StringVar(&cfg.PoliciesDir, "policies-dir", cfg.PoliciesDir, "directory for command policy YAML files (default.yaml, <project id>.yaml)")
+	flag.StringVar(&cfg.RecordingsDir, "recordings-dir", cfg.RecordingsDir, "directory for asciicast session recordings (empty disables recording)")
+	flag.StringVar(&cfg.TerminalBackend, "terminal-backend", cfg.TerminalBackend, "terminal backend for agent sessions (pty, ptyd, tmux)")
+	flag.StringVar(&cfg.PtydSocket, "ptyd-socket", cfg.PtydSocket, "unix socket of the PTY supervisor used by the ptyd backend")
+	flag.StringVar(&cfg.CgroupRoot, "cgroup-root", cfg.CgroupRoot, "delegated cgroup v2 directory for per-session resource limits (empty checks them by polling)")
 	flag.StringVar(&cfg.LLMAPIKey, "llm-api-key", cfg.LLMAPIKey, "LLM API key (defaults to ANTHROPIC_API_KEY env var)")
 	flag.StringVar(&cfg.LLMModel, "llm-model", cfg.LLMModel, "LLM model name for orchestrator")
 	flag.StringVar(&cfg.LLMBaseURL, "llm-base-url", cfg.LLMBaseURL, "LLM API URL for orchestrator")
@@ -73,6 +81,9 @@ func Load() (*Config, error) {
 	if cfg.Port < 1 || cfg.Port > 65535 {
 		return nil, fmt.Errorf("invalid port %d: must be between 1 and 65535", cfg.Port)
 	}
+	if err := cfg.validateTerminalBackend(); err != nil {
+		return nil, err
+	}
 
 	if cfg.Token == "" {
 		token, err := generateToken()
@@ -88,6 +99,75 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// LoadPtyd loads the configuration for the "agenterm ptyd" subcommand. It
+// reads the shared config file and parses args with a dedicated flag set so
+// the supervisor does not accept server-only flags.
+func LoadPtyd(args []string) (*Config, error) {
+	cfg, err := defaults()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.loadFromFile(); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	fs := flag.NewFlagSet("ptyd", flag.ContinueOnError)
+	fs.StringVar(&cfg.PtydSocket, "socket", cfg.PtydSocket, "unix socket to listen on")
+	fs.StringVar(&cfg.RecordingsDir, "recordings-dir", cfg.RecordingsDir, "directory for asciicast session recordings (empty disables recording)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cfg.PtydSocket) == "" {
+		return nil, fmt.Errorf("ptyd socket path is required")
+	}
+	return cfg, nil
+}
+
+func defaults() (*Config, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return &Config{
+		Port:                          8765,
+		TmuxSession:                   "ai-coding",
+		DefaultDir:                    filepath.Join(homeDir, "08Coding"),
+		ConfigPath:                    filepath.Join(homeDir, ".config", "agenterm", "config"),
+		DBPath:                        filepath.Join(homeDir, ".config", "agenterm", "agenterm.db"),
+		AgentsDir:                     filepath.Join(homeDir, ".config", "agenterm", "agents"),
+		PlaybooksDir:                  filepath.Join(homeDir, ".config", "agenterm", "playbooks"),
+		PoliciesDir:                   filepath.Join(homeDir, ".config", "agenterm", "policies"),
+		RecordingsDir:                 filepath.Join(homeDir, ".config", "agenterm", "recordings"),
+		TerminalBackend:               TerminalBackendPTY,
+		PtydSocket:                    filepath.Join(homeDir, ".config", "agenterm", "ptyd.sock"),
+		LLMModel:                      "claude-sonnet-4-5",
+		LLMBaseURL:                    "https://api.anthropic.com/v1/messages",
+		OrchestratorGlobalMaxParallel: 32,
+		OrchestratorUserLanguage:      "en",
+	}, nil
+}
+
+func (c *Config) validateTerminalBackend() error {
+	c.TerminalBackend = strings.ToLower(strings.TrimSpace(c.TerminalBackend))
+	switch c.TerminalBackend {
+	case "":
+		c.TerminalBackend = TerminalBackendPTY
+	case TerminalBackendPTY:
+	case TerminalBackendPtyd:
+		if strings.TrimSpace(c.PtydSocket) == "" {
+			return fmt.Errorf("ptyd socket path is required for the ptyd terminal backend")
+		}
+	case TerminalBackendTmux:
+		if strings.TrimSpace(c.TmuxSession) == "" {
+			return fmt.Errorf("tmux session name is required for the tmux terminal backend")
+		}
+	default:
+		return fmt.Errorf("invalid terminal backend %q: must be pty, ptyd or tmux", c.TerminalBackend)
+	}
+	return nil
+}
+
 func (c *Config) loadFromFile() error {
 	data, err := os.ReadFile(c.ConfigPath)
 	if err != nil {
@@ -124,6 +204,16 @@ func (c *Config) loadFromFile() error {
 			c.AgentsDir = value
 		case "PlaybooksDir":
 			c.PlaybooksDir = value
+		case "PoliciesDir":
+			c.PoliciesDir = value
+		case "RecordingsDir":
+			c.RecordingsDir = value
+		case "TerminalBackend":
+			c.TerminalBackend = value
+		case "PtydSocket":
+			c.PtydSocket = value
+		case "CgroupRoot":
+			c.CgroupRoot = value
 		case "LLMAPIKey":
 			c.LLMAPIKey = value
 		case "LLMModel":
@@ -149,8 +239,8 @@ func (c *Config) saveToFile() error {
 		return err
 	}
 	data := fmt.Sprintf(
-		"Port=%d\nTmuxSession=%s\nToken=%s\nDefaultDir=%s\nDBPath=%s\nAgentsDir=%s\nPlaybooksDir=%s\nLLMAPIKey=%s\nLLMModel=%s\nLLMBaseURL=%s\nOrchestratorGlobalMaxParallel=%d\nOrchestratorUserLanguage=%s\n",
-		c.Port, c.TmuxSession, c.Token, c.DefaultDir, c.DBPath, c.AgentsDir, c.PlaybooksDir, c.LLMAPIKey, c.LLMModel, c.LLMBaseURL, c.OrchestratorGlobalMaxParallel, c.OrchestratorUserLanguage,
+		"Port=%d\nTmuxSession=%s\nToken=%s\nDefaultDir=%s\nDBPath=%s\nAgentsDir=%s\nPlaybooksDir=%s\nPoliciesDir=%s\nRecordingsDir=%s\nTerminalBackend=%s\nPtydSocket=%s\nCgroupRoot=%s\nLLMAPIKey=%s\nLLMModel=%s\nLLMBaseURL=%s\nOrchestratorGlobalMaxParallel=%d\nOrchestratorUserLanguage=%s\n",
+		c.Port, c.TmuxSession, c.Token, c.DefaultDir, c.DBPath, c.AgentsDir, c.PlaybooksDir, c.PoliciesDir, c.RecordingsDir, c.TerminalBackend, c.PtydSocket, c.CgroupRoot, c.LLMAPIKey, c.LLMModel, c.LLMBaseURL, c.OrchestratorGlobalMaxParallel, c.OrchestratorUserLanguage,
 	)
 	return os.WriteFile(c.ConfigPath, []byte(data), 0600)
 }
@@ -10,7 +10,7 @@ func TestLoadFromFileParsesDBPath(t *testing.T) {
 	cfg := &Config{}
 	cfg.ConfigPath = filepath.Join(t.TempDir(), "config")
 
-	content := "Port=9999\nTmuxSession=ai\nToken=test-token\nDefaultDir=/tmp/work\nDBPath=/tmp/custom/agenterm.db\nAgentsDir=/tmp/custom/agents\nPlaybooksDir=/tmp/custom/playbooks\nLLMAPIKey=test-llm-key\nLLMModel=claude-sonnet-test\nLLMBaseURL=https://example.invalid/v1/messages\nOrchestratorGlobalMaxParallel=19\n"
+	content := "Port=9999\nTmuxSession=ai\nToken=test-token\nDefaultDir=/tmp/work\nDBPath=/tmp/custom/agenterm.db\nAgentsDir=/tmp/custom/agents\nPlaybooksDir=/tmp/custom/playbooks\nRecordingsDir=/tmp/custom/recordings\nTerminalBackend=ptyd\nPtydSocket=/tmp/custom/ptyd.sock\nLLMAPIKey=test-llm-key\nLLMModel=claude-sonnet-test\nLLMBaseURL=https://example.invalid/v1/messages\nOrchestratorGlobalMaxParallel=19\n"
 	if err := os.WriteFile(cfg.ConfigPath, []byte(content), 0o600); err != nil {
 		t.Fatalf("write config file error = %v", err)
 	}
@@ -28,6 +28,15 @@ func TestLoadFromFileParsesDBPath(t *testing.T) {
 	if cfg.PlaybooksDir != "/tmp/custom/playbooks" {
 		t.Fatalf("PlaybooksDir = %q, want /tmp/custom/playbooks", cfg.PlaybooksDir)
 	}
+	if cfg.RecordingsDir != "/tmp/custom/recordings" {
+		t.Fatalf("RecordingsDir = %q, want /tmp/custom/recordings", cfg.RecordingsDir)
+	}
+	if cfg.TerminalBackend != "ptyd" {
+		t.Fatalf("TerminalBackend = %q, want ptyd", cfg.TerminalBackend)
+	}
+	if cfg.PtydSocket != "/tmp/custom/ptyd.sock" {
+		t.Fatalf("PtydSocket = %q, want /tmp/custom/ptyd.sock", cfg.PtydSocket)
+	}
 	if cfg.LLMAPIKey != "test-llm-key" {
 		t.Fatalf("LLMAPIKey = %q, want test-llm-key", cfg.LLMAPIKey)
 	}
@@ -41,3 +50,28 @@ func TestLoadFromFileParsesDBPath(t *testing.T) {
 		t.Fatalf("OrchestratorGlobalMaxParallel = %d, want 19", cfg.OrchestratorGlobalMaxParallel)
 	}
 }
+
+func TestValidateTerminalBackend(t *testing.T) {
+	cfg := &Config{TerminalBackend: " PTYD ", PtydSocket: "/tmp/ptyd.sock"}
+	if err := cfg.validateTerminalBackend(); err != nil {
+		t.Fatalf("validateTerminalBackend() error = %v", err)
+	}
+	if cfg.TerminalBackend != TerminalBackendPtyd {
+		t.Fatalf("TerminalBackend = %q, want ptyd", cfg.TerminalBackend)
+	}
+
+	cfg = &Config{TerminalBackend: "ptyd"}
+	if err := cfg.validateTerminalBackend(); err == nil {
+		t.Fatalf("expected error when ptyd socket is empty")
+	}
+
+	cfg = &Config{TerminalBackend: "tmux"}
+	if err := cfg.validateTerminalBackend(); err == nil {
+		t.Fatalf("expected error when tmux session is empty")
+	}
+
+	cfg = &Config{TerminalBackend: "screen"}
+	if err := cfg.validateTerminalBackend(); err == nil {
+		t.Fatalf("expected error for unknown backend")
+	}
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type BudgetRepo struct {
+	db *sql.DB
+}
+
+func NewBudgetRepo(db *sql.DB) *BudgetRepo {
+	return &BudgetRepo{db: db}
+}
+
+const budgetColumns = `id, project_id, requirement_id, max_cost_usd, max_tokens, action, exceeded_at, created_at, updated_at`
+
+// Upsert creates the budget of its project or requirement, or replaces the
+// existing one. Either way the budget is no longer marked exceeded.
+func (r *BudgetRepo) Upsert(ctx context.Context, budget *Budget) error {
+	if budget == nil {
+		return fmt.Errorf("budget is required")
+	}
+	existing, err := r.getByScope(ctx, budget.ProjectID, budget.RequirementID)
+	if err != nil {
+		return err
+	}
+	now := nowUTC()
+	budget.ExceededAt = time.Time{}
+	budget.UpdatedAt = now
+	if existing != nil {
+		budget.ID = existing.ID
+		budget.CreatedAt = existing.CreatedAt
+		_, err := r.db.ExecContext(ctx, `UPDATE budgets SET max_cost_usd = ?, max_tokens = ?, action = ?, exceeded_at = '', updated_at = ? WHERE id = ?`,
+			budget.MaxCostUSD, budget.MaxTokens, budget.Action, formatTimestamp(now), budget.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update budget %q: %w", budget.ID, err)
+		}
+		return nil
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return err
+	}
+	budget.ID = id
+	budget.CreatedAt = now
+	_, err = r.db.ExecContext(ctx, `INSERT INTO budgets (`+budgetColumns+`) VALUES (?, ?, ?, ?, ?, ?, '', ?, ?)`,
+		budget.ID, budget.ProjectID, budget.RequirementID, budget.MaxCostUSD, budget.MaxTokens, budget.Action,
+		formatTimestamp(now), formatTimestamp(now))
+	if err != nil {
+		return fmt.Errorf("failed to create budget: %w", err)
+	}
+	return nil
+}
+
+func (r *BudgetRepo) Get(ctx context.Context, id string) (*Budget, error) {
+	budget, err := scanBudget(r.db.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget %q: %w", id, err)
+	}
+	return budget, nil
+}
+
+func (r *BudgetRepo) getByScope(ctx context.Context, projectID, requirementID string) (*Budget, error) {
+	budget, err := scanBudget(r.db.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE project_id = ? AND requirement_id = ?`, projectID, requirementID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget of project %q: %w", projectID, err)
+	}
+	return budget, nil
+}
+
+// ListByProject returns a project's budgets, the project-wide one first.
+func (r *BudgetRepo) ListByProject(ctx context.Context, projectID string) ([]*Budget, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE project_id = ? ORDER BY requirement_id ASC`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list budgets: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*Budget, 0)
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		out = append(out, budget)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating budgets: %w", err)
+	}
+	return out, nil
+}
+
+// MarkExceeded records that the budget's action was taken at at. It
+// reports false when the budget was already marked.
+func (r *BudgetRepo) MarkExceeded(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE budgets SET exceeded_at = ? WHERE id = ? AND exceeded_at = ''`, formatTimestamp(at), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark budget %q exceeded: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark budget %q exceeded: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+func (r *BudgetRepo) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM budgets WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete budget %q: %w", id, err)
+	}
+	return nil
+}
+
+func scanBudget(row rowScanner) (*Budget, error) {
+	var budget Budget
+	var exceededAtRaw, createdAtRaw, updatedAtRaw string
+	if err := row.Scan(&budget.ID, &budget.ProjectID, &budget.RequirementID, &budget.MaxCostUSD, &budget.MaxTokens, &budget.Action,
+		&exceededAtRaw, &createdAtRaw, &updatedAtRaw); err != nil {
+		return nil, err
+	}
+	var err error
+	if budget.ExceededAt, err = parseOptionalTimestamp(exceededAtRaw); err != nil {
+		return nil, err
+	}
+	if budget.CreatedAt, err = parseTimestamp(createdAtRaw); err != nil {
+		return nil, err
+	}
+	if budget.UpdatedAt, err = parseTimestamp(updatedAtRaw); err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
@@ -7,6 +7,10 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/resources"
 )
 
 func openTestDB(t *testing.T) (*DB, string) {
@@ -79,8 +83,8 @@ func TestMigrationsAreIdempotent(t *testing.T) {
 	if err := database.SQL().QueryRow(`SELECT value FROM _meta WHERE key='schema_version'`).Scan(&version); err != nil {
 		t.Fatalf("read schema version error = %v", err)
 	}
-	if version != "10" {
-		t.Fatalf("schema version = %s, want 10", version)
+	if version != "25" {
+		t.Fatalf("schema version = %s, want 25", version)
 	}
 }
 
@@ -114,6 +118,7 @@ func TestProjectRepoCRUDAndListByStatus(t *testing.T) {
 	}
 
 	project.Status = "paused"
+	project.ResourceLimits = resources.Limits{CPUQuota: 1.5, MemoryMB: 2048}
 	if err := repo.Update(ctx, project); err != nil {
 		t.Fatalf("Update() error = %v", err)
 	}
@@ -125,6 +130,9 @@ func TestProjectRepoCRUDAndListByStatus(t *testing.T) {
 	if len(pausedList) != 1 || pausedList[0].ID != project.ID {
 		t.Fatalf("List(paused) got = %#v", pausedList)
 	}
+	if pausedList[0].ResourceLimits != project.ResourceLimits {
+		t.Fatalf("ResourceLimits = %+v, want %+v", pausedList[0].ResourceLimits, project.ResourceLimits)
+	}
 
 	if err := repo.Delete(ctx, project.ID); err != nil {
 		t.Fatalf("Delete() error = %v", err)
@@ -191,6 +199,7 @@ func TestTaskRepoCRUDAndJSONDependsOn(t *testing.T) {
 
 	task.Status = "running"
 	task.DependsOn = []string{"task-a"}
+	task.Env = environ.Map{"API_BASE": strPtr("https://api.example.com"), "http_proxy": nil}
 	if err := taskRepo.Update(ctx, task); err != nil {
 		t.Fatalf("Update() error = %v", err)
 	}
@@ -202,6 +211,9 @@ func TestTaskRepoCRUDAndJSONDependsOn(t *testing.T) {
 	if updated.Status != "running" || !reflect.DeepEqual(updated.DependsOn, []string{"task-a"}) {
 		t.Fatalf("updated task = %#v", updated)
 	}
+	if !reflect.DeepEqual(updated.Env, task.Env) {
+		t.Fatalf("Env = %#v, want %#v", updated.Env, task.Env)
+	}
 
 	if err := taskRepo.Delete(ctx, task.ID); err != nil {
 		t.Fatalf("Delete() error = %v", err)
@@ -322,6 +334,24 @@ func TestSessionRepoCRUDAndFilters(t *testing.T) {
 		t.Fatalf("ListActive after update len = %d, want 0", len(activeAfter))
 	}
 
+	code := 137
+	if err := sessionRepo.SetExit(ctx, session.ID, &SessionExit{Code: &code, Signal: "SIGKILL", Reason: "oom", At: time.Now()}); err != nil {
+		t.Fatalf("SetExit() error = %v", err)
+	}
+	exited, err := sessionRepo.Get(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Get() after SetExit error = %v", err)
+	}
+	if exited.Exit == nil || exited.Exit.Code == nil || *exited.Exit.Code != 137 || exited.Exit.Signal != "SIGKILL" || exited.Exit.Reason != "oom" || exited.Exit.At.IsZero() {
+		t.Fatalf("Get() exit = %#v", exited.Exit)
+	}
+	if err := sessionRepo.SetExit(ctx, session.ID, nil); err != nil {
+		t.Fatalf("SetExit(nil) error = %v", err)
+	}
+	if cleared, _ := sessionRepo.Get(ctx, session.ID); cleared.Exit != nil {
+		t.Fatalf("Get() exit after clear = %#v", cleared.Exit)
+	}
+
 	if err := sessionRepo.Delete(ctx, session.ID); err != nil {
 		t.Fatalf("Delete() error = %v", err)
 	}
@@ -543,3 +573,5 @@ func TestNewIDUniqueness(t *testing.T) {
 		ids[id] = struct{}{}
 	}
 }
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type HeadlessRunRepo struct {
+	db *sql.DB
+}
+
+func NewHeadlessRunRepo(db *sql.DB) *HeadlessRunRepo {
+	return &HeadlessRunRepo{db: db}
+}
+
+const headlessRunColumns = `id, task_id, agent_type, prompt, status, exit_code, stdout, stderr, error, created_at, finished_at`
+
+func (r *HeadlessRunRepo) Create(ctx context.Context, run *HeadlessRun) error {
+	if run == nil {
+		return fmt.Errorf("headless run is required")
+	}
+	if run.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+	}
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = nowUTC()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO headless_runs (`+headlessRunColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.TaskID, run.AgentType, run.Prompt, run.Status, nullableInt(run.ExitCode), run.Stdout, run.Stderr, run.Error,
+		formatTimestamp(run.CreatedAt), formatTimestampOrEmpty(run.FinishedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create headless run: %w", err)
+	}
+	return nil
+}
+
+// Finish records the outcome of a run.
+func (r *HeadlessRunRepo) Finish(ctx context.Context, run *HeadlessRun) error {
+	if run.FinishedAt.IsZero() {
+		run.FinishedAt = nowUTC()
+	}
+	res, err := r.db.ExecContext(ctx, `
+UPDATE headless_runs
+SET status = ?, exit_code = ?, stdout = ?, stderr = ?, error = ?, finished_at = ?
+WHERE id = ?
+`, run.Status, nullableInt(run.ExitCode), run.Stdout, run.Stderr, run.Error, formatTimestamp(run.FinishedAt), run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to finish headless run %q: %w", run.ID, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read updated rows for headless run %q: %w", run.ID, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("headless run %q not found", run.ID)
+	}
+	return nil
+}
+
+func (r *HeadlessRunRepo) Get(ctx context.Context, id string) (*HeadlessRun, error) {
+	run, err := scanHeadlessRun(r.db.QueryRowContext(ctx, `SELECT `+headlessRunColumns+` FROM headless_runs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get headless run %q: %w", id, err)
+	}
+	return run, nil
+}
+
+// ListByTask returns a task's runs, newest first.
+func (r *HeadlessRunRepo) ListByTask(ctx context.Context, taskID string) ([]*HeadlessRun, error) {
+	return r.list(ctx, `SELECT `+headlessRunColumns+` FROM headless_runs WHERE task_id = ? ORDER BY created_at DESC, rowid DESC`, taskID)
+}
+
+func (r *HeadlessRunRepo) ListByStatus(ctx context.Context, status string) ([]*HeadlessRun, error) {
+	return r.list(ctx, `SELECT `+headlessRunColumns+` FROM headless_runs WHERE status = ? ORDER BY created_at ASC, rowid ASC`, status)
+}
+
+func (r *HeadlessRunRepo) list(ctx context.Context, query string, args ...any) ([]*HeadlessRun, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list headless runs: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*HeadlessRun, 0)
+	for rows.Next() {
+		run, err := scanHeadlessRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan headless run: %w", err)
+		}
+		out = append(out, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating headless runs: %w", err)
+	}
+	return out, nil
+}
+
+func scanHeadlessRun(row rowScanner) (*HeadlessRun, error) {
+	var run HeadlessRun
+	var exitCode sql.NullInt64
+	var createdAtRaw, finishedAtRaw string
+	if err := row.Scan(&run.ID, &run.TaskID, &run.AgentType, &run.Prompt, &run.Status, &exitCode, &run.Stdout, &run.Stderr, &run.Error, &createdAtRaw, &finishedAtRaw); err != nil {
+		return nil, err
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		run.ExitCode = &code
+	}
+	var err error
+	if run.CreatedAt, err = parseTimestamp(createdAtRaw); err != nil {
+		return nil, err
+	}
+	if run.FinishedAt, err = parseOptionalTimestamp(finishedAtRaw); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func nullableInt(v *int) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
@@ -467,6 +467,44 @@ WHERE rc.task_id = ?
 	return total, nil
 }
 
+// ListOpenIssuesByTask returns the unresolved issues of all review cycles of
+// a task, oldest first.
+func (r *ReviewRepo) ListOpenIssuesByTask(ctx context.Context, taskID string) ([]*ReviewIssue, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT ri.id, ri.cycle_id, ri.severity, ri.summary, ri.status, ri.resolution, ri.created_at, ri.updated_at
+FROM review_issues ri
+JOIN review_cycles rc ON rc.id = ri.cycle_id
+WHERE rc.task_id = ?
+  AND lower(trim(ri.status)) NOT IN ('resolved', 'closed', 'accepted')
+ORDER BY ri.created_at ASC
+`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("list open review issues: %w", err)
+	}
+	defer rows.Close()
+	items := make([]*ReviewIssue, 0)
+	for rows.Next() {
+		var item ReviewIssue
+		var createdAtRaw, updatedAtRaw string
+		if err := rows.Scan(&item.ID, &item.CycleID, &item.Severity, &item.Summary, &item.Status, &item.Resolution, &createdAtRaw, &updatedAtRaw); err != nil {
+			return nil, fmt.Errorf("scan review issue: %w", err)
+		}
+		item.CreatedAt, err = parseTimestamp(createdAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		item.UpdatedAt, err = parseTimestamp(updatedAtRaw)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate review issues: %w", err)
+	}
+	return items, nil
+}
+
 func (r *ReviewRepo) nextIteration(ctx context.Context, taskID string) (int, error) {
 	var max sql.NullInt64
 	if err := r.db.QueryRowContext(ctx, `SELECT max(iteration) FROM review_cycles WHERE task_id = ?`, taskID).Scan(&max); err != nil {
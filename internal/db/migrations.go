@@ -402,6 +402,225 @@ CREATE INDEX IF NOT EXISTS idx_permission_templates_agent ON permission_template
 ALTER TABLE tasks ADD COLUMN requirement_id TEXT DEFAULT '';
 ALTER TABLE projects ADD COLUMN context_template TEXT DEFAULT '';
 ALTER TABLE projects ADD COLUMN knowledge TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 11,
+		name:    "add project resource limits",
+		sql: `
+ALTER TABLE projects ADD COLUMN resource_limits TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 12,
+		name:    "add project and task env",
+		sql: `
+ALTER TABLE projects ADD COLUMN env TEXT DEFAULT '';
+ALTER TABLE tasks ADD COLUMN env TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 13,
+		name:    "add session exit status",
+		sql: `
+ALTER TABLE sessions ADD COLUMN exit_code INTEGER;
+ALTER TABLE sessions ADD COLUMN exit_signal TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN exit_reason TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN exited_at TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 14,
+		name:    "add task agent type",
+		sql: `
+ALTER TABLE tasks ADD COLUMN agent_type TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 15,
+		name:    "create session waitlist",
+		sql: `
+CREATE TABLE IF NOT EXISTS session_waitlist (
+	id TEXT PRIMARY KEY,
+	task_id TEXT NOT NULL,
+	agent_type TEXT NOT NULL,
+	role TEXT NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY(task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_waitlist_agent_priority ON session_waitlist(agent_type, priority DESC, created_at);
+`,
+	},
+	{
+		version: 16,
+		name:    "create session events",
+		sql: `
+CREATE TABLE IF NOT EXISTS session_events (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	rule TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_events_session_created ON session_events(session_id, created_at);
+`,
+	},
+	{
+		version: 17,
+		name:    "create headless runs",
+		sql: `
+CREATE TABLE IF NOT EXISTS headless_runs (
+	id TEXT PRIMARY KEY,
+	task_id TEXT NOT NULL,
+	agent_type TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	status TEXT NOT NULL,
+	exit_code INTEGER,
+	stdout TEXT NOT NULL DEFAULT '',
+	stderr TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	finished_at TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_headless_runs_task_created ON headless_runs(task_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_headless_runs_status ON headless_runs(status);
+`,
+	},
+	{
+		version: 18,
+		name:    "create session transcripts",
+		sql: `
+CREATE TABLE IF NOT EXISTS session_transcripts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	class TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_transcripts_session_seq ON session_transcripts(session_id, seq);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS session_transcripts_fts USING fts5(
+	text,
+	content='session_transcripts',
+	content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS session_transcripts_ai AFTER INSERT ON session_transcripts BEGIN
+	INSERT INTO session_transcripts_fts(rowid, text) VALUES (new.id, new.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS session_transcripts_ad AFTER DELETE ON session_transcripts BEGIN
+	INSERT INTO session_transcripts_fts(session_transcripts_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+`,
+	},
+	{
+		version: 19,
+		name:    "create usage records and budgets",
+		sql: `
+CREATE TABLE IF NOT EXISTS usage_records (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	task_id TEXT NOT NULL DEFAULT '',
+	requirement_id TEXT NOT NULL DEFAULT '',
+	project_id TEXT NOT NULL DEFAULT '',
+	agent_type TEXT NOT NULL,
+	source TEXT NOT NULL,
+	input_tokens INTEGER NOT NULL DEFAULT 0,
+	output_tokens INTEGER NOT NULL DEFAULT 0,
+	total_tokens INTEGER NOT NULL DEFAULT 0,
+	cost_usd REAL NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_records_session ON usage_records(session_id);
+CREATE INDEX IF NOT EXISTS idx_usage_records_task ON usage_records(task_id);
+CREATE INDEX IF NOT EXISTS idx_usage_records_project ON usage_records(project_id, requirement_id);
+
+CREATE TABLE IF NOT EXISTS budgets (
+	id TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	requirement_id TEXT NOT NULL DEFAULT '',
+	max_cost_usd REAL NOT NULL DEFAULT 0,
+	max_tokens INTEGER NOT NULL DEFAULT 0,
+	action TEXT NOT NULL,
+	exceeded_at TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	UNIQUE(project_id, requirement_id),
+	FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		version: 20,
+		name:    "add project responder rules",
+		sql: `
+ALTER TABLE projects ADD COLUMN responder_rules TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 21,
+		name:    "add session agent session id",
+		sql: `
+ALTER TABLE sessions ADD COLUMN agent_session_id TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 22,
+		name:    "create policy events",
+		sql: `
+CREATE TABLE IF NOT EXISTS policy_events (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	task_id TEXT NOT NULL DEFAULT '',
+	project_id TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	source TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	command TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_policy_events_project ON policy_events(project_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_policy_events_session ON policy_events(session_id);
+`,
+	},
+	{
+		version: 23,
+		name:    "add session takeover leases",
+		sql: `
+ALTER TABLE sessions ADD COLUMN takeover_owner TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN takeover_acquired_at TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN takeover_heartbeat_at TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN takeover_expires_at TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 24,
+		name:    "add session suspended status",
+		sql: `
+ALTER TABLE sessions ADD COLUMN suspended_status TEXT DEFAULT '';
+`,
+	},
+	{
+		version: 25,
+		name:    "add project auto schedule",
+		sql: `
+ALTER TABLE projects ADD COLUMN auto_schedule INTEGER NOT NULL DEFAULT 0;
 `,
 	},
 }
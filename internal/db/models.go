@@ -7,32 +7,53 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/responder"
 )
 
 type Project struct {
-	ID              string    `json:"id"`
-	Name            string    `json:"name"`
-	RepoPath        string    `json:"repo_path"`
-	Status          string    `json:"status"`
-	Playbook        string    `json:"playbook,omitempty"`
-	ContextTemplate string    `json:"context_template,omitempty"`
-	Knowledge       string    `json:"knowledge,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	RepoPath        string `json:"repo_path"`
+	Status          string `json:"status"`
+	Playbook        string `json:"playbook,omitempty"`
+	ContextTemplate string `json:"context_template,omitempty"`
+	Knowledge       string `json:"knowledge,omitempty"`
+	// ResourceLimits apply to every agent session of the project, combined
+	// with the agent's own limits (the stricter value wins).
+	ResourceLimits resources.Limits `json:"resource_limits"`
+	// Env is layered over the agent's env for every session of the project.
+	Env environ.Map `json:"env,omitempty"`
+	// ResponderRules answer prompts of the project's unattended sessions
+	// before the agent's own rules.
+	ResponderRules responder.Rules `json:"responder_rules,omitempty"`
+	// AutoSchedule lets the scheduler start sessions for the project's
+	// pending tasks on its own.
+	AutoSchedule bool      `json:"auto_schedule"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type Task struct {
-	ID            string    `json:"id"`
-	ProjectID     string    `json:"project_id"`
-	Title         string    `json:"title"`
-	Description   string    `json:"description"`
-	Status        string    `json:"status"`
-	DependsOn     []string  `json:"depends_on"`
-	WorktreeID    string    `json:"worktree_id,omitempty"`
-	SpecPath      string    `json:"spec_path,omitempty"`
-	RequirementID string    `json:"requirement_id,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string   `json:"id"`
+	ProjectID     string   `json:"project_id"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Status        string   `json:"status"`
+	DependsOn     []string `json:"depends_on"`
+	WorktreeID    string   `json:"worktree_id,omitempty"`
+	SpecPath      string   `json:"spec_path,omitempty"`
+	RequirementID string   `json:"requirement_id,omitempty"`
+	// Env is layered over the agent's and project's env for the task's
+	// sessions.
+	Env environ.Map `json:"env,omitempty"`
+	// AgentType is the agent the scheduler launches for the task; tasks
+	// without one are never started automatically.
+	AgentType string    `json:"agent_type,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Worktree struct {
@@ -55,6 +76,169 @@ type Session struct {
 	HumanAttached   bool      `json:"human_attached"`
 	CreatedAt       time.Time `json:"created_at"`
 	LastActivityAt  time.Time `json:"last_activity_at"`
+	// Exit is set once the session's agent process has ended.
+	Exit *SessionExit `json:"exit,omitempty"`
+	// AgentSessionID is the agent's own ID for the session's conversation,
+	// used to resume exactly that conversation.
+	AgentSessionID string `json:"agent_session_id,omitempty"`
+	// Takeover is the lease of the human who has taken the session over;
+	// nil when automation drives it.
+	Takeover *TakeoverLease `json:"takeover,omitempty"`
+	// SuspendedStatus is the status a suspended session had before the
+	// server shut down, restored when it is reattached.
+	SuspendedStatus string `json:"suspended_status,omitempty"`
+}
+
+// TakeoverLease is a human's hold on a session's terminal. It lapses at
+// ExpiresAt unless its owner heartbeats; a zero ExpiresAt holds it until
+// it is handed back.
+type TakeoverLease struct {
+	Owner       string    `json:"owner"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Active reports whether l is held at now.
+func (l *TakeoverLease) Active(now time.Time) bool {
+	return l != nil && (l.ExpiresAt.IsZero() || now.Before(l.ExpiresAt))
+}
+
+// SessionExit records how a session's agent process ended.
+type SessionExit struct {
+	// Code is nil when the backend could not observe the exit.
+	Code   *int      `json:"code,omitempty"`
+	Signal string    `json:"signal,omitempty"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// WaitlistEntry is a session request waiting for its agent to have a free
+// slot. Higher priorities start first, then older entries.
+type WaitlistEntry struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	AgentType string    `json:"agent_type"`
+	Role      string    `json:"role"`
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SessionEvent records something that happened to a session outside its
+// own output, such as a watchdog rule firing.
+type SessionEvent struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Kind      string    `json:"kind"`
+	Rule      string    `json:"rule,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HeadlessRun is a non-interactive agent run for a task: the prompt is fed
+// on stdin and the output captured, without a terminal.
+type HeadlessRun struct {
+	ID        string `json:"id"`
+	TaskID    string `json:"task_id"`
+	AgentType string `json:"agent_type"`
+	Prompt    string `json:"prompt"`
+	Status    string `json:"status"`
+	// ExitCode is nil while running or when the process could not start.
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// TranscriptEntry is one parsed output line of a session, numbered by Seq
+// in the order it was produced.
+type TranscriptEntry struct {
+	SessionID string    `json:"session_id"`
+	Seq       int64     `json:"seq"`
+	Text      string    `json:"text"`
+	Class     string    `json:"class,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TranscriptHit is a transcript entry matching a search, with the session
+// it belongs to and the lines around it.
+type TranscriptHit struct {
+	TranscriptEntry
+	TaskID    string             `json:"task_id,omitempty"`
+	ProjectID string             `json:"project_id,omitempty"`
+	AgentType string             `json:"agent_type"`
+	Role      string             `json:"role"`
+	Before    []*TranscriptEntry `json:"before"`
+	After     []*TranscriptEntry `json:"after"`
+}
+
+// UsageRecord is usage reported by a session's agent. The task,
+// requirement and project are copied from the session when recorded, so
+// totals survive the session's deletion.
+type UsageRecord struct {
+	ID            string    `json:"id"`
+	SessionID     string    `json:"session_id"`
+	TaskID        string    `json:"task_id,omitempty"`
+	RequirementID string    `json:"requirement_id,omitempty"`
+	ProjectID     string    `json:"project_id,omitempty"`
+	AgentType     string    `json:"agent_type"`
+	Source        string    `json:"source"`
+	InputTokens   int64     `json:"input_tokens"`
+	OutputTokens  int64     `json:"output_tokens"`
+	TotalTokens   int64     `json:"total_tokens"`
+	CostUSD       float64   `json:"cost_usd"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PolicyEvent is a command the command policy blocked or warned about.
+// The task and project are copied from the session when recorded, so the
+// event survives the session's deletion.
+type PolicyEvent struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	TaskID    string `json:"task_id,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// Action is block or warn.
+	Action string `json:"action"`
+	Rule   string `json:"rule"`
+	// Source is the policy layer the rule came from, or "builtin".
+	Source    string    `json:"source,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Command   string    `json:"command"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UsageTotals struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalTokens  int64   `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// UsageGroup is the usage of one session, task, requirement or agent.
+type UsageGroup struct {
+	ID string `json:"id"`
+	UsageTotals
+}
+
+// Budget caps the usage of a project, or of one of its requirements when
+// RequirementID is set. A zero maximum is not enforced.
+type Budget struct {
+	ID            string  `json:"id"`
+	ProjectID     string  `json:"project_id"`
+	RequirementID string  `json:"requirement_id,omitempty"`
+	MaxCostUSD    float64 `json:"max_cost_usd,omitempty"`
+	MaxTokens     int64   `json:"max_tokens,omitempty"`
+	// Action is warn or pause.
+	Action string `json:"action"`
+	// ExceededAt is when the budget's action was taken; zero until then.
+	ExceededAt time.Time `json:"exceeded_at,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type SessionCommand struct {
@@ -218,6 +402,35 @@ type DemandPoolFilter struct {
 	Offset    int
 }
 
+type TranscriptFilter struct {
+	Query     string
+	ProjectID string
+	TaskID    string
+	SessionID string
+	// Context is how many lines before and after each hit are returned.
+	Context int
+	Limit   int
+}
+
+type UsageFilter struct {
+	ProjectID     string
+	RequirementID string
+	TaskID        string
+	SessionID     string
+}
+
+type PolicyEventFilter struct {
+	ProjectID string
+	TaskID    string
+	SessionID string
+	Action    string
+	Rule      string
+	// Since and Until bound created_at when set.
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
 type RequirementFilter struct {
 	ProjectID string
 	Status    string
@@ -277,6 +490,75 @@ func decodeStringSlice(raw string) ([]string, error) {
 	return values, nil
 }
 
+func encodeLimits(l resources.Limits) (string, error) {
+	if l.IsZero() {
+		return "", nil
+	}
+	buf, err := json.Marshal(l)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resource limits: %w", err)
+	}
+	return string(buf), nil
+}
+
+func decodeLimits(raw string) (resources.Limits, error) {
+	var l resources.Limits
+	if raw == "" {
+		return l, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &l); err != nil {
+		return l, fmt.Errorf("failed to decode resource limits: %w", err)
+	}
+	return l, nil
+}
+
+func encodeEnv(env environ.Map) (string, error) {
+	if len(env) == 0 {
+		return "", nil
+	}
+	buf, err := json.Marshal(env)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode env: %w", err)
+	}
+	return string(buf), nil
+}
+
+func decodeEnv(raw string) (environ.Map, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var env environ.Map
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		return nil, fmt.Errorf("failed to decode env: %w", err)
+	}
+	return env, nil
+}
+
+func encodeResponderRules(rules responder.Rules) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	buf, err := json.Marshal(rules)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode responder rules: %w", err)
+	}
+	return string(buf), nil
+}
+
+func decodeResponderRules(raw string) (responder.Rules, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var rules responder.Rules
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode responder rules: %w", err)
+	}
+	if err := rules.Compile(); err != nil {
+		return nil, fmt.Errorf("failed to decode responder rules: %w", err)
+	}
+	return rules, nil
+}
+
 func nullIfEmpty(v string) sql.NullString {
 	if v == "" {
 		return sql.NullString{}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultPolicyEventLimit = 100
+	maxPolicyEventLimit     = 1000
+)
+
+type PolicyEventRepo struct {
+	db *sql.DB
+}
+
+func NewPolicyEventRepo(db *sql.DB) *PolicyEventRepo {
+	return &PolicyEventRepo{db: db}
+}
+
+const policyEventColumns = `id, session_id, task_id, project_id, role, action, rule, source, detail, command, created_at`
+
+func (r *PolicyEventRepo) Create(ctx context.Context, event *PolicyEvent) error {
+	if event == nil {
+		return fmt.Errorf("policy event is required")
+	}
+	if event.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = nowUTC()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO policy_events (`+policyEventColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.ID, event.SessionID, event.TaskID, event.ProjectID, event.Role, event.Action, event.Rule, event.Source,
+		event.Detail, event.Command, formatTimestamp(event.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create policy event: %w", err)
+	}
+	return nil
+}
+
+// List returns the events matching filter, newest first.
+func (r *PolicyEventRepo) List(ctx context.Context, filter PolicyEventFilter) ([]*PolicyEvent, error) {
+	where := []string{}
+	args := []any{}
+	for _, cond := range []struct{ column, value string }{
+		{"project_id", filter.ProjectID},
+		{"task_id", filter.TaskID},
+		{"session_id", filter.SessionID},
+		{"action", filter.Action},
+		{"rule", filter.Rule},
+	} {
+		if cond.value != "" {
+			where = append(where, cond.column+" = ?")
+			args = append(args, cond.value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, formatTimestamp(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at <= ?")
+		args = append(args, formatTimestamp(filter.Until))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPolicyEventLimit
+	}
+	if limit > maxPolicyEventLimit {
+		limit = maxPolicyEventLimit
+	}
+
+	query := `SELECT ` + policyEventColumns + ` FROM policy_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy events: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*PolicyEvent, 0)
+	for rows.Next() {
+		event, err := scanPolicyEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan policy event: %w", err)
+		}
+		out = append(out, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating policy events: %w", err)
+	}
+	return out, nil
+}
+
+func scanPolicyEvent(row rowScanner) (*PolicyEvent, error) {
+	var event PolicyEvent
+	var createdAtRaw string
+	if err := row.Scan(&event.ID, &event.SessionID, &event.TaskID, &event.ProjectID, &event.Role, &event.Action,
+		&event.Rule, &event.Source, &event.Detail, &event.Command, &createdAtRaw); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTimestamp(createdAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	event.CreatedAt = createdAt
+	return &event, nil
+}
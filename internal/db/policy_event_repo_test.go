@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPolicyEventRepoListFilters(t *testing.T) {
+	database, _ := openTestDB(t)
+	repo := NewPolicyEventRepo(database.SQL())
+	ctx := context.Background()
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []*PolicyEvent{
+		{SessionID: "s1", TaskID: "t1", ProjectID: "p1", Action: "block", Rule: "no_eval", Command: "eval x", CreatedAt: base},
+		{SessionID: "s1", TaskID: "t1", ProjectID: "p1", Action: "warn", Rule: "npm-publish", Source: "project", Command: "npm publish", CreatedAt: base.Add(time.Minute)},
+		{SessionID: "s2", TaskID: "t2", ProjectID: "p1", Action: "block", Rule: "no_eval", Command: "eval y", CreatedAt: base.Add(2 * time.Minute)},
+		{SessionID: "s3", ProjectID: "p2", Action: "block", Rule: "no_eval", Command: "eval z", CreatedAt: base.Add(3 * time.Minute)},
+	}
+	for _, event := range events {
+		if err := repo.Create(ctx, event); err != nil {
+			t.Fatalf("create policy event: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		filter PolicyEventFilter
+		want   []string
+	}{
+		{"project newest first", PolicyEventFilter{ProjectID: "p1"}, []string{"eval y", "npm publish", "eval x"}},
+		{"action", PolicyEventFilter{ProjectID: "p1", Action: "warn"}, []string{"npm publish"}},
+		{"rule and session", PolicyEventFilter{Rule: "no_eval", SessionID: "s1"}, []string{"eval x"}},
+		{"task", PolicyEventFilter{TaskID: "t2"}, []string{"eval y"}},
+		{"time range", PolicyEventFilter{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, []string{"eval y", "npm publish"}},
+		{"limit", PolicyEventFilter{Limit: 1}, []string{"eval z"}},
+	}
+	for _, tc := range cases {
+		got, err := repo.List(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: list: %v", tc.name, err)
+		}
+		var commands []string
+		for _, event := range got {
+			commands = append(commands, event.Command)
+		}
+		if len(commands) != len(tc.want) {
+			t.Fatalf("%s: commands=%v want %v", tc.name, commands, tc.want)
+		}
+		for i := range commands {
+			if commands[i] != tc.want[i] {
+				t.Fatalf("%s: commands=%v want %v", tc.name, commands, tc.want)
+			}
+		}
+	}
+	got, _ := repo.List(ctx, PolicyEventFilter{Action: "warn"})
+	if got[0].Source != "project" || !got[0].CreatedAt.Equal(base.Add(time.Minute)) {
+		t.Fatalf("event=%+v", got[0])
+	}
+}
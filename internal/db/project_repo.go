@@ -30,10 +30,23 @@ func (r *ProjectRepo) Create(ctx context.Context, project *Project) error {
 		project.UpdatedAt = project.CreatedAt
 	}
 
-	_, err := r.db.ExecContext(ctx, `
-INSERT INTO projects (id, name, repo_path, status, playbook, context_template, knowledge, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-`, project.ID, project.Name, project.RepoPath, project.Status, project.Playbook, project.ContextTemplate, project.Knowledge, formatTimestamp(project.CreatedAt), formatTimestamp(project.UpdatedAt))
+	limitsRaw, err := encodeLimits(project.ResourceLimits)
+	if err != nil {
+		return err
+	}
+	envRaw, err := encodeEnv(project.Env)
+	if err != nil {
+		return err
+	}
+	rulesRaw, err := encodeResponderRules(project.ResponderRules)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+INSERT INTO projects (id, name, repo_path, status, playbook, context_template, knowledge, resource_limits, env, responder_rules, auto_schedule, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, project.ID, project.Name, project.RepoPath, project.Status, project.Playbook, project.ContextTemplate, project.Knowledge, limitsRaw, envRaw, rulesRaw, boolToInt(project.AutoSchedule), formatTimestamp(project.CreatedAt), formatTimestamp(project.UpdatedAt))
 	if err != nil {
 		return fmt.Errorf("failed to create project: %w", err)
 	}
@@ -42,13 +55,15 @@ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 
 func (r *ProjectRepo) Get(ctx context.Context, id string) (*Project, error) {
 	var p Project
+	var limitsRaw, envRaw, rulesRaw sql.NullString
+	var autoSchedule int
 	var createdAtRaw, updatedAtRaw string
 
 	err := r.db.QueryRowContext(ctx, `
-SELECT id, name, repo_path, status, playbook, context_template, knowledge, created_at, updated_at
+SELECT id, name, repo_path, status, playbook, context_template, knowledge, resource_limits, env, responder_rules, auto_schedule, created_at, updated_at
 FROM projects
 WHERE id = ?
-`, id).Scan(&p.ID, &p.Name, &p.RepoPath, &p.Status, &p.Playbook, &p.ContextTemplate, &p.Knowledge, &createdAtRaw, &updatedAtRaw)
+`, id).Scan(&p.ID, &p.Name, &p.RepoPath, &p.Status, &p.Playbook, &p.ContextTemplate, &p.Knowledge, &limitsRaw, &envRaw, &rulesRaw, &autoSchedule, &createdAtRaw, &updatedAtRaw)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -56,6 +71,19 @@ WHERE id = ?
 		return nil, fmt.Errorf("failed to get project %q: %w", id, err)
 	}
 
+	p.AutoSchedule = autoSchedule != 0
+	p.ResourceLimits, err = decodeLimits(limitsRaw.String)
+	if err != nil {
+		return nil, err
+	}
+	p.Env, err = decodeEnv(envRaw.String)
+	if err != nil {
+		return nil, err
+	}
+	p.ResponderRules, err = decodeResponderRules(rulesRaw.String)
+	if err != nil {
+		return nil, err
+	}
 	p.CreatedAt, err = parseTimestamp(createdAtRaw)
 	if err != nil {
 		return nil, err
@@ -69,7 +97,7 @@ WHERE id = ?
 }
 
 func (r *ProjectRepo) List(ctx context.Context, filter ProjectFilter) ([]*Project, error) {
-	query := `SELECT id, name, repo_path, status, playbook, context_template, knowledge, created_at, updated_at FROM projects`
+	query := `SELECT id, name, repo_path, status, playbook, context_template, knowledge, resource_limits, env, responder_rules, auto_schedule, created_at, updated_at FROM projects`
 	args := []any{}
 	where := []string{}
 	if filter.Status != "" {
@@ -90,10 +118,25 @@ func (r *ProjectRepo) List(ctx context.Context, filter ProjectFilter) ([]*Projec
 	projects := []*Project{}
 	for rows.Next() {
 		var p Project
+		var limitsRaw, envRaw, rulesRaw sql.NullString
+		var autoSchedule int
 		var createdAtRaw, updatedAtRaw string
-		if err := rows.Scan(&p.ID, &p.Name, &p.RepoPath, &p.Status, &p.Playbook, &p.ContextTemplate, &p.Knowledge, &createdAtRaw, &updatedAtRaw); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.RepoPath, &p.Status, &p.Playbook, &p.ContextTemplate, &p.Knowledge, &limitsRaw, &envRaw, &rulesRaw, &autoSchedule, &createdAtRaw, &updatedAtRaw); err != nil {
 			return nil, fmt.Errorf("failed to scan project: %w", err)
 		}
+		p.AutoSchedule = autoSchedule != 0
+		p.ResourceLimits, err = decodeLimits(limitsRaw.String)
+		if err != nil {
+			return nil, err
+		}
+		p.Env, err = decodeEnv(envRaw.String)
+		if err != nil {
+			return nil, err
+		}
+		p.ResponderRules, err = decodeResponderRules(rulesRaw.String)
+		if err != nil {
+			return nil, err
+		}
 		p.CreatedAt, err = parseTimestamp(createdAtRaw)
 		if err != nil {
 			return nil, err
@@ -117,12 +160,24 @@ func (r *ProjectRepo) ListByStatus(ctx context.Context, status string) ([]*Proje
 }
 
 func (r *ProjectRepo) Update(ctx context.Context, project *Project) error {
+	limitsRaw, err := encodeLimits(project.ResourceLimits)
+	if err != nil {
+		return err
+	}
+	envRaw, err := encodeEnv(project.Env)
+	if err != nil {
+		return err
+	}
+	rulesRaw, err := encodeResponderRules(project.ResponderRules)
+	if err != nil {
+		return err
+	}
 	project.UpdatedAt = nowUTC()
 	res, err := r.db.ExecContext(ctx, `
 UPDATE projects
-SET name = ?, repo_path = ?, status = ?, playbook = ?, context_template = ?, knowledge = ?, updated_at = ?
+SET name = ?, repo_path = ?, status = ?, playbook = ?, context_template = ?, knowledge = ?, resource_limits = ?, env = ?, responder_rules = ?, auto_schedule = ?, updated_at = ?
 WHERE id = ?
-`, project.Name, project.RepoPath, project.Status, project.Playbook, project.ContextTemplate, project.Knowledge, formatTimestamp(project.UpdatedAt), project.ID)
+`, project.Name, project.RepoPath, project.Status, project.Playbook, project.ContextTemplate, project.Knowledge, limitsRaw, envRaw, rulesRaw, boolToInt(project.AutoSchedule), formatTimestamp(project.UpdatedAt), project.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update project %q: %w", project.ID, err)
 	}
@@ -56,50 +56,21 @@ INSERT INTO session_commands (
 	return nil
 }
 
+const sessionCommandColumns = `id, session_id, op, payload_json, status, result_json, error, created_at, sent_at, acked_at, completed_at`
+
 func (r *SessionCommandRepo) Get(ctx context.Context, id string) (*SessionCommand, error) {
-	var cmd SessionCommand
-	var createdAtRaw, sentAtRaw, ackedAtRaw, completedAtRaw string
-	err := r.db.QueryRowContext(ctx, `
-SELECT id, session_id, op, payload_json, status, result_json, error, created_at, sent_at, acked_at, completed_at
+	cmd, err := scanSessionCommand(r.db.QueryRowContext(ctx, `
+SELECT `+sessionCommandColumns+`
 FROM session_commands
 WHERE id = ?
-`, id).Scan(
-		&cmd.ID,
-		&cmd.SessionID,
-		&cmd.Op,
-		&cmd.PayloadJSON,
-		&cmd.Status,
-		&cmd.ResultJSON,
-		&cmd.Error,
-		&createdAtRaw,
-		&sentAtRaw,
-		&ackedAtRaw,
-		&completedAtRaw,
-	)
+`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get session command %q: %w", id, err)
 	}
-	var parseErr error
-	cmd.CreatedAt, parseErr = parseTimestamp(createdAtRaw)
-	if parseErr != nil {
-		return nil, parseErr
-	}
-	cmd.SentAt, parseErr = parseOptionalTimestamp(sentAtRaw)
-	if parseErr != nil {
-		return nil, parseErr
-	}
-	cmd.AckedAt, parseErr = parseOptionalTimestamp(ackedAtRaw)
-	if parseErr != nil {
-		return nil, parseErr
-	}
-	cmd.CompletedAt, parseErr = parseOptionalTimestamp(completedAtRaw)
-	if parseErr != nil {
-		return nil, parseErr
-	}
-	return &cmd, nil
+	return cmd, nil
 }
 
 func (r *SessionCommandRepo) ListBySession(ctx context.Context, sessionID string, limit int) ([]*SessionCommand, error) {
@@ -110,7 +81,7 @@ func (r *SessionCommandRepo) ListBySession(ctx context.Context, sessionID string
 		limit = 500
 	}
 	rows, err := r.db.QueryContext(ctx, `
-SELECT id, session_id, op, payload_json, status, result_json, error, created_at, sent_at, acked_at, completed_at
+SELECT `+sessionCommandColumns+`
 FROM session_commands
 WHERE session_id = ?
 ORDER BY created_at DESC
@@ -119,45 +90,33 @@ LIMIT ?
 	if err != nil {
 		return nil, fmt.Errorf("failed to list session commands: %w", err)
 	}
-	defer rows.Close()
+	return collectSessionCommands(rows)
+}
+
+// ListByStatus returns the commands in a status across sessions, oldest
+// first.
+func (r *SessionCommandRepo) ListByStatus(ctx context.Context, status string) ([]*SessionCommand, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT `+sessionCommandColumns+`
+FROM session_commands
+WHERE status = ?
+ORDER BY created_at ASC, rowid ASC
+`, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session commands: %w", err)
+	}
+	return collectSessionCommands(rows)
+}
 
-	out := make([]*SessionCommand, 0, limit)
+func collectSessionCommands(rows *sql.Rows) ([]*SessionCommand, error) {
+	defer rows.Close()
+	out := make([]*SessionCommand, 0)
 	for rows.Next() {
-		var cmd SessionCommand
-		var createdAtRaw, sentAtRaw, ackedAtRaw, completedAtRaw string
-		if err := rows.Scan(
-			&cmd.ID,
-			&cmd.SessionID,
-			&cmd.Op,
-			&cmd.PayloadJSON,
-			&cmd.Status,
-			&cmd.ResultJSON,
-			&cmd.Error,
-			&createdAtRaw,
-			&sentAtRaw,
-			&ackedAtRaw,
-			&completedAtRaw,
-		); err != nil {
+		cmd, err := scanSessionCommand(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan session command: %w", err)
 		}
-		var parseErr error
-		cmd.CreatedAt, parseErr = parseTimestamp(createdAtRaw)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		cmd.SentAt, parseErr = parseOptionalTimestamp(sentAtRaw)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		cmd.AckedAt, parseErr = parseOptionalTimestamp(ackedAtRaw)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		cmd.CompletedAt, parseErr = parseOptionalTimestamp(completedAtRaw)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		out = append(out, &cmd)
+		out = append(out, cmd)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed while iterating session commands: %w", err)
@@ -165,6 +124,44 @@ LIMIT ?
 	return out, nil
 }
 
+func scanSessionCommand(row rowScanner) (*SessionCommand, error) {
+	var cmd SessionCommand
+	var createdAtRaw, sentAtRaw, ackedAtRaw, completedAtRaw string
+	if err := row.Scan(
+		&cmd.ID,
+		&cmd.SessionID,
+		&cmd.Op,
+		&cmd.PayloadJSON,
+		&cmd.Status,
+		&cmd.ResultJSON,
+		&cmd.Error,
+		&createdAtRaw,
+		&sentAtRaw,
+		&ackedAtRaw,
+		&completedAtRaw,
+	); err != nil {
+		return nil, err
+	}
+	var parseErr error
+	cmd.CreatedAt, parseErr = parseTimestamp(createdAtRaw)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	cmd.SentAt, parseErr = parseOptionalTimestamp(sentAtRaw)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	cmd.AckedAt, parseErr = parseOptionalTimestamp(ackedAtRaw)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	cmd.CompletedAt, parseErr = parseOptionalTimestamp(completedAtRaw)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return &cmd, nil
+}
+
 func (r *SessionCommandRepo) Update(ctx context.Context, cmd *SessionCommand) error {
 	if cmd == nil {
 		return fmt.Errorf("session command is required")
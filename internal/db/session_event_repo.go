@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type SessionEventRepo struct {
+	db *sql.DB
+}
+
+func NewSessionEventRepo(db *sql.DB) *SessionEventRepo {
+	return &SessionEventRepo{db: db}
+}
+
+const sessionEventColumns = `id, session_id, kind, rule, action, detail, created_at`
+
+func (r *SessionEventRepo) Create(ctx context.Context, event *SessionEvent) error {
+	if event == nil {
+		return fmt.Errorf("session event is required")
+	}
+	if event.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = nowUTC()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO session_events (`+sessionEventColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.ID, event.SessionID, event.Kind, event.Rule, event.Action, event.Detail, formatTimestamp(event.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create session event: %w", err)
+	}
+	return nil
+}
+
+// ListBySession returns a session's events, oldest first.
+func (r *SessionEventRepo) ListBySession(ctx context.Context, sessionID string) ([]*SessionEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+sessionEventColumns+` FROM session_events WHERE session_id = ? ORDER BY created_at ASC, rowid ASC`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session events: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*SessionEvent, 0)
+	for rows.Next() {
+		event, err := scanSessionEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session event: %w", err)
+		}
+		out = append(out, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating session events: %w", err)
+	}
+	return out, nil
+}
+
+func scanSessionEvent(row rowScanner) (*SessionEvent, error) {
+	var event SessionEvent
+	var createdAtRaw string
+	if err := row.Scan(&event.ID, &event.SessionID, &event.Kind, &event.Rule, &event.Action, &event.Detail, &createdAtRaw); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTimestamp(createdAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	event.CreatedAt = createdAt
+	return &event, nil
+}
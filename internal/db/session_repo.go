@@ -31,9 +31,9 @@ func (r *SessionRepo) Create(ctx context.Context, session *Session) error {
 	}
 
 	_, err := r.db.ExecContext(ctx, `
-INSERT INTO sessions (id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, created_at, last_activity_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-`, session.ID, nullIfEmpty(session.TaskID), session.TmuxSessionName, session.TmuxWindowID, session.AgentType, session.Role, session.Status, boolToInt(session.HumanAttached), formatTimestamp(session.CreatedAt), formatTimestamp(session.LastActivityAt))
+INSERT INTO sessions (id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, agent_session_id, created_at, last_activity_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, session.ID, nullIfEmpty(session.TaskID), session.TmuxSessionName, session.TmuxWindowID, session.AgentType, session.Role, session.Status, boolToInt(session.HumanAttached), session.AgentSessionID, formatTimestamp(session.CreatedAt), formatTimestamp(session.LastActivityAt))
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
@@ -42,39 +42,18 @@ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 }
 
 func (r *SessionRepo) Get(ctx context.Context, id string) (*Session, error) {
-	var s Session
-	var taskID sql.NullString
-	var humanAttachedInt int
-	var createdAtRaw, lastActivityAtRaw string
-
-	err := r.db.QueryRowContext(ctx, `
-SELECT id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, created_at, last_activity_at
-FROM sessions
-WHERE id = ?
-`, id).Scan(&s.ID, &taskID, &s.TmuxSessionName, &s.TmuxWindowID, &s.AgentType, &s.Role, &s.Status, &humanAttachedInt, &createdAtRaw, &lastActivityAtRaw)
+	s, err := scanSession(r.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get session %q: %w", id, err)
 	}
-
-	s.TaskID = taskID.String
-	s.HumanAttached = humanAttachedInt != 0
-	s.CreatedAt, err = parseTimestamp(createdAtRaw)
-	if err != nil {
-		return nil, err
-	}
-	s.LastActivityAt, err = parseTimestamp(lastActivityAtRaw)
-	if err != nil {
-		return nil, err
-	}
-
-	return &s, nil
+	return s, nil
 }
 
 func (r *SessionRepo) List(ctx context.Context, filter SessionFilter) ([]*Session, error) {
-	query := `SELECT id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, created_at, last_activity_at FROM sessions`
+	query := `SELECT ` + sessionColumns + ` FROM sessions`
 	args := []any{}
 	where := []string{}
 
@@ -99,24 +78,11 @@ func (r *SessionRepo) List(ctx context.Context, filter SessionFilter) ([]*Sessio
 
 	sessions := []*Session{}
 	for rows.Next() {
-		var s Session
-		var taskID sql.NullString
-		var humanAttachedInt int
-		var createdAtRaw, lastActivityAtRaw string
-		if err := rows.Scan(&s.ID, &taskID, &s.TmuxSessionName, &s.TmuxWindowID, &s.AgentType, &s.Role, &s.Status, &humanAttachedInt, &createdAtRaw, &lastActivityAtRaw); err != nil {
-			return nil, fmt.Errorf("failed to scan session: %w", err)
-		}
-		s.TaskID = taskID.String
-		s.HumanAttached = humanAttachedInt != 0
-		s.CreatedAt, err = parseTimestamp(createdAtRaw)
+		s, err := scanSession(rows)
 		if err != nil {
-			return nil, err
-		}
-		s.LastActivityAt, err = parseTimestamp(lastActivityAtRaw)
-		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
-		sessions = append(sessions, &s)
+		sessions = append(sessions, s)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -132,7 +98,7 @@ func (r *SessionRepo) ListByTask(ctx context.Context, taskID string) ([]*Session
 
 func (r *SessionRepo) ListActive(ctx context.Context) ([]*Session, error) {
 	rows, err := r.db.QueryContext(ctx, `
-SELECT id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, created_at, last_activity_at
+SELECT `+sessionColumns+`
 FROM sessions
 WHERE status NOT IN ('completed', 'terminated', 'failed')
 ORDER BY created_at DESC
@@ -144,24 +110,11 @@ ORDER BY created_at DESC
 
 	sessions := []*Session{}
 	for rows.Next() {
-		var s Session
-		var taskID sql.NullString
-		var humanAttachedInt int
-		var createdAtRaw, lastActivityAtRaw string
-		if err := rows.Scan(&s.ID, &taskID, &s.TmuxSessionName, &s.TmuxWindowID, &s.AgentType, &s.Role, &s.Status, &humanAttachedInt, &createdAtRaw, &lastActivityAtRaw); err != nil {
-			return nil, fmt.Errorf("failed to scan active session: %w", err)
-		}
-		s.TaskID = taskID.String
-		s.HumanAttached = humanAttachedInt != 0
-		s.CreatedAt, err = parseTimestamp(createdAtRaw)
-		if err != nil {
-			return nil, err
-		}
-		s.LastActivityAt, err = parseTimestamp(lastActivityAtRaw)
+		s, err := scanSession(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan active session: %w", err)
 		}
-		sessions = append(sessions, &s)
+		sessions = append(sessions, s)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -175,9 +128,9 @@ func (r *SessionRepo) Update(ctx context.Context, session *Session) error {
 	session.LastActivityAt = nowUTC()
 	res, err := r.db.ExecContext(ctx, `
 UPDATE sessions
-SET task_id = ?, tmux_session_name = ?, tmux_window_id = ?, agent_type = ?, role = ?, status = ?, human_attached = ?, last_activity_at = ?
+SET task_id = ?, tmux_session_name = ?, tmux_window_id = ?, agent_type = ?, role = ?, status = ?, suspended_status = ?, human_attached = ?, last_activity_at = ?
 WHERE id = ?
-`, nullIfEmpty(session.TaskID), session.TmuxSessionName, session.TmuxWindowID, session.AgentType, session.Role, session.Status, boolToInt(session.HumanAttached), formatTimestamp(session.LastActivityAt), session.ID)
+`, nullIfEmpty(session.TaskID), session.TmuxSessionName, session.TmuxWindowID, session.AgentType, session.Role, session.Status, session.SuspendedStatus, boolToInt(session.HumanAttached), formatTimestamp(session.LastActivityAt), session.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update session %q: %w", session.ID, err)
 	}
@@ -191,6 +144,88 @@ WHERE id = ?
 	return nil
 }
 
+// SetExit records how the session's agent process ended. A nil exit clears
+// it, e.g. when the session is resumed.
+func (r *SessionRepo) SetExit(ctx context.Context, id string, exit *SessionExit) error {
+	var code sql.NullInt64
+	var signal, reason, exitedAt string
+	if exit != nil {
+		if exit.Code != nil {
+			code = sql.NullInt64{Int64: int64(*exit.Code), Valid: true}
+		}
+		signal, reason, exitedAt = exit.Signal, exit.Reason, formatTimestamp(exit.At)
+	}
+	res, err := r.db.ExecContext(ctx, `
+UPDATE sessions
+SET exit_code = ?, exit_signal = ?, exit_reason = ?, exited_at = ?
+WHERE id = ?
+`, code, signal, reason, exitedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to set exit of session %q: %w", id, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read updated rows for session %q: %w", id, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("session %q not found", id)
+	}
+	return nil
+}
+
+// SetAgentSessionID records the agent's own ID for the session's
+// conversation.
+func (r *SessionRepo) SetAgentSessionID(ctx context.Context, id, agentSessionID string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET agent_session_id = ? WHERE id = ?`, agentSessionID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set agent session id of session %q: %w", id, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read updated rows for session %q: %w", id, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("session %q not found", id)
+	}
+	return nil
+}
+
+// SetTakeoverLease records the takeover lease of a session; nil clears it.
+func (r *SessionRepo) SetTakeoverLease(ctx context.Context, id string, lease *TakeoverLease) error {
+	var owner, acquiredAt, heartbeatAt, expiresAt string
+	if lease != nil {
+		owner = lease.Owner
+		acquiredAt = formatTimestamp(lease.AcquiredAt)
+		heartbeatAt = formatTimestamp(lease.HeartbeatAt)
+		expiresAt = formatTimestampOrEmpty(lease.ExpiresAt)
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET takeover_owner = ?, takeover_acquired_at = ?, takeover_heartbeat_at = ?, takeover_expires_at = ? WHERE id = ?`,
+		owner, acquiredAt, heartbeatAt, expiresAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to set takeover lease of session %q: %w", id, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read updated rows for session %q: %w", id, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("session %q not found", id)
+	}
+	return nil
+}
+
+// AgentSessionIDTaken reports whether another session of agentType already
+// owns agentSessionID.
+func (r *SessionRepo) AgentSessionIDTaken(ctx context.Context, agentType, agentSessionID, exceptID string) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE agent_type = ? AND agent_session_id = ? AND id != ?`,
+		agentType, agentSessionID, exceptID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up agent session id %q: %w", agentSessionID, err)
+	}
+	return n > 0, nil
+}
+
 func (r *SessionRepo) Delete(ctx context.Context, id string) error {
 	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
 	if err != nil {
@@ -199,6 +234,64 @@ func (r *SessionRepo) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+const sessionColumns = `id, task_id, tmux_session_name, tmux_window_id, agent_type, role, status, human_attached, created_at, last_activity_at, exit_code, exit_signal, exit_reason, exited_at, agent_session_id, takeover_owner, takeover_acquired_at, takeover_heartbeat_at, takeover_expires_at, suspended_status`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var s Session
+	var taskID, exitSignal, exitReason, exitedAtRaw, agentSessionID sql.NullString
+	var takeoverOwner, takeoverAcquiredAt, takeoverHeartbeatAt, takeoverExpiresAt, suspendedStatus sql.NullString
+	var exitCode sql.NullInt64
+	var humanAttachedInt int
+	var createdAtRaw, lastActivityAtRaw string
+	err := row.Scan(&s.ID, &taskID, &s.TmuxSessionName, &s.TmuxWindowID, &s.AgentType, &s.Role, &s.Status, &humanAttachedInt, &createdAtRaw, &lastActivityAtRaw, &exitCode, &exitSignal, &exitReason, &exitedAtRaw, &agentSessionID,
+		&takeoverOwner, &takeoverAcquiredAt, &takeoverHeartbeatAt, &takeoverExpiresAt, &suspendedStatus)
+	if err != nil {
+		return nil, err
+	}
+	s.TaskID = taskID.String
+	s.AgentSessionID = agentSessionID.String
+	s.SuspendedStatus = suspendedStatus.String
+	s.HumanAttached = humanAttachedInt != 0
+	s.CreatedAt, err = parseTimestamp(createdAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	s.LastActivityAt, err = parseTimestamp(lastActivityAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	if exitedAtRaw.String != "" {
+		exit := &SessionExit{Signal: exitSignal.String, Reason: exitReason.String}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			exit.Code = &code
+		}
+		exit.At, err = parseTimestamp(exitedAtRaw.String)
+		if err != nil {
+			return nil, err
+		}
+		s.Exit = exit
+	}
+	if takeoverOwner.String != "" {
+		lease := &TakeoverLease{Owner: takeoverOwner.String}
+		if lease.AcquiredAt, err = parseTimestamp(takeoverAcquiredAt.String); err != nil {
+			return nil, err
+		}
+		if lease.HeartbeatAt, err = parseTimestamp(takeoverHeartbeatAt.String); err != nil {
+			return nil, err
+		}
+		if lease.ExpiresAt, err = parseOptionalTimestamp(takeoverExpiresAt.String); err != nil {
+			return nil, err
+		}
+		s.Takeover = lease
+	}
+	return &s, nil
+}
+
 func boolToInt(v bool) int {
 	if v {
 		return 1
@@ -34,11 +34,15 @@ func (r *TaskRepo) Create(ctx context.Context, task *Task) error {
 	if err != nil {
 		return err
 	}
+	envRaw, err := encodeEnv(task.Env)
+	if err != nil {
+		return err
+	}
 
 	_, err = r.db.ExecContext(ctx, `
-INSERT INTO tasks (id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-`, task.ID, task.ProjectID, task.Title, task.Description, task.Status, dependsOnRaw, task.WorktreeID, task.SpecPath, task.RequirementID, formatTimestamp(task.CreatedAt), formatTimestamp(task.UpdatedAt))
+INSERT INTO tasks (id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, env, agent_type, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, task.ID, task.ProjectID, task.Title, task.Description, task.Status, dependsOnRaw, task.WorktreeID, task.SpecPath, task.RequirementID, envRaw, task.AgentType, formatTimestamp(task.CreatedAt), formatTimestamp(task.UpdatedAt))
 	if err != nil {
 		return fmt.Errorf("failed to create task: %w", err)
 	}
@@ -49,12 +53,13 @@ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 func (r *TaskRepo) Get(ctx context.Context, id string) (*Task, error) {
 	var t Task
 	var dependsOnRaw, createdAtRaw, updatedAtRaw string
+	var envRaw, agentType sql.NullString
 
 	err := r.db.QueryRowContext(ctx, `
-SELECT id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, created_at, updated_at
+SELECT id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, env, agent_type, created_at, updated_at
 FROM tasks
 WHERE id = ?
-`, id).Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &dependsOnRaw, &t.WorktreeID, &t.SpecPath, &t.RequirementID, &createdAtRaw, &updatedAtRaw)
+`, id).Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &dependsOnRaw, &t.WorktreeID, &t.SpecPath, &t.RequirementID, &envRaw, &agentType, &createdAtRaw, &updatedAtRaw)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -66,6 +71,11 @@ WHERE id = ?
 	if err != nil {
 		return nil, err
 	}
+	t.Env, err = decodeEnv(envRaw.String)
+	if err != nil {
+		return nil, err
+	}
+	t.AgentType = agentType.String
 	t.CreatedAt, err = parseTimestamp(createdAtRaw)
 	if err != nil {
 		return nil, err
@@ -79,7 +89,7 @@ WHERE id = ?
 }
 
 func (r *TaskRepo) List(ctx context.Context, filter TaskFilter) ([]*Task, error) {
-	query := `SELECT id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, created_at, updated_at FROM tasks`
+	query := `SELECT id, project_id, title, description, status, depends_on, worktree_id, spec_path, requirement_id, env, agent_type, created_at, updated_at FROM tasks`
 	args := []any{}
 	where := []string{}
 
@@ -106,13 +116,19 @@ func (r *TaskRepo) List(ctx context.Context, filter TaskFilter) ([]*Task, error)
 	for rows.Next() {
 		var t Task
 		var dependsOnRaw, createdAtRaw, updatedAtRaw string
-		if err := rows.Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &dependsOnRaw, &t.WorktreeID, &t.SpecPath, &t.RequirementID, &createdAtRaw, &updatedAtRaw); err != nil {
+		var envRaw, agentType sql.NullString
+		if err := rows.Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &dependsOnRaw, &t.WorktreeID, &t.SpecPath, &t.RequirementID, &envRaw, &agentType, &createdAtRaw, &updatedAtRaw); err != nil {
 			return nil, fmt.Errorf("failed to scan task: %w", err)
 		}
 		t.DependsOn, err = decodeStringSlice(dependsOnRaw)
 		if err != nil {
 			return nil, err
 		}
+		t.Env, err = decodeEnv(envRaw.String)
+		if err != nil {
+			return nil, err
+		}
+		t.AgentType = agentType.String
 		t.CreatedAt, err = parseTimestamp(createdAtRaw)
 		if err != nil {
 			return nil, err
@@ -145,11 +161,15 @@ func (r *TaskRepo) Update(ctx context.Context, task *Task) error {
 	if err != nil {
 		return err
 	}
+	envRaw, err := encodeEnv(task.Env)
+	if err != nil {
+		return err
+	}
 	res, err := r.db.ExecContext(ctx, `
 UPDATE tasks
-SET project_id = ?, title = ?, description = ?, status = ?, depends_on = ?, worktree_id = ?, spec_path = ?, requirement_id = ?, updated_at = ?
+SET project_id = ?, title = ?, description = ?, status = ?, depends_on = ?, worktree_id = ?, spec_path = ?, requirement_id = ?, env = ?, agent_type = ?, updated_at = ?
 WHERE id = ?
-`, task.ProjectID, task.Title, task.Description, task.Status, dependsOnRaw, task.WorktreeID, task.SpecPath, task.RequirementID, formatTimestamp(task.UpdatedAt), task.ID)
+`, task.ProjectID, task.Title, task.Description, task.Status, dependsOnRaw, task.WorktreeID, task.SpecPath, task.RequirementID, envRaw, task.AgentType, formatTimestamp(task.UpdatedAt), task.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update task %q: %w", task.ID, err)
 	}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultTranscriptSearchLimit = 50
+	maxTranscriptSearchLimit     = 500
+	maxTranscriptContext         = 20
+)
+
+type TranscriptRepo struct {
+	db *sql.DB
+}
+
+func NewTranscriptRepo(db *sql.DB) *TranscriptRepo {
+	return &TranscriptRepo{db: db}
+}
+
+const transcriptColumns = `session_id, seq, text, class, created_at`
+
+// Append stores entries at the end of their sessions' transcripts, setting
+// each entry's Seq.
+func (r *TranscriptRepo) Append(ctx context.Context, entries []*TranscriptEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transcript transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	next := make(map[string]int64)
+	for _, entry := range entries {
+		seq, ok := next[entry.SessionID]
+		if !ok {
+			if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM session_transcripts WHERE session_id = ?`, entry.SessionID).Scan(&seq); err != nil {
+				return fmt.Errorf("failed to read transcript sequence of session %q: %w", entry.SessionID, err)
+			}
+		}
+		seq++
+		next[entry.SessionID] = seq
+		entry.Seq = seq
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = nowUTC()
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO session_transcripts (`+transcriptColumns+`) VALUES (?, ?, ?, ?, ?)`,
+			entry.SessionID, entry.Seq, entry.Text, entry.Class, formatTimestamp(entry.CreatedAt)); err != nil {
+			return fmt.Errorf("failed to append transcript of session %q: %w", entry.SessionID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transcript entries: %w", err)
+	}
+	return nil
+}
+
+// ListBySession returns up to limit entries of a session's transcript after
+// the given sequence number, oldest first.
+func (r *TranscriptRepo) ListBySession(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]*TranscriptEntry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	return r.list(ctx, `SELECT `+transcriptColumns+` FROM session_transcripts WHERE session_id = ? AND seq > ? ORDER BY seq ASC LIMIT ?`, sessionID, afterSeq, limit)
+}
+
+// Search returns the entries matching every term of filter.Query, newest
+// first, each with up to filter.Context lines on either side.
+func (r *TranscriptRepo) Search(ctx context.Context, filter TranscriptFilter) ([]*TranscriptHit, error) {
+	match := transcriptMatchQuery(filter.Query)
+	if match == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+	query := `
+SELECT t.session_id, t.seq, t.text, t.class, t.created_at,
+       COALESCE(s.task_id, ''), COALESCE(k.project_id, ''), s.agent_type, s.role
+FROM session_transcripts_fts f
+JOIN session_transcripts t ON t.id = f.rowid
+JOIN sessions s ON s.id = t.session_id
+LEFT JOIN tasks k ON k.id = s.task_id
+WHERE session_transcripts_fts MATCH ?`
+	args := []any{match}
+	if filter.ProjectID != "" {
+		query += " AND k.project_id = ?"
+		args = append(args, filter.ProjectID)
+	}
+	if filter.TaskID != "" {
+		query += " AND s.task_id = ?"
+		args = append(args, filter.TaskID)
+	}
+	if filter.SessionID != "" {
+		query += " AND t.session_id = ?"
+		args = append(args, filter.SessionID)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultTranscriptSearchLimit
+	}
+	if limit > maxTranscriptSearchLimit {
+		limit = maxTranscriptSearchLimit
+	}
+	query += " ORDER BY t.created_at DESC, t.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transcripts: %w", err)
+	}
+	hits := make([]*TranscriptHit, 0)
+	for rows.Next() {
+		var hit TranscriptHit
+		var createdAtRaw string
+		if err := rows.Scan(&hit.SessionID, &hit.Seq, &hit.Text, &hit.Class, &createdAtRaw,
+			&hit.TaskID, &hit.ProjectID, &hit.AgentType, &hit.Role); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan transcript hit: %w", err)
+		}
+		if hit.CreatedAt, err = parseTimestamp(createdAtRaw); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan transcript hit: %w", err)
+		}
+		hits = append(hits, &hit)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed while iterating transcript hits: %w", err)
+	}
+	rows.Close()
+
+	n := filter.Context
+	if n > maxTranscriptContext {
+		n = maxTranscriptContext
+	}
+	for _, hit := range hits {
+		hit.Before, hit.After = []*TranscriptEntry{}, []*TranscriptEntry{}
+		if n <= 0 {
+			continue
+		}
+		around, err := r.list(ctx, `SELECT `+transcriptColumns+` FROM session_transcripts WHERE session_id = ? AND seq BETWEEN ? AND ? ORDER BY seq ASC`,
+			hit.SessionID, hit.Seq-int64(n), hit.Seq+int64(n))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range around {
+			switch {
+			case entry.Seq < hit.Seq:
+				hit.Before = append(hit.Before, entry)
+			case entry.Seq > hit.Seq:
+				hit.After = append(hit.After, entry)
+			}
+		}
+	}
+	return hits, nil
+}
+
+func (r *TranscriptRepo) list(ctx context.Context, query string, args ...any) ([]*TranscriptEntry, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transcript entries: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*TranscriptEntry, 0)
+	for rows.Next() {
+		entry, err := scanTranscriptEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transcript entry: %w", err)
+		}
+		out = append(out, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating transcript entries: %w", err)
+	}
+	return out, nil
+}
+
+func scanTranscriptEntry(row rowScanner) (*TranscriptEntry, error) {
+	var entry TranscriptEntry
+	var createdAtRaw string
+	if err := row.Scan(&entry.SessionID, &entry.Seq, &entry.Text, &entry.Class, &createdAtRaw); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTimestamp(createdAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	entry.CreatedAt = createdAt
+	return &entry, nil
+}
+
+// transcriptMatchQuery turns free text into an FTS5 query matching entries
+// that contain every term, so punctuation in error messages is searched
+// literally rather than parsed as query syntax.
+func transcriptMatchQuery(q string) string {
+	terms := strings.Fields(q)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
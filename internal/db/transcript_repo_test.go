@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRepoSearch(t *testing.T) {
+	database, _ := openTestDB(t)
+	projectRepo := NewProjectRepo(database.SQL())
+	taskRepo := NewTaskRepo(database.SQL())
+	sessionRepo := NewSessionRepo(database.SQL())
+	repo := NewTranscriptRepo(database.SQL())
+	ctx := context.Background()
+
+	var sessions []*Session
+	for _, name := range []string{"P1", "P2"} {
+		project := &Project{Name: name, RepoPath: t.TempDir(), Status: "active"}
+		if err := projectRepo.Create(ctx, project); err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+		task := &Task{ProjectID: project.ID, Title: "T", Description: "D", Status: "running"}
+		if err := taskRepo.Create(ctx, task); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		session := &Session{TaskID: task.ID, TmuxSessionName: name, AgentType: "codex", Role: "coder", Status: "working"}
+		if err := sessionRepo.Create(ctx, session); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var entries []*TranscriptEntry
+	for i, text := range []string{"$ make migrate", "running 0007_users.sql", "ERROR: migration 0007 failed: duplicate column", "exit status 1", "$ "} {
+		entries = append(entries, &TranscriptEntry{SessionID: sessions[0].ID, Text: text, Class: "normal", CreatedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	entries = append(entries, &TranscriptEntry{SessionID: sessions[1].ID, Text: "migration applied", CreatedAt: base.Add(time.Hour)})
+	if err := repo.Append(ctx, entries); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	more := []*TranscriptEntry{{SessionID: sessions[0].ID, Text: "retrying migration"}}
+	if err := repo.Append(ctx, more); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if more[0].Seq != 6 || entries[5].Seq != 1 {
+		t.Fatalf("seq=%d,%d want 6,1", more[0].Seq, entries[5].Seq)
+	}
+
+	hits, err := repo.Search(ctx, TranscriptFilter{Query: "migration failed:", Context: 1})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Seq != 3 || hits[0].ProjectID == "" || hits[0].AgentType != "codex" {
+		t.Fatalf("hits=%+v", hits)
+	}
+	if len(hits[0].Before) != 1 || hits[0].Before[0].Text != "running 0007_users.sql" || len(hits[0].After) != 1 || hits[0].After[0].Text != "exit status 1" {
+		t.Fatalf("context before=%+v after=%+v", hits[0].Before, hits[0].After)
+	}
+
+	hits, err = repo.Search(ctx, TranscriptFilter{Query: "migration"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 3 || hits[0].Text != "retrying migration" {
+		t.Fatalf("hits=%+v want 3, newest first", hits)
+	}
+	hits, err = repo.Search(ctx, TranscriptFilter{Query: "migration", ProjectID: hits[1].ProjectID})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].SessionID != sessions[1].ID {
+		t.Fatalf("project filtered hits=%+v", hits)
+	}
+	if _, err := repo.Search(ctx, TranscriptFilter{Query: "  "}); err == nil {
+		t.Fatalf("expected error for empty query")
+	}
+
+	listed, err := repo.ListBySession(ctx, sessions[0].ID, 4, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed) != 2 || listed[0].Seq != 5 || listed[1].Text != "retrying migration" {
+		t.Fatalf("listed=%+v", listed)
+	}
+
+	if err := sessionRepo.Delete(ctx, sessions[0].ID); err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+	hits, err = repo.Search(ctx, TranscriptFilter{Query: "migration"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("hits after delete=%d want 1", len(hits))
+	}
+}
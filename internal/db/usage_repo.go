@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type UsageRepo struct {
+	db *sql.DB
+}
+
+func NewUsageRepo(db *sql.DB) *UsageRepo {
+	return &UsageRepo{db: db}
+}
+
+const usageRecordColumns = `id, session_id, task_id, requirement_id, project_id, agent_type, source, input_tokens, output_tokens, total_tokens, cost_usd, created_at`
+
+const usageTotalsColumns = `COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost_usd), 0)`
+
+// usageGroupColumns are the columns usage can be grouped by.
+var usageGroupColumns = map[string]bool{
+	"session_id":     true,
+	"task_id":        true,
+	"requirement_id": true,
+	"agent_type":     true,
+}
+
+func (r *UsageRepo) Create(ctx context.Context, record *UsageRecord) error {
+	if record == nil {
+		return fmt.Errorf("usage record is required")
+	}
+	if record.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		record.ID = id
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = nowUTC()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO usage_records (`+usageRecordColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.ID, record.SessionID, record.TaskID, record.RequirementID, record.ProjectID, record.AgentType, record.Source,
+		record.InputTokens, record.OutputTokens, record.TotalTokens, record.CostUSD, formatTimestamp(record.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create usage record: %w", err)
+	}
+	return nil
+}
+
+// Totals sums the usage matching filter. Source, when set, only counts
+// records from that source.
+func (r *UsageRepo) Totals(ctx context.Context, filter UsageFilter, source string) (UsageTotals, error) {
+	where, args := usageWhere(filter)
+	if source != "" {
+		where = append(where, "source = ?")
+		args = append(args, source)
+	}
+	query := `SELECT ` + usageTotalsColumns + ` FROM usage_records`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	var totals UsageTotals
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&totals.InputTokens, &totals.OutputTokens, &totals.TotalTokens, &totals.CostUSD); err != nil {
+		return UsageTotals{}, fmt.Errorf("failed to sum usage: %w", err)
+	}
+	return totals, nil
+}
+
+// GroupBy sums the usage matching filter per value of column, costliest
+// first. Records without a value for column are left out.
+func (r *UsageRepo) GroupBy(ctx context.Context, filter UsageFilter, column string) ([]*UsageGroup, error) {
+	if !usageGroupColumns[column] {
+		return nil, fmt.Errorf("cannot group usage by %q", column)
+	}
+	where, args := usageWhere(filter)
+	where = append(where, column+" != ''")
+	query := `SELECT ` + column + `, ` + usageTotalsColumns + ` FROM usage_records WHERE ` + strings.Join(where, " AND ") +
+		` GROUP BY ` + column + ` ORDER BY SUM(cost_usd) DESC, SUM(total_tokens) DESC, ` + column
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to group usage by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	out := make([]*UsageGroup, 0)
+	for rows.Next() {
+		var group UsageGroup
+		if err := rows.Scan(&group.ID, &group.InputTokens, &group.OutputTokens, &group.TotalTokens, &group.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan usage group: %w", err)
+		}
+		out = append(out, &group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating usage groups: %w", err)
+	}
+	return out, nil
+}
+
+func usageWhere(filter UsageFilter) ([]string, []any) {
+	where := []string{}
+	args := []any{}
+	if filter.ProjectID != "" {
+		where = append(where, "project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+	if filter.RequirementID != "" {
+		where = append(where, "requirement_id = ?")
+		args = append(args, filter.RequirementID)
+	}
+	if filter.TaskID != "" {
+		where = append(where, "task_id = ?")
+		args = append(args, filter.TaskID)
+	}
+	if filter.SessionID != "" {
+		where = append(where, "session_id = ?")
+		args = append(args, filter.SessionID)
+	}
+	return where, args
+}
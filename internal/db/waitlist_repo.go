@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type WaitlistRepo struct {
+	db *sql.DB
+}
+
+func NewWaitlistRepo(db *sql.DB) *WaitlistRepo {
+	return &WaitlistRepo{db: db}
+}
+
+const waitlistColumns = `id, task_id, agent_type, role, priority, created_at`
+
+func (r *WaitlistRepo) Create(ctx context.Context, entry *WaitlistEntry) error {
+	if entry == nil {
+		return fmt.Errorf("waitlist entry is required")
+	}
+	if entry.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = nowUTC()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO session_waitlist (`+waitlistColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.TaskID, entry.AgentType, entry.Role, entry.Priority, formatTimestamp(entry.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create waitlist entry: %w", err)
+	}
+	return nil
+}
+
+// Find returns the entry queued for the same task, agent and role, if any.
+func (r *WaitlistRepo) Find(ctx context.Context, taskID, agentType, role string) (*WaitlistEntry, error) {
+	entry, err := scanWaitlistEntry(r.db.QueryRowContext(ctx, `SELECT `+waitlistColumns+` FROM session_waitlist WHERE task_id = ? AND agent_type = ? AND role = ?`, taskID, agentType, role))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find waitlist entry: %w", err)
+	}
+	return entry, nil
+}
+
+// List returns the waitlist in start order. An empty agentType lists every
+// agent's entries.
+func (r *WaitlistRepo) List(ctx context.Context, agentType string) ([]*WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + ` FROM session_waitlist`
+	var args []any
+	if agentType != "" {
+		query += ` WHERE agent_type = ?`
+		args = append(args, agentType)
+	}
+	query += ` ORDER BY priority DESC, created_at ASC, rowid ASC`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list waitlist: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]*WaitlistEntry, 0)
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan waitlist entry: %w", err)
+		}
+		out = append(out, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed while iterating waitlist: %w", err)
+	}
+	return out, nil
+}
+
+// Delete removes an entry and reports whether it existed.
+func (r *WaitlistRepo) Delete(ctx context.Context, id string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM session_waitlist WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete waitlist entry %q: %w", id, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read deleted rows for waitlist entry %q: %w", id, err)
+	}
+	return affected > 0, nil
+}
+
+// DeleteByAgent clears an agent's waitlist and returns the number of
+// entries removed.
+func (r *WaitlistRepo) DeleteByAgent(ctx context.Context, agentType string) (int, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM session_waitlist WHERE agent_type = ?`, agentType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear waitlist of %q: %w", agentType, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read deleted rows for waitlist of %q: %w", agentType, err)
+	}
+	return int(affected), nil
+}
+
+func scanWaitlistEntry(row rowScanner) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var createdAtRaw string
+	if err := row.Scan(&entry.ID, &entry.TaskID, &entry.AgentType, &entry.Role, &entry.Priority, &createdAtRaw); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTimestamp(createdAtRaw)
+	if err != nil {
+		return nil, err
+	}
+	entry.CreatedAt = createdAt
+	return &entry, nil
+}
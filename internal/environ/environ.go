@@ -0,0 +1,153 @@
+// Package environ builds agent process environments from layered variable
+// maps.
+//
+// Layers are applied in order on top of a base environment (normally the
+// server's own). Values may reference variables already defined by the base
+// or an earlier layer as $NAME or ${NAME}; "$$" is a literal dollar sign. A
+// null value unsets the variable.
+package environ
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Map is one layer of environment variables. A nil value unsets the
+// variable.
+type Map map[string]*string
+
+// Set returns a layer that sets name to value.
+func Set(name, value string) Map {
+	return Map{name: &value}
+}
+
+// Validate rejects names that are not shell identifiers and values that
+// cannot be passed to a process.
+func (m Map) Validate() error {
+	for name := range m {
+		if !isIdentifier(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		if v := m[name]; v != nil && strings.ContainsRune(*v, 0) {
+			return fmt.Errorf("environment variable %s contains a NUL byte", name)
+		}
+	}
+	return nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Build applies layers on top of base, a list of NAME=value pairs as
+// returned by os.Environ, and returns the resulting environment. Within a
+// layer, names are applied in sorted order so that expansion is
+// deterministic; a layer should not reference its own variables. Base
+// variables keep their position and new ones are appended.
+func Build(base []string, layers ...Map) []string {
+	order := make([]string, 0, len(base))
+	values := make(map[string]string, len(base))
+	for _, kv := range base {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			continue
+		}
+		if _, seen := values[name]; !seen {
+			order = append(order, name)
+		}
+		values[name] = value
+	}
+
+	for _, layer := range layers {
+		names := make([]string, 0, len(layer))
+		for name := range layer {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		resolved := make(map[string]*string, len(layer))
+		for _, name := range names {
+			if v := layer[name]; v != nil {
+				expanded := expand(*v, values)
+				resolved[name] = &expanded
+			} else {
+				resolved[name] = nil
+			}
+		}
+		for _, name := range names {
+			v := resolved[name]
+			if v == nil {
+				delete(values, name)
+				continue
+			}
+			if _, seen := values[name]; !seen {
+				order = append(order, name)
+			}
+			values[name] = *v
+		}
+	}
+
+	env := make([]string, 0, len(values))
+	for _, name := range order {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		env = append(env, name+"="+value)
+		// A name unset and set again is listed twice in order.
+		delete(values, name)
+	}
+	return env
+}
+
+func expand(s string, values map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return values[name]
+	})
+}
+
+// Diff returns the variables of env that differ from base and the names of
+// base variables missing from env. Backends that can only add variables to
+// an inherited environment use it to apply a built one.
+func Diff(base, env []string) (set []string, unset []string) {
+	baseValues := make(map[string]string, len(base))
+	for _, kv := range base {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			baseValues[name] = value
+		}
+	}
+	present := make(map[string]bool, len(env))
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		present[name] = true
+		if old, ok := baseValues[name]; !ok || old != value {
+			set = append(set, kv)
+		}
+	}
+	for _, kv := range base {
+		name, _, ok := strings.Cut(kv, "=")
+		if ok && !present[name] {
+			unset = append(unset, name)
+			present[name] = true
+		}
+	}
+	return set, unset
+}
@@ -0,0 +1,65 @@
+package environ
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildLayersExpandAndUnset(t *testing.T) {
+	base := []string{"HOME=/home/me", "PATH=/usr/bin", "https_proxy=http://old"}
+	agent := Map{
+		"https_proxy": strPtr("http://127.0.0.1:10808"),
+		"PATH":        strPtr("$HOME/bin:${PATH}"),
+	}
+	project := Map{
+		"API_BASE":    strPtr("https://api.example.com"),
+		"https_proxy": nil,
+	}
+	task := Map{
+		"WORKTREE": strPtr("$HOME/wt/$API_BASE"),
+		"PRICE":    strPtr("$$5"),
+	}
+
+	got := Build(base, agent, project, task)
+	want := []string{
+		"HOME=/home/me",
+		"PATH=/home/me/bin:/usr/bin",
+		"API_BASE=https://api.example.com",
+		"PRICE=$5",
+		"WORKTREE=/home/me/wt/https://api.example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Build()=%q\nwant %q", got, want)
+	}
+}
+
+func TestBuildUnsetThenSetAgain(t *testing.T) {
+	got := Build([]string{"A=1", "B=2"}, Map{"A": nil}, Set("A", "3"))
+	want := []string{"A=3", "B=2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Build()=%q want %q", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	set, unset := Diff([]string{"A=1", "B=2", "C=3"}, []string{"A=1", "B=two", "D=4"})
+	if want := []string{"B=two", "D=4"}; !reflect.DeepEqual(set, want) {
+		t.Fatalf("set=%q want %q", set, want)
+	}
+	if want := []string{"C"}; !reflect.DeepEqual(unset, want) {
+		t.Fatalf("unset=%q want %q", unset, want)
+	}
+}
+
+func TestMapValidate(t *testing.T) {
+	if err := (Map{"GOOD_NAME": strPtr("x"), "UNSET": nil}).Validate(); err != nil {
+		t.Fatalf("Validate() error=%v", err)
+	}
+	for _, m := range []Map{{"": strPtr("x")}, {"A=B": strPtr("x")}, {"1A": strPtr("x")}, {"A-B": strPtr("x")}, {"A": strPtr("x\x00")}} {
+		if err := m.Validate(); err == nil {
+			t.Fatalf("Validate(%v) expected error", m)
+		}
+	}
+}
+
+func strPtr(s string) *string { return &s }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type WorktreeInfo struct {
@@ -115,6 +116,23 @@ func GetLog(worktreePath string, count int) ([]CommitInfo, error) {
 	return parseGitLog(out), nil
 }
 
+// GetLogSince returns up to count commits reachable from HEAD that were
+// committed after since, newest first.
+func GetLogSince(worktreePath string, since time.Time, count int) ([]CommitInfo, error) {
+	cleanPath, err := cleanAbsolutePath(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 || count > 100 {
+		count = 100
+	}
+	out, err := runGit(cleanPath, "log", "-n", strconv.Itoa(count), "--since="+since.UTC().Format(time.RFC3339), "--pretty=format:%H%x1f%an%x1f%aI%x1f%s")
+	if err != nil {
+		return nil, err
+	}
+	return parseGitLog(out), nil
+}
+
 func GetDiff(worktreePath, ref1, ref2 string) (string, error) {
 	cleanPath, err := cleanAbsolutePath(worktreePath)
 	if err != nil {
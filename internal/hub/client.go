@@ -108,7 +108,6 @@ func sanitizeLogText(v string) string {
 
 func (c *Client) subscribe(sessionID string) {
 	c.subMu.Lock()
-	defer c.subMu.Unlock()
 	if sessionID == "" {
 		for id := range c.attached {
 			c.hub.handleTerminalDetach(id)
@@ -116,13 +115,23 @@ func (c *Client) subscribe(sessionID string) {
 		c.attached = make(map[string]struct{})
 		c.subscribeAll = true
 		c.subscriptions = make(map[string]struct{})
+		c.subMu.Unlock()
 		return
 	}
 	c.subscribeAll = false
 	c.subscriptions[sessionID] = struct{}{}
+	newlyAttached := false
 	if _, ok := c.attached[sessionID]; !ok {
 		c.attached[sessionID] = struct{}{}
 		c.hub.handleTerminalAttach(sessionID)
+		newlyAttached = true
+	}
+	c.subMu.Unlock()
+
+	// Rendering the screen may call out to the terminal backend, so it runs
+	// without holding subMu (the hub loop needs it to route broadcasts).
+	if newlyAttached {
+		c.hub.seedTerminal(c, sessionID)
 	}
 }
 
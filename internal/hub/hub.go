@@ -15,6 +15,10 @@ import (
 
 const defaultBatchInterval = 100 * time.Millisecond
 
+// terminalBeatInterval is how often sessions with an attached terminal are
+// reported as still attached, well within their takeover lease.
+const terminalBeatInterval = time.Minute
+
 type Hub struct {
 	clients          map[string]*Client
 	register         chan *clientRegistration
@@ -34,6 +38,8 @@ type Hub struct {
 	onKillBySession  func(sessionID string, windowID string)
 	onTerminalAttach func(sessionID string)
 	onTerminalDetach func(sessionID string)
+	onTerminalBeat   func(sessionID string)
+	terminalSnapshot func(sessionID string) (string, bool)
 	onOrchestrator   func(ctx context.Context, projectID string, message string) (<-chan OrchestratorServerMessage, error)
 	token            string
 	defaultDir       string
@@ -86,6 +92,8 @@ func (h *Hub) Run(ctx context.Context) {
 	h.ctxWrap = &ctxWrapper{ctx: ctx}
 	h.running.Store(true)
 	defer h.running.Store(false)
+	beat := time.NewTicker(terminalBeatInterval)
+	defer beat.Stop()
 
 	for {
 		select {
@@ -124,6 +132,9 @@ func (h *Hub) Run(ctx context.Context) {
 
 		case msg := <-h.broadcast:
 			h.broadcastToClients(msg)
+
+		case <-beat.C:
+			go h.beatAttachedTerminals()
 		}
 	}
 }
@@ -252,6 +263,12 @@ func (h *Hub) sendBroadcast(msg any) {
 		sessionID = m.SessionID
 	case StatusMessage:
 		sessionID = m.SessionID
+	case SessionExitedMessage:
+		sessionID = m.SessionID
+	case SessionDequeuedMessage:
+		sessionID = m.SessionID
+	case SessionEventMessage:
+		sessionID = m.SessionID
 	}
 
 	data, err := json.Marshal(msg)
@@ -320,6 +337,41 @@ func (h *Hub) BroadcastSessionStatus(sessionID string, status string) {
 	h.BroadcastStatusForSession(sessionID, "", status)
 }
 
+// BroadcastSessionExited sends a "session_exited" event for a session whose
+// agent process ended.
+func (h *Hub) BroadcastSessionExited(msg SessionExitedMessage) {
+	msg.Type = "session_exited"
+	h.sendBroadcast(msg)
+}
+
+// BroadcastSessionDequeued sends a "session_dequeued" event for a request
+// that left an agent's waitlist.
+func (h *Hub) BroadcastSessionDequeued(msg SessionDequeuedMessage) {
+	msg.Type = "session_dequeued"
+	h.sendBroadcast(msg)
+}
+
+// BroadcastSessionEvent sends a "session_event" event for an event recorded
+// on a session.
+func (h *Hub) BroadcastSessionEvent(msg SessionEventMessage) {
+	msg.Type = "session_event"
+	h.sendBroadcast(msg)
+}
+
+// BroadcastHeadlessRun sends a "headless_run" event when a headless run
+// starts or finishes.
+func (h *Hub) BroadcastHeadlessRun(msg HeadlessRunMessage) {
+	msg.Type = "headless_run"
+	h.sendBroadcast(msg)
+}
+
+// BroadcastHeadlessOutput sends a "headless_output" event for a line of a
+// headless run's output.
+func (h *Hub) BroadcastHeadlessOutput(msg HeadlessOutputMessage) {
+	msg.Type = "headless_output"
+	h.sendBroadcast(msg)
+}
+
 func (h *Hub) BroadcastProjectEvent(projectID string, event string, data any) {
 	msg := ProjectEventMessage{
 		Type:      "project_event",
@@ -331,6 +383,32 @@ func (h *Hub) BroadcastProjectEvent(projectID string, event string, data any) {
 	h.sendBroadcast(msg)
 }
 
+// seedTerminal sends the current screen of sessionID to client.
+func (h *Hub) seedTerminal(client *Client, sessionID string) {
+	if h.terminalSnapshot == nil {
+		return
+	}
+	text, ok := h.terminalSnapshot(sessionID)
+	if !ok || text == "" {
+		return
+	}
+	data, err := json.Marshal(TerminalDataMessage{
+		Type:      "terminal_data",
+		SessionID: sessionID,
+		Window:    sessionID,
+		Text:      text,
+	})
+	if err != nil {
+		log.Printf("error marshaling terminal snapshot: %v", err)
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("client %s send buffer full, dropping terminal snapshot", client.id)
+	}
+}
+
 func (h *Hub) SendError(client *Client, message string) {
 	msg := ErrorMessage{Type: "error", Message: message}
 	data, err := json.Marshal(msg)
@@ -450,6 +528,22 @@ func (h *Hub) handleTerminalDetach(sessionID string) {
 	}
 }
 
+// beatAttachedTerminals reports each session that has a terminal attached.
+func (h *Hub) beatAttachedTerminals() {
+	if h.onTerminalBeat == nil {
+		return
+	}
+	h.attachMu.Lock()
+	sessionIDs := make([]string, 0, len(h.attachedSessions))
+	for sessionID := range h.attachedSessions {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	h.attachMu.Unlock()
+	for _, sessionID := range sessionIDs {
+		h.onTerminalBeat(sessionID)
+	}
+}
+
 func (h *Hub) SetOnNewWindow(fn func(name string)) {
 	h.onNewWindow = fn
 }
@@ -506,6 +600,20 @@ func (h *Hub) SetOnTerminalDetach(fn func(sessionID string)) {
 	h.onTerminalDetach = fn
 }
 
+// SetOnTerminalHeartbeat registers fn to be called periodically for each
+// session that still has a terminal attached.
+func (h *Hub) SetOnTerminalHeartbeat(fn func(sessionID string)) {
+	h.onTerminalBeat = fn
+}
+
+// SetTerminalSnapshotProvider registers fn to render a session's current
+// screen as terminal output. A client that subscribes to a session receives
+// it as its first terminal_data message, so a late subscriber starts from
+// the exact screen instead of a blank terminal.
+func (h *Hub) SetTerminalSnapshotProvider(fn func(sessionID string) (string, bool)) {
+	h.terminalSnapshot = fn
+}
+
 func (h *Hub) SetDefaultDir(dir string) {
 	h.defaultDir = dir
 }
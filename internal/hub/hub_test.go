@@ -177,6 +177,59 @@ func TestSubscribeFiresAttachAndDetach(t *testing.T) {
 	}
 }
 
+func TestTerminalHeartbeatReportsAttachedSessions(t *testing.T) {
+	h := New("token", nil)
+	var beats []string
+	h.SetOnTerminalHeartbeat(func(sessionID string) { beats = append(beats, sessionID) })
+
+	c := &Client{
+		id:            "c1",
+		hub:           h,
+		send:          make(chan []byte, 1),
+		subscribeAll:  true,
+		subscriptions: make(map[string]struct{}),
+		attached:      make(map[string]struct{}),
+	}
+	c.subscribe("s-1")
+	h.beatAttachedTerminals()
+	c.detachAll()
+	h.beatAttachedTerminals()
+
+	if len(beats) != 1 || beats[0] != "s-1" {
+		t.Fatalf("beats=%v want [s-1]", beats)
+	}
+}
+
+func TestSubscribeSeedsTerminalSnapshot(t *testing.T) {
+	h := New("token", nil)
+	h.SetTerminalSnapshotProvider(func(sessionID string) (string, bool) {
+		return "\x1b[H\x1b[2Jscreen of " + sessionID, true
+	})
+
+	c := &Client{
+		id:            "c1",
+		hub:           h,
+		send:          make(chan []byte, 4),
+		subscribeAll:  true,
+		subscriptions: make(map[string]struct{}),
+		attached:      make(map[string]struct{}),
+	}
+
+	c.subscribe("s-1")
+	c.subscribe("s-1")
+
+	if len(c.send) != 1 {
+		t.Fatalf("got %d messages, want a single snapshot per attach", len(c.send))
+	}
+	var msg TerminalDataMessage
+	if err := json.Unmarshal(<-c.send, &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if msg.Type != "terminal_data" || msg.SessionID != "s-1" || msg.Text != "\x1b[H\x1b[2Jscreen of s-1" {
+		t.Fatalf("snapshot message=%+v", msg)
+	}
+}
+
 func TestSubscribeDetachWaitsForLastAttachedClient(t *testing.T) {
 	h := New("token", nil)
 	attached := []string{}
@@ -46,6 +46,64 @@ type StatusMessage struct {
 	Status    string `json:"status"`
 }
 
+// SessionExitedMessage announces that a session's agent process ended.
+type SessionExitedMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Status    string `json:"status"`
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	Signal    string `json:"signal,omitempty"`
+	Reason    string `json:"reason"`
+	ExitedAt  int64  `json:"exited_at"`
+}
+
+// SessionDequeuedMessage announces that a waitlisted session request left
+// the waitlist, with the started session or the error that stopped it.
+type SessionDequeuedMessage struct {
+	Type      string `json:"type"`
+	EntryID   string `json:"entry_id"`
+	TaskID    string `json:"task_id"`
+	AgentType string `json:"agent_type"`
+	Role      string `json:"role"`
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	WaitedMS  int64  `json:"waited_ms"`
+}
+
+// SessionEventMessage announces an event recorded for a session, such as a
+// watchdog rule firing.
+type SessionEventMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	EventID   string `json:"event_id"`
+	Kind      string `json:"kind"`
+	Rule      string `json:"rule,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Ts        int64  `json:"ts"`
+}
+
+// HeadlessRunMessage announces a headless run starting or finishing.
+type HeadlessRunMessage struct {
+	Type      string `json:"type"`
+	RunID     string `json:"run_id"`
+	TaskID    string `json:"task_id"`
+	AgentType string `json:"agent_type"`
+	Status    string `json:"status"`
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HeadlessOutputMessage carries a line a headless run wrote to stdout or
+// stderr.
+type HeadlessOutputMessage struct {
+	Type   string `json:"type"`
+	RunID  string `json:"run_id"`
+	TaskID string `json:"task_id"`
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+}
+
 type ClientMessage struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id,omitempty"`
@@ -65,7 +65,7 @@ func (p *Parser) Feed(windowID string, data string) {
 	if PromptConfirmPattern.MatchString(cleanText) || PromptQuestionPattern.MatchString(cleanText) || PromptBracketedChoicePattern.MatchString(cleanText) {
 		immediateFlush = true
 		classification = ClassPrompt
-		actions = generateQuickActions(cleanText)
+		actions = QuickActions(cleanText)
 	} else if PromptShellPattern.MatchString(cleanText) {
 		immediateFlush = true
 	}
@@ -132,7 +132,7 @@ func (p *Parser) classify(text string) (MessageClass, []QuickAction) {
 	}
 
 	if PromptConfirmPattern.MatchString(text) || PromptQuestionPattern.MatchString(text) || PromptBracketedChoicePattern.MatchString(text) || hasNumberedChoices(text) {
-		actions := generateQuickActions(text)
+		actions := QuickActions(text)
 		return ClassPrompt, actions
 	}
 
@@ -172,7 +172,8 @@ func hasCodeIndent(text string) bool {
 	return indentedCount >= 3
 }
 
-func generateQuickActions(text string) []QuickAction {
+// QuickActions returns the answers offered for a prompt.
+func QuickActions(text string) []QuickAction {
 	if strings.Contains(text, "[Y/n]") || strings.Contains(text, "[Y/N]") {
 		return []QuickAction{
 			{Label: "Yes", Keys: "y\n"},
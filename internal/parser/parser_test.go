@@ -233,7 +233,7 @@ func TestQuickActions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actions := generateQuickActions(tt.input)
+			actions := QuickActions(tt.input)
 			foundYes := false
 			foundNo := false
 			foundCtrlC := false
@@ -0,0 +1,253 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	shellExecPattern = regexp.MustCompile(`(^|[;&|]\s*)(bash|sh|zsh|fish)\s+-c(\s|$)`)
+	evalPattern      = regexp.MustCompile(`(^|[;&|]\s*)eval(\s|$)`)
+	redirectPattern  = regexp.MustCompile(`(?:^|[\s;|&])(?:>|>>|1>|2>|&>)\s*([^\s]+)`)
+)
+
+var commandWrappers = []string{"sudo", "command", "nohup"}
+
+// violation is a finding of a built-in check.
+type violation struct {
+	rule   string
+	detail string
+}
+
+// builtinViolations runs every built-in check on cmd and returns what they
+// found, in BuiltinRules order. Paths must lie within one of roots.
+func builtinViolations(cmd string, fields []string, workDir string, roots []string) []violation {
+	var out []violation
+	lower := strings.ToLower(cmd)
+	if strings.Contains(cmd, "`") || strings.Contains(cmd, "$(") {
+		out = append(out, violation{RuleShellSubstitution, "shell substitution is blocked (` or $())"})
+	}
+	if shellExecPattern.MatchString(lower) {
+		out = append(out, violation{RuleShellDashC, "shell -c execution is blocked"})
+	}
+	if evalPattern.MatchString(lower) {
+		out = append(out, violation{RuleEval, "eval is blocked"})
+	}
+	if strings.Contains(cmd, "../") || strings.Contains(cmd, "..\\") {
+		out = append(out, violation{RulePathTraversal, "relative traversal (../) is blocked"})
+	}
+	if len(fields) == 0 {
+		return out
+	}
+	pathTokens := extractPathTokens(cmd, fields)
+	if v := pathExpansionVariables(pathTokens); v != nil {
+		out = append(out, *v)
+	}
+	if v := absoluteRecursiveRemove(fields); v != nil {
+		out = append(out, *v)
+	}
+	if v := pathScope(workDir, roots, pathTokens); v != nil {
+		out = append(out, *v)
+	}
+	return out
+}
+
+func absoluteRecursiveRemove(fields []string) *violation {
+	exe, args := unwrapCommand(fields)
+	if !strings.EqualFold(exe, "rm") {
+		return nil
+	}
+	recursive := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && strings.Contains(arg, "r") {
+			recursive = true
+		}
+	}
+	if !recursive {
+		return nil
+	}
+	for _, arg := range args {
+		normalized := normalizePathToken(arg)
+		if strings.HasPrefix(normalized, "-") || !looksLikePath(normalized) {
+			continue
+		}
+		if filepath.IsAbs(normalized) {
+			return &violation{RuleRmRfAbsolute, "recursive rm with absolute path is blocked"}
+		}
+	}
+	return nil
+}
+
+func pathExpansionVariables(paths []string) *violation {
+	for _, p := range paths {
+		if strings.Contains(p, "$") || strings.Contains(p, "%") {
+			return &violation{RuleEnvPathExpansion, "environment variable path expansion is blocked"}
+		}
+	}
+	return nil
+}
+
+func unwrapCommand(fields []string) (string, []string) {
+	i := 0
+	for i < len(fields) {
+		tok := strings.TrimSpace(fields[i])
+		if tok == "" {
+			i++
+			continue
+		}
+		base := filepath.Base(tok)
+		if slices.Contains(commandWrappers, strings.ToLower(base)) {
+			i++
+			continue
+		}
+		if base == "env" {
+			i++
+			for i < len(fields) && isEnvAssignment(fields[i]) {
+				i++
+			}
+			continue
+		}
+		break
+	}
+	if i >= len(fields) {
+		return "", nil
+	}
+	return filepath.Base(fields[i]), fields[i+1:]
+}
+
+func isEnvAssignment(token string) bool {
+	token = strings.TrimSpace(token)
+	if token == "" || strings.HasPrefix(token, "-") {
+		return false
+	}
+	key, _, ok := strings.Cut(token, "=")
+	if !ok || key == "" {
+		return false
+	}
+	for idx, r := range key {
+		if idx == 0 && !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')) {
+			return false
+		}
+		if !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathScope requires every path to lie within one of roots, relative
+// paths being taken from workDir.
+func pathScope(workDir string, roots []string, paths []string) *violation {
+	root := strings.TrimSpace(workDir)
+	if root == "" {
+		if len(paths) > 0 {
+			return &violation{RuleMissingScope, "cannot validate path scope because workdir is unavailable"}
+		}
+		return nil
+	}
+	root = canonicalPathForPolicy(root)
+	for _, p := range paths {
+		p = normalizePathToken(p)
+		if p == "" {
+			continue
+		}
+		if strings.HasPrefix(p, "~") {
+			return &violation{RuleTildePath, "home-expanded paths are blocked"}
+		}
+		resolved := p
+		if filepath.IsAbs(resolved) {
+			resolved = filepath.Clean(resolved)
+		} else {
+			resolved = filepath.Clean(filepath.Join(root, resolved))
+		}
+		resolved = canonicalPathForPolicy(resolved)
+		if !slices.ContainsFunc(roots, func(base string) bool { return pathWithinBase(base, resolved) }) {
+			return &violation{RulePathOutside, fmt.Sprintf("path %q is outside allowed workdir", p)}
+		}
+	}
+	return nil
+}
+
+func extractPathTokens(raw string, fields []string) []string {
+	paths := make([]string, 0, 8)
+	for _, f := range fields {
+		if f == "" {
+			continue
+		}
+		if strings.HasPrefix(f, "-") {
+			parts := strings.SplitN(f, "=", 2)
+			if len(parts) == 2 {
+				pathPart := normalizePathToken(parts[1])
+				if looksLikePath(pathPart) {
+					paths = append(paths, pathPart)
+				}
+			}
+			continue
+		}
+		pathPart := normalizePathToken(f)
+		if looksLikePath(pathPart) {
+			paths = append(paths, pathPart)
+		}
+	}
+	for _, m := range redirectPattern.FindAllStringSubmatch(raw, -1) {
+		if len(m) > 1 {
+			pathPart := normalizePathToken(m[1])
+			if looksLikePath(pathPart) {
+				paths = append(paths, pathPart)
+			}
+		}
+	}
+	return paths
+}
+
+func looksLikePath(token string) bool {
+	token = normalizePathToken(token)
+	if token == "" {
+		return false
+	}
+	if strings.Contains(token, "://") {
+		return false
+	}
+	return strings.HasPrefix(token, "/") ||
+		strings.HasPrefix(token, ".") ||
+		strings.HasPrefix(token, "~") ||
+		strings.Contains(token, "/") ||
+		strings.Contains(token, "\\")
+}
+
+func normalizePathToken(token string) string {
+	token = strings.TrimSpace(token)
+	for len(token) >= 2 {
+		if (token[0] == '\'' && token[len(token)-1] == '\'') || (token[0] == '"' && token[len(token)-1] == '"') {
+			token = strings.TrimSpace(token[1 : len(token)-1])
+			continue
+		}
+		break
+	}
+	return token
+}
+
+func canonicalPathForPolicy(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return filepath.Clean(resolved)
+	}
+	return path
+}
+
+func pathWithinBase(base string, target string) bool {
+	base = filepath.Clean(base)
+	target = filepath.Clean(target)
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	rel = filepath.Clean(rel)
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,286 @@
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Decision actions: the command runs, runs but is reported, or is refused.
+const (
+	DecisionAllow = "allow"
+	DecisionWarn  = "warn"
+	DecisionBlock = "block"
+)
+
+// SourceBuiltin is the source of decisions made by built-in checks.
+const SourceBuiltin = "builtin"
+
+// Decision is the outcome of evaluating a command.
+type Decision struct {
+	Action string `json:"action"`
+	// Rule is the rule or check that decided; empty when nothing matched.
+	Rule string `json:"rule,omitempty"`
+	// Source is the layer the rule came from, or "builtin".
+	Source string `json:"source,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Layer is a policy with the name decisions report it by.
+type Layer struct {
+	Source string
+	Policy *Policy
+}
+
+// Named is a policy file, e.g. the project's or the default one.
+type Named struct {
+	Name   string
+	Policy *Policy
+}
+
+// Resolve orders the layers that apply to sessions of role. policies are
+// ordered most specific first; each contributes its role override, then
+// itself.
+func Resolve(role string, policies ...Named) []Layer {
+	var layers []Layer
+	for _, named := range policies {
+		if named.Policy == nil {
+			continue
+		}
+		if rp, ok := named.Policy.Roles[role]; ok && role != "" {
+			layers = append(layers, Layer{Source: named.Name + " role " + role, Policy: &rp})
+		}
+		layers = append(layers, Layer{Source: named.Name, Policy: named.Policy})
+	}
+	return layers
+}
+
+// Evaluate decides whether command may run in workDir under layers, most
+// specific first. The first matching rule decides; otherwise the network
+// section and the built-in checks run, and a blocking finding beats a
+// warning. Allow rules only match single commands: rules see the first
+// executable alone, so a chained or substituted command line is never
+// exempted from the checks.
+func Evaluate(command, workDir string, layers ...Layer) Decision {
+	cmd := strings.TrimSpace(command)
+	if cmd == "" {
+		return Decision{Action: DecisionAllow}
+	}
+	fields := strings.Fields(cmd)
+	exe, args := unwrapCommand(fields)
+	chained := chainsCommands(cmd)
+
+	for _, layer := range layers {
+		for _, rule := range layer.Policy.Rules {
+			if rule.Action == ActionAllow && chained || !rule.matches(cmd, exe) {
+				continue
+			}
+			d := Decision{Action: DecisionAllow, Rule: rule.Label(), Source: layer.Source, Detail: rule.Message}
+			if rule.Action == ActionDeny {
+				d.Action = severityAction(rule.Severity)
+				if d.Detail == "" && d.Action == DecisionWarn {
+					d.Detail = "flagged by rule " + rule.Label()
+				} else if d.Detail == "" {
+					d.Detail = "denied by rule " + rule.Label()
+				}
+			}
+			return d
+		}
+	}
+
+	var warning *Decision
+	note := func(d Decision) bool {
+		if d.Action == DecisionBlock {
+			return true
+		}
+		if warning == nil {
+			warning = &d
+		}
+		return false
+	}
+
+	if network, source := firstNetwork(layers); network != nil && containsFold(networkTools(network), exe) {
+		if detail := networkViolation(network, exe, args); detail != "" {
+			if d := (Decision{Action: severityAction(network.Severity), Rule: RuleNetwork, Source: source, Detail: detail}); note(d) {
+				return d
+			}
+		}
+	}
+
+	severities := builtinSeverities(layers)
+	roots := allowedRoots(workDir, layers)
+	for _, v := range builtinViolations(cmd, fields, workDir, roots) {
+		severity := severities[v.rule]
+		if severity == SeverityOff {
+			continue
+		}
+		if d := (Decision{Action: severityAction(severity), Rule: v.rule, Source: SourceBuiltin, Detail: v.detail}); note(d) {
+			return d
+		}
+	}
+	if warning != nil {
+		return *warning
+	}
+	return Decision{Action: DecisionAllow}
+}
+
+func (r Rule) matches(cmd, exe string) bool {
+	if len(r.Commands) > 0 && !containsFold(r.Commands, exe) {
+		return false
+	}
+	if r.Match == "" {
+		return true
+	}
+	re, err := regexp.Compile(r.Match)
+	return err == nil && re.MatchString(cmd)
+}
+
+// shellChainTokens run or substitute further commands.
+var shellChainTokens = []string{";", "&&", "||", "|", "$(", "`", "\n"}
+
+// chainsCommands reports whether cmd runs more than one command.
+func chainsCommands(cmd string) bool {
+	for _, token := range shellChainTokens {
+		if strings.Contains(cmd, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func severityAction(severity string) string {
+	if severity == SeverityWarn {
+		return DecisionWarn
+	}
+	return DecisionBlock
+}
+
+func firstNetwork(layers []Layer) (*Network, string) {
+	for _, layer := range layers {
+		if layer.Policy.Network != nil {
+			return layer.Policy.Network, layer.Source
+		}
+	}
+	return nil, ""
+}
+
+func networkTools(n *Network) []string {
+	if len(n.Tools) > 0 {
+		return n.Tools
+	}
+	return DefaultNetworkTools
+}
+
+// networkViolation explains why running the network tool exe with args is
+// denied, or returns "" when every host it names is allowed. A command
+// whose host cannot be told is denied.
+func networkViolation(n *Network, exe string, args []string) string {
+	if len(n.AllowHosts) == 0 {
+		return exe + " is not allowed"
+	}
+	bare := containsFold(bareHostTools, exe)
+	found := false
+	for _, arg := range args {
+		host := hostOf(normalizePathToken(arg), bare)
+		if host == "" {
+			continue
+		}
+		if !hostAllowed(n.AllowHosts, host) {
+			return fmt.Sprintf("%s may not reach %s", exe, host)
+		}
+		found = true
+		if bare {
+			// Later arguments are the remote command or port.
+			break
+		}
+	}
+	if !found {
+		return "cannot tell which host " + exe + " reaches"
+	}
+	return ""
+}
+
+// bareHostTools take a host as a plain argument rather than as a URL or
+// host:path.
+var bareHostTools = []string{"ssh", "sftp", "nc", "ncat", "telnet", "ftp"}
+
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// hostOf returns the host a command argument refers to: that of a URL, of
+// user@host[:path] or host:path, or, with bare, a plain name with a dot.
+func hostOf(arg string, bare bool) string {
+	if arg == "" || strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	if strings.Contains(arg, "://") {
+		u, err := url.Parse(arg)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(u.Hostname())
+	}
+	user, rest, hasUser := strings.Cut(arg, "@")
+	if hasUser && user != "" {
+		arg = rest
+	}
+	host, _, hasPath := strings.Cut(arg, ":")
+	if !hasUser && !hasPath && !bare {
+		return ""
+	}
+	host = strings.ToLower(host)
+	if !hostnamePattern.MatchString(host) || !hasUser && !strings.Contains(host, ".") {
+		return ""
+	}
+	return host
+}
+
+func hostAllowed(allowed []string, host string) bool {
+	for _, candidate := range allowed {
+		candidate = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(candidate), "*."))
+		if host == candidate || strings.HasSuffix(host, "."+candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinSeverities merges the builtin settings of layers, the most
+// specific first.
+func builtinSeverities(layers []Layer) map[string]string {
+	out := make(map[string]string)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for name, severity := range layers[i].Policy.Builtin {
+			out[name] = severity
+		}
+	}
+	return out
+}
+
+func allowedRoots(workDir string, layers []Layer) []string {
+	var roots []string
+	if strings.TrimSpace(workDir) != "" {
+		roots = append(roots, canonicalPathForPolicy(strings.TrimSpace(workDir)))
+	}
+	home, _ := os.UserHomeDir()
+	for _, layer := range layers {
+		for _, path := range layer.Policy.AllowPaths {
+			path = strings.TrimSpace(path)
+			if (path == "~" || strings.HasPrefix(path, "~/")) && home != "" {
+				path = home + path[1:]
+			}
+			roots = append(roots, canonicalPathForPolicy(path))
+		}
+	}
+	return roots
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(strings.TrimSpace(candidate), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+// Package policy decides whether commands typed into agent sessions are
+// allowed.
+//
+// A policy is read from YAML. Its rules allow or deny commands by pattern
+// and executable, its network section restricts network tools to known
+// hosts, and allow_paths widens the path scope beyond the worktree. The
+// built-in checks (shell substitution, bash -c, eval, ../, $VAR paths,
+// rm -rf of absolute paths, paths outside the worktree) run unless the
+// policy turns them off or down to a warning. Roles may extend or replace
+// parts of a policy for their sessions.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule actions and severities, and the action of a decision.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+
+	SeverityBlock = "block"
+	SeverityWarn  = "warn"
+	// SeverityOff disables a built-in check.
+	SeverityOff = "off"
+)
+
+// Built-in checks, by the rule name reported when they fire.
+const (
+	RuleShellSubstitution = "no_shell_substitution"
+	RuleShellDashC        = "no_shell_dash_c"
+	RuleEval              = "no_eval"
+	RulePathTraversal     = "no_path_traversal"
+	RuleEnvPathExpansion  = "no_env_path_expansion"
+	RuleRmRfAbsolute      = "no_rm_rf_absolute"
+	RuleMissingScope      = "missing_workdir_scope"
+	RuleTildePath         = "no_tilde_path"
+	RulePathOutside       = "path_outside_workdir"
+	// RuleNetwork is reported when the network section denies a command.
+	RuleNetwork = "network"
+)
+
+// BuiltinRules lists the built-in checks in the order they run.
+var BuiltinRules = []string{
+	RuleShellSubstitution,
+	RuleShellDashC,
+	RuleEval,
+	RulePathTraversal,
+	RuleEnvPathExpansion,
+	RuleRmRfAbsolute,
+	RuleMissingScope,
+	RuleTildePath,
+	RulePathOutside,
+}
+
+// DefaultNetworkTools are the executables the network section restricts
+// when it names none.
+var DefaultNetworkTools = []string{"curl", "wget", "nc", "ncat", "telnet", "ssh", "scp", "sftp", "rsync", "ftp"}
+
+// Policy is one command policy.
+type Policy struct {
+	// Rules are tried in order before any check; the first that matches
+	// decides.
+	Rules []Rule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	// Builtin sets the severity of built-in checks by rule name: block
+	// (the default), warn or off.
+	Builtin map[string]string `yaml:"builtin,omitempty" json:"builtin,omitempty"`
+	// AllowPaths are directories commands may reference besides the
+	// worktree; ~ is expanded.
+	AllowPaths []string `yaml:"allow_paths,omitempty" json:"allow_paths,omitempty"`
+	// Network restricts network tools.
+	Network *Network `yaml:"network,omitempty" json:"network,omitempty"`
+	// Roles extend the policy for sessions of a role: their rules are
+	// tried first, and their builtin, allow_paths and network settings
+	// take precedence.
+	Roles map[string]Policy `yaml:"roles,omitempty" json:"roles,omitempty"`
+}
+
+// Rule allows or denies the commands it matches.
+type Rule struct {
+	// Name is reported when the rule matches; it defaults to the pattern.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Match is a regular expression tested against the whole command.
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+	// Commands limits the rule to these executables, after sudo, env and
+	// similar wrappers.
+	Commands []string `yaml:"commands,omitempty" json:"commands,omitempty"`
+	// Action is allow or deny.
+	Action string `yaml:"action" json:"action"`
+	// Severity of a deny rule: block (the default) or warn.
+	Severity string `yaml:"severity,omitempty" json:"severity,omitempty"`
+	// Message explains a denial.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// Network restricts the hosts network tools may reach.
+type Network struct {
+	// Tools are the restricted executables; empty uses
+	// DefaultNetworkTools.
+	Tools []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+	// AllowHosts are the hosts, and their subdomains, the tools may reach;
+	// empty denies every use of the tools.
+	AllowHosts []string `yaml:"allow_hosts,omitempty" json:"allow_hosts,omitempty"`
+	// Severity of a denial: block (the default) or warn.
+	Severity string `yaml:"severity,omitempty" json:"severity,omitempty"`
+}
+
+// Parse reads and validates a policy.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks the rules, severities and roles of p.
+func (p Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	for name, severity := range p.Builtin {
+		if !isBuiltin(name) {
+			return fmt.Errorf("builtin: unknown check %q", name)
+		}
+		if !validSeverity(severity, true) {
+			return fmt.Errorf("builtin %s: severity must be block, warn or off", name)
+		}
+	}
+	for _, path := range p.AllowPaths {
+		if strings.TrimSpace(path) == "" {
+			return errors.New("allow_paths: empty path")
+		}
+	}
+	if p.Network != nil && !validSeverity(p.Network.Severity, false) {
+		return errors.New("network: severity must be block or warn")
+	}
+	for role, rp := range p.Roles {
+		if strings.TrimSpace(role) == "" {
+			return errors.New("role name is required")
+		}
+		if len(rp.Roles) > 0 {
+			return fmt.Errorf("role %s: roles cannot be nested", role)
+		}
+		if err := rp.Validate(); err != nil {
+			return fmt.Errorf("role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that r matches something and has a known action and
+// severity.
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.Match) == "" && len(r.Commands) == 0 {
+		return errors.New("rule must set match or commands")
+	}
+	if r.Match != "" {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("match: %w", err)
+		}
+	}
+	switch r.Action {
+	case ActionAllow:
+		if r.Severity != "" {
+			return errors.New("severity only applies to deny rules")
+		}
+	case ActionDeny:
+		if !validSeverity(r.Severity, false) {
+			return errors.New("severity must be block or warn")
+		}
+	default:
+		return errors.New("action must be allow or deny")
+	}
+	return nil
+}
+
+// Label names r in decisions.
+func (r Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if r.Match != "" {
+		return r.Match
+	}
+	return strings.Join(r.Commands, ",")
+}
+
+func isBuiltin(name string) bool {
+	for _, candidate := range BuiltinRules {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validSeverity(severity string, allowOff bool) bool {
+	switch severity {
+	case "", SeverityBlock, SeverityWarn:
+		return true
+	case SeverityOff:
+		return allowOff
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultName is the policy that applies to every project.
+const DefaultName = "default"
+
+// Store loads policies from <name>.yaml files in a directory, rereading a
+// file whenever it changes so edits apply without a restart.
+type Store struct {
+	dir string
+
+	mu     sync.Mutex
+	loaded map[string]storedPolicy
+}
+
+type storedPolicy struct {
+	path    string
+	modTime time.Time
+	size    int64
+	policy  *Policy
+}
+
+// NewStore returns a store reading policies from dir.
+func NewStore(dir string) *Store {
+	return &Store{dir: strings.TrimSpace(dir), loaded: make(map[string]storedPolicy)}
+}
+
+// Dir returns the directory s reads.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load returns the policy name, or nil when it has no file. When a changed
+// file does not parse, the policy last read from it is returned with the
+// error.
+func (s *Store) Load(name string) (*Policy, error) {
+	if s == nil || s.dir == "" {
+		return nil, nil
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid policy name %q", name)
+	}
+	path, info, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.loaded[name]
+	if info == nil {
+		delete(s.loaded, name)
+		return nil, nil
+	}
+	if ok && cached.path == path && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.policy, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cached.policy, fmt.Errorf("read policy %s: %w", path, err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return cached.policy, fmt.Errorf("policy %s: %w", path, err)
+	}
+	s.loaded[name] = storedPolicy{path: path, modTime: info.ModTime(), size: info.Size(), policy: p}
+	return p, nil
+}
+
+func (s *Store) find(name string) (string, os.FileInfo, error) {
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(s.dir, name+ext)
+		info, err := os.Stat(path)
+		if err == nil {
+			return path, info, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", nil, fmt.Errorf("stat policy %s: %w", path, err)
+		}
+	}
+	return "", nil, nil
+}
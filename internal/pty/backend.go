@@ -3,59 +3,124 @@ package pty
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+
+	"github.com/user/agenterm/internal/asciicast"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/vt"
 )
 
-const captureBufferSize = 256 * 1024
+// screenScrollback is the number of scrolled-off lines kept per session.
+const screenScrollback = 5000
 
 // Backend wraps a Manager to satisfy session.TerminalBackend.
-// It captures output in per-session ring buffers and re-broadcasts
-// session events so that external consumers (e.g. main.go / hub)
-// can read them without competing with the internal capture loop.
+// It feeds output into a per-session virtual terminal screen and
+// re-broadcasts session events so that external consumers (e.g. main.go /
+// hub) can read them without competing with the internal capture loop.
+// When a recording directory is set, every session's raw output is
+// also appended to an asciicast v2 file named after the session ID.
 type Backend struct {
-	manager       *Manager
-	mu            sync.RWMutex
-	outputBuffers map[string]*ringBuf
-	eventChans    map[string]chan Event // broadcast channels for external consumers
+	manager      *Manager
+	mu           sync.RWMutex
+	screens      map[string]*vt.Screen
+	eventChans   map[string]chan Event // broadcast channels for external consumers
+	recorders    map[string]*asciicast.Writer
+	recordingDir string
 }
 
 // NewBackend creates a Backend with a fresh Manager.
 func NewBackend() *Backend {
 	return &Backend{
-		manager:       NewManager(),
-		outputBuffers: make(map[string]*ringBuf),
-		eventChans:    make(map[string]chan Event),
+		manager:    NewManager(),
+		screens:    make(map[string]*vt.Screen),
+		eventChans: make(map[string]chan Event),
+		recorders:  make(map[string]*asciicast.Writer),
+	}
+}
+
+// SetRecordingDir enables asciicast recording of new sessions into dir.
+// An empty dir disables recording.
+func (b *Backend) SetRecordingDir(dir string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recordingDir = strings.TrimSpace(dir)
+}
+
+// RecordingPath returns the asciicast file for a session, or "" when
+// recording is disabled.
+func (b *Backend) RecordingPath(id string) string {
+	b.mu.RLock()
+	dir := b.recordingDir
+	b.mu.RUnlock()
+	if dir == "" || strings.TrimSpace(id) == "" || strings.ContainsAny(id, `/\`) {
+		return ""
 	}
+	return filepath.Join(dir, id+".cast")
 }
 
 // CreateSession spawns a new PTY session and starts a goroutine that
-// reads from the session's Events channel, writes output to a ring buffer,
-// and forwards all events to a broadcast channel returned by Events().
-func (b *Backend) CreateSession(_ context.Context, id, name, command, workDir string) (string, error) {
+// reads from the session's Events channel, feeds output to the session's
+// screen model, and forwards all events to a broadcast channel returned by Events().
+// A non-nil env replaces the inherited environment.
+func (b *Backend) CreateSession(_ context.Context, id, name, command, workDir string, env []string) (string, error) {
 	argv := parseCommand(command)
 	if len(argv) == 0 {
 		return "", fmt.Errorf("pty backend: empty command")
 	}
+	return b.spawn(id, name, argv, workDir, env)
+}
+
+// CreateSandboxedSession is CreateSession with the command run through the
+// sandbox helper, so that it and all of its children are confined to policy.
+func (b *Backend) CreateSandboxedSession(_ context.Context, id, name, command, workDir string, env []string, policy sandbox.Policy) (string, error) {
+	argv := parseCommand(command)
+	if len(argv) == 0 {
+		return "", fmt.Errorf("pty backend: empty command")
+	}
+	if err := sandbox.Supported(); err != nil {
+		return "", err
+	}
+	argv, err := sandbox.Command(argv, policy)
+	if err != nil {
+		return "", err
+	}
+	return b.spawn(id, name, argv, workDir, env)
+}
 
-	sess, err := b.manager.CreateSession(id, name, argv, workDir, nil)
+func (b *Backend) spawn(id, name string, argv []string, workDir string, env []string) (string, error) {
+	sess, err := b.manager.CreateSession(id, name, argv, workDir, env)
 	if err != nil {
 		return "", err
 	}
 
-	rb := newRingBuf(captureBufferSize)
+	cols, rows := sess.Size()
+	screen := vt.New(int(cols), int(rows), screenScrollback)
 	broadcast := make(chan Event, 1024)
+	rec := b.openRecorder(sess)
 
 	b.mu.Lock()
-	b.outputBuffers[id] = rb
+	b.screens[id] = screen
 	b.eventChans[id] = broadcast
+	if rec != nil {
+		b.recorders[id] = rec
+	}
 	b.mu.Unlock()
 
-	// Fan-out: read from session events, write to ringBuf + broadcast channel.
+	// Fan-out: read from session events, write to the screen, recording
+	// and broadcast channel.
 	go func() {
 		for evt := range sess.Events() {
 			if evt.Type == EventOutput {
-				rb.Write([]byte(evt.Data))
+				_, _ = screen.Write([]byte(evt.Data))
+				if rec != nil {
+					if err := rec.WriteOutput(evt.At, []byte(evt.Data)); err != nil {
+						slog.Debug("pty recording write failed", "session", id, "error", err)
+					}
+				}
 			}
 			// Non-blocking send to broadcast channel.
 			select {
@@ -65,11 +130,44 @@ func (b *Backend) CreateSession(_ context.Context, id, name, command, workDir st
 			}
 		}
 		close(broadcast)
+		if rec != nil {
+			_ = rec.Close()
+			b.mu.Lock()
+			if b.recorders[id] == rec {
+				delete(b.recorders, id)
+			}
+			b.mu.Unlock()
+		}
 	}()
 
 	return id, nil
 }
 
+// openRecorder starts (or resumes) the asciicast recording for sess.
+// Recording failures are logged and never prevent the session from running.
+func (b *Backend) openRecorder(sess *Session) *asciicast.Writer {
+	path := b.RecordingPath(sess.ID())
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("pty recording disabled: create dir failed", "session", sess.ID(), "error", err)
+		return nil
+	}
+	cols, rows := sess.Size()
+	rec, err := asciicast.Create(path, asciicast.Header{
+		Width:  int(cols),
+		Height: int(rows),
+		Title:  sess.Name(),
+		Env:    map[string]string{"TERM": "xterm-256color"},
+	})
+	if err != nil {
+		slog.Warn("pty recording disabled: open failed", "session", sess.ID(), "path", path, "error", err)
+		return nil
+	}
+	return rec
+}
+
 // Events returns the broadcast event channel for a session.
 // External consumers (e.g. main.go) read from this to forward
 // terminal data to the hub.
@@ -79,11 +177,11 @@ func (b *Backend) Events(id string) <-chan Event {
 	return b.eventChans[id]
 }
 
-// DestroySession removes the session's ring buffer and broadcast channel,
+// DestroySession removes the session's screen and broadcast channel,
 // then delegates to the underlying Manager.
 func (b *Backend) DestroySession(_ context.Context, id string) error {
 	b.mu.Lock()
-	delete(b.outputBuffers, id)
+	delete(b.screens, id)
 	delete(b.eventChans, id)
 	b.mu.Unlock()
 	return b.manager.DestroySession(id)
@@ -111,30 +209,80 @@ func (b *Backend) SendKey(_ context.Context, id, key string) error {
 	return err
 }
 
-// Resize changes the PTY dimensions.
+// Resize changes the PTY dimensions and records the change.
 func (b *Backend) Resize(_ context.Context, id string, cols, rows int) error {
 	sess, err := b.manager.GetSession(id)
 	if err != nil {
 		return err
 	}
-	return sess.Resize(uint16(cols), uint16(rows))
+	if err := sess.Resize(uint16(cols), uint16(rows)); err != nil {
+		return err
+	}
+	b.mu.RLock()
+	rec := b.recorders[id]
+	screen := b.screens[id]
+	b.mu.RUnlock()
+	if screen != nil {
+		screen.Resize(cols, rows)
+	}
+	if rec != nil {
+		_ = rec.WriteResize(cols, rows)
+	}
+	return nil
 }
 
-// CaptureOutput returns the last N lines of terminal output from the
-// session's ring buffer.
+// CaptureOutput returns the last N lines of the rendered terminal:
+// scrollback followed by the visible screen, with cursor movement and
+// redraws already applied.
 func (b *Backend) CaptureOutput(_ context.Context, id string, lines int) ([]string, error) {
+	screen, err := b.screen(id)
+	if err != nil {
+		return nil, err
+	}
+	return screen.History(lines), nil
+}
+
+// ProcessID returns the pid of the session's child process, the root of
+// its process tree.
+func (b *Backend) ProcessID(_ context.Context, id string) (int, error) {
+	sess, err := b.manager.GetSession(id)
+	if err != nil {
+		return 0, err
+	}
+	return sess.PID(), nil
+}
+
+// ExitStatus returns how the session's child process ended. It fails while
+// the process is still running.
+func (b *Backend) ExitStatus(_ context.Context, id string) (ExitStatus, error) {
+	sess, err := b.manager.GetSession(id)
+	if err != nil {
+		return ExitStatus{}, err
+	}
+	exit, ok := sess.Exit()
+	if !ok {
+		return ExitStatus{}, fmt.Errorf("pty: session %q is still running", id)
+	}
+	return exit, nil
+}
+
+// Screen returns a snapshot of the session's visible screen.
+func (b *Backend) Screen(_ context.Context, id string) (vt.Snapshot, error) {
+	screen, err := b.screen(id)
+	if err != nil {
+		return vt.Snapshot{}, err
+	}
+	return screen.Snapshot(), nil
+}
+
+func (b *Backend) screen(id string) (*vt.Screen, error) {
 	b.mu.RLock()
-	rb, ok := b.outputBuffers[id]
+	screen, ok := b.screens[id]
 	b.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("pty backend: session %q not found", id)
 	}
-	data := rb.Bytes()
-	allLines := strings.Split(string(data), "\n")
-	if lines > 0 && lines < len(allLines) {
-		allLines = allLines[len(allLines)-lines:]
-	}
-	return allLines, nil
+	return screen, nil
 }
 
 // SessionExists returns true if the session is still alive.
@@ -146,6 +294,11 @@ func (b *Backend) SessionExists(_ context.Context, id string) bool {
 	return !sess.IsClosed()
 }
 
+// ListSessions returns metadata for every session tracked by the backend.
+func (b *Backend) ListSessions() []SessionInfo {
+	return b.manager.ListSessions()
+}
+
 // Manager returns the underlying PTY Manager for direct access if needed.
 func (b *Backend) Manager() *Manager {
 	return b.manager
@@ -207,45 +360,3 @@ func parseCommand(command string) []string {
 	}
 	return strings.Fields(command)
 }
-
-// ---------------------------------------------------------------------------
-// ringBuf — fixed-size circular buffer for byte data
-// ---------------------------------------------------------------------------
-
-type ringBuf struct {
-	mu   sync.Mutex
-	data []byte
-	pos  int
-	full bool
-	cap  int
-}
-
-func newRingBuf(capacity int) *ringBuf {
-	return &ringBuf{data: make([]byte, capacity), cap: capacity}
-}
-
-// Write appends p to the ring buffer, overwriting oldest data when full.
-func (r *ringBuf) Write(p []byte) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	for _, b := range p {
-		r.data[r.pos] = b
-		r.pos = (r.pos + 1) % r.cap
-		if r.pos == 0 {
-			r.full = true
-		}
-	}
-}
-
-// Bytes returns a copy of the buffered data in chronological order.
-func (r *ringBuf) Bytes() []byte {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if !r.full {
-		return append([]byte(nil), r.data[:r.pos]...)
-	}
-	result := make([]byte, r.cap)
-	copy(result, r.data[r.pos:])
-	copy(result[r.cap-r.pos:], r.data[:r.pos])
-	return result
-}
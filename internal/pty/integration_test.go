@@ -14,7 +14,7 @@ func TestBackendIntegration(t *testing.T) {
 	ctx := context.Background()
 
 	// Create a bash session
-	id, err := b.CreateSession(ctx, "int-test", "bash", "bash", "/tmp")
+	id, err := b.CreateSession(ctx, "int-test", "bash", "bash", "/tmp", nil)
 	if err != nil {
 		t.Fatalf("CreateSession: %v", err)
 	}
@@ -11,6 +11,10 @@ import (
 	creackpty "github.com/creack/pty"
 )
 
+// readDrainTimeout bounds how long waitExit waits for buffered PTY output
+// after the child process has exited.
+const readDrainTimeout = 2 * time.Second
+
 // Session wraps a child process running inside a PTY.
 type Session struct {
 	id        string
@@ -20,13 +24,15 @@ type Session struct {
 	cmd  *exec.Cmd
 	ptmx *os.File
 
-	events chan Event
+	events   chan Event
+	readDone chan struct{}
 
 	cols uint16
 	rows uint16
 
 	mu        sync.Mutex
 	closed    bool
+	exit      *ExitStatus
 	closeOnce sync.Once
 }
 
@@ -61,6 +67,7 @@ func newSession(id, name string, argv []string, workDir string, env []string) (*
 		cmd:       cmd,
 		ptmx:      ptmx,
 		events:    make(chan Event, 1024),
+		readDone:  make(chan struct{}),
 		cols:      defaultCols,
 		rows:      defaultRows,
 	}
@@ -74,6 +81,7 @@ func newSession(id, name string, argv []string, workDir string, env []string) (*
 // readPump reads data from the PTY fd and sends EventOutput events.
 // It runs until the PTY is closed or any read error occurs.
 func (s *Session) readPump() {
+	defer close(s.readDone)
 	buf := make([]byte, 4096)
 	for {
 		n, err := s.ptmx.Read(buf)
@@ -82,6 +90,7 @@ func (s *Session) readPump() {
 				Type: EventOutput,
 				ID:   s.id,
 				Data: string(buf[:n]),
+				At:   time.Now(),
 			}
 		}
 		if err != nil {
@@ -91,14 +100,26 @@ func (s *Session) readPump() {
 }
 
 // waitExit waits for the child process to exit, then sends an EventClosed
-// event and closes the events channel.
+// event and closes the events channel. The read pump is drained first so the
+// final output is not lost and nothing is sent on the closed channel; if a
+// background grandchild keeps the PTY open, the fd is closed after a grace
+// period to unblock the pump.
 func (s *Session) waitExit() {
 	_ = s.cmd.Wait()
+	exit := exitStatus(s.cmd.ProcessState)
 
 	s.mu.Lock()
+	s.exit = &exit
 	s.closed = true
 	s.mu.Unlock()
 
+	select {
+	case <-s.readDone:
+	case <-time.After(readDrainTimeout):
+		_ = s.ptmx.Close()
+		<-s.readDone
+	}
+
 	s.events <- Event{
 		Type: EventClosed,
 		ID:   s.id,
@@ -106,6 +127,28 @@ func (s *Session) waitExit() {
 	close(s.events)
 }
 
+func exitStatus(state *os.ProcessState) ExitStatus {
+	exit := ExitStatus{Code: -1, At: time.Now()}
+	if state == nil {
+		return exit
+	}
+	exit.Code = state.ExitCode()
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		exit.Signal = int(ws.Signal())
+	}
+	return exit
+}
+
+// Exit returns how the child process ended, once it has.
+func (s *Session) Exit() (ExitStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exit == nil {
+		return ExitStatus{}, false
+	}
+	return *s.exit, true
+}
+
 // IsClosed returns true if the session has been closed.
 func (s *Session) IsClosed() bool {
 	s.mu.Lock()
@@ -133,6 +176,21 @@ func (s *Session) Write(data []byte) (int, error) {
 	return s.ptmx.Write(data)
 }
 
+// PID returns the process id of the session's child process.
+func (s *Session) PID() int {
+	if s.cmd.Process == nil {
+		return 0
+	}
+	return s.cmd.Process.Pid
+}
+
+// Size returns the current PTY window size.
+func (s *Session) Size() (cols, rows uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cols, s.rows
+}
+
 // Resize changes the PTY window size.
 func (s *Session) Resize(cols, rows uint16) error {
 	s.mu.Lock()
@@ -42,6 +42,31 @@ done:
 	}
 }
 
+// TestSessionExitStatus verifies the exit code and terminating signal are
+// recorded once the child process ends.
+func TestSessionExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		argv   []string
+		code   int
+		signal int
+	}{
+		{argv: []string{"sh", "-c", "exit 3"}, code: 3},
+		{argv: []string{"sh", "-c", "kill -KILL $$"}, code: -1, signal: 9},
+	} {
+		s, err := newSession("test-exit", "exit-test", tc.argv, "", nil)
+		if err != nil {
+			t.Fatalf("newSession: %v", err)
+		}
+		for range s.Events() {
+		}
+		exit, ok := s.Exit()
+		if !ok || exit.Code != tc.code || exit.Signal != tc.signal || exit.At.IsZero() {
+			t.Fatalf("%v: Exit()=%+v,%v want code %d signal %d", tc.argv, exit, ok, tc.code, tc.signal)
+		}
+		s.Close()
+	}
+}
+
 // TestSessionResize spawns "sleep 10", calls Resize(200, 50), verifies no error,
 // and closes the session.
 func TestSessionResize(t *testing.T) {
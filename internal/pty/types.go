@@ -17,6 +17,14 @@ type Event struct {
 	Type EventType
 	ID   string
 	Data string
+	At   time.Time // when the output was read; zero for EventClosed
+}
+
+// ExitStatus describes how a session's child process ended.
+type ExitStatus struct {
+	Code   int       `json:"code"`             // -1 when killed by a signal
+	Signal int       `json:"signal,omitempty"` // terminating signal number
+	At     time.Time `json:"at"`
 }
 
 // SessionInfo is a read-only snapshot of session metadata returned by Manager.ListSessions.
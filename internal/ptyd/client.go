@@ -0,0 +1,318 @@
+package ptyd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/user/agenterm/internal/pty"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/vt"
+)
+
+const defaultCallTimeout = 10 * time.Second
+
+var errClientClosed = errors.New("ptyd: client closed")
+
+// Client talks to a running supervisor and satisfies session.TerminalBackend.
+// Closing the client only disconnects; the supervisor keeps the sessions
+// running so a new server process can reattach to them.
+type Client struct {
+	socketPath string
+	timeout    time.Duration
+
+	mu     sync.Mutex // serialises request/response pairs on conn
+	conn   net.Conn
+	sc     *bufio.Scanner
+	closed bool
+
+	attachMu sync.Mutex
+	attached map[net.Conn]struct{} // nil once the client is closed
+}
+
+// Dial connects to the supervisor listening on socketPath.
+func Dial(socketPath string) (*Client, error) {
+	c := &Client{
+		socketPath: socketPath,
+		timeout:    defaultCallTimeout,
+		attached:   make(map[net.Conn]struct{}),
+	}
+	if _, err := c.call(context.Background(), request{Op: opPing}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// PID returns the process id of the supervisor.
+func (c *Client) PID(ctx context.Context) (int, error) {
+	resp, err := c.call(ctx, request{Op: opPing})
+	if err != nil {
+		return 0, err
+	}
+	return resp.PID, nil
+}
+
+func (c *Client) CreateSession(ctx context.Context, id, name, command, workDir string, env []string) (string, error) {
+	resp, err := c.call(ctx, request{Op: opCreate, ID: id, Name: name, Command: command, WorkDir: workDir, Env: env})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// CreateSandboxedSession spawns a session confined to policy.
+func (c *Client) CreateSandboxedSession(ctx context.Context, id, name, command, workDir string, env []string, policy sandbox.Policy) (string, error) {
+	resp, err := c.call(ctx, request{Op: opCreate, ID: id, Name: name, Command: command, WorkDir: workDir, Env: env, Sandbox: &policy})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) DestroySession(ctx context.Context, id string) error {
+	_, err := c.call(ctx, request{Op: opDestroy, ID: id})
+	return err
+}
+
+func (c *Client) SendInput(ctx context.Context, id, data string) error {
+	_, err := c.call(ctx, request{Op: opInput, ID: id, Data: data})
+	return err
+}
+
+func (c *Client) SendKey(ctx context.Context, id, key string) error {
+	_, err := c.call(ctx, request{Op: opKey, ID: id, Key: key})
+	return err
+}
+
+func (c *Client) Resize(ctx context.Context, id string, cols, rows int) error {
+	_, err := c.call(ctx, request{Op: opResize, ID: id, Cols: cols, Rows: rows})
+	return err
+}
+
+func (c *Client) CaptureOutput(ctx context.Context, id string, lines int) ([]string, error) {
+	resp, err := c.call(ctx, request{Op: opCapture, ID: id, Lines: lines})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Lines, nil
+}
+
+// ProcessID returns the pid of a session's child process. The supervisor
+// runs on the same host, so the pid is valid for /proc and cgroups here.
+func (c *Client) ProcessID(ctx context.Context, id string) (int, error) {
+	resp, err := c.call(ctx, request{Op: opProcessID, ID: id})
+	if err != nil {
+		return 0, err
+	}
+	return resp.PID, nil
+}
+
+// ExitStatus returns how a session's process ended, once it has.
+func (c *Client) ExitStatus(ctx context.Context, id string) (pty.ExitStatus, error) {
+	resp, err := c.call(ctx, request{Op: opExitStatus, ID: id})
+	if err != nil {
+		return pty.ExitStatus{}, err
+	}
+	if resp.Exit == nil {
+		return pty.ExitStatus{}, fmt.Errorf("ptyd: no exit status for session %q", id)
+	}
+	return *resp.Exit, nil
+}
+
+// Screen returns the rendered screen the supervisor keeps for a session.
+func (c *Client) Screen(ctx context.Context, id string) (vt.Snapshot, error) {
+	resp, err := c.call(ctx, request{Op: opScreen, ID: id})
+	if err != nil {
+		return vt.Snapshot{}, err
+	}
+	if resp.Screen == nil {
+		return vt.Snapshot{}, fmt.Errorf("ptyd: empty screen response")
+	}
+	return *resp.Screen, nil
+}
+
+// SessionExists reports whether the supervisor has a live session with id.
+// An unreachable supervisor reports false.
+func (c *Client) SessionExists(ctx context.Context, id string) bool {
+	resp, err := c.call(ctx, request{Op: opExists, ID: id})
+	if err != nil {
+		slog.Debug("ptyd exists check failed", "session", id, "error", err)
+		return false
+	}
+	return resp.Exists
+}
+
+// ListSessions returns metadata for every session owned by the supervisor.
+func (c *Client) ListSessions() []pty.SessionInfo {
+	resp, err := c.call(context.Background(), request{Op: opList})
+	if err != nil {
+		slog.Debug("ptyd list sessions failed", "error", err)
+		return nil
+	}
+	infos := make([]pty.SessionInfo, 0, len(resp.Sessions))
+	for _, s := range resp.Sessions {
+		infos = append(infos, pty.SessionInfo{ID: s.ID, Name: s.Name, Active: s.Active, CreatedAt: s.CreatedAt})
+	}
+	return infos
+}
+
+// RecordingPath returns the asciicast file the supervisor writes for a
+// session, or "" when recording is disabled.
+func (c *Client) RecordingPath(id string) string {
+	resp, err := c.call(context.Background(), request{Op: opRecordingPath, ID: id})
+	if err != nil {
+		return ""
+	}
+	return resp.Path
+}
+
+// Events attaches to a session's output stream. The channel ends with an
+// EventClosed when the session exits, and is closed without one if the
+// connection to the supervisor is lost. It returns nil when the session is
+// unknown or the supervisor is unreachable.
+func (c *Client) Events(id string) <-chan pty.Event {
+	conn, err := c.dial()
+	if err != nil {
+		slog.Debug("ptyd attach dial failed", "session", id, "error", err)
+		return nil
+	}
+	sc := newScanner(conn)
+	resp, err := roundTrip(conn, sc, request{Op: opAttach, ID: id}, time.Now().Add(c.timeout))
+	if err == nil && !resp.OK {
+		err = errors.New(resp.Error)
+	}
+	if err != nil {
+		_ = conn.Close()
+		slog.Debug("ptyd attach failed", "session", id, "error", err)
+		return nil
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	c.attachMu.Lock()
+	if c.attached == nil {
+		c.attachMu.Unlock()
+		_ = conn.Close()
+		return nil
+	}
+	c.attached[conn] = struct{}{}
+	c.attachMu.Unlock()
+
+	out := make(chan pty.Event, 1024)
+	go func() {
+		defer close(out)
+		defer func() {
+			c.attachMu.Lock()
+			delete(c.attached, conn)
+			c.attachMu.Unlock()
+			_ = conn.Close()
+		}()
+		for sc.Scan() {
+			var evt streamEvent
+			if err := json.Unmarshal(sc.Bytes(), &evt); err != nil {
+				continue
+			}
+			switch evt.Type {
+			case eventOutput:
+				out <- pty.Event{Type: pty.EventOutput, ID: id, Data: evt.Data, At: evt.At}
+			case eventClosed:
+				out <- pty.Event{Type: pty.EventClosed, ID: id}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Close disconnects from the supervisor. Sessions keep running.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		c.sc = nil
+	}
+	c.mu.Unlock()
+
+	c.attachMu.Lock()
+	for conn := range c.attached {
+		_ = conn.Close()
+	}
+	c.attached = nil
+	c.attachMu.Unlock()
+}
+
+// call sends one request on the shared control connection, reconnecting if
+// a previous call broke it. Supervisor-side failures are returned with the
+// backend's original message.
+func (c *Client) call(ctx context.Context, req request) (response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return response{}, errClientClosed
+	}
+	if c.conn == nil {
+		conn, err := c.dial()
+		if err != nil {
+			return response{}, err
+		}
+		c.conn = conn
+		c.sc = newScanner(conn)
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	if ctx != nil {
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+	}
+	resp, err := roundTrip(c.conn, c.sc, req, deadline)
+	if err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		c.sc = nil
+		return response{}, fmt.Errorf("ptyd: %s: %w", req.Op, err)
+	}
+	if !resp.OK {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", c.socketPath, c.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("ptyd: connect %s: %w", c.socketPath, err)
+	}
+	return conn, nil
+}
+
+func roundTrip(conn net.Conn, sc *bufio.Scanner, req request, deadline time.Time) (response, error) {
+	_ = conn.SetDeadline(deadline)
+	line, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		return response{}, err
+	}
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return response{}, err
+		}
+		return response{}, io.EOF
+	}
+	var resp response
+	if err := json.Unmarshal(sc.Bytes(), &resp); err != nil {
+		return response{}, err
+	}
+	return resp, nil
+}
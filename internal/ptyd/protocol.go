@@ -0,0 +1,87 @@
+// Package ptyd implements the out-of-process PTY supervisor ("agenterm ptyd")
+// and the client the server uses to talk to it.
+//
+// The supervisor owns every agent PTY, so restarting or upgrading the server
+// does not kill running agents: on startup the server reconnects to the
+// supervisor socket and reattaches to the sessions that are still alive.
+//
+// The wire protocol is newline-delimited JSON over a Unix socket. A
+// connection carries a sequence of request/response pairs, except for
+// "attach", which answers once and then turns the connection into a stream
+// of session events until the session closes or either side hangs up.
+package ptyd
+
+import (
+	"time"
+
+	"github.com/user/agenterm/internal/pty"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/vt"
+)
+
+const (
+	opPing          = "ping"
+	opCreate        = "create"
+	opDestroy       = "destroy"
+	opInput         = "input"
+	opKey           = "key"
+	opResize        = "resize"
+	opCapture       = "capture"
+	opExists        = "exists"
+	opList          = "list"
+	opRecordingPath = "recording_path"
+	opScreen        = "screen"
+	opProcessID     = "process_id"
+	opExitStatus    = "exit_status"
+	opAttach        = "attach"
+)
+
+const (
+	eventOutput = "output"
+	eventClosed = "closed"
+)
+
+// maxMessageSize bounds a single protocol line. Pasted input and captured
+// scrollback can be large, so this is well above the PTY read size.
+const maxMessageSize = 8 << 20
+
+type request struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Command string          `json:"command,omitempty"`
+	WorkDir string          `json:"work_dir,omitempty"`
+	Env     []string        `json:"env,omitempty"`
+	Sandbox *sandbox.Policy `json:"sandbox,omitempty"`
+	Data    string          `json:"data,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	Cols    int             `json:"cols,omitempty"`
+	Rows    int             `json:"rows,omitempty"`
+	Lines   int             `json:"lines,omitempty"`
+}
+
+type response struct {
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Exists   bool            `json:"exists,omitempty"`
+	Lines    []string        `json:"lines,omitempty"`
+	Sessions []sessionInfo   `json:"sessions,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	PID      int             `json:"pid,omitempty"`
+	Screen   *vt.Snapshot    `json:"screen,omitempty"`
+	Exit     *pty.ExitStatus `json:"exit,omitempty"`
+}
+
+type sessionInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type streamEvent struct {
+	Type string    `json:"type"`
+	Data string    `json:"data,omitempty"`
+	At   time.Time `json:"at,omitempty"`
+}
@@ -0,0 +1,304 @@
+package ptyd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/user/agenterm/internal/pty"
+)
+
+// Server exposes a pty.Backend over a Unix socket.
+type Server struct {
+	backend *pty.Backend
+
+	mu      sync.Mutex
+	streams map[string]map[*subscriber]struct{} // live sessions -> attached clients
+	conns   map[net.Conn]struct{}
+}
+
+type subscriber struct {
+	events chan pty.Event
+}
+
+// NewServer creates a Server that owns backend. The backend's sessions are
+// closed by the caller once Serve returns.
+func NewServer(backend *pty.Backend) *Server {
+	return &Server{
+		backend: backend,
+		streams: make(map[string]map[*subscriber]struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve listens on socketPath until ctx is cancelled. It refuses to start
+// when another supervisor is already answering on the socket, and removes a
+// stale socket file left behind by a crashed one.
+func (s *Server) Serve(ctx context.Context, socketPath string) error {
+	if err := prepareSocket(socketPath); err != nil {
+		return err
+	}
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("ptyd: listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		_ = ln.Close()
+		return fmt.Errorf("ptyd: restrict socket permissions: %w", err)
+	}
+	defer os.Remove(socketPath)
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ptyd: accept: %w", err)
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+func prepareSocket(socketPath string) error {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o700); err != nil {
+		return fmt.Errorf("ptyd: create socket dir: %w", err)
+	}
+	if _, err := os.Stat(socketPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("ptyd: already running on %s", socketPath)
+	}
+	if err := os.Remove(socketPath); err != nil {
+		return fmt.Errorf("ptyd: remove stale socket: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	sc := newScanner(conn)
+	enc := json.NewEncoder(conn)
+	for sc.Scan() {
+		var req request
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			if enc.Encode(response{Error: "invalid request"}) != nil {
+				return
+			}
+			continue
+		}
+		if req.Op == opAttach {
+			s.attach(conn, enc, req.ID)
+			return
+		}
+		if err := enc.Encode(s.handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(req request) response {
+	ctx := context.Background()
+	fail := func(err error) response { return response{Error: err.Error()} }
+
+	switch req.Op {
+	case opPing:
+		return response{OK: true, PID: os.Getpid()}
+	case opCreate:
+		var id string
+		var err error
+		if req.Sandbox != nil {
+			id, err = s.backend.CreateSandboxedSession(ctx, req.ID, req.Name, req.Command, req.WorkDir, req.Env, *req.Sandbox)
+		} else {
+			id, err = s.backend.CreateSession(ctx, req.ID, req.Name, req.Command, req.WorkDir, req.Env)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		s.startStream(id)
+		return response{OK: true, ID: id}
+	case opDestroy:
+		if err := s.backend.DestroySession(ctx, req.ID); err != nil {
+			return fail(err)
+		}
+		return response{OK: true}
+	case opInput:
+		if err := s.backend.SendInput(ctx, req.ID, req.Data); err != nil {
+			return fail(err)
+		}
+		return response{OK: true}
+	case opKey:
+		if err := s.backend.SendKey(ctx, req.ID, req.Key); err != nil {
+			return fail(err)
+		}
+		return response{OK: true}
+	case opResize:
+		if err := s.backend.Resize(ctx, req.ID, req.Cols, req.Rows); err != nil {
+			return fail(err)
+		}
+		return response{OK: true}
+	case opCapture:
+		lines, err := s.backend.CaptureOutput(ctx, req.ID, req.Lines)
+		if err != nil {
+			return fail(err)
+		}
+		return response{OK: true, Lines: lines}
+	case opProcessID:
+		pid, err := s.backend.ProcessID(ctx, req.ID)
+		if err != nil {
+			return fail(err)
+		}
+		return response{OK: true, PID: pid}
+	case opExitStatus:
+		exit, err := s.backend.ExitStatus(ctx, req.ID)
+		if err != nil {
+			return fail(err)
+		}
+		return response{OK: true, Exit: &exit}
+	case opScreen:
+		snap, err := s.backend.Screen(ctx, req.ID)
+		if err != nil {
+			return fail(err)
+		}
+		return response{OK: true, Screen: &snap}
+	case opExists:
+		return response{OK: true, Exists: s.backend.SessionExists(ctx, req.ID)}
+	case opList:
+		infos := s.backend.ListSessions()
+		sessions := make([]sessionInfo, 0, len(infos))
+		for _, info := range infos {
+			sessions = append(sessions, sessionInfo{ID: info.ID, Name: info.Name, Active: info.Active, CreatedAt: info.CreatedAt})
+		}
+		return response{OK: true, Sessions: sessions}
+	case opRecordingPath:
+		return response{OK: true, Path: s.backend.RecordingPath(req.ID)}
+	default:
+		return response{Error: fmt.Sprintf("unsupported op %q", req.Op)}
+	}
+}
+
+// startStream takes over the backend's event channel for a new session and
+// fans it out to every attached client.
+func (s *Server) startStream(id string) {
+	events := s.backend.Events(id)
+	if events == nil {
+		return
+	}
+	s.mu.Lock()
+	s.streams[id] = make(map[*subscriber]struct{})
+	s.mu.Unlock()
+
+	go func() {
+		for evt := range events {
+			if evt.Type != pty.EventOutput {
+				continue
+			}
+			s.mu.Lock()
+			for sub := range s.streams[id] {
+				select {
+				case sub.events <- evt:
+				default:
+					// Drop if the client is slow; it can recapture output.
+				}
+			}
+			s.mu.Unlock()
+		}
+		s.mu.Lock()
+		for sub := range s.streams[id] {
+			close(sub.events)
+		}
+		delete(s.streams, id)
+		s.mu.Unlock()
+	}()
+}
+
+func (s *Server) subscribe(id string) (*subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs, ok := s.streams[id]
+	if !ok {
+		return nil, fmt.Errorf("pty: session %q not found", id)
+	}
+	sub := &subscriber{events: make(chan pty.Event, 1024)}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+func (s *Server) unsubscribe(id string, sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams[id], sub)
+}
+
+// attach streams a session's output to conn until the session ends or the
+// client disconnects. The stream always ends with a "closed" event when the
+// session itself has exited.
+func (s *Server) attach(conn net.Conn, enc *json.Encoder, id string) {
+	sub, err := s.subscribe(id)
+	if err != nil {
+		_ = enc.Encode(response{Error: err.Error()})
+		return
+	}
+	defer s.unsubscribe(id, sub)
+	if err := enc.Encode(response{OK: true, ID: id}); err != nil {
+		return
+	}
+
+	hangup := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(hangup)
+	}()
+
+	for {
+		select {
+		case evt, ok := <-sub.events:
+			if !ok {
+				_ = enc.Encode(streamEvent{Type: eventClosed})
+				return
+			}
+			if err := enc.Encode(streamEvent{Type: eventOutput, Data: evt.Data, At: evt.At}); err != nil {
+				slog.Debug("ptyd attach write failed", "session", id, "error", err)
+				return
+			}
+		case <-hangup:
+			return
+		}
+	}
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	return sc
+}
@@ -0,0 +1,180 @@
+package ptyd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/pty"
+)
+
+// startServer runs a supervisor on a short socket path (Unix socket paths
+// are limited to ~100 bytes, which t.TempDir can exceed).
+func startServer(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ptyd")
+	if err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	socketPath := filepath.Join(dir, "s.sock")
+
+	backend := pty.NewBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewServer(backend).Serve(ctx, socketPath) }()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not create socket")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		backend.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return socketPath
+}
+
+func waitForOutput(t *testing.T, events <-chan pty.Event, want string) {
+	t.Helper()
+	var got strings.Builder
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				t.Fatalf("event stream ended before %q; got %q", want, got.String())
+			}
+			got.WriteString(evt.Data)
+			if strings.Contains(got.String(), want) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q; got %q", want, got.String())
+		}
+	}
+}
+
+func TestClientReattachesAfterDisconnect(t *testing.T) {
+	socketPath := startServer(t)
+	ctx := context.Background()
+
+	first, err := Dial(socketPath)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := first.CreateSession(ctx, "s1", "shell", "cat", os.TempDir(), nil); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	events := first.Events("s1")
+	if events == nil {
+		t.Fatalf("attach returned nil")
+	}
+	if err := first.SendInput(ctx, "s1", "before-restart\n"); err != nil {
+		t.Fatalf("send input: %v", err)
+	}
+	waitForOutput(t, events, "before-restart")
+
+	// Simulate a server restart: the client goes away, the session stays.
+	first.Close()
+	for range events {
+	}
+
+	second, err := Dial(socketPath)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer second.Close()
+	if !second.SessionExists(ctx, "s1") {
+		t.Fatalf("session did not survive client disconnect")
+	}
+	infos := second.ListSessions()
+	if len(infos) != 1 || infos[0].ID != "s1" || !infos[0].Active {
+		t.Fatalf("sessions=%+v", infos)
+	}
+
+	events = second.Events("s1")
+	if events == nil {
+		t.Fatalf("reattach returned nil")
+	}
+	if err := second.SendInput(ctx, "s1", "after-restart\n"); err != nil {
+		t.Fatalf("send input after reattach: %v", err)
+	}
+	waitForOutput(t, events, "after-restart")
+
+	lines, err := second.CaptureOutput(ctx, "s1", 50)
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if joined := strings.Join(lines, "\n"); !strings.Contains(joined, "before-restart") {
+		t.Fatalf("capture lost output from before reattach: %q", joined)
+	}
+	if pid, err := second.ProcessID(ctx, "s1"); err != nil || pid <= 0 || pid == os.Getpid() {
+		t.Fatalf("ProcessID=%d err=%v", pid, err)
+	}
+	screen, err := second.Screen(ctx, "s1")
+	if err != nil {
+		t.Fatalf("screen: %v", err)
+	}
+	if joined := strings.Join(screen.Lines, "\n"); !strings.Contains(joined, "after-restart") || screen.Cols == 0 {
+		t.Fatalf("screen=%+v missing live output", screen)
+	}
+
+	if err := second.DestroySession(ctx, "s1"); err != nil {
+		t.Fatalf("destroy: %v", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				t.Fatalf("stream ended without closed event")
+			}
+			if evt.Type == pty.EventClosed {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for closed event")
+		}
+	}
+}
+
+func TestClientReportsBackendErrors(t *testing.T) {
+	socketPath := startServer(t)
+	client, err := Dial(socketPath)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	err = client.SendInput(context.Background(), "missing", "x")
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("SendInput error=%v, want not found", err)
+	}
+	if client.Events("missing") != nil {
+		t.Fatalf("attach to missing session should return nil")
+	}
+	// The control connection is still usable after an error response.
+	if _, err := client.PID(context.Background()); err != nil {
+		t.Fatalf("ping after error: %v", err)
+	}
+}
+
+func TestServeRefusesSecondSupervisor(t *testing.T) {
+	socketPath := startServer(t)
+	err := NewServer(pty.NewBackend()).Serve(context.Background(), socketPath)
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("Serve error=%v, want already running", err)
+	}
+}
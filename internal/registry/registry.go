@@ -3,6 +3,7 @@ package registry
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/user/agenterm/internal/responder"
+	"github.com/user/agenterm/internal/usage"
 	"gopkg.in/yaml.v3"
 )
 
@@ -218,6 +221,39 @@ func validate(cfg *AgentConfig) error {
 		cfg.OrchestratorAPIKey = ""
 		cfg.OrchestratorAPIBase = ""
 	}
+	if err := cfg.Limits.Validate(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	if err := cfg.Env.Validate(); err != nil {
+		return fmt.Errorf("env: %w", err)
+	}
+	cfg.Sandbox.Mode = strings.ToLower(strings.TrimSpace(cfg.Sandbox.Mode))
+	if err := cfg.Sandbox.Validate(); err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+	if err := cfg.Paste.Validate(); err != nil {
+		return fmt.Errorf("paste: %w", err)
+	}
+	if err := cfg.AgentSession.Validate(); err != nil {
+		return fmt.Errorf("agent_session: %w", err)
+	}
+	if err := cfg.Completion.Validate(); err != nil {
+		return fmt.Errorf("completion: %w", err)
+	}
+	for i := range cfg.Watchdog {
+		rule := &cfg.Watchdog[i]
+		rule.Trigger = strings.ToLower(strings.TrimSpace(rule.Trigger))
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("watchdog rule %d: %w", i+1, err)
+		}
+	}
+	if err := cfg.Usage.Validate(); err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	if err := cfg.Responder.Compile(); err != nil {
+		return err
+	}
 	cfg.Notes = strings.TrimSpace(cfg.Notes)
 	if cfg.Capabilities == nil {
 		cfg.Capabilities = []string{}
@@ -245,5 +281,29 @@ func cloneConfig(cfg *AgentConfig) *AgentConfig {
 	out := *cfg
 	out.Capabilities = append([]string(nil), cfg.Capabilities...)
 	out.Languages = append([]string(nil), cfg.Languages...)
+	out.Env = maps.Clone(cfg.Env)
+	out.Sandbox.AllowRead = append([]string(nil), cfg.Sandbox.AllowRead...)
+	out.Sandbox.AllowWrite = append([]string(nil), cfg.Sandbox.AllowWrite...)
+	out.Completion.Roles = maps.Clone(cfg.Completion.Roles)
+	if cfg.Watchdog != nil {
+		out.Watchdog = make([]WatchdogRule, len(cfg.Watchdog))
+		for i, rule := range cfg.Watchdog {
+			rule.Roles = append([]string(nil), rule.Roles...)
+			out.Watchdog[i] = rule
+		}
+	}
+	out.Usage.Patterns = append([]usage.Pattern(nil), cfg.Usage.Patterns...)
+	if cfg.Usage.Log != nil {
+		log := *cfg.Usage.Log
+		out.Usage.Log = &log
+	}
+	if cfg.Responder != nil {
+		out.Responder = make(responder.Rules, len(cfg.Responder))
+		for i, rule := range cfg.Responder {
+			rule.Agents = append([]string(nil), rule.Agents...)
+			rule.Roles = append([]string(nil), rule.Roles...)
+			out.Responder[i] = rule
+		}
+	}
 	return &out
 }
@@ -4,6 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/user/agenterm/internal/completion"
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/usage"
 )
 
 func TestNewRegistryCreatesDefaults(t *testing.T) {
@@ -26,6 +30,11 @@ func TestNewRegistryCreatesDefaults(t *testing.T) {
 			t.Fatalf("default file missing for %q: %v", id, err)
 		}
 	}
+	for _, id := range []string{"claude-code", "codex"} {
+		if cfg := r.Get(id).Usage; cfg.Log == nil || cfg.InputUSDPerMTok == 0 || cfg.OutputUSDPerMTok == 0 {
+			t.Fatalf("default agent %q has no priced usage log: %+v", id, cfg)
+		}
+	}
 }
 
 func TestNewRegistryValidationFailure(t *testing.T) {
@@ -93,6 +102,27 @@ func TestRegistrySaveValidation(t *testing.T) {
 	if err := r.Save(&AgentConfig{ID: "ok-id", Name: "N", Model: "m", Command: "c", MaxParallelAgents: 100}); err == nil {
 		t.Fatalf("expected max_parallel_agents validation error")
 	}
+
+	for _, paste := range []PasteConfig{{ChunkSize: -1}, {FileThreshold: 100, FileTemplate: "Read the prompt file"}} {
+		if err := r.Save(&AgentConfig{ID: "ok-id", Name: "N", Model: "m", Command: "c", Paste: paste}); err == nil {
+			t.Fatalf("expected paste validation error for %+v", paste)
+		}
+	}
+
+	for _, rule := range []WatchdogRule{{Trigger: "stalled", Action: "notify"}, {Trigger: "no_commit", Action: "notify"}, {Trigger: "repeated_output", Repeats: 3, Action: "nudge"}} {
+		if err := r.Save(&AgentConfig{ID: "ok-id", Name: "N", Model: "m", Command: "c", Watchdog: []WatchdogRule{rule}}); err == nil {
+			t.Fatalf("expected watchdog validation error for %+v", rule)
+		}
+	}
+
+	bad := completion.Detector{FileExists: "/abs/done"}
+	if err := r.Save(&AgentConfig{ID: "ok-id", Name: "N", Model: "m", Command: "c", Completion: completion.Config{Roles: map[string]completion.Config{"qa": {Done: &bad}}}}); err == nil {
+		t.Fatalf("expected completion validation error")
+	}
+
+	if err := r.Save(&AgentConfig{ID: "ok-id", Name: "N", Model: "m", Command: "c", Usage: usage.Config{Patterns: []usage.Pattern{{Regex: `cost: (\d+)`}}}}); err == nil {
+		t.Fatalf("expected usage validation error")
+	}
 }
 
 func TestRegistryDeleteSupportsYMLExtension(t *testing.T) {
@@ -155,3 +185,37 @@ func TestRegistrySaveNormalizesModelAndParallel(t *testing.T) {
 		t.Fatalf("Notes = %q, want %q", got.Notes, "test notes")
 	}
 }
+
+func TestNewRegistryLoadsEnvWithUnset(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "agents")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	yaml := "id: env-agent\nname: Env Agent\ncommand: run\nenv:\n    https_proxy: http://127.0.0.1:10808\n    PORT: 8080\n    NO_PROXY: null\n"
+	if err := os.WriteFile(filepath.Join(dir, "env-agent.yaml"), []byte(yaml), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	r, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	got := r.Get("env-agent")
+	if got == nil {
+		t.Fatalf("expected env-agent")
+	}
+	if v := got.Env["https_proxy"]; v == nil || *v != "http://127.0.0.1:10808" {
+		t.Fatalf("https_proxy = %v", v)
+	}
+	if v := got.Env["PORT"]; v == nil || *v != "8080" {
+		t.Fatalf("PORT = %v", v)
+	}
+	if v, ok := got.Env["NO_PROXY"]; !ok || v != nil {
+		t.Fatalf("NO_PROXY = %v (present %v), want unset entry", v, ok)
+	}
+
+	bad := &AgentConfig{ID: "bad-env", Name: "Bad", Command: "run", Env: environ.Set("BAD-NAME", "x")}
+	if err := r.Save(bad); err == nil {
+		t.Fatalf("expected invalid env name error")
+	}
+}
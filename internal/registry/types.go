@@ -1,5 +1,19 @@
 package registry
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/user/agenterm/internal/completion"
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/responder"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/usage"
+)
+
 type AgentConfig struct {
 	ID                    string   `yaml:"id" json:"id"`
 	Name                  string   `yaml:"name" json:"name"`
@@ -19,5 +33,203 @@ type AgentConfig struct {
 	SupportsSessionResume bool     `yaml:"supports_session_resume" json:"supports_session_resume"`
 	SupportsHeadless      bool     `yaml:"supports_headless" json:"supports_headless"`
 	AutoAcceptMode        string   `yaml:"auto_accept_mode,omitempty" json:"auto_accept_mode,omitempty"`
-	Notes                 string   `yaml:"notes,omitempty" json:"notes,omitempty"`
+	// Limits cap each session of this agent; project limits may tighten them.
+	Limits resources.Limits `yaml:"limits,omitempty" json:"limits"`
+	// Env is the base environment layer of this agent's sessions, extended
+	// or overridden by project and task env. A null value unsets a variable.
+	Env environ.Map `yaml:"env,omitempty" json:"env,omitempty"`
+	// Sandbox confines the agent's filesystem access to its worktree.
+	Sandbox sandbox.Config `yaml:"sandbox,omitempty" json:"sandbox,omitempty"`
+	// Paste controls how send_text payloads are typed into the agent's TUI.
+	Paste PasteConfig `yaml:"paste,omitempty" json:"paste,omitempty"`
+	// AgentSession tells how to learn the agent's own conversation ID, which
+	// resume_command can use as {agent_session_id}.
+	AgentSession AgentSessionConfig `yaml:"agent_session,omitempty" json:"agent_session,omitempty"`
+	// Completion decides when this agent's sessions are done or ready for
+	// review, optionally per role.
+	Completion completion.Config `yaml:"completion,omitempty" json:"completion,omitempty"`
+	// Watchdog lists the rules that detect stuck sessions of this agent.
+	Watchdog []WatchdogRule `yaml:"watchdog,omitempty" json:"watchdog,omitempty"`
+	// Usage tells how to read token usage and cost from this agent's
+	// output or usage log.
+	Usage usage.Config `yaml:"usage,omitempty" json:"usage,omitempty"`
+	// Responder answers this agent's prompts while no human is attached;
+	// project rules are tried first.
+	Responder responder.Rules `yaml:"responder,omitempty" json:"responder,omitempty"`
+	Notes     string          `yaml:"notes,omitempty" json:"notes,omitempty"`
+}
+
+// PasteConfig controls delivery of text to an agent. The zero value writes
+// the text in one go, as typed input.
+type PasteConfig struct {
+	// Bracketed wraps the text in bracketed paste sequences so that
+	// newlines are inserted instead of submitting each line. Only enable it
+	// for TUIs that turn on bracketed paste mode.
+	Bracketed bool `yaml:"bracketed,omitempty" json:"bracketed,omitempty"`
+	// ChunkSize splits writes into pieces of at most this many bytes; 0
+	// writes the text at once.
+	ChunkSize int `yaml:"chunk_size,omitempty" json:"chunk_size,omitempty"`
+	// ChunkDelayMS paces chunked writes.
+	ChunkDelayMS int `yaml:"chunk_delay_ms,omitempty" json:"chunk_delay_ms,omitempty"`
+	// SubmitDelayMS waits between the text and the Enter that submits it,
+	// giving the TUI time to finish processing the paste.
+	SubmitDelayMS int `yaml:"submit_delay_ms,omitempty" json:"submit_delay_ms,omitempty"`
+	// FileThreshold writes texts longer than this many bytes to a file in
+	// the worktree and sends a reference to it instead; 0 disables it.
+	FileThreshold int `yaml:"file_threshold,omitempty" json:"file_threshold,omitempty"`
+	// FileTemplate is the reference sent for such files; {path} is replaced
+	// by the file's path relative to the worktree.
+	FileTemplate string `yaml:"file_template,omitempty" json:"file_template,omitempty"`
+}
+
+// Validate rejects negative sizes and delays.
+func (p PasteConfig) Validate() error {
+	switch {
+	case p.ChunkSize < 0:
+		return errors.New("chunk_size must be >= 0")
+	case p.ChunkDelayMS < 0:
+		return errors.New("chunk_delay_ms must be >= 0")
+	case p.SubmitDelayMS < 0:
+		return errors.New("submit_delay_ms must be >= 0")
+	case p.FileThreshold < 0:
+		return errors.New("file_threshold must be >= 0")
+	case p.FileTemplate != "" && !strings.Contains(p.FileTemplate, "{path}"):
+		return errors.New("file_template must contain {path}")
+	}
+	return nil
+}
+
+// AgentSessionIDPlaceholder is replaced by a session's agent session ID in
+// start_flag and resume_command.
+const AgentSessionIDPlaceholder = "{agent_session_id}"
+
+// AgentSessionConfig captures the agent's own ID for a session's
+// conversation. The sources are tried in order: StartFlag, Output, Files.
+type AgentSessionConfig struct {
+	// StartFlag is appended to the command of new sessions with
+	// {agent_session_id} replaced by a generated UUID, e.g.
+	// "--session-id {agent_session_id}".
+	StartFlag string `yaml:"start_flag,omitempty" json:"start_flag,omitempty"`
+	// Output is a regular expression whose "id" group captures the ID from
+	// the session's output.
+	Output string `yaml:"output,omitempty" json:"output,omitempty"`
+	// Files is a glob of the agent's session files; ~, {work_dir} and
+	// {work_dir_slug} are expanded as for usage logs. The first file
+	// written after the session started that no other session claims
+	// names the ID.
+	Files string `yaml:"files,omitempty" json:"files,omitempty"`
+	// FilePattern is a regular expression whose "id" group captures the ID
+	// from a file's base name; by default the name without extension is
+	// the ID.
+	FilePattern string `yaml:"file_pattern,omitempty" json:"file_pattern,omitempty"`
+	// FileWorkDir, when set, is the field of a file's first JSON entry
+	// holding the directory the agent ran in; only files recorded in the
+	// session's work directory are considered.
+	FileWorkDir string `yaml:"file_work_dir,omitempty" json:"file_work_dir,omitempty"`
+}
+
+// IsZero reports whether c captures nothing.
+func (c AgentSessionConfig) IsZero() bool {
+	return c.StartFlag == "" && c.Output == "" && c.Files == ""
+}
+
+// Validate checks the placeholder and that patterns compile with an "id"
+// group.
+func (c AgentSessionConfig) Validate() error {
+	if c.StartFlag != "" && !strings.Contains(c.StartFlag, AgentSessionIDPlaceholder) {
+		return errors.New("start_flag must contain " + AgentSessionIDPlaceholder)
+	}
+	if c.FilePattern != "" && c.Files == "" {
+		return errors.New("file_pattern needs files")
+	}
+	for _, field := range []struct{ name, pattern string }{{"output", c.Output}, {"file_pattern", c.FilePattern}} {
+		name, pattern := field.name, field.pattern
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if re.SubexpIndex("id") < 0 {
+			return fmt.Errorf("%s needs a (?P<id>...) group", name)
+		}
+	}
+	return nil
+}
+
+// Watchdog triggers.
+const (
+	// WatchdogMaxWallTime fires once a session has run for After.
+	WatchdogMaxWallTime = "max_wall_time"
+	// WatchdogNoCommit fires when the worktree gets no commit for After.
+	WatchdogNoCommit = "no_commit"
+	// WatchdogRepeatedOutput fires when the last Repeats output lines are
+	// identical.
+	WatchdogRepeatedOutput = "repeated_output"
+	// WatchdogUnansweredPrompt fires when the agent has waited at a prompt
+	// for After while no human is attached.
+	WatchdogUnansweredPrompt = "unanswered_prompt"
+)
+
+// Watchdog actions.
+const (
+	WatchdogNotify    = "notify"
+	WatchdogInterrupt = "interrupt"
+	WatchdogNudge     = "nudge"
+	WatchdogTerminate = "terminate"
+)
+
+// WatchdogRule is a stuck-session check and what to do when it fires.
+type WatchdogRule struct {
+	Trigger string `yaml:"trigger" json:"trigger"`
+	// Roles limits the rule to sessions of these roles; empty applies it to
+	// every role.
+	Roles []string `yaml:"roles,omitempty" json:"roles,omitempty"`
+	// AfterSeconds is the wall time, commit window or prompt timeout.
+	AfterSeconds int `yaml:"after_seconds,omitempty" json:"after_seconds,omitempty"`
+	// Repeats is the number of identical lines repeated_output looks for.
+	Repeats int    `yaml:"repeats,omitempty" json:"repeats,omitempty"`
+	Action  string `yaml:"action" json:"action"`
+	// Message is the text a nudge sends to the agent.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// AppliesTo reports whether the rule covers sessions of role.
+func (r WatchdogRule) AppliesTo(role string) bool {
+	if len(r.Roles) == 0 {
+		return true
+	}
+	for _, candidate := range r.Roles {
+		if strings.EqualFold(candidate, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the trigger, its threshold and the action.
+func (r WatchdogRule) Validate() error {
+	switch r.Trigger {
+	case WatchdogMaxWallTime, WatchdogNoCommit, WatchdogUnansweredPrompt:
+		if r.AfterSeconds <= 0 {
+			return fmt.Errorf("%s requires after_seconds > 0", r.Trigger)
+		}
+	case WatchdogRepeatedOutput:
+		if r.Repeats < 2 {
+			return errors.New("repeated_output requires repeats >= 2")
+		}
+	default:
+		return fmt.Errorf("unsupported trigger %q", r.Trigger)
+	}
+	switch r.Action {
+	case WatchdogNotify, WatchdogInterrupt, WatchdogTerminate:
+	case WatchdogNudge:
+		if strings.TrimSpace(r.Message) == "" {
+			return errors.New("nudge requires a message")
+		}
+	default:
+		return fmt.Errorf("unsupported action %q", r.Action)
+	}
+	return nil
 }
@@ -0,0 +1,143 @@
+//go:build linux
+
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cpuPeriodMicros = 100000
+
+// Apply limits l to the process tree rooted at pid. When cgroupRoot is a
+// writable cgroup v2 directory, a child cgroup named after name is created
+// under it and pid is moved into it. Otherwise, or when that fails, every
+// limit is reported unenforced for the caller to check reactively: an
+// address-space rlimit would stand in for memory_mb, but runtimes such as
+// Node reserve far more virtual memory than they use and abort under one.
+// Wall clock limits are never applied here; the caller owns the timer.
+func Apply(pid int, name string, l Limits, cgroupRoot string) (Enforcement, error) {
+	if pid <= 0 {
+		return Enforcement{Mechanism: MechanismNone}, fmt.Errorf("invalid pid %d", pid)
+	}
+	if l.CPUQuota == 0 && l.MemoryMB == 0 && l.MaxPids == 0 {
+		return Enforcement{Mechanism: MechanismNone}, nil
+	}
+	if strings.TrimSpace(cgroupRoot) == "" {
+		return unenforced(l), nil
+	}
+	enf, err := applyCgroup(pid, name, l, cgroupRoot)
+	if err != nil {
+		return unenforced(l), err
+	}
+	return enf, nil
+}
+
+// Prepare creates the cgroup Apply would move the tree into, so that the
+// launcher of the agent can join it before exec and no early child escapes
+// the limits. It returns the cgroup directory, or "" when limits are not
+// enforced with a cgroup. Apply still has to be called once the agent runs.
+func Prepare(name string, l Limits, cgroupRoot string) (string, error) {
+	if strings.TrimSpace(cgroupRoot) == "" || (l.CPUQuota == 0 && l.MemoryMB == 0 && l.MaxPids == 0) {
+		return "", nil
+	}
+	enf, err := createCgroup(name, l, cgroupRoot)
+	if err != nil {
+		return "", err
+	}
+	return enf.CgroupPath, nil
+}
+
+func unenforced(l Limits) Enforcement {
+	enf := Enforcement{Mechanism: MechanismNone}
+	if l.CPUQuota > 0 {
+		enf.Unenforced = append(enf.Unenforced, "cpu_quota")
+	}
+	if l.MemoryMB > 0 {
+		enf.Unenforced = append(enf.Unenforced, "memory_mb")
+	}
+	if l.MaxPids > 0 {
+		enf.Unenforced = append(enf.Unenforced, "max_pids")
+	}
+	return enf
+}
+
+func applyCgroup(pid int, name string, l Limits, root string) (Enforcement, error) {
+	enf, err := createCgroup(name, l, root)
+	if err != nil {
+		return Enforcement{}, err
+	}
+	if err := os.WriteFile(filepath.Join(enf.CgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		_ = os.Remove(enf.CgroupPath)
+		return Enforcement{}, fmt.Errorf("move pid %d into cgroup: %w", pid, err)
+	}
+	return enf, nil
+}
+
+// createCgroup creates the cgroup of name under root with limits l set.
+func createCgroup(name string, l Limits, root string) (Enforcement, error) {
+	if strings.ContainsAny(name, `/\`) || name == "" {
+		return Enforcement{}, fmt.Errorf("invalid cgroup name %q", name)
+	}
+	// Enabling controllers fails when already enabled or not delegated;
+	// missing ones show up as absent interface files below.
+	for _, c := range []string{"+cpu", "+memory", "+pids"} {
+		_ = os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte(c), 0o644)
+	}
+	dir := filepath.Join(root, "agenterm-"+name)
+	if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return Enforcement{}, fmt.Errorf("create cgroup: %w", err)
+	}
+
+	enf := Enforcement{Mechanism: MechanismCgroup, CgroupPath: dir}
+	set := func(field, file, value string) {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644); err != nil {
+			enf.Unenforced = append(enf.Unenforced, field)
+		}
+	}
+	if l.CPUQuota > 0 {
+		quota := int(l.CPUQuota * cpuPeriodMicros)
+		set("cpu_quota", "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriodMicros))
+	}
+	if l.MemoryMB > 0 {
+		set("memory_mb", "memory.max", strconv.FormatInt(int64(l.MemoryMB)<<20, 10))
+	}
+	if l.MaxPids > 0 {
+		set("max_pids", "pids.max", strconv.Itoa(l.MaxPids))
+	}
+	return enf, nil
+}
+
+// OOMKills returns how many processes the kernel OOM killer has killed in
+// the cgroup created by Apply. It is always 0 for other mechanisms.
+func OOMKills(e Enforcement) (int, error) {
+	if e.Mechanism != MechanismCgroup || e.CgroupPath == "" {
+		return 0, nil
+	}
+	raw, err := os.ReadFile(filepath.Join(e.CgroupPath, "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			return strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	return 0, nil
+}
+
+// Release removes the cgroup created by Apply once its processes have
+// exited. It is a no-op for other mechanisms.
+func Release(e Enforcement) error {
+	if e.Mechanism != MechanismCgroup || e.CgroupPath == "" {
+		return nil
+	}
+	if err := os.Remove(e.CgroupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove cgroup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Package resources applies resource limits to agent process trees and
+// samples their live usage from /proc.
+//
+// Limits are enforced with a cgroup v2 per session when a delegated cgroup
+// root is configured. Limits the active mechanism cannot enforce are
+// reported rather than silently dropped, so callers can apply them
+// reactively.
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned on platforms without /proc or cgroup support.
+var ErrUnsupported = errors.New("resource limits are not supported on this platform")
+
+// Limits caps the resources of one agent process tree. Zero fields are
+// unlimited.
+type Limits struct {
+	// CPUQuota is the number of CPUs the tree may use, e.g. 1.5.
+	CPUQuota float64 `yaml:"cpu_quota,omitempty" json:"cpu_quota,omitempty"`
+	// MemoryMB bounds the memory of the tree in MiB.
+	MemoryMB int `yaml:"memory_mb,omitempty" json:"memory_mb,omitempty"`
+	// MaxPids bounds the number of processes in the tree.
+	MaxPids int `yaml:"max_pids,omitempty" json:"max_pids,omitempty"`
+	// WallClockSeconds terminates the session after it has run this long.
+	WallClockSeconds int `yaml:"wall_clock_seconds,omitempty" json:"wall_clock_seconds,omitempty"`
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// WallClock returns the wall clock limit as a duration.
+func (l Limits) WallClock() time.Duration {
+	return time.Duration(l.WallClockSeconds) * time.Second
+}
+
+// Validate rejects negative limits.
+func (l Limits) Validate() error {
+	switch {
+	case l.CPUQuota < 0:
+		return fmt.Errorf("cpu_quota must be >= 0")
+	case l.MemoryMB < 0:
+		return fmt.Errorf("memory_mb must be >= 0")
+	case l.MaxPids < 0:
+		return fmt.Errorf("max_pids must be >= 0")
+	case l.WallClockSeconds < 0:
+		return fmt.Errorf("wall_clock_seconds must be >= 0")
+	}
+	return nil
+}
+
+// Merge combines two sets of limits, keeping the stricter value of each
+// field. It is used to combine per-agent and per-project limits.
+func (l Limits) Merge(other Limits) Limits {
+	return Limits{
+		CPUQuota:         stricterFloat(l.CPUQuota, other.CPUQuota),
+		MemoryMB:         stricterInt(l.MemoryMB, other.MemoryMB),
+		MaxPids:          stricterInt(l.MaxPids, other.MaxPids),
+		WallClockSeconds: stricterInt(l.WallClockSeconds, other.WallClockSeconds),
+	}
+}
+
+func stricterInt(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+func stricterFloat(a, b float64) float64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Mechanisms reported by Enforcement.
+const (
+	MechanismNone   = "none"
+	MechanismCgroup = "cgroup"
+)
+
+// JoinCommand prefixes the shell command command so that it moves itself
+// into the cgroup directory created by Prepare before exec'ing command.
+// Failing to join is not fatal; Apply moves the tree afterwards.
+func JoinCommand(cgroupDir, command string) string {
+	procs := filepath.Join(cgroupDir, "cgroup.procs")
+	return "echo $$ > " + shellQuote(procs) + " 2>/dev/null; exec sh -c " + shellQuote(command)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Enforcement describes how limits were applied to a process tree.
+type Enforcement struct {
+	Mechanism  string `json:"mechanism"`
+	CgroupPath string `json:"cgroup_path,omitempty"`
+	// Unenforced lists limit fields the mechanism could not apply. The
+	// caller is expected to watch those reactively (e.g. via Sample).
+	Unenforced []string `json:"unenforced,omitempty"`
+}
+
+// Enforces reports whether field (a Limits JSON name) is applied by the
+// kernel rather than needing a reactive check.
+func (e Enforcement) Enforces(field string) bool {
+	if e.Mechanism == MechanismNone {
+		return false
+	}
+	for _, f := range e.Unenforced {
+		if f == field {
+			return false
+		}
+	}
+	return true
+}
+
+// Usage is a point-in-time sample of a process tree.
+type Usage struct {
+	// CPUPercent is the CPU used since the previous sample, where 100 is one
+	// full CPU. The first sample averages over the tree's lifetime.
+	CPUPercent float64   `json:"cpu_percent"`
+	RSSBytes   int64     `json:"rss_bytes"`
+	Processes  int       `json:"processes"`
+	SampledAt  time.Time `json:"sampled_at"`
+}
+
+// Process is one process of a tree as read from /proc.
+type Process struct {
+	PID     int    `json:"pid"`
+	PPID    int    `json:"ppid"`
+	Command string `json:"command"`
+	// Cwd is empty when the process belongs to another user.
+	Cwd      string `json:"cwd,omitempty"`
+	State    string `json:"state"`
+	RSSBytes int64  `json:"rss_bytes"`
+	CPUTicks uint64 `json:"-"`
+	// CPUSeconds is the user and system CPU time used so far.
+	CPUSeconds     float64   `json:"cpu_seconds"`
+	StartedAt      time.Time `json:"started_at"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+}
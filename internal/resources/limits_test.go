@@ -0,0 +1,37 @@
+package resources
+
+import "testing"
+
+func TestMergeKeepsStricterLimits(t *testing.T) {
+	agent := Limits{CPUQuota: 2, MemoryMB: 4096, WallClockSeconds: 3600}
+	project := Limits{CPUQuota: 1.5, MemoryMB: 8192, MaxPids: 256}
+	got := agent.Merge(project)
+	want := Limits{CPUQuota: 1.5, MemoryMB: 4096, MaxPids: 256, WallClockSeconds: 3600}
+	if got != want {
+		t.Fatalf("Merge=%+v want %+v", got, want)
+	}
+	if got := (Limits{}).Merge(Limits{}); !got.IsZero() {
+		t.Fatalf("merge of empty limits=%+v", got)
+	}
+}
+
+func TestValidateRejectsNegativeLimits(t *testing.T) {
+	for _, l := range []Limits{{CPUQuota: -1}, {MemoryMB: -1}, {MaxPids: -1}, {WallClockSeconds: -1}} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted", l)
+		}
+	}
+	if err := (Limits{CPUQuota: 0.5, MemoryMB: 512}).Validate(); err != nil {
+		t.Errorf("Validate valid limits: %v", err)
+	}
+}
+
+func TestEnforcementEnforces(t *testing.T) {
+	e := Enforcement{Mechanism: MechanismCgroup, Unenforced: []string{"max_pids"}}
+	if e.Enforces("max_pids") || !e.Enforces("memory_mb") {
+		t.Fatalf("Enforces mismatch for %+v", e)
+	}
+	if (Enforcement{Mechanism: MechanismNone}).Enforces("memory_mb") {
+		t.Fatalf("none mechanism must not enforce anything")
+	}
+}
@@ -0,0 +1,191 @@
+//go:build linux
+
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of /proc CPU times. It is 100 on every
+// Linux architecture Go supports.
+const clockTicks = 100
+
+var (
+	bootTimeOnce sync.Once
+	bootTime     time.Time
+)
+
+// Tree returns root and all of its descendants. It fails with an
+// os.ErrNotExist error when root is not running.
+func Tree(root int) ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("read /proc: %w", err)
+	}
+	all := make(map[int]Process, len(entries))
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		proc, err := readProcess(pid)
+		if err != nil {
+			continue // exited while scanning
+		}
+		all[pid] = proc
+		children[proc.PPID] = append(children[proc.PPID], pid)
+	}
+	if _, ok := all[root]; !ok {
+		return nil, fmt.Errorf("process %d: %w", root, os.ErrNotExist)
+	}
+
+	tree := []Process{}
+	queue := []int{root}
+	seen := map[int]bool{}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		tree = append(tree, all[pid])
+		queue = append(queue, children[pid]...)
+	}
+	return tree, nil
+}
+
+func readProcess(pid int) (Process, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	raw, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return Process{}, err
+	}
+	// The command name is in parentheses and may itself contain spaces or
+	// parentheses, so fields are split after the last ')'.
+	open := bytes.IndexByte(raw, '(')
+	end := bytes.LastIndexByte(raw, ')')
+	if open < 0 || end < open {
+		return Process{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(raw[end+1:]))
+	if len(fields) < 22 {
+		return Process{}, fmt.Errorf("short stat for pid %d", pid)
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	command := string(raw[open+1 : end])
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		command = strings.TrimSpace(strings.ReplaceAll(string(bytes.TrimRight(cmdline, "\x00")), "\x00", " "))
+	}
+	cwd, _ := os.Readlink(filepath.Join(dir, "cwd"))
+
+	startedAt := bootTimeValue().Add(time.Duration(start) * time.Second / clockTicks)
+	elapsed := time.Since(startedAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return Process{
+		PID:            pid,
+		PPID:           ppid,
+		Command:        command,
+		Cwd:            cwd,
+		State:          fields[0],
+		RSSBytes:       rssPages * int64(os.Getpagesize()),
+		CPUTicks:       utime + stime,
+		CPUSeconds:     float64(utime+stime) / clockTicks,
+		StartedAt:      startedAt,
+		ElapsedSeconds: elapsed,
+	}, nil
+}
+
+func bootTimeValue() time.Time {
+	bootTimeOnce.Do(func() {
+		raw, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			if rest, ok := strings.CutPrefix(line, "btime "); ok {
+				if secs, err := strconv.ParseInt(strings.TrimSpace(rest), 10, 64); err == nil {
+					bootTime = time.Unix(secs, 0)
+				}
+				return
+			}
+		}
+	})
+	return bootTime
+}
+
+// Signal sends sig to pid.
+func Signal(pid int, sig syscall.Signal) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// Sampler computes usage of process trees. CPU is reported relative to the
+// previous sample of the same root, so one Sampler should be shared by all
+// callers sampling a tree.
+type Sampler struct {
+	mu   sync.Mutex
+	prev map[int]cpuSample
+}
+
+type cpuSample struct {
+	ticks uint64
+	at    time.Time
+}
+
+// NewSampler creates a Sampler.
+func NewSampler() *Sampler {
+	return &Sampler{prev: make(map[int]cpuSample)}
+}
+
+// Sample returns the usage of root's process tree.
+func (s *Sampler) Sample(root int) (Usage, error) {
+	tree, err := Tree(root)
+	if err != nil {
+		return Usage{}, err
+	}
+	now := time.Now()
+	usage := Usage{Processes: len(tree), SampledAt: now.UTC()}
+	var ticks uint64
+	for _, p := range tree {
+		usage.RSSBytes += p.RSSBytes
+		ticks += p.CPUTicks
+	}
+
+	s.mu.Lock()
+	prev, ok := s.prev[root]
+	s.prev[root] = cpuSample{ticks: ticks, at: now}
+	s.mu.Unlock()
+	if !ok {
+		prev = cpuSample{at: tree[0].StartedAt}
+	}
+	if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 && ticks >= prev.ticks {
+		usage.CPUPercent = float64(ticks-prev.ticks) / clockTicks / elapsed * 100
+	}
+	return usage, nil
+}
+
+// Forget drops the CPU baseline of root.
+func (s *Sampler) Forget(root int) {
+	s.mu.Lock()
+	delete(s.prev, root)
+	s.mu.Unlock()
+}
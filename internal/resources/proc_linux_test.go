@@ -0,0 +1,134 @@
+//go:build linux
+
+package resources
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func startSleeper(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd
+}
+
+func TestTreeAndSample(t *testing.T) {
+	cmd := startSleeper(t)
+	pid := cmd.Process.Pid
+
+	var tree []Process
+	for i := 0; i < 100; i++ {
+		var err error
+		tree, err = Tree(pid)
+		if err != nil {
+			t.Fatalf("Tree: %v", err)
+		}
+		if len(tree) >= 2 {
+			break
+		}
+	}
+	if len(tree) < 2 || tree[0].PID != pid {
+		t.Fatalf("tree=%+v want shell and sleep child", tree)
+	}
+	if !strings.Contains(tree[1].Command, "sleep") || tree[1].PPID != pid {
+		t.Fatalf("child=%+v", tree[1])
+	}
+
+	s := NewSampler()
+	usage, err := s.Sample(pid)
+	if err != nil {
+		t.Fatalf("Sample: %v", err)
+	}
+	if usage.Processes != len(tree) || usage.RSSBytes <= 0 || usage.CPUPercent < 0 {
+		t.Fatalf("usage=%+v", usage)
+	}
+
+	if _, err := Tree(1 << 30); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Tree(missing) error=%v want ErrNotExist", err)
+	}
+}
+
+func TestApplyWithoutCgroupLeavesLimitsToReactiveChecks(t *testing.T) {
+	cmd := startSleeper(t)
+	enf, err := Apply(cmd.Process.Pid, "t", Limits{MemoryMB: 512, MaxPids: 10}, "")
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if enf.Mechanism != MechanismNone || enf.Enforces("memory_mb") || len(enf.Unenforced) != 2 {
+		t.Fatalf("enforcement=%+v", enf)
+	}
+	raw, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "limits"))
+	if err != nil {
+		t.Fatalf("read limits: %v", err)
+	}
+	if strings.Contains(string(raw), "536870912") {
+		t.Fatalf("address space limit applied:\n%s", raw)
+	}
+}
+
+func TestPrepareCreatesCgroupForLauncherToJoin(t *testing.T) {
+	root := t.TempDir()
+	dir, err := Prepare("s1", Limits{MemoryMB: 256}, root)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if dir != filepath.Join(root, "agenterm-s1") {
+		t.Fatalf("dir=%q", dir)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "memory.max")); err != nil || string(got) != "268435456" {
+		t.Fatalf("memory.max=%q err=%v", got, err)
+	}
+	if dir, err := Prepare("s2", Limits{WallClockSeconds: 60}, root); err != nil || dir != "" {
+		t.Fatalf("Prepare without kernel limits = %q, %v", dir, err)
+	}
+
+	out, err := exec.Command("sh", "-c", JoinCommand(dir, `echo "it's $0"`)).Output()
+	if err != nil {
+		t.Fatalf("run joined command: %v", err)
+	}
+	if string(out) != "it's sh\n" {
+		t.Fatalf("output=%q", out)
+	}
+	if procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")); err != nil || strings.TrimSpace(string(procs)) == "" {
+		t.Fatalf("cgroup.procs=%q err=%v", procs, err)
+	}
+}
+
+func TestApplyCgroupWritesInterfaceFiles(t *testing.T) {
+	root := t.TempDir()
+	enf, err := applyCgroup(4242, "s1", Limits{CPUQuota: 1.5, MemoryMB: 256, MaxPids: 64}, root)
+	if err != nil {
+		t.Fatalf("applyCgroup: %v", err)
+	}
+	if enf.Mechanism != MechanismCgroup || len(enf.Unenforced) != 0 {
+		t.Fatalf("enforcement=%+v", enf)
+	}
+	want := map[string]string{
+		"cpu.max":      "150000 100000",
+		"memory.max":   "268435456",
+		"pids.max":     "64",
+		"cgroup.procs": "4242",
+	}
+	for file, value := range want {
+		got, err := os.ReadFile(filepath.Join(root, "agenterm-s1", file))
+		if err != nil || string(got) != value {
+			t.Errorf("%s=%q err=%v want %q", file, got, err, value)
+		}
+	}
+	if _, err := applyCgroup(1, "../escape", Limits{MaxPids: 1}, root); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+}
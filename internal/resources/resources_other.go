@@ -0,0 +1,40 @@
+//go:build !linux
+
+package resources
+
+import "syscall"
+
+// Apply reports ErrUnsupported when any kernel-enforced limit is set.
+func Apply(pid int, name string, l Limits, cgroupRoot string) (Enforcement, error) {
+	if l.CPUQuota == 0 && l.MemoryMB == 0 && l.MaxPids == 0 {
+		return Enforcement{Mechanism: MechanismNone}, nil
+	}
+	return Enforcement{Mechanism: MechanismNone}, ErrUnsupported
+}
+
+// Prepare is a no-op without cgroups.
+func Prepare(name string, l Limits, cgroupRoot string) (string, error) { return "", nil }
+
+// Release is a no-op without cgroups.
+func Release(Enforcement) error { return nil }
+
+// OOMKills is always 0 without cgroups.
+func OOMKills(Enforcement) (int, error) { return 0, nil }
+
+// Tree is unsupported without /proc.
+func Tree(root int) ([]Process, error) { return nil, ErrUnsupported }
+
+// Signal is unsupported without /proc.
+func Signal(pid int, sig syscall.Signal) error { return ErrUnsupported }
+
+// Sampler is unsupported without /proc.
+type Sampler struct{}
+
+// NewSampler creates a Sampler.
+func NewSampler() *Sampler { return &Sampler{} }
+
+// Sample is unsupported without /proc.
+func (s *Sampler) Sample(root int) (Usage, error) { return Usage{}, ErrUnsupported }
+
+// Forget is a no-op without /proc.
+func (s *Sampler) Forget(root int) {}
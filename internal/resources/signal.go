@@ -0,0 +1,54 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// signals are the signals that may be sent to a session's processes.
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// signalNames names the signals an agent process commonly dies from.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// SignalName returns the conventional name of sig, e.g. "SIGKILL".
+func SignalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
+
+// ParseSignal resolves a signal name such as "TERM" or "SIGKILL". An empty
+// name is SIGTERM.
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	if sig, ok := signals[strings.TrimPrefix(name, "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unsupported signal %q", name)
+}
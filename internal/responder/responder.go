@@ -0,0 +1,232 @@
+// Package responder answers agent prompts from declarative rules while no
+// human is attached to the session.
+package responder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/user/agenterm/internal/parser"
+)
+
+// pathGroup is the regex group naming the file a prompt is about.
+const pathGroup = "path"
+
+// Rule answers prompts whose text matches Match. Exactly one of Action and
+// Answer is set.
+type Rule struct {
+	// Name is reported when the rule answers a prompt; it defaults to the
+	// match pattern.
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Match is a regular expression tested against the prompt text. A
+	// group named "path" captures the file the prompt is about.
+	Match string `yaml:"match" json:"match"`
+	// Agents and Roles limit the rule to sessions of these agents and
+	// roles; empty applies it to all of them.
+	Agents []string `yaml:"agents,omitempty" json:"agents,omitempty"`
+	Roles  []string `yaml:"roles,omitempty" json:"roles,omitempty"`
+	// Action picks the prompt's quick action with this label, e.g. "Yes".
+	// The rule is skipped when the prompt offers no such action.
+	Action string `yaml:"action,omitempty" json:"action,omitempty"`
+	// Answer is typed as is; end it with a newline to submit it.
+	Answer string `yaml:"answer,omitempty" json:"answer,omitempty"`
+	// RequirePathInWorktree skips the rule unless the path group matched a
+	// path inside the session's worktree.
+	RequirePathInWorktree bool `yaml:"require_path_in_worktree,omitempty" json:"require_path_in_worktree,omitempty"`
+
+	// re is Match compiled by Rules.Compile.
+	re *regexp.Regexp
+}
+
+// Rules are tried in order; the first that applies answers the prompt.
+type Rules []Rule
+
+// Validate checks every rule.
+func (rs Rules) Validate() error {
+	for i, rule := range rs {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("responder rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Compile validates every rule and keeps its compiled match pattern, so
+// that prompts are matched without compiling it again. Rules are compiled
+// when they are loaded.
+func (rs Rules) Compile() error {
+	for i := range rs {
+		re, err := rs[i].compile()
+		if err != nil {
+			return fmt.Errorf("responder rule %d: %w", i+1, err)
+		}
+		rs[i].re = re
+	}
+	return nil
+}
+
+// Validate checks that r compiles, answers exactly one way and can check
+// paths when asked to.
+func (r Rule) Validate() error {
+	_, err := r.compile()
+	return err
+}
+
+func (r Rule) compile() (*regexp.Regexp, error) {
+	if strings.TrimSpace(r.Match) == "" {
+		return nil, errors.New("match is required")
+	}
+	re, err := regexp.Compile(r.Match)
+	if err != nil {
+		return nil, fmt.Errorf("match: %w", err)
+	}
+	if (r.Action == "") == (r.Answer == "") {
+		return nil, errors.New("rule must set exactly one of action, answer")
+	}
+	if r.RequirePathInWorktree && re.SubexpIndex(pathGroup) < 0 {
+		return nil, errors.New("require_path_in_worktree needs a (?P<path>...) group in match")
+	}
+	return re, nil
+}
+
+// Label names r in reports.
+func (r Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Match
+}
+
+// Prompt is a prompt waiting for an answer.
+type Prompt struct {
+	Text      string
+	AgentType string
+	Role      string
+	// WorkDir is the session's worktree, used by RequirePathInWorktree.
+	WorkDir string
+	// Actions are the quick actions the parser offers for the prompt.
+	Actions []parser.QuickAction
+}
+
+// Response is how a rule answers a prompt.
+type Response struct {
+	Rule Rule
+	// Label is the chosen quick action's label, or the answer.
+	Label string
+	// Keys are the keystrokes to send.
+	Keys string
+	// Path is the path the rule matched, if any.
+	Path string
+}
+
+// Match returns the response of the first rule that applies to prompt.
+// ruleSets are tried in order, most specific first.
+func Match(prompt Prompt, ruleSets ...Rules) (Response, bool) {
+	for _, rules := range ruleSets {
+		for _, rule := range rules {
+			if resp, ok := rule.respond(prompt); ok {
+				return resp, true
+			}
+		}
+	}
+	return Response{}, false
+}
+
+func (r Rule) respond(prompt Prompt) (Response, bool) {
+	if !containsFold(r.Agents, prompt.AgentType) || !containsFold(r.Roles, prompt.Role) {
+		return Response{}, false
+	}
+	re := r.re
+	if re == nil {
+		// Rules built in code skip Compile.
+		var err error
+		if re, err = r.compile(); err != nil {
+			return Response{}, false
+		}
+	}
+	groups := re.FindStringSubmatch(prompt.Text)
+	if groups == nil {
+		return Response{}, false
+	}
+	resp := Response{Rule: r}
+	if i := re.SubexpIndex(pathGroup); i >= 0 {
+		resp.Path = strings.Trim(strings.TrimSpace(groups[i]), "\"'`")
+	}
+	if r.RequirePathInWorktree && !InsideDir(prompt.WorkDir, resp.Path) {
+		return Response{}, false
+	}
+	if r.Answer != "" {
+		resp.Label = r.Answer
+		resp.Keys = r.Answer
+		return resp, true
+	}
+	for _, action := range prompt.Actions {
+		if strings.EqualFold(action.Label, r.Action) {
+			resp.Label = action.Label
+			resp.Keys = action.Keys
+			return resp, true
+		}
+	}
+	return Response{}, false
+}
+
+// InsideDir reports whether path, relative to dir unless absolute, is dir
+// or lies below it once symlinks are resolved.
+func InsideDir(dir, path string) bool {
+	if strings.TrimSpace(dir) == "" || strings.TrimSpace(path) == "" {
+		return false
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	root = resolve(root)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolve(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolve evaluates the symlinks of the longest existing prefix of path,
+// so that files the agent is about to create are checked too.
+func resolve(path string) string {
+	rest := ""
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			if real, err := filepath.EvalSymlinks(path); err == nil {
+				path = real
+			}
+			return filepath.Join(path, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if strings.EqualFold(strings.TrimSpace(candidate), value) {
+			return true
+		}
+	}
+	return false
+}
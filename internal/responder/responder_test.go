@@ -0,0 +1,90 @@
+package responder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/agenterm/internal/parser"
+)
+
+func TestValidateRules(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+		err  string
+	}{
+		{"action", Rule{Match: `Allow edit`, Action: "Yes"}, ""},
+		{"answer with path", Rule{Match: `Allow edit to (?P<path>\S+)\?`, Answer: "1", RequirePathInWorktree: true}, ""},
+		{"missing match", Rule{Action: "Yes"}, "match is required"},
+		{"bad regex", Rule{Match: `(`, Action: "Yes"}, "match:"},
+		{"no answer", Rule{Match: `x`}, "exactly one of"},
+		{"two answers", Rule{Match: `x`, Action: "Yes", Answer: "y\n"}, "exactly one of"},
+		{"path check without group", Rule{Match: `Allow edit`, Action: "Yes", RequirePathInWorktree: true}, "(?P<path>...)"},
+	}
+	for _, tc := range cases {
+		err := Rules{tc.rule}.Validate()
+		if tc.err == "" && err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("%s: error=%v want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	project := Rules{
+		{Name: "edits", Match: `Allow edit to (?P<path>\S+)\? \[y/N\]`, Action: "yes", RequirePathInWorktree: true},
+		{Name: "reviewers", Match: `Continue\?`, Roles: []string{"reviewer"}, Action: "Cancel"},
+	}
+	agent := Rules{
+		{Name: "codex only", Match: `Continue\?`, Agents: []string{"codex"}, Answer: "2\n"},
+		{Name: "missing action", Match: `Overwrite\?`, Action: "Always"},
+	}
+	for _, rules := range []Rules{project, agent} {
+		if err := rules.Compile(); err != nil {
+			t.Fatalf("Compile: %v", err)
+		}
+		for _, rule := range rules {
+			if rule.re == nil {
+				t.Fatalf("rule %q not compiled", rule.Label())
+			}
+		}
+	}
+	prompt := func(text, agentType, role string) Prompt {
+		return Prompt{Text: text, AgentType: agentType, Role: role, WorkDir: dir, Actions: parser.QuickActions(text)}
+	}
+
+	cases := []struct {
+		name   string
+		prompt Prompt
+		rule   string
+		label  string
+		keys   string
+	}{
+		{"path inside", prompt("Allow edit to src/main.go? [y/N]", "codex", "coder"), "edits", "Yes", "y\n"},
+		{"absolute path inside", prompt("Allow edit to "+filepath.Join(dir, "new", "file.go")+"? [y/N]", "codex", "coder"), "edits", "Yes", "y\n"},
+		{"path outside", prompt("Allow edit to ../other/main.go? [y/N]", "codex", "coder"), "", "", ""},
+		{"symlink escape", prompt("Allow edit to escape/main.go? [y/N]", "codex", "coder"), "", "", ""},
+		{"project rule first", prompt("Continue?", "codex", "reviewer"), "reviewers", "Cancel", "\x03"},
+		{"agent rule", prompt("Continue?", "codex", "coder"), "codex only", "2\n", "2\n"},
+		{"agent filter", prompt("Continue?", "claude", "coder"), "", "", ""},
+		{"action not offered", prompt("Overwrite? [y/N]", "codex", "coder"), "", "", ""},
+	}
+	for _, tc := range cases {
+		resp, ok := Match(tc.prompt, project, agent)
+		if ok != (tc.rule != "") {
+			t.Fatalf("%s: matched=%v (%+v) want %v", tc.name, ok, resp, tc.rule != "")
+		}
+		if ok && (resp.Rule.Label() != tc.rule || resp.Label != tc.label || resp.Keys != tc.keys) {
+			t.Fatalf("%s: response=%+v want rule %q label %q keys %q", tc.name, resp, tc.rule, tc.label, tc.keys)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock syscalls share their numbers across architectures.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	prSetNoNewPrivs = 38
+
+	// oPath is O_PATH, which package syscall does not export; this is its
+	// value on every architecture agenterm is built for.
+	oPath = 0x200000
+)
+
+// Filesystem access rights, by the ABI version that introduced them.
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13 // ABI 2
+	accessTruncate   = 1 << 14 // ABI 3
+
+	accessABI1 = accessMakeSym<<1 - 1
+
+	accessRead     = accessExecute | accessReadFile | accessReadDir
+	accessFileOnly = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+	accessDevice   = accessRead | accessWriteFile | accessTruncate
+)
+
+type rulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// pathBeneathAttr mirrors the packed kernel struct; the trailing padding
+// Go adds is never read.
+type pathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// abiVersion returns the Landlock ABI version of the running kernel.
+func abiVersion() (int, error) {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupported, errno)
+	}
+	return int(v), nil
+}
+
+// Supported reports whether sandboxed sessions can be started.
+func Supported() error {
+	_, err := abiVersion()
+	return err
+}
+
+func handledAccess(abi int) uint64 {
+	handled := uint64(accessABI1)
+	if abi >= 2 {
+		handled |= accessRefer
+	}
+	if abi >= 3 {
+		handled |= accessTruncate
+	}
+	return handled
+}
+
+// restrict confines the calling thread, and whatever it execs, to p. The
+// caller must hold the OS thread.
+func restrict(p Policy) error {
+	abi, err := abiVersion()
+	if err != nil {
+		return err
+	}
+	handled := handledAccess(abi)
+	attr := rulesetAttr{handledAccessFS: handled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock create ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	readable := p.Readable
+	if p.Mode != ModeHidden {
+		readable = []string{"/"}
+	}
+	for _, path := range readable {
+		if err := addRule(ruleset, path, accessRead&handled); err != nil {
+			return err
+		}
+	}
+	if err := addRule(ruleset, "/dev", accessDevice&handled); err != nil {
+		return err
+	}
+	for _, path := range p.Writable {
+		if err := addRule(ruleset, path, handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock restrict self: %w", errno)
+	}
+	return nil
+}
+
+// addRule allows access beneath path. Missing paths are skipped; rights
+// that only apply to directories are dropped for files.
+func addRule(ruleset int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EACCES) {
+			return nil
+		}
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= accessFileOnly
+	}
+	attr := pathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock add rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// Exec implements HelperCommand: it restricts itself to the policy in args
+// and replaces itself with the sandboxed command. It only returns on error.
+func Exec(args []string) error {
+	p, argv, err := parseHelperArgs(args)
+	if err != nil {
+		return err
+	}
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	// Landlock and no_new_privs apply to the calling thread, which must be
+	// the one that execs.
+	runtime.LockOSThread()
+	if p.Cgroup != "" {
+		// Best effort: the server moves the tree into the cgroup once the
+		// agent runs if this fails.
+		_ = os.WriteFile(filepath.Join(p.Cgroup, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644)
+	}
+	if err := restrict(p); err != nil {
+		return err
+	}
+	return syscall.Exec(bin, argv, os.Environ())
+}
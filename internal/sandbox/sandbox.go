@@ -0,0 +1,217 @@
+// Package sandbox confines agent processes to their worktree with Landlock.
+//
+// A sandboxed session is spawned through the agenterm binary itself:
+// "agenterm sandbox-exec --policy <json> -- <argv>" restricts its own thread
+// and then execs the agent, so the restriction covers the agent and every
+// process it starts. The kernel has no way to lift it afterwards.
+//
+// In readonly mode the whole filesystem stays readable and only the
+// worktree, temp dirs and configured paths are writable. In hidden mode
+// only system directories and the configured toolchain allowlist are
+// readable at all, which keeps e.g. ~/.ssh out of reach.
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HelperCommand is the agenterm subcommand that applies a policy and execs
+// the agent.
+const HelperCommand = "sandbox-exec"
+
+// Sandbox modes.
+const (
+	ModeReadOnly = "readonly"
+	ModeHidden   = "hidden"
+)
+
+// ErrUnsupported is returned when the kernel does not provide Landlock.
+var ErrUnsupported = errors.New("sandbox unsupported: landlock is not available")
+
+// systemReadable is what hidden mode keeps readable so that shells and
+// dynamically linked toolchains still work.
+var systemReadable = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc", "/opt", "/proc", "/sys", "/dev"}
+
+// helperPath locates the binary providing HelperCommand.
+var helperPath = os.Executable
+
+// Config is the per-agent sandbox setting. The zero value disables the
+// sandbox.
+type Config struct {
+	// Mode is "readonly" or "hidden"; empty disables the sandbox.
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// AllowRead is the toolchain allowlist readable in hidden mode, e.g.
+	// ~/go or ~/.local/share/claude.
+	AllowRead []string `yaml:"allow_read,omitempty" json:"allow_read,omitempty"`
+	// AllowWrite lists writable paths besides the worktree and temp dirs,
+	// e.g. ~/.claude or ~/.cache/go-build.
+	AllowWrite []string `yaml:"allow_write,omitempty" json:"allow_write,omitempty"`
+}
+
+// Enabled reports whether the sandbox is on.
+func (c Config) Enabled() bool {
+	return strings.TrimSpace(c.Mode) != ""
+}
+
+// Validate rejects unknown modes and relative paths.
+func (c Config) Validate() error {
+	switch strings.TrimSpace(c.Mode) {
+	case "", ModeReadOnly, ModeHidden:
+	default:
+		return fmt.Errorf("mode must be %q or %q", ModeReadOnly, ModeHidden)
+	}
+	for _, p := range append(append([]string{}, c.AllowRead...), c.AllowWrite...) {
+		if !filepath.IsAbs(expandPath(p)) {
+			return fmt.Errorf("path %q must be absolute or start with ~", p)
+		}
+	}
+	return nil
+}
+
+// Policy is a resolved sandbox for one session.
+type Policy struct {
+	Mode     string   `json:"mode"`
+	Readable []string `json:"readable,omitempty"`
+	Writable []string `json:"writable"`
+	// Cgroup is the resource-limit cgroup directory the helper moves itself
+	// into before restricting itself, which the sandbox would forbid later.
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+// Policy resolves c for a session running in workDir. When workDir is a git
+// worktree, the repository's shared git directory is writable too so that
+// the agent can commit.
+func (c Config) Policy(workDir string) (Policy, error) {
+	if !c.Enabled() {
+		return Policy{}, fmt.Errorf("sandbox is not enabled")
+	}
+	if err := c.Validate(); err != nil {
+		return Policy{}, err
+	}
+	workDir = strings.TrimSpace(workDir)
+	if workDir == "" {
+		return Policy{}, fmt.Errorf("sandbox requires a working directory")
+	}
+	workDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	p := Policy{Mode: strings.TrimSpace(c.Mode)}
+	p.Writable = appendUnique(p.Writable, workDir, os.TempDir(), "/tmp", "/var/tmp")
+	if common := gitCommonDir(workDir); common != "" {
+		p.Writable = appendUnique(p.Writable, common)
+	}
+	for _, path := range c.AllowWrite {
+		p.Writable = appendUnique(p.Writable, expandPath(path))
+	}
+	if p.Mode == ModeHidden {
+		p.Readable = appendUnique(p.Readable, systemReadable...)
+		for _, path := range c.AllowRead {
+			p.Readable = appendUnique(p.Readable, expandPath(path))
+		}
+	}
+	return p, nil
+}
+
+// Command returns the argv that runs argv under p.
+func Command(argv []string, p Policy) ([]string, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("sandbox: empty command")
+	}
+	exe, err := helperPath()
+	if err != nil {
+		return nil, fmt.Errorf("locate sandbox helper: %w", err)
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{exe, HelperCommand, "--policy", string(raw), "--"}, argv...), nil
+}
+
+// ShellCommand is Command for backends that run a shell command string: the
+// result runs command with sh -c under p.
+func ShellCommand(command string, p Policy) (string, error) {
+	argv, err := Command([]string{"sh", "-c", command}, p)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+	return "exec " + strings.Join(quoted, " "), nil
+}
+
+// parseHelperArgs splits "--policy <json> -- <argv>".
+func parseHelperArgs(args []string) (Policy, []string, error) {
+	var p Policy
+	if len(args) < 4 || args[0] != "--policy" || args[2] != "--" {
+		return p, nil, fmt.Errorf("usage: agenterm %s --policy <json> -- <command> [args...]", HelperCommand)
+	}
+	if err := json.Unmarshal([]byte(args[1]), &p); err != nil {
+		return p, nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return p, args[3:], nil
+}
+
+func expandPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return filepath.Clean(os.ExpandEnv(path))
+}
+
+// gitCommonDir returns the main repository's .git directory when dir is a
+// linked worktree, whose .git is a file pointing into it.
+func gitCommonDir(dir string) string {
+	raw, err := os.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return ""
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(raw)), "gitdir:")
+	if !ok {
+		return ""
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	// <repo>/.git/worktrees/<name>
+	if filepath.Base(filepath.Dir(gitDir)) != "worktrees" {
+		return gitDir
+	}
+	return filepath.Dir(filepath.Dir(gitDir))
+}
+
+func appendUnique(list []string, paths ...string) []string {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		dup := false
+		for _, existing := range list {
+			if existing == path {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			list = append(list, path)
+		}
+	}
+	return list
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package sandbox
+
+// Supported always fails without Landlock.
+func Supported() error { return ErrUnsupported }
+
+// Exec always fails without Landlock.
+func Exec(args []string) error {
+	if _, _, err := parseHelperArgs(args); err != nil {
+		return err
+	}
+	return ErrUnsupported
+}
@@ -0,0 +1,118 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary act as the sandbox helper, standing in for
+// the agenterm binary.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == HelperCommand {
+		if err := Exec(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(126)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func TestConfigPolicy(t *testing.T) {
+	repo := t.TempDir()
+	worktree := t.TempDir()
+	gitDir := filepath.Join(repo, ".git", "worktrees", "feature")
+	if err := os.MkdirAll(gitDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+gitDir+"\n"), 0o644); err != nil {
+		t.Fatalf("write .git: %v", err)
+	}
+
+	p, err := Config{Mode: ModeHidden, AllowRead: []string{"/opt/go"}, AllowWrite: []string{"~/.cache/go-build"}}.Policy(worktree)
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+	home, _ := os.UserHomeDir()
+	for _, want := range []string{worktree, filepath.Join(repo, ".git"), filepath.Join(home, ".cache/go-build")} {
+		if !contains(p.Writable, want) {
+			t.Fatalf("writable=%q missing %q", p.Writable, want)
+		}
+	}
+	if !contains(p.Readable, "/opt/go") || !contains(p.Readable, "/usr") {
+		t.Fatalf("readable=%q want allowlist and system dirs", p.Readable)
+	}
+
+	if _, err := (Config{}).Policy(worktree); err == nil {
+		t.Fatalf("Policy of disabled config should fail")
+	}
+	for _, c := range []Config{{Mode: "strict"}, {Mode: ModeReadOnly, AllowWrite: []string{"relative/dir"}}} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) expected error", c)
+		}
+	}
+}
+
+func TestShellCommandQuotes(t *testing.T) {
+	helperPath = func() (string, error) { return "/usr/bin/agenterm", nil }
+	defer func() { helperPath = os.Executable }()
+
+	got, err := ShellCommand(`echo 'hi' && claude`, Policy{Mode: ModeReadOnly, Writable: []string{"/w"}})
+	if err != nil {
+		t.Fatalf("ShellCommand: %v", err)
+	}
+	want := `exec '/usr/bin/agenterm' 'sandbox-exec' '--policy' '{"mode":"readonly","writable":["/w"]}' '--' 'sh' '-c' 'echo '\''hi'\'' && claude'`
+	if got != want {
+		t.Fatalf("ShellCommand()=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSandboxedCommandCannotWriteOutsideWorktree(t *testing.T) {
+	if err := Supported(); err != nil {
+		t.Skipf("landlock unavailable: %v", err)
+	}
+	helperPath = func() (string, error) { return os.Args[0], nil }
+	defer func() { helperPath = os.Executable }()
+
+	worktree := t.TempDir()
+	// The outside directory must not be under a writable temp dir.
+	outside, err := os.MkdirTemp(".", "outside-")
+	if err != nil {
+		t.Fatalf("mkdir outside: %v", err)
+	}
+	outside, _ = filepath.Abs(outside)
+	defer os.RemoveAll(outside)
+
+	p, err := Config{Mode: ModeReadOnly}.Policy(worktree)
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+	script := fmt.Sprintf("echo ok > %s/in && echo bad > %s/out; cat %s/in", worktree, outside, worktree)
+	argv, err := Command([]string{"sh", "-c", script}, p)
+	if err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	out, _ := exec.Command(argv[0], argv[1:]...).CombinedOutput()
+
+	if _, err := os.Stat(filepath.Join(worktree, "in")); err != nil {
+		t.Fatalf("worktree write failed: %v (output %q)", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "out")); err == nil {
+		t.Fatalf("write outside the worktree succeeded (output %q)", out)
+	}
+	if !strings.Contains(string(out), "ok") {
+		t.Fatalf("output=%q want worktree file to be readable", out)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/usage"
+)
+
+const (
+	// agentSessionScanInterval is how often the session files of agents
+	// are searched for the IDs of running sessions that have none yet.
+	agentSessionScanInterval = 5 * time.Second
+	// agentSessionFileSlack admits session files the agent wrote just
+	// before the session was recorded.
+	agentSessionFileSlack = 5 * time.Second
+)
+
+// agentSessionIDPattern is what an agent session ID may look like. IDs are
+// substituted into the resume command line unquoted, so anything captured
+// from output or file names outside it is ignored.
+var agentSessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// agentSessionWatch follows the output of one session for its agent
+// session ID.
+type agentSessionWatch struct {
+	output *regexp.Regexp
+	id     string
+}
+
+// agentStartCommand returns the command of a new session of agent and the
+// agent session ID its start flag fixes, if any.
+func agentStartCommand(agent *registry.AgentConfig) (string, string, error) {
+	flag := agent.AgentSession.StartFlag
+	if flag == "" {
+		return agent.Command, "", nil
+	}
+	id, err := newUUID()
+	if err != nil {
+		return "", "", fmt.Errorf("generate agent session id: %w", err)
+	}
+	return agent.Command + " " + strings.ReplaceAll(flag, registry.AgentSessionIDPlaceholder, id), id, nil
+}
+
+// resumeCommand fills the agent session ID into agent's resume command.
+// Without a valid ID the placeholder is dropped, leaving the agent to pick
+// the conversation.
+func resumeCommand(agent *registry.AgentConfig, agentSessionID string) string {
+	cmd := strings.TrimSpace(agent.ResumeCommand)
+	if !strings.Contains(cmd, registry.AgentSessionIDPlaceholder) {
+		return cmd
+	}
+	if !agentSessionIDPattern.MatchString(agentSessionID) {
+		return strings.Join(strings.Fields(strings.ReplaceAll(cmd, registry.AgentSessionIDPlaceholder, "")), " ")
+	}
+	return strings.ReplaceAll(cmd, registry.AgentSessionIDPlaceholder, agentSessionID)
+}
+
+// newUUID returns a random (version 4) UUID, the form agents expect for
+// conversation IDs.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// agentSessionWatchFor returns the output watch of a session, or nil when
+// its agent does not print its session ID.
+func (sm *Manager) agentSessionWatchFor(ctx context.Context, sessionID string) *agentSessionWatch {
+	sm.agentSessionMu.Lock()
+	defer sm.agentSessionMu.Unlock()
+	if w, ok := sm.agentSessionWatches[sessionID]; ok {
+		return w
+	}
+	var w *agentSessionWatch
+	if sess, err := sm.sessionRepo.Get(ctx, sessionID); err == nil && sess != nil {
+		if agent := sm.registry.Get(sess.AgentType); agent != nil && agent.AgentSession.Output != "" {
+			// Validated when the agent was loaded.
+			w = &agentSessionWatch{output: regexp.MustCompile(agent.AgentSession.Output), id: sess.AgentSessionID}
+		}
+	}
+	sm.agentSessionWatches[sessionID] = w
+	return w
+}
+
+// captureAgentSessionID records the agent session ID an output line of a
+// session reports. A later, different ID replaces it, as when the agent
+// starts a new conversation.
+func (sm *Manager) captureAgentSessionID(sessionID, text string) {
+	w := sm.agentSessionWatchFor(context.Background(), sessionID)
+	if w == nil {
+		return
+	}
+	groups := w.output.FindStringSubmatch(text)
+	if groups == nil {
+		return
+	}
+	id := strings.TrimSpace(groups[w.output.SubexpIndex("id")])
+	sm.agentSessionMu.Lock()
+	changed := agentSessionIDPattern.MatchString(id) && id != w.id
+	if changed {
+		w.id = id
+	}
+	sm.agentSessionMu.Unlock()
+	if changed {
+		sm.setAgentSessionID(context.Background(), sessionID, id, "output")
+	}
+}
+
+func (sm *Manager) setAgentSessionID(ctx context.Context, sessionID, agentSessionID, source string) {
+	if err := sm.sessionRepo.SetAgentSessionID(ctx, sessionID, agentSessionID); err != nil {
+		slog.Warn("failed to record agent session id", "session_id", sessionID, "error", err)
+		return
+	}
+	slog.Info("agent session id captured", "session_id", sessionID, "agent_session_id", agentSessionID, "source", source)
+}
+
+// runAgentSessionScanner searches agent session files for the IDs of
+// running sessions until ctx is done.
+func (sm *Manager) runAgentSessionScanner(ctx context.Context) {
+	ticker := time.NewTicker(agentSessionScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sm.agentSessionScanPass(ctx)
+	}
+}
+
+func (sm *Manager) agentSessionScanPass(ctx context.Context) {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		slog.Warn("agent session scanner failed to list sessions", "error", err)
+		return
+	}
+	running := make(map[string]bool, len(active))
+	for _, sess := range active {
+		if !sessionRunning(sess) {
+			continue
+		}
+		running[sess.ID] = true
+		if sess.AgentSessionID != "" {
+			continue
+		}
+		if id := sm.findAgentSessionFile(ctx, sess); id != "" {
+			sm.setAgentSessionID(ctx, sess.ID, id, "files")
+		}
+	}
+
+	sm.agentSessionMu.Lock()
+	for id := range sm.agentSessionWatches {
+		if !running[id] {
+			delete(sm.agentSessionWatches, id)
+		}
+	}
+	sm.agentSessionMu.Unlock()
+}
+
+// findAgentSessionFile returns the ID named by the first session file of
+// sess's agent written since the session started, from its work directory
+// when the files record one, that no other session claims, or "" when
+// there is none.
+func (sm *Manager) findAgentSessionFile(ctx context.Context, sess *db.Session) string {
+	agent := sm.registry.Get(sess.AgentType)
+	if agent == nil || agent.AgentSession.Files == "" {
+		return ""
+	}
+	var namePattern *regexp.Regexp
+	if agent.AgentSession.FilePattern != "" {
+		namePattern = regexp.MustCompile(agent.AgentSession.FilePattern)
+	}
+	workDir := sm.resolveWorkDirForSession(ctx, sess)
+	paths, err := filepath.Glob(usage.ExpandPath(agent.AgentSession.Files, workDir))
+	if err != nil {
+		return ""
+	}
+	since := sess.CreatedAt.Add(-agentSessionFileSlack)
+	best, bestAt := "", time.Time{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.ModTime().Before(since) {
+			continue
+		}
+		if !bestAt.IsZero() && !info.ModTime().Before(bestAt) {
+			continue
+		}
+		if field := agent.AgentSession.FileWorkDir; field != "" {
+			dir, _, err := usage.FirstEntryField(path, field)
+			if err != nil || dir == "" || filepath.Clean(dir) != filepath.Clean(workDir) {
+				continue
+			}
+		}
+		id := agentSessionIDFromFile(path, namePattern)
+		if !agentSessionIDPattern.MatchString(id) {
+			continue
+		}
+		taken, err := sm.sessionRepo.AgentSessionIDTaken(ctx, sess.AgentType, id, sess.ID)
+		if err != nil || taken {
+			continue
+		}
+		best, bestAt = id, info.ModTime()
+	}
+	return best
+}
+
+func agentSessionIDFromFile(path string, namePattern *regexp.Regexp) string {
+	base := filepath.Base(path)
+	if namePattern == nil {
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	groups := namePattern.FindStringSubmatch(base)
+	if groups == nil {
+		return ""
+	}
+	return groups[namePattern.SubexpIndex("id")]
+}
@@ -0,0 +1,178 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestAgentSessionIDIsGeneratedAndUsedOnResume(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	seeded := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{
+		ID:                    "codex",
+		Name:                  "Codex",
+		Command:               "codex",
+		ResumeCommand:         "codex resume {agent_session_id}",
+		SupportsSessionResume: true,
+		MaxParallelAgents:     2,
+		AgentSession:          registry.AgentSessionConfig{StartFlag: "--session-id {agent_session_id}"},
+	}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[seeded.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+
+	sess, err := lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: seeded.TaskID, AgentType: "codex", Role: "coder"})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(sess.AgentSessionID) {
+		t.Fatalf("agent session id=%q want a UUID", sess.AgentSessionID)
+	}
+	if got := backend.commands[sess.ID]; got != "codex --session-id "+sess.AgentSessionID {
+		t.Fatalf("command=%q", got)
+	}
+
+	// After a restart the session resumes its own conversation.
+	lifecycle.Close()
+	delete(backend.sessions, sess.ID)
+	lifecycle = NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("restart lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+	if got := backend.commands[sess.ID]; got != "codex resume "+sess.AgentSessionID {
+		t.Fatalf("resume command=%q", got)
+	}
+	// A session without an ID falls back to the agent's picker.
+	if got := resumeCommand(reg.Get("codex"), ""); got != "codex resume" {
+		t.Fatalf("resume command without id=%q", got)
+	}
+	// So does one whose ID would change the command line.
+	if got := resumeCommand(reg.Get("codex"), "x; rm -rf ~"); got != "codex resume" {
+		t.Fatalf("resume command with unsafe id=%q", got)
+	}
+}
+
+func TestAgentSessionIDIsCapturedFromOutputAndFiles(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	files := t.TempDir()
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", AgentSession: registry.AgentSessionConfig{
+		Output:      `session id: (?P<id>[0-9a-f-]+)`,
+		Files:       filepath.Join(files, "rollout-*.jsonl"),
+		FilePattern: `^rollout-(?P<id>.+)\.jsonl$`,
+	}}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	// Files written before the session started belong to other sessions.
+	old := filepath.Join(files, "rollout-old.jsonl")
+	if err := os.WriteFile(old, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	// Names that are no safe ID are skipped, even when written first.
+	unsafe := filepath.Join(files, "rollout-x;touch pwned.jsonl")
+	if err := os.WriteFile(unsafe, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(unsafe, time.Now().Add(-time.Second), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(files, "rollout-new.jsonl"), nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	lifecycle.agentSessionScanPass(ctx)
+	if got, _ := sessionRepo.Get(ctx, sess.ID); got.AgentSessionID != "new" {
+		t.Fatalf("agent session id=%q want new from files", got.AgentSessionID)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "session id: 0a1b-2c3d", "normal", time.Now().UTC())
+	if got, _ := sessionRepo.Get(ctx, sess.ID); got.AgentSessionID != "0a1b-2c3d" {
+		t.Fatalf("agent session id=%q want 0a1b-2c3d from output", got.AgentSessionID)
+	}
+}
+
+func TestAgentSessionFileMustRecordTheSessionWorkDir(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	files := t.TempDir()
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", AgentSession: registry.AgentSessionConfig{
+		Files:       filepath.Join(files, "rollout-*.jsonl"),
+		FilePattern: `^rollout-(?P<id>.+)\.jsonl$`,
+		FileWorkDir: "payload.cwd",
+	}}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	workDir := lifecycle.resolveWorkDirForSession(ctx, sess)
+	if workDir == "" {
+		t.Fatal("session has no work dir")
+	}
+
+	// Another worktree's rollout is written first.
+	other := filepath.Join(files, "rollout-other.jsonl")
+	if err := os.WriteFile(other, []byte(`{"type":"session_meta","payload":{"cwd":"/elsewhere"}}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.Chtimes(other, time.Now().Add(-time.Second), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if got := lifecycle.findAgentSessionFile(ctx, sess); got != "" {
+		t.Fatalf("agent session id=%q want none from another work dir", got)
+	}
+	if err := os.WriteFile(filepath.Join(files, "rollout-mine.jsonl"), []byte(`{"type":"session_meta","payload":{"cwd":"`+workDir+`"}}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if got := lifecycle.findAgentSessionFile(ctx, sess); got != "mine" {
+		t.Fatalf("agent session id=%q want mine", got)
+	}
+}
@@ -1,13 +1,20 @@
 package session
 
-import "context"
+import (
+	"context"
+
+	"github.com/user/agenterm/internal/pty"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/vt"
+)
 
 // TerminalBackend abstracts the terminal runtime (tmux or PTY).
 type TerminalBackend interface {
 	// CreateSession spawns a new terminal session.
-	// command is the shell command string to execute.
+	// command is the shell command string to execute. env is the complete
+	// environment of the command; nil inherits the server's.
 	// Returns the session/terminal ID.
-	CreateSession(ctx context.Context, id string, name string, command string, workDir string) (string, error)
+	CreateSession(ctx context.Context, id string, name string, command string, workDir string, env []string) (string, error)
 
 	// DestroySession kills the terminal session.
 	DestroySession(ctx context.Context, id string) error
@@ -27,3 +34,41 @@ type TerminalBackend interface {
 	// SessionExists returns true if the session is still alive.
 	SessionExists(ctx context.Context, id string) bool
 }
+
+// RecordingBackend is implemented by terminal backends that persist an
+// asciicast recording of each session's output.
+type RecordingBackend interface {
+	// RecordingPath returns the recording file for a session, or "" when
+	// recording is disabled.
+	RecordingPath(id string) string
+}
+
+// ProcessBackend is implemented by terminal backends whose sessions run as
+// local processes.
+type ProcessBackend interface {
+	// ProcessID returns the pid of the session's root process.
+	ProcessID(ctx context.Context, id string) (int, error)
+}
+
+// ExitBackend is implemented by terminal backends that observe how a
+// session's process exited.
+type ExitBackend interface {
+	// ExitStatus returns the exit status of a session whose process has
+	// exited.
+	ExitStatus(ctx context.Context, id string) (pty.ExitStatus, error)
+}
+
+// SandboxBackend is implemented by terminal backends that can spawn a
+// session under a filesystem sandbox.
+type SandboxBackend interface {
+	// CreateSandboxedSession is CreateSession with the command confined to
+	// policy.
+	CreateSandboxedSession(ctx context.Context, id string, name string, command string, workDir string, env []string, policy sandbox.Policy) (string, error)
+}
+
+// ScreenBackend is implemented by terminal backends that can render the
+// current terminal screen rather than raw output.
+type ScreenBackend interface {
+	// Screen returns a snapshot of the visible screen.
+	Screen(ctx context.Context, id string) (vt.Snapshot, error)
+}
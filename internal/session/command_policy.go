@@ -1,29 +1,25 @@
 package session
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"regexp"
-	"slices"
 	"strings"
-	"time"
-)
 
-var (
-	shellExecPattern = regexp.MustCompile(`(^|[;&|]\s*)(bash|sh|zsh|fish)\s+-c(\s|$)`)
-	evalPattern      = regexp.MustCompile(`(^|[;&|]\s*)eval(\s|$)`)
-	redirectPattern  = regexp.MustCompile(`(?:^|[\s;|&])(?:>|>>|1>|2>|&>)\s*([^\s]+)`)
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/policy"
 )
 
-var commandWrappers = []string{"sudo", "command", "nohup"}
-
-// CommandPolicyError indicates a command was denied by hard-coded policy rules.
+// CommandPolicyError indicates a command was denied by command policy.
 type CommandPolicyError struct {
 	Rule    string
 	Detail  string
 	Command string
+	// Severity is block for denied commands and warn for commands that
+	// were sent but reported.
+	Severity string
+	// Source is the policy layer the rule came from, or "builtin".
+	Source string
 }
 
 func (e *CommandPolicyError) Error() string {
@@ -39,304 +35,190 @@ func ValidateCommandPolicy(raw string, allowedRoot string) error {
 	return enforceCommandPolicy(raw, allowedRoot)
 }
 
-func AuditCommandPolicyViolation(workDir string, sessionID string, raw string, policyErr *CommandPolicyError) {
-	auditCommandPolicyViolation(workDir, sessionID, raw, policyErr)
-}
-
-func enforceCommandPolicy(raw string, allowedRoot string) error {
-	cmd := strings.TrimSpace(raw)
-	if cmd == "" {
-		return nil
-	}
-	lower := strings.ToLower(cmd)
-	if strings.Contains(cmd, "`") || strings.Contains(cmd, "$(") {
-		return &CommandPolicyError{
-			Rule:    "no_shell_substitution",
-			Detail:  "shell substitution is blocked (` or $())",
-			Command: cmd,
-		}
-	}
-	if shellExecPattern.MatchString(lower) {
-		return &CommandPolicyError{
-			Rule:    "no_shell_dash_c",
-			Detail:  "shell -c execution is blocked",
-			Command: cmd,
-		}
-	}
-	if evalPattern.MatchString(lower) {
-		return &CommandPolicyError{
-			Rule:    "no_eval",
-			Detail:  "eval is blocked",
-			Command: cmd,
-		}
-	}
-	if strings.Contains(cmd, "../") || strings.Contains(cmd, "..\\") {
-		return &CommandPolicyError{
-			Rule:    "no_path_traversal",
-			Detail:  "relative traversal (../) is blocked",
-			Command: cmd,
-		}
-	}
-
-	fields := strings.Fields(cmd)
-	if len(fields) == 0 {
+func enforceCommandPolicy(raw string, allowedRoot string, layers ...policy.Layer) error {
+	policyErr := commandPolicyFinding(raw, policy.Evaluate(raw, allowedRoot, layers...))
+	if policyErr == nil || policyErr.Severity != policy.SeverityBlock {
 		return nil
 	}
-	pathTokens := extractPathTokens(cmd, fields)
-	if err := blockPathExpansionVariables(cmd, pathTokens); err != nil {
-		return err
-	}
-	if err := blockAbsoluteRecursiveRemove(cmd, fields); err != nil {
-		return err
-	}
-	if err := validatePathScope(cmd, allowedRoot, pathTokens); err != nil {
-		return err
-	}
-	return nil
+	return policyErr
 }
 
-func blockAbsoluteRecursiveRemove(command string, fields []string) error {
-	exe, args := unwrapCommand(fields)
-	if !strings.EqualFold(exe, "rm") {
+// commandPolicyFinding converts a decision that denies or warns about raw
+// into a CommandPolicyError, or returns nil for an allowed command.
+func commandPolicyFinding(raw string, decision policy.Decision) *CommandPolicyError {
+	var severity string
+	switch decision.Action {
+	case policy.DecisionBlock:
+		severity = policy.SeverityBlock
+	case policy.DecisionWarn:
+		severity = policy.SeverityWarn
+	default:
 		return nil
 	}
-	recursive := false
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "-") && strings.Contains(arg, "r") {
-			recursive = true
-		}
+	return &CommandPolicyError{
+		Rule:     decision.Rule,
+		Detail:   decision.Detail,
+		Command:  strings.TrimSpace(raw),
+		Severity: severity,
+		Source:   decision.Source,
 	}
-	if !recursive {
-		return nil
-	}
-	for _, arg := range args {
-		normalized := normalizePathToken(arg)
-		if strings.HasPrefix(normalized, "-") || !looksLikePath(normalized) {
-			continue
-		}
-		if filepath.IsAbs(normalized) {
-			return &CommandPolicyError{
-				Rule:    "no_rm_rf_absolute",
-				Detail:  "recursive rm with absolute path is blocked",
-				Command: command,
-			}
-		}
-	}
-	return nil
 }
 
-func blockPathExpansionVariables(command string, paths []string) error {
-	for _, p := range paths {
-		if strings.Contains(p, "$") || strings.Contains(p, "%") {
-			return &CommandPolicyError{
-				Rule:    "no_env_path_expansion",
-				Detail:  "environment variable path expansion is blocked",
-				Command: command,
-			}
-		}
-	}
-	return nil
+// SetPoliciesDir sets the directory of command policy files: default.yaml
+// applies to every project and <project id>.yaml to one project. Files
+// are reread when they change.
+func (sm *Manager) SetPoliciesDir(dir string) {
+	sm.policyMu.Lock()
+	defer sm.policyMu.Unlock()
+	sm.policies = policy.NewStore(dir)
 }
 
-func unwrapCommand(fields []string) (string, []string) {
-	i := 0
-	for i < len(fields) {
-		tok := strings.TrimSpace(fields[i])
-		if tok == "" {
-			i++
+// commandPolicyLayers returns the policy layers for sessions of role in a
+// project: the project's policy, then the default one, each preceded by
+// its override for role. A policy that fails to load is skipped, or kept
+// at its last good version.
+func (sm *Manager) commandPolicyLayers(projectID, role string) []policy.Layer {
+	sm.policyMu.Lock()
+	store := sm.policies
+	sm.policyMu.Unlock()
+
+	var named []policy.Named
+	for _, name := range []string{projectID, policy.DefaultName} {
+		if name == "" {
 			continue
 		}
-		base := filepath.Base(tok)
-		if slices.Contains(commandWrappers, strings.ToLower(base)) {
-			i++
-			continue
+		p, err := store.Load(name)
+		if err != nil {
+			slog.Warn("command policy failed to load", "policy", name, "error", err)
 		}
-		if base == "env" {
-			i++
-			for i < len(fields) && isEnvAssignment(fields[i]) {
-				i++
+		if p != nil {
+			source := "project"
+			if name == policy.DefaultName {
+				source = policy.DefaultName
 			}
-			continue
+			named = append(named, policy.Named{Name: source, Policy: p})
 		}
-		break
-	}
-	if i >= len(fields) {
-		return "", nil
 	}
-	return filepath.Base(fields[i]), fields[i+1:]
+	return policy.Resolve(role, named...)
 }
 
-func isEnvAssignment(token string) bool {
-	token = strings.TrimSpace(token)
-	if token == "" || strings.HasPrefix(token, "-") {
-		return false
-	}
-	key, _, ok := strings.Cut(token, "=")
-	if !ok || key == "" {
-		return false
-	}
-	for idx, r := range key {
-		if idx == 0 && !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')) {
-			return false
-		}
-		if !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')) {
-			return false
-		}
-	}
-	return true
-}
+// ProjectEventPolicy is the project event broadcast for each command the
+// command policy blocks or warns about.
+const ProjectEventPolicy = "policy_event"
 
-func validatePathScope(command string, allowedRoot string, paths []string) error {
-	root := strings.TrimSpace(allowedRoot)
-	if root == "" {
-		if len(paths) > 0 {
-			return &CommandPolicyError{
-				Rule:    "missing_workdir_scope",
-				Detail:  "cannot validate path scope because workdir is unavailable",
-				Command: command,
-			}
+// checkSessionCommand evaluates text, about to be sent to session, against
+// the policy of its project and role. Denials and warnings are recorded as
+// policy events, not in the work directory's audit file; only denials are
+// returned.
+func (sm *Manager) checkSessionCommand(ctx context.Context, session *db.Session, workDir, text string) error {
+	var projectID string
+	if session.TaskID != "" {
+		if task, err := sm.taskRepo.Get(ctx, session.TaskID); err == nil && task != nil {
+			projectID = task.ProjectID
 		}
+	}
+	layers := sm.commandPolicyLayers(projectID, session.Role)
+	policyErr := commandPolicyFinding(text, policy.Evaluate(text, workDir, layers...))
+	if policyErr == nil {
 		return nil
 	}
-	root = canonicalPathForPolicy(root)
-	for _, p := range paths {
-		p = normalizePathToken(p)
-		if p == "" {
-			continue
-		}
-		if strings.HasPrefix(p, "~") {
-			return &CommandPolicyError{
-				Rule:    "no_tilde_path",
-				Detail:  "home-expanded paths are blocked",
-				Command: command,
-			}
-		}
-		resolved := p
-		if filepath.IsAbs(resolved) {
-			resolved = filepath.Clean(resolved)
-		} else {
-			resolved = filepath.Clean(filepath.Join(root, resolved))
-		}
-		resolved = canonicalPathForPolicy(resolved)
-		if !pathWithinBase(root, resolved) {
-			return &CommandPolicyError{
-				Rule:    "path_outside_workdir",
-				Detail:  fmt.Sprintf("path %q is outside allowed workdir", p),
-				Command: command,
-			}
-		}
+	if policyErr.Severity == policy.SeverityWarn {
+		slog.Warn("command flagged by policy", "session_id", session.ID, "rule", policyErr.Rule, "detail", policyErr.Detail)
+	} else {
+		slog.Warn("blocked command by policy", "session_id", session.ID, "rule", policyErr.Rule, "detail", policyErr.Detail)
+	}
+	sm.recordPolicyEvent(ctx, &db.PolicyEvent{
+		SessionID: session.ID,
+		TaskID:    session.TaskID,
+		ProjectID: projectID,
+		Role:      session.Role,
+		Action:    policyErr.Severity,
+		Rule:      policyErr.Rule,
+		Source:    policyErr.Source,
+		Detail:    policyErr.Detail,
+		Command:   policyErr.Command,
+	})
+	if policyErr.Severity != policy.SeverityBlock {
+		return nil
 	}
-	return nil
+	return policyErr
 }
 
-func extractPathTokens(raw string, fields []string) []string {
-	paths := make([]string, 0, 8)
-	for _, f := range fields {
-		if f == "" {
-			continue
-		}
-		if strings.HasPrefix(f, "-") {
-			parts := strings.SplitN(f, "=", 2)
-			if len(parts) == 2 {
-				pathPart := normalizePathToken(parts[1])
-				if looksLikePath(pathPart) {
-					paths = append(paths, pathPart)
-				}
-			}
-			continue
-		}
-		pathPart := normalizePathToken(f)
-		if looksLikePath(pathPart) {
-			paths = append(paths, pathPart)
-		}
+// recordPolicyEvent stores a policy decision and broadcasts it to the
+// project's subscribers.
+func (sm *Manager) recordPolicyEvent(ctx context.Context, event *db.PolicyEvent) {
+	if err := sm.policyEvents.Create(ctx, event); err != nil {
+		slog.Warn("failed to record policy event", "session_id", event.SessionID, "rule", event.Rule, "error", err)
+		return
 	}
-	for _, m := range redirectPattern.FindAllStringSubmatch(raw, -1) {
-		if len(m) > 1 {
-			pathPart := normalizePathToken(m[1])
-			if looksLikePath(pathPart) {
-				paths = append(paths, pathPart)
-			}
-		}
+	if sm.hub != nil && event.ProjectID != "" {
+		sm.hub.BroadcastProjectEvent(event.ProjectID, ProjectEventPolicy, event)
 	}
-	return paths
 }
 
-func looksLikePath(token string) bool {
-	token = normalizePathToken(token)
-	if token == "" {
-		return false
+// ListPolicyEvents returns the policy events of a project matching filter,
+// newest first.
+func (sm *Manager) ListPolicyEvents(ctx context.Context, projectID string, filter db.PolicyEventFilter) ([]*db.PolicyEvent, error) {
+	project, err := sm.projectRepo.Get(ctx, projectID)
+	if err != nil {
+		return nil, err
 	}
-	if strings.Contains(token, "://") {
-		return false
+	if project == nil {
+		return nil, errNotFound("project")
 	}
-	return strings.HasPrefix(token, "/") ||
-		strings.HasPrefix(token, ".") ||
-		strings.HasPrefix(token, "~") ||
-		strings.Contains(token, "/") ||
-		strings.Contains(token, "\\")
+	filter.ProjectID = projectID
+	return sm.policyEvents.List(ctx, filter)
 }
 
-func normalizePathToken(token string) string {
-	token = strings.TrimSpace(token)
-	for len(token) >= 2 {
-		if (token[0] == '\'' && token[len(token)-1] == '\'') || (token[0] == '"' && token[len(token)-1] == '"') {
-			token = strings.TrimSpace(token[1 : len(token)-1])
-			continue
-		}
-		break
-	}
-	return token
+// CommandPolicyEvaluation is the dry-run decision on a command.
+type CommandPolicyEvaluation struct {
+	policy.Decision
+	Command string `json:"command"`
+	Role    string `json:"role,omitempty"`
+	// WorkDir is the directory path scopes were checked against.
+	WorkDir string `json:"work_dir"`
+	// Layers are the policies consulted, most specific first.
+	Layers []string `json:"layers"`
 }
 
-func canonicalPathForPolicy(path string) string {
-	path = filepath.Clean(path)
-	if resolved, err := filepath.EvalSymlinks(path); err == nil {
-		return filepath.Clean(resolved)
+// EvaluateCommandPolicy reports what the command policy of a project would
+// decide for command typed into a session of role. Paths are scoped to the
+// task's worktree when taskID is set, or else to the project's repository.
+func (sm *Manager) EvaluateCommandPolicy(ctx context.Context, projectID, role, taskID, command string) (*CommandPolicyEvaluation, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command is required")
 	}
-	return path
-}
-
-func pathWithinBase(base string, target string) bool {
-	base = filepath.Clean(base)
-	target = filepath.Clean(target)
-	rel, err := filepath.Rel(base, target)
+	project, err := sm.projectRepo.Get(ctx, projectID)
 	if err != nil {
-		return false
+		return nil, err
 	}
-	if rel == "." {
-		return true
+	if project == nil {
+		return nil, errNotFound("project")
 	}
-	rel = filepath.Clean(rel)
-	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
-}
-
-func auditCommandPolicyViolation(workDir string, sessionID string, raw string, policyErr *CommandPolicyError) {
-	if policyErr == nil {
-		return
+	workDir := project.RepoPath
+	if taskID != "" {
+		task, err := sm.taskRepo.Get(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if task == nil || task.ProjectID != projectID {
+			return nil, errNotFound("task")
+		}
+		if workDir, err = sm.resolveWorkDir(ctx, task, project); err != nil {
+			return nil, err
+		}
 	}
-	slog.Warn("blocked command by policy", "session_id", sessionID, "rule", policyErr.Rule, "detail", policyErr.Detail)
 
-	workDir = strings.TrimSpace(workDir)
-	if workDir == "" {
-		return
+	layers := sm.commandPolicyLayers(projectID, role)
+	eval := &CommandPolicyEvaluation{
+		Decision: policy.Evaluate(command, workDir, layers...),
+		Command:  strings.TrimSpace(command),
+		Role:     role,
+		WorkDir:  workDir,
+		Layers:   make([]string, 0, len(layers)),
 	}
-	auditDir := filepath.Join(workDir, ".orchestra")
-	if err := os.MkdirAll(auditDir, 0o755); err != nil {
-		return
-	}
-	auditPath := filepath.Join(auditDir, "command-policy-audit.log")
-	line := fmt.Sprintf(
-		"%s session=%s rule=%s detail=%q command=%q\n",
-		time.Now().UTC().Format(time.RFC3339),
-		sessionID,
-		policyErr.Rule,
-		policyErr.Detail,
-		strings.TrimSpace(raw),
-	)
-	f, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return
+	for _, layer := range layers {
+		eval.Layers = append(eval.Layers, layer.Source)
 	}
-	defer f.Close()
-	_, _ = f.WriteString(line)
+	return eval, nil
 }
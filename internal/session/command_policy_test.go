@@ -1,9 +1,17 @@
 package session
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/policy"
+	"github.com/user/agenterm/internal/registry"
 )
 
 func TestEnforceCommandPolicyAllowsSafeCommand(t *testing.T) {
@@ -109,20 +117,85 @@ func TestEnforceCommandPolicyAllowsNoPathCommandWhenWorkDirUnknown(t *testing.T)
 	}
 }
 
-func TestAuditCommandPolicyViolationWritesLog(t *testing.T) {
-	root := t.TempDir()
-	policyErr := &CommandPolicyError{
-		Rule:    "test_rule",
-		Detail:  "test detail",
-		Command: "bad",
-	}
-	auditCommandPolicyViolation(root, "session-1", "bad", policyErr)
-	auditPath := filepath.Join(root, ".orchestra", "command-policy-audit.log")
-	data, err := os.ReadFile(auditPath)
+func TestProjectCommandPolicyAppliesToSessions(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	task, err := taskRepo.Get(ctx, sess.TaskID)
+	if err != nil || task == nil {
+		t.Fatalf("get task: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, task.ProjectID+".yaml"), []byte(`
+rules:
+  - name: no-force-push
+    match: 'git push .*--force'
+    action: deny
+  - name: publish
+    match: '^npm publish'
+    action: deny
+    severity: warn
+roles:
+  reviewer:
+    rules:
+      - name: reviewers-read-only
+        commands: [git]
+        match: 'git (commit|push)'
+        action: deny
+`), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
 	if err != nil {
-		t.Fatalf("read audit log: %v", err)
+		t.Fatalf("new registry: %v", err)
+	}
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	lifecycle.SetPoliciesDir(dir)
+
+	err = lifecycle.dispatchCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "git push origin main --force\n"})
+	var policyErr *CommandPolicyError
+	if !errors.As(err, &policyErr) || policyErr.Rule != "no-force-push" || policyErr.Source != "project" {
+		t.Fatalf("force push error=%v", err)
+	}
+	if err := lifecycle.dispatchCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "npm publish\n"}); err != nil {
+		t.Fatalf("warned command should be sent: %v", err)
+	}
+	if !strings.Contains(strings.Join(backend.inputs, ""), "npm publish") {
+		t.Fatalf("inputs=%v", backend.inputs)
+	}
+	if _, err := os.Stat(filepath.Join(lifecycle.resolveWorkDirForSession(ctx, sess), ".orchestra", "command-policy-audit.log")); !os.IsNotExist(err) {
+		t.Fatalf("session commands should not write the audit file: %v", err)
+	}
+
+	events, err := lifecycle.ListPolicyEvents(ctx, task.ProjectID, db.PolicyEventFilter{})
+	if err != nil {
+		t.Fatalf("ListPolicyEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Rule != "publish" || events[0].Action != "warn" || events[1].Rule != "no-force-push" ||
+		events[1].Action != "block" || events[1].SessionID != sess.ID || events[1].TaskID != sess.TaskID || events[1].Command != "git push origin main --force" {
+		t.Fatalf("policy events=%+v", events)
+	}
+	if blocked, _ := lifecycle.ListPolicyEvents(ctx, task.ProjectID, db.PolicyEventFilter{Action: "block"}); len(blocked) != 1 {
+		t.Fatalf("blocked events=%+v", blocked)
+	}
+
+	eval, err := lifecycle.EvaluateCommandPolicy(ctx, task.ProjectID, "reviewer", sess.TaskID, "git commit -m wip")
+	if err != nil {
+		t.Fatalf("EvaluateCommandPolicy: %v", err)
+	}
+	if eval.Action != policy.DecisionBlock || eval.Rule != "reviewers-read-only" || strings.Join(eval.Layers, ",") != "project role reviewer,project" {
+		t.Fatalf("evaluation=%+v", eval)
+	}
+	if eval, err = lifecycle.EvaluateCommandPolicy(ctx, task.ProjectID, "coder", "", "git commit -m wip"); err != nil || eval.Action != policy.DecisionAllow {
+		t.Fatalf("coder evaluation=%+v err=%v", eval, err)
 	}
-	if len(data) == 0 {
-		t.Fatalf("expected non-empty audit log")
+	if _, err := lifecycle.EvaluateCommandPolicy(ctx, "missing", "", "", "ls"); !IsNotFound(err) {
+		t.Fatalf("missing project error=%v", err)
 	}
 }
@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+// Script step operations.
+const (
+	ScriptStepSendText    = "send_text"
+	ScriptStepSendKey     = "send_key"
+	ScriptStepWaitIdle    = "wait_idle"
+	ScriptStepWaitPattern = "wait_pattern"
+	ScriptStepSleep       = "sleep"
+)
+
+const (
+	// defaultScriptStepTimeout bounds wait steps without a timeout_ms.
+	defaultScriptStepTimeout = time.Minute
+	// scriptIdleSettle gives the agent time to react to the previous step
+	// before wait_idle trusts an idle state it may still show from before.
+	scriptIdleSettle = 500 * time.Millisecond
+)
+
+// ScriptStep is one step of a script command.
+type ScriptStep struct {
+	Op   string `json:"op"`
+	Text string `json:"text,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Pattern is the regular expression wait_pattern looks for in output
+	// produced after the step starts.
+	Pattern string `json:"pattern,omitempty"`
+	// DurationMS is how long sleep pauses.
+	DurationMS int `json:"duration_ms,omitempty"`
+	// TimeoutMS bounds wait steps; defaultScriptStepTimeout when zero.
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	// ExpectTimeout makes a wait step succeed when it times out and fail
+	// when its condition is met, e.g. to check that an error never shows.
+	ExpectTimeout bool `json:"expect_timeout,omitempty"`
+}
+
+// ScriptStepResult records how one step of a script went.
+type ScriptStepResult struct {
+	Index     int    `json:"index"`
+	Op        string `json:"op"`
+	Status    string `json:"status"`
+	Match     string `json:"match,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+type scriptResult struct {
+	Status string             `json:"status"`
+	Steps  []ScriptStepResult `json:"steps"`
+}
+
+func validateScript(steps []ScriptStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("script steps are required")
+	}
+	for i, step := range steps {
+		if step.TimeoutMS < 0 || step.DurationMS < 0 {
+			return fmt.Errorf("invalid script step %d: negative duration", i)
+		}
+		switch step.Op {
+		case ScriptStepSendText:
+			if step.Text == "" {
+				return fmt.Errorf("invalid script step %d: text is required", i)
+			}
+		case ScriptStepSendKey:
+			if ValidateControlKey(step.Key) == "" {
+				return fmt.Errorf("invalid script step %d: unsupported key %q", i, step.Key)
+			}
+		case ScriptStepWaitIdle:
+		case ScriptStepWaitPattern:
+			if step.Pattern == "" {
+				return fmt.Errorf("invalid script step %d: pattern is required", i)
+			}
+			if _, err := regexp.Compile(step.Pattern); err != nil {
+				return fmt.Errorf("invalid script step %d: %v", i, err)
+			}
+		case ScriptStepSleep:
+			if step.DurationMS == 0 {
+				return fmt.Errorf("invalid script step %d: duration_ms is required", i)
+			}
+		default:
+			return fmt.Errorf("invalid script step %d: unsupported op %q", i, step.Op)
+		}
+	}
+	return nil
+}
+
+// runScriptCommand runs a script's steps in order, stopping at the first
+// failure. It holds the session's command queue for the whole run, so no
+// other command interleaves, and records per-step results on cmd.
+func (sm *Manager) runScriptCommand(sessionID string, cmd *db.SessionCommand, req CommandRequest) error {
+	sm.mu.RLock()
+	ctx := sm.ctx
+	sm.mu.RUnlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd.Status = "sent"
+	cmd.SentAt = time.Now().UTC()
+	cmd.Error = ""
+	_ = sm.commandRepo.Update(context.Background(), cmd)
+
+	result := scriptResult{Status: "ok", Steps: make([]ScriptStepResult, 0, len(req.Steps))}
+	var runErr error
+	for i, step := range req.Steps {
+		started := time.Now()
+		stepResult := ScriptStepResult{Index: i, Op: step.Op, Status: "ok"}
+		match, err := sm.runScriptStep(ctx, sessionID, step)
+		stepResult.Match = match
+		stepResult.ElapsedMS = time.Since(started).Milliseconds()
+		if err != nil {
+			stepResult.Status = "failed"
+			if err == errCommandWaitTimeout {
+				stepResult.Status = "timeout"
+			}
+			stepResult.Error = err.Error()
+			runErr = fmt.Errorf("script step %d (%s): %w", i, step.Op, err)
+		}
+		result.Steps = append(result.Steps, stepResult)
+		if runErr != nil {
+			result.Status = stepResult.Status
+			break
+		}
+	}
+
+	cmd.Status = "completed"
+	if runErr != nil {
+		cmd.Status = "failed"
+		if result.Status == "timeout" {
+			cmd.Status = "timeout"
+		}
+		cmd.Error = runErr.Error()
+	}
+	if raw, err := json.Marshal(result); err == nil {
+		cmd.ResultJSON = string(raw)
+	}
+	cmd.CompletedAt = time.Now().UTC()
+	_ = sm.commandRepo.Update(context.Background(), cmd)
+	return runErr
+}
+
+// runScriptStep runs one step and returns the output line a wait_pattern
+// matched.
+func (sm *Manager) runScriptStep(ctx context.Context, sessionID string, step ScriptStep) (string, error) {
+	switch step.Op {
+	case ScriptStepSendText, ScriptStepSendKey:
+		op := CommandOpSendText
+		if step.Op == ScriptStepSendKey {
+			op = CommandOpSendKey
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, commandDispatchTimeout)
+		defer cancel()
+		return "", sm.dispatchCommand(sendCtx, sessionID, CommandRequest{Op: op, Text: step.Text, Key: step.Key})
+	case ScriptStepSleep:
+		return "", sleepContext(ctx, time.Duration(step.DurationMS)*time.Millisecond)
+	}
+
+	timeout := time.Duration(step.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultScriptStepTimeout
+	}
+	var cond func(context.Context) (string, bool, error)
+	if step.Op == ScriptStepWaitIdle {
+		if err := sleepContext(ctx, scriptIdleSettle); err != nil {
+			return "", err
+		}
+		cond = func(ctx context.Context) (string, bool, error) {
+			state, err := sm.GetIdleState(ctx, sessionID)
+			return "", state.Idle, err
+		}
+	} else {
+		pattern := regexp.MustCompile(step.Pattern)
+		since := time.Now().UTC()
+		cond = func(ctx context.Context) (string, bool, error) {
+			entries, err := sm.GetOutput(ctx, sessionID, since)
+			if err != nil {
+				return "", false, err
+			}
+			for _, entry := range entries {
+				if pattern.MatchString(entry.Text) {
+					return strings.TrimSpace(entry.Text), true, nil
+				}
+			}
+			return "", false, nil
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		match, met, err := cond(ctx)
+		if err != nil {
+			return "", err
+		}
+		if met {
+			if step.ExpectTimeout {
+				return match, fmt.Errorf("condition met while expecting a timeout")
+			}
+			return match, nil
+		}
+		if time.Now().After(deadline) {
+			if step.ExpectTimeout {
+				return "", nil
+			}
+			return "", errCommandWaitTimeout
+		}
+		if err := sleepContext(ctx, commandWaitPollInterval); err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestScriptCommandRunsStepsInOrder(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	commandRepo := db.NewSessionCommandRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex"}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	bad := CommandRequest{Op: CommandOpScript, Steps: []ScriptStep{{Op: ScriptStepWaitPattern, Pattern: "("}}}
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, bad); err == nil || !strings.Contains(err.Error(), "invalid script step 0") {
+		t.Fatalf("EnqueueCommand with bad pattern error=%v", err)
+	}
+
+	script, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpScript, Steps: []ScriptStep{
+		{Op: ScriptStepSendText, Text: "reset\n"},
+		{Op: ScriptStepWaitPattern, Pattern: `^cleared`, TimeoutMS: 5000},
+		{Op: ScriptStepWaitPattern, Pattern: `(?i)error`, TimeoutMS: 100, ExpectTimeout: true},
+		{Op: ScriptStepSleep, DurationMS: 10},
+		{Op: ScriptStepSendKey, Key: "enter"},
+		{Op: ScriptStepWaitPattern, Pattern: `never`, TimeoutMS: 100},
+		{Op: ScriptStepSendText, Text: "unreached\n"},
+	}})
+	if err != nil {
+		t.Fatalf("EnqueueCommand: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "cleared context", "normal", time.Now().UTC())
+
+	var cmd *db.SessionCommand
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cmd, err = commandRepo.Get(ctx, script.ID)
+		if err != nil {
+			t.Fatalf("get command: %v", err)
+		}
+		if !cmd.CompletedAt.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("script did not finish, status=%q", cmd.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if cmd.Status != "timeout" {
+		t.Fatalf("status=%q want timeout (error %q)", cmd.Status, cmd.Error)
+	}
+
+	var result scriptResult
+	if err := json.Unmarshal([]byte(cmd.ResultJSON), &result); err != nil {
+		t.Fatalf("decode result %q: %v", cmd.ResultJSON, err)
+	}
+	var statuses []string
+	for _, step := range result.Steps {
+		statuses = append(statuses, step.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "ok,ok,ok,ok,ok,timeout" {
+		t.Fatalf("step statuses=%s want the last wait to time out", got)
+	}
+	if result.Steps[1].Match != "cleared context" {
+		t.Fatalf("wait_pattern match=%q", result.Steps[1].Match)
+	}
+	if got := strings.Join(backend.inputs, "|"); strings.Contains(got, "unreached") || !strings.Contains(got, "reset") {
+		t.Fatalf("inputs=%q want only the steps before the failure", backend.inputs)
+	}
+	if len(backend.keys) != 1 || backend.keys[0] != sess.TmuxWindowID+":C-m" {
+		t.Fatalf("keys=%q want one Enter", backend.keys)
+	}
+}
@@ -0,0 +1,212 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+// CommandWait names the session state a command waits for before it is sent.
+type CommandWait string
+
+const (
+	// CommandWaitReady waits until the agent accepts input, as reported by
+	// GetSessionReadyState.
+	CommandWaitReady CommandWait = "ready"
+	// CommandWaitIdle waits until the agent stops producing output or shows
+	// its prompt.
+	CommandWaitIdle CommandWait = "idle"
+	// CommandWaitPrompt waits until the agent's prompt is on screen.
+	CommandWaitPrompt CommandWait = "prompt"
+)
+
+const (
+	defaultCommandWaitTimeout = 10 * time.Minute
+	commandWaitPollInterval   = 250 * time.Millisecond
+	maxCommandDelay           = 24 * time.Hour
+)
+
+var errCommandWaitTimeout = errors.New("timed out waiting for session")
+
+func validateCommandWait(req CommandRequest) error {
+	switch req.WaitFor {
+	case "", CommandWaitReady, CommandWaitIdle, CommandWaitPrompt:
+	default:
+		return fmt.Errorf("unsupported wait_for %q", req.WaitFor)
+	}
+	if req.Timeout < 0 {
+		return fmt.Errorf("unsupported negative timeout")
+	}
+	if time.Until(req.NotBefore) > maxCommandDelay {
+		return fmt.Errorf("unsupported not_before more than %s ahead", maxCommandDelay)
+	}
+	return nil
+}
+
+// deferred reports whether a command has to sit in the pending state until
+// its condition is met.
+func (req CommandRequest) deferred() bool {
+	return req.WaitFor != "" || time.Now().Before(req.NotBefore)
+}
+
+// parkCommand holds a deferred command outside the session queue until it
+// is due and then queues it behind whatever is waiting by then. On failure
+// it records the outcome, except on shutdown, which leaves the command
+// pending for the next Start. CancelCommand drops it while it waits.
+func (sm *Manager) parkCommand(item queuedCommand) {
+	sm.mu.RLock()
+	parent := sm.ctx
+	sm.mu.RUnlock()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	sm.commandMu.Lock()
+	sm.parked[item.cmd.ID] = cancel
+	sm.commandMu.Unlock()
+
+	go func() {
+		defer cancel()
+		cmd, req := item.cmd, item.req
+		err := sm.awaitCommand(ctx, cmd.SessionID, req)
+		if !sm.unparkCommand(cmd.ID) || parent.Err() != nil {
+			return
+		}
+		if err == nil {
+			cmd.Status = "queued"
+			_ = sm.commandRepo.Update(context.Background(), cmd)
+			err = sendQueuedCommand(ctx, sm.ensureSessionCommandQueue(cmd.SessionID), item)
+			if err == nil {
+				return
+			}
+		}
+		cmd.Status = "failed"
+		if errors.Is(err, errCommandWaitTimeout) {
+			cmd.Status = "timeout"
+		}
+		cmd.Error = err.Error()
+		cmd.CompletedAt = time.Now().UTC()
+		cmd.ResultJSON = fmt.Sprintf(`{"status":"%s","wait_for":"%s"}`, cmd.Status, req.WaitFor)
+		_ = sm.commandRepo.Update(context.Background(), cmd)
+	}()
+}
+
+// unparkCommand reports whether the command was still parked, that is, not
+// cancelled.
+func (sm *Manager) unparkCommand(commandID string) bool {
+	sm.commandMu.Lock()
+	defer sm.commandMu.Unlock()
+	_, ok := sm.parked[commandID]
+	delete(sm.parked, commandID)
+	return ok
+}
+
+// awaitCommand blocks until req may be sent: after NotBefore and, once that
+// passed, until the session reaches WaitFor or the timeout runs out, and
+// then for as long as a human has the session taken over.
+func (sm *Manager) awaitCommand(ctx context.Context, sessionID string, req CommandRequest) error {
+	err := sleepContext(ctx, time.Until(req.NotBefore))
+	if err == nil && req.WaitFor != "" {
+		err = sm.waitForSession(ctx, sessionID, req)
+	}
+	if err == nil {
+		err = sm.waitForHandback(ctx, sessionID)
+	}
+	return err
+}
+
+// CancelCommand drops a deferred command that is still pending.
+func (sm *Manager) CancelCommand(ctx context.Context, sessionID string, commandID string) (*db.SessionCommand, error) {
+	cmd, err := sm.commandRepo.Get(ctx, commandID)
+	if err != nil {
+		return nil, err
+	}
+	if cmd == nil || cmd.SessionID != sessionID {
+		return nil, errNotFound("session command")
+	}
+	sm.commandMu.Lock()
+	cancel, ok := sm.parked[commandID]
+	delete(sm.parked, commandID)
+	sm.commandMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("session command %s is not pending (%s)", commandID, cmd.Status)
+	}
+	cancel()
+	cmd.Status = "cancelled"
+	cmd.CompletedAt = time.Now().UTC()
+	cmd.ResultJSON = `{"status":"cancelled"}`
+	if err := sm.commandRepo.Update(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (sm *Manager) waitForSession(ctx context.Context, sessionID string, req CommandRequest) error {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandWaitTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		met, err := sm.commandWaitMet(ctx, sessionID, req.WaitFor)
+		if err != nil || met {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w (wait_for %s, %s)", errCommandWaitTimeout, req.WaitFor, timeout)
+		}
+		if err := sleepContext(ctx, commandWaitPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func (sm *Manager) commandWaitMet(ctx context.Context, sessionID string, wait CommandWait) (bool, error) {
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session == nil {
+		return false, errNotFound("session")
+	}
+	if !isActiveSessionStatus(session.Status) || session.Exit != nil {
+		return false, fmt.Errorf("session ended (%s) before it was %s", session.Status, wait)
+	}
+	switch wait {
+	case CommandWaitIdle:
+		state, err := sm.GetIdleState(ctx, sessionID)
+		return state.Idle, err
+	case CommandWaitPrompt:
+		state, err := sm.GetSessionReadyState(ctx, sessionID)
+		return state.PromptDetected, err
+	default:
+		state, err := sm.GetSessionReadyState(ctx, sessionID)
+		return state.Ready, err
+	}
+}
+
+// restorePendingCommands parks the commands that were still waiting when
+// the manager last stopped.
+func (sm *Manager) restorePendingCommands(ctx context.Context) {
+	pending, err := sm.commandRepo.ListByStatus(ctx, "pending")
+	if err != nil {
+		slog.Warn("failed to list pending session commands", "error", err)
+		return
+	}
+	for _, cmd := range pending {
+		var req CommandRequest
+		if err := json.Unmarshal([]byte(cmd.PayloadJSON), &req); err != nil {
+			cmd.Status = "failed"
+			cmd.Error = fmt.Sprintf("decode pending command: %v", err)
+			cmd.CompletedAt = time.Now().UTC()
+			_ = sm.commandRepo.Update(ctx, cmd)
+			continue
+		}
+		sm.parkCommand(queuedCommand{cmd: cmd, req: req, done: make(chan commandResult, 1)})
+	}
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestEnqueueCommandWaitsForPrompt(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	commandRepo := db.NewSessionCommandRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex"}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "hi\n", WaitFor: "later"}); err == nil || !strings.Contains(err.Error(), "unsupported wait_for") {
+		t.Fatalf("EnqueueCommand with bad wait_for error=%v", err)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "thinking...", "normal", time.Now().UTC())
+	expired, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "too early\n", WaitFor: CommandWaitPrompt, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("EnqueueCommand: %v", err)
+	}
+	if expired.Status != "pending" {
+		t.Fatalf("status=%q want pending", expired.Status)
+	}
+	later, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "next\n", WaitFor: CommandWaitPrompt, Timeout: 5 * time.Second, NotBefore: time.Now().Add(300 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("EnqueueCommand: %v", err)
+	}
+
+	waitCommand := func(id, want string) *db.SessionCommand {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			cmd, err := commandRepo.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("get command: %v", err)
+			}
+			if cmd.Status == want {
+				return cmd
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("command %s status=%q want %q", id, cmd.Status, want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if cmd := waitCommand(expired.ID, "timeout"); !strings.Contains(cmd.Error, "timed out waiting for session (wait_for prompt") {
+		t.Fatalf("timeout error=%q", cmd.Error)
+	}
+	if cmd, _ := commandRepo.Get(ctx, later.ID); cmd.Status != "pending" {
+		t.Fatalf("follow-up status=%q before the prompt, want pending", cmd.Status)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "codex $", "prompt", time.Now().UTC())
+	cmd := waitCommand(later.ID, "completed")
+	if cmd.SentAt.Before(later.CreatedAt.Add(300 * time.Millisecond).Truncate(time.Second)) {
+		t.Fatalf("sent_at=%v before not_before", cmd.SentAt)
+	}
+	for _, input := range backend.inputs {
+		if strings.Contains(input, "too early") {
+			t.Fatalf("timed out command was sent: %q", backend.inputs)
+		}
+	}
+}
+
+func TestDeferredCommandDoesNotHoldQueueAndCanBeCancelled(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	commandRepo := db.NewSessionCommandRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex"}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "much later\n", NotBefore: time.Now().Add(48 * time.Hour)}); err == nil || !strings.Contains(err.Error(), "unsupported not_before") {
+		t.Fatalf("EnqueueCommand with distant not_before error=%v", err)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "thinking...", "normal", time.Now().UTC())
+	pending, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "at the prompt\n", WaitFor: CommandWaitPrompt})
+	if err != nil {
+		t.Fatalf("EnqueueCommand deferred: %v", err)
+	}
+
+	queueCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	sent, err := lifecycle.EnqueueCommand(queueCtx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "now\n"})
+	if err != nil {
+		t.Fatalf("EnqueueCommand behind a deferred command: %v", err)
+	}
+	if sent.Status != "completed" {
+		t.Fatalf("status=%q want completed", sent.Status)
+	}
+	interrupt, err := lifecycle.EnqueueCommand(queueCtx, sess.ID, CommandRequest{Op: CommandOpInterrupt})
+	if err != nil || interrupt.Status != "completed" {
+		t.Fatalf("interrupt=%+v err=%v", interrupt, err)
+	}
+
+	if _, err := lifecycle.CancelCommand(ctx, "other-session", pending.ID); err == nil || !IsNotFound(err) {
+		t.Fatalf("CancelCommand on another session error=%v", err)
+	}
+	cancelled, err := lifecycle.CancelCommand(ctx, sess.ID, pending.ID)
+	if err != nil {
+		t.Fatalf("CancelCommand: %v", err)
+	}
+	if cancelled.Status != "cancelled" {
+		t.Fatalf("status=%q want cancelled", cancelled.Status)
+	}
+	if _, err := lifecycle.CancelCommand(ctx, sess.ID, sent.ID); err == nil || !strings.Contains(err.Error(), "is not pending") {
+		t.Fatalf("CancelCommand on a sent command error=%v", err)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "codex $", "prompt", time.Now().UTC())
+	time.Sleep(3 * commandWaitPollInterval)
+	if cmd, _ := commandRepo.Get(ctx, pending.ID); cmd.Status != "cancelled" {
+		t.Fatalf("cancelled command status=%q", cmd.Status)
+	}
+	for _, input := range backend.inputs {
+		if strings.Contains(input, "at the prompt") {
+			t.Fatalf("cancelled command was sent: %q", backend.inputs)
+		}
+	}
+}
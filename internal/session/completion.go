@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/agenterm/configs"
+	"github.com/user/agenterm/internal/completion"
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/sandbox"
+)
+
+// SessionEventCompletion is the kind of events recorded when a session's
+// done or review detector starts firing.
+const SessionEventCompletion = "completion"
+
+// SetPlaybooksDir sets the directory of playbook YAML files whose roles may
+// declare completion detectors. Shipped playbooks are used for IDs not
+// found there.
+func (sm *Manager) SetPlaybooksDir(dir string) {
+	sm.playbookMu.Lock()
+	defer sm.playbookMu.Unlock()
+	sm.playbooksDir = strings.TrimSpace(dir)
+}
+
+// completionDetectors returns the done and review detectors of a session:
+// those of its role in the project's playbook, then the agent's role
+// override, then the agent's own, then the defaults.
+func (sm *Manager) completionDetectors(ctx context.Context, sess *db.Session) (done, review completion.Detector) {
+	var layers []completion.Config
+	if playbook := sm.sessionPlaybook(ctx, sess); playbook != "" {
+		roles, err := sm.playbookCompletion(playbook)
+		if err != nil {
+			slog.Warn("ignoring playbook completion detectors", "playbook", playbook, "error", err)
+		} else if rc, ok := roles[sess.Role]; ok {
+			layers = append(layers, rc)
+		}
+	}
+	if agent := sm.registry.Get(sess.AgentType); agent != nil {
+		layers = append(layers, agent.Completion)
+	}
+	return completion.Resolve(sess.Role, layers...)
+}
+
+// checkCompletionDetectors fails when the detectors sess would get are
+// invalid, so that no session is started that its monitor cannot watch.
+func (sm *Manager) checkCompletionDetectors(ctx context.Context, sess *db.Session) error {
+	done, review := sm.completionDetectors(ctx, sess)
+	if err := done.Validate(); err != nil {
+		return fmt.Errorf("invalid done detector: %w", err)
+	}
+	if err := review.Validate(); err != nil {
+		return fmt.Errorf("invalid review detector: %w", err)
+	}
+	return nil
+}
+
+// detectorCommand returns how the command detectors of sess are run: in the
+// agent's sandbox and the session's cgroup, like the agent itself.
+func (sm *Manager) detectorCommand(ctx context.Context, sess *db.Session, workDir string) func(string) ([]string, error) {
+	agent := sm.registry.Get(sess.AgentType)
+	limits := sm.effectiveLimits(ctx, sess)
+	return func(command string) ([]string, error) {
+		cgroup := sm.prepareCgroup(sess.ID, limits)
+		if agent == nil || !agent.Sandbox.Enabled() {
+			if cgroup != "" {
+				command = resources.JoinCommand(cgroup, command)
+			}
+			return []string{"sh", "-c", command}, nil
+		}
+		policy, err := agent.Sandbox.Policy(workDir)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox for agent %q: %w", agent.ID, err)
+		}
+		policy.Cgroup = cgroup
+		return sandbox.Command([]string{"sh", "-c", command}, policy)
+	}
+}
+
+func (sm *Manager) sessionPlaybook(ctx context.Context, sess *db.Session) string {
+	if sess.TaskID == "" {
+		return ""
+	}
+	task, err := sm.taskRepo.Get(ctx, sess.TaskID)
+	if err != nil || task == nil {
+		return ""
+	}
+	project, err := sm.projectRepo.Get(ctx, task.ProjectID)
+	if err != nil || project == nil {
+		return ""
+	}
+	return strings.TrimSpace(project.Playbook)
+}
+
+// playbookCompletion loads the completion detectors of a playbook's roles.
+func (sm *Manager) playbookCompletion(id string) (map[string]completion.Config, error) {
+	data, err := sm.readPlaybook(id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return completion.PlaybookRoles(data)
+}
+
+// readPlaybook reads a playbook from the playbooks directory, falling back
+// to the shipped playbooks. It returns nil when neither has it.
+func (sm *Manager) readPlaybook(id string) ([]byte, error) {
+	if strings.ContainsAny(id, `/\`) {
+		return nil, errors.New("invalid playbook id")
+	}
+	sm.playbookMu.Lock()
+	dir := sm.playbooksDir
+	sm.playbookMu.Unlock()
+
+	for _, ext := range []string{".yaml", ".yml"} {
+		if dir == "" {
+			break
+		}
+		data, err := os.ReadFile(filepath.Join(dir, id+ext))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	data, err := configs.PlaybookDefaults.ReadFile("playbooks/" + id + ".yaml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// recordCompletion records which detector marked a session done or ready
+// for review.
+func (sm *Manager) recordCompletion(ctx context.Context, sessionID, kind string, result completion.Result) {
+	status := "completed"
+	if kind == "review" {
+		status = "waiting_review"
+	}
+	sm.recordSessionEvent(ctx, &db.SessionEvent{
+		SessionID: sessionID,
+		Kind:      SessionEventCompletion,
+		Rule:      result.Detector,
+		Action:    status,
+		Detail:    result.Detail,
+	})
+}
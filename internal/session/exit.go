@@ -0,0 +1,104 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/hub"
+	"github.com/user/agenterm/internal/resources"
+)
+
+// Exit reasons recorded on a session when its agent process ends.
+const (
+	ExitReasonCompleted     = "completed"
+	ExitReasonCrashed       = "crashed"
+	ExitReasonOOM           = "oom"
+	ExitReasonKilled        = "killed"
+	ExitReasonLimitExceeded = "limit_exceeded"
+	// ExitReasonWatchdog is used when a watchdog rule terminated a stuck
+	// session.
+	ExitReasonWatchdog = "watchdog"
+	// ExitReasonHandedOff is used when a handoff closed the session for
+	// another agent to continue its task.
+	ExitReasonHandedOff = "handed_off"
+	// ExitReasonUnknown is used when the backend cannot report how the
+	// process ended, e.g. with tmux or after a server restart.
+	ExitReasonUnknown = "unknown"
+)
+
+// sessionExited records the exit of a session whose process ended on its
+// own. It is called by the session's monitor.
+func (sm *Manager) sessionExited(ctx context.Context, sessionID string) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil || sess == nil || sess.Exit != nil {
+		return
+	}
+	// Releasing the limits notes whether the cgroup saw an OOM kill.
+	sm.releaseLimits(sessionID)
+	exit := sm.observeExit(ctx, sess)
+	sm.limitMu.Lock()
+	oom := sm.oomKilled[sessionID]
+	delete(sm.oomKilled, sessionID)
+	sm.limitMu.Unlock()
+	if oom && (exit.Code == nil || exit.Signal == resources.SignalName(syscall.SIGKILL)) {
+		exit.Reason = ExitReasonOOM
+	}
+	sm.recordExit(ctx, sess, exit)
+}
+
+// observeExit asks the backend how the session's process ended.
+func (sm *Manager) observeExit(ctx context.Context, sess *db.Session) *db.SessionExit {
+	exit := &db.SessionExit{Reason: ExitReasonUnknown, At: time.Now().UTC()}
+	backend, ok := sm.backend.(ExitBackend)
+	if !ok {
+		return exit
+	}
+	terminalID := sess.TmuxWindowID
+	if terminalID == "" {
+		terminalID = sess.ID
+	}
+	status, err := backend.ExitStatus(ctx, terminalID)
+	if err != nil {
+		slog.Debug("session exit status unavailable", "session_id", sess.ID, "error", err)
+		return exit
+	}
+	code := status.Code
+	exit.Code = &code
+	if status.Signal > 0 {
+		exit.Signal = resources.SignalName(syscall.Signal(status.Signal))
+	}
+	if !status.At.IsZero() {
+		exit.At = status.At.UTC()
+	}
+	if code == 0 && exit.Signal == "" {
+		exit.Reason = ExitReasonCompleted
+	} else {
+		exit.Reason = ExitReasonCrashed
+	}
+	return exit
+}
+
+// recordExit stores exit on the session and broadcasts a session_exited
+// event.
+func (sm *Manager) recordExit(ctx context.Context, sess *db.Session, exit *db.SessionExit) {
+	if err := sm.sessionRepo.SetExit(ctx, sess.ID, exit); err != nil {
+		slog.Warn("failed to record session exit", "session_id", sess.ID, "error", err)
+		return
+	}
+	sess.Exit = exit
+	sm.wakeScheduler()
+	slog.Info("session exited", "session_id", sess.ID, "reason", exit.Reason, "signal", exit.Signal)
+	if sm.hub != nil {
+		sm.hub.BroadcastSessionExited(hub.SessionExitedMessage{
+			SessionID: sess.ID,
+			Status:    sess.Status,
+			ExitCode:  exit.Code,
+			Signal:    exit.Signal,
+			Reason:    exit.Reason,
+			ExitedAt:  exit.At.Unix(),
+		})
+	}
+}
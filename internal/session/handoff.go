@@ -0,0 +1,245 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	gitops "github.com/user/agenterm/internal/git"
+)
+
+const (
+	// handoffDir holds handoff notes, relative to the worktree.
+	handoffDir = ".orchestra/handoff"
+	// handoffOutputLines is how much of the previous session's output the
+	// note carries over.
+	handoffOutputLines = 80
+	// handoffGracePeriod is how long the previous agent gets to exit after
+	// being interrupted before its terminal is destroyed.
+	handoffGracePeriod = 5 * time.Second
+)
+
+// HandoffRequest names the agent and role that take over a session's task.
+type HandoffRequest struct {
+	AgentType string
+	Role      string
+	// Note is added to the handoff note as guidance for the next agent.
+	Note string
+}
+
+// HandoffResult describes a completed handoff.
+type HandoffResult struct {
+	PreviousSessionID string      `json:"previous_session_id"`
+	Session           *db.Session `json:"session"`
+	// NotePath is the handoff note, relative to the worktree.
+	NotePath string `json:"note_path"`
+	// CommandID is the command that primes the new session with the note.
+	CommandID string `json:"command_id,omitempty"`
+}
+
+// Handoff ends a session and starts req's agent and role on the same task
+// and worktree, primed with a note on what the previous session did.
+func (sm *Manager) Handoff(ctx context.Context, sessionID string, req HandoffRequest) (*HandoffResult, error) {
+	if err := sm.ensureStarted(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.AgentType) == "" || strings.TrimSpace(req.Role) == "" {
+		return nil, fmt.Errorf("agent_type and role are required")
+	}
+	agent := sm.registry.Get(req.AgentType)
+	if agent == nil {
+		return nil, fmt.Errorf("unknown agent type %q", req.AgentType)
+	}
+	prev, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, errNotFound("session")
+	}
+	// The previous terminal is interrupted and destroyed: not while a human
+	// holds it, and not once it has ended.
+	if !sessionRunning(prev) {
+		return nil, fmt.Errorf("session %s is not running", sessionID)
+	}
+	if prev.Takeover.Active(time.Now().UTC()) {
+		return nil, takeoverError(sessionID, prev.Takeover)
+	}
+	task, err := sm.taskRepo.Get(ctx, prev.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, errNotFound("task")
+	}
+	if err := sm.checkHandoffCapacity(ctx, prev, req.AgentType, agentCapacity(agent)); err != nil {
+		return nil, err
+	}
+
+	workDir := sm.resolveWorkDirForSession(ctx, prev)
+	if workDir == "" {
+		return nil, fmt.Errorf("session has no work directory")
+	}
+	note := sm.handoffNote(ctx, prev, task, workDir, req)
+	notePath, err := writeHandoffNote(workDir, prev.ID, note)
+	if err != nil {
+		return nil, err
+	}
+
+	// The next session starts first so that a failed start leaves the task
+	// with its current agent.
+	next, err := sm.createSession(ctx, CreateSessionRequest{TaskID: task.ID, AgentType: req.AgentType, Role: req.Role}, createOptions{replacing: prev})
+	if err != nil {
+		return nil, err
+	}
+	if err := sm.closeGracefully(ctx, prev); err != nil {
+		return nil, fmt.Errorf("close session: %w", err)
+	}
+	result := &HandoffResult{PreviousSessionID: prev.ID, Session: next, NotePath: notePath}
+	prompt := fmt.Sprintf("You are taking over this task as %s from the previous %s session. Read %s for what was done so far, then continue.\n", req.Role, prev.Role, notePath)
+	cmd, err := sm.EnqueueCommand(ctx, next.ID, CommandRequest{Op: CommandOpSendText, Text: prompt, WaitFor: CommandWaitReady})
+	if err != nil {
+		slog.Warn("failed to prime handoff session", "session_id", next.ID, "error", err)
+	} else {
+		result.CommandID = cmd.ID
+	}
+	slog.Info("session handed off", "from", prev.ID, "to", next.ID, "agent", req.AgentType, "role", req.Role, "note", notePath)
+	return result, nil
+}
+
+// checkHandoffCapacity fails when the target agent has no slot, counting the
+// slot prev frees, so that prev is not closed for nothing.
+func (sm *Manager) checkHandoffCapacity(ctx context.Context, prev *db.Session, agentType string, limit int) error {
+	capacity, err := sm.schedulerCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	busy := capacity.byAgent[agentType]
+	if prev.AgentType == agentType && sessionRunning(prev) {
+		busy--
+	}
+	waiting, err := sm.waitlistRepo.List(ctx, agentType)
+	if err != nil {
+		return err
+	}
+	if busy >= limit || len(waiting) > 0 {
+		return fmt.Errorf("agent %q at capacity (%d/%d, %d waiting)", agentType, busy, limit, len(waiting))
+	}
+	return nil
+}
+
+// handoffNote summarizes a session for the agent that takes over: the task,
+// commits made during the session, open review issues and recent output.
+func (sm *Manager) handoffNote(ctx context.Context, prev *db.Session, task *db.Task, workDir string, req HandoffRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Handoff: %s → %s\n\n", prev.Role, req.Role)
+	fmt.Fprintf(&b, "From session %s (%s, %s) to %s (%s), %s.\n\n", prev.ID, prev.AgentType, prev.Role, req.AgentType, req.Role, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "## Task\n\n%s\n", task.Title)
+	if desc := strings.TrimSpace(task.Description); desc != "" {
+		fmt.Fprintf(&b, "\n%s\n", desc)
+	}
+	if note := strings.TrimSpace(req.Note); note != "" {
+		fmt.Fprintf(&b, "\n## Notes\n\n%s\n", note)
+	}
+
+	b.WriteString("\n## Commits since the session started\n\n")
+	commits, err := gitops.GetLogSince(workDir, prev.CreatedAt, 50)
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "Unavailable: %v\n", err)
+	case len(commits) == 0:
+		b.WriteString("None.\n")
+	default:
+		for _, c := range commits {
+			hash := c.Hash
+			if len(hash) > 12 {
+				hash = hash[:12]
+			}
+			fmt.Fprintf(&b, "- %s %s\n", hash, c.Message)
+		}
+	}
+
+	b.WriteString("\n## Open review issues\n\n")
+	issues, err := sm.reviewRepo.ListOpenIssuesByTask(ctx, task.ID)
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "Unavailable: %v\n", err)
+	case len(issues) == 0:
+		b.WriteString("None.\n")
+	default:
+		for _, issue := range issues {
+			fmt.Fprintf(&b, "- [%s] %s\n", issue.Severity, issue.Summary)
+		}
+	}
+
+	b.WriteString("\n## Recent output\n\n")
+	entries, err := sm.GetOutput(ctx, prev.ID, time.Time{})
+	if err != nil || len(entries) == 0 {
+		b.WriteString("None captured.\n")
+	} else {
+		if len(entries) > handoffOutputLines {
+			entries = entries[len(entries)-handoffOutputLines:]
+		}
+		b.WriteString("```\n")
+		for _, entry := range entries {
+			b.WriteString(entry.Text)
+			b.WriteByte('\n')
+		}
+		b.WriteString("```\n")
+	}
+	return b.String()
+}
+
+// writeHandoffNote stores note under handoffDir in workDir and returns its
+// path relative to workDir.
+func writeHandoffNote(workDir, sessionID, note string) (string, error) {
+	dir := filepath.Join(workDir, filepath.FromSlash(handoffDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create handoff dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%d.md", sessionID, time.Now().Unix())
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(note), 0o644); err != nil {
+		return "", fmt.Errorf("write handoff note: %w", err)
+	}
+	return handoffDir + "/" + name, nil
+}
+
+// closeGracefully interrupts a session's agent so it can exit on its own,
+// then destroys whatever is left of its terminal. The session ends as
+// handed_off rather than completed: its task goes on in another session.
+func (sm *Manager) closeGracefully(ctx context.Context, sess *db.Session) error {
+	if sessionRunning(sess) && sm.backend.SessionExists(ctx, sess.TmuxWindowID) {
+		for i := 0; i < 2; i++ {
+			if err := sm.backend.SendKey(ctx, sess.TmuxWindowID, "C-c"); err != nil {
+				break
+			}
+			if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+				return err
+			}
+		}
+		deadline := time.Now().Add(handoffGracePeriod)
+		for !sm.terminalExited(ctx, sess.TmuxWindowID) && time.Now().Before(deadline) {
+			if err := sleepContext(ctx, commandWaitPollInterval); err != nil {
+				return err
+			}
+		}
+	}
+	return sm.destroySession(ctx, sess.ID, "handed_off", ExitReasonHandedOff)
+}
+
+// terminalExited reports whether the process in a terminal has ended.
+func (sm *Manager) terminalExited(ctx context.Context, terminalID string) bool {
+	if !sm.backend.SessionExists(ctx, terminalID) {
+		return true
+	}
+	if exits, ok := sm.backend.(ExitBackend); ok {
+		_, err := exits.ExitStatus(ctx, terminalID)
+		return err == nil
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestHandoffStartsNextRoleWithNote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	reviewRepo := db.NewReviewRepo(database.SQL())
+
+	repo := t.TempDir()
+	git := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+		cmd.Env = append(cmd.Env, env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git(nil, "init", "-q")
+	old := []string{"GIT_AUTHOR_DATE=2020-01-01T00:00:00Z", "GIT_COMMITTER_DATE=2020-01-01T00:00:00Z"}
+	git(old, "commit", "-q", "--allow-empty", "-m", "initial import")
+	git(nil, "commit", "-q", "--allow-empty", "-m", "add failing tests")
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	for _, id := range []string{"codex", "busy"} {
+		if err := reg.Save(&registry.AgentConfig{ID: id, Name: id, Command: id, MaxParallelAgents: 1}); err != nil {
+			t.Fatalf("save agent: %v", err)
+		}
+	}
+
+	project := &db.Project{Name: "P1", RepoPath: repo, Status: "active"}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	task := &db.Task{ProjectID: project.ID, Title: "Parse config", Description: "Support YAML.", Status: "in_progress"}
+	if err := taskRepo.Create(ctx, task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	cycle := &db.ReviewCycle{TaskID: task.ID, Status: "review_changes_requested"}
+	if err := reviewRepo.CreateCycle(ctx, cycle); err != nil {
+		t.Fatalf("create cycle: %v", err)
+	}
+	if err := reviewRepo.CreateIssue(ctx, &db.ReviewIssue{CycleID: cycle.ID, Severity: "high", Summary: "missing error test", Status: "open"}); err != nil {
+		t.Fatalf("create issue: %v", err)
+	}
+	// Terminals are named after their sessions and still running.
+	backend := &exitFakeBackend{fakeBackend: newFakeBackend()}
+	newSession := func(agent, role string) *db.Session {
+		id, err := db.NewID()
+		if err != nil {
+			t.Fatalf("new id: %v", err)
+		}
+		sess := &db.Session{ID: id, TaskID: task.ID, TmuxSessionName: id, TmuxWindowID: id, AgentType: agent, Role: role, Status: "working", CreatedAt: time.Now().UTC().Add(-time.Hour)}
+		if err := sessionRepo.Create(ctx, sess); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		backend.sessions[id] = true
+		return sess
+	}
+	prev := newSession("codex", "test-writer")
+	newSession("busy", "coder")
+
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+	lifecycle.ObserveParsedOutput(prev.ID, prev.TmuxWindowID, "12 tests written, 3 failing", "normal", time.Now().UTC())
+
+	if _, err := lifecycle.Handoff(ctx, prev.ID, HandoffRequest{AgentType: "busy", Role: "implementer"}); err == nil || !strings.Contains(err.Error(), "at capacity") {
+		t.Fatalf("Handoff to a full agent error=%v want at capacity", err)
+	}
+	if got, _ := sessionRepo.Get(ctx, prev.ID); got.Status != "working" {
+		t.Fatalf("refused handoff changed the session to %q", got.Status)
+	}
+
+	lease := &db.TakeoverLease{Owner: "alice", AcquiredAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Minute)}
+	if err := sessionRepo.SetTakeoverLease(ctx, prev.ID, lease); err != nil {
+		t.Fatalf("set takeover lease: %v", err)
+	}
+	if _, err := lifecycle.Handoff(ctx, prev.ID, HandoffRequest{AgentType: "codex", Role: "implementer"}); err == nil || !strings.Contains(err.Error(), "under human takeover") {
+		t.Fatalf("Handoff under takeover error=%v want under human takeover", err)
+	}
+	if len(backend.keys) != 0 {
+		t.Fatalf("keys=%q want a held terminal left alone", backend.keys)
+	}
+	if err := sessionRepo.SetTakeoverLease(ctx, prev.ID, nil); err != nil {
+		t.Fatalf("clear takeover lease: %v", err)
+	}
+
+	result, err := lifecycle.Handoff(ctx, prev.ID, HandoffRequest{AgentType: "codex", Role: "implementer", Note: "Start with the parser."})
+	if err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+	if result.Session.Role != "implementer" || result.Session.TaskID != task.ID || result.CommandID == "" {
+		t.Fatalf("result=%+v want a primed implementer session on the task", result)
+	}
+	closed, err := sessionRepo.Get(ctx, prev.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if closed.Status != "handed_off" || closed.Exit == nil || closed.Exit.Reason != ExitReasonHandedOff {
+		t.Fatalf("previous session status=%q exit=%+v want handed_off", closed.Status, closed.Exit)
+	}
+	if len(backend.keys) == 0 || backend.keys[0] != prev.ID+":C-c" {
+		t.Fatalf("keys=%q want the previous agent interrupted", backend.keys)
+	}
+	if _, err := lifecycle.Handoff(ctx, prev.ID, HandoffRequest{AgentType: "codex", Role: "reviewer"}); err == nil || !strings.Contains(err.Error(), "is not running") {
+		t.Fatalf("Handoff of an ended session error=%v want is not running", err)
+	}
+
+	note, err := os.ReadFile(filepath.Join(repo, filepath.FromSlash(result.NotePath)))
+	if err != nil {
+		t.Fatalf("read note: %v", err)
+	}
+	for _, want := range []string{"test-writer → implementer", "Parse config", "Start with the parser.", "add failing tests", "[high] missing error test", "12 tests written, 3 failing"} {
+		if !strings.Contains(string(note), want) {
+			t.Fatalf("note missing %q:\n%s", want, note)
+		}
+	}
+	if strings.Contains(string(note), "initial import") {
+		t.Fatalf("note lists a commit from before the session:\n%s", note)
+	}
+}
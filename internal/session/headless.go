@@ -0,0 +1,389 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/hub"
+	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/sandbox"
+)
+
+const (
+	// defaultHeadlessTimeout bounds runs that do not set a timeout.
+	defaultHeadlessTimeout = 30 * time.Minute
+	// maxHeadlessOutput caps the stdout and the stderr kept for a run.
+	maxHeadlessOutput = 1 << 20
+	// headlessKillDelay is how long a killed run's output pipes may stay
+	// open, e.g. held by orphaned children, before they are closed.
+	headlessKillDelay = 5 * time.Second
+)
+
+// Headless run statuses.
+const (
+	HeadlessRunning   = "running"
+	HeadlessCompleted = "completed"
+	HeadlessFailed    = "failed"
+	HeadlessTimeout   = "timeout"
+	HeadlessCancelled = "cancelled"
+)
+
+// HeadlessRunRequest asks for a one-shot, non-interactive agent run.
+type HeadlessRunRequest struct {
+	AgentType string
+	// Prompt is written to the agent's stdin.
+	Prompt string
+	// Timeout kills the run after this long; zero uses
+	// defaultHeadlessTimeout.
+	Timeout time.Duration
+}
+
+type headlessHandle struct {
+	agentType string
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// StartHeadlessRun runs an agent's headless command for a task in the
+// task's worktree, without a terminal. It returns once the process has
+// started; the outcome is recorded on the run. Runs take a slot of the
+// agent's capacity, and are refused rather than queued when none is free.
+func (sm *Manager) StartHeadlessRun(ctx context.Context, taskID string, req HeadlessRunRequest) (*db.HeadlessRun, error) {
+	if err := sm.ensureStarted(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.AgentType) == "" {
+		return nil, fmt.Errorf("agent type is required")
+	}
+	if strings.TrimSpace(req.Prompt) == "" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+	if req.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	agent := sm.registry.Get(req.AgentType)
+	if agent == nil {
+		return nil, fmt.Errorf("unknown agent type %q", req.AgentType)
+	}
+	if !agent.SupportsHeadless || strings.TrimSpace(agent.HeadlessCommand) == "" {
+		return nil, fmt.Errorf("headless runs are unsupported by agent %q", req.AgentType)
+	}
+	task, err := sm.taskRepo.Get(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, errNotFound("task")
+	}
+	if err := sm.budgetBlocks(ctx, task); err != nil {
+		return nil, err
+	}
+	project, err := sm.projectRepo.Get(ctx, task.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project for task not found")
+	}
+	workDir, err := sm.resolveWorkDir(ctx, task, project)
+	if err != nil {
+		return nil, err
+	}
+	argv, err := headlessArgv(agent, workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.createMu.Lock()
+	defer sm.createMu.Unlock()
+	if err := sm.headlessSlotFree(ctx, agent); err != nil {
+		return nil, err
+	}
+
+	run := &db.HeadlessRun{TaskID: task.ID, AgentType: agent.ID, Prompt: req.Prompt, Status: HeadlessRunning}
+	if err := sm.headlessRepo.Create(ctx, run); err != nil {
+		return nil, err
+	}
+
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = defaultHeadlessTimeout
+	}
+	sm.mu.RLock()
+	parent := sm.ctx
+	sm.mu.RUnlock()
+	runCtx, cancel := context.WithTimeout(parent, timeout)
+
+	cmd := exec.CommandContext(runCtx, argv[0], argv[1:]...)
+	cmd.Dir = workDir
+	cmd.Env = sessionEnv(agent, project, task)
+	cmd.Stdin = strings.NewReader(req.Prompt)
+	// Kill the whole process group so that tools the agent started do not
+	// outlive a cancelled run.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = headlessKillDelay
+	stdout, stderr, err := startWithPipes(cmd)
+	if err != nil {
+		cancel()
+		run.Status = HeadlessFailed
+		run.Error = fmt.Sprintf("start agent: %v", err)
+		if finishErr := sm.headlessRepo.Finish(ctx, run); finishErr != nil {
+			slog.Warn("failed to record headless run failure", "run_id", run.ID, "error", finishErr)
+		}
+		return nil, fmt.Errorf("start headless run: %w", err)
+	}
+	handle := &headlessHandle{agentType: agent.ID, cancel: cancel}
+	sm.headlessMu.Lock()
+	sm.headless[run.ID] = handle
+	sm.headlessMu.Unlock()
+	sm.headlessWG.Add(1)
+	go sm.runHeadless(runCtx, cmd, handle, *run, stdout, stderr)
+
+	slog.Info("headless run started", "run_id", run.ID, "task_id", task.ID, "agent", agent.ID)
+	sm.broadcastHeadlessRun(run)
+	return run, nil
+}
+
+// startWithPipes starts cmd with its output going to pipes that Wait
+// copies into, so that Wait, not the readers, decides when the output ends.
+// runHeadless closes them once Wait returns.
+func startWithPipes(cmd *exec.Cmd) (stdout, stderr io.Reader, err error) {
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	cmd.Stdout, cmd.Stderr = outW, errW
+	if err = cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return outR, errR, nil
+}
+
+// headlessArgv returns the command line of an agent's headless command,
+// inside its sandbox when one is configured.
+func headlessArgv(agent *registry.AgentConfig, workDir string) ([]string, error) {
+	argv := []string{"sh", "-c", agent.HeadlessCommand}
+	if !agent.Sandbox.Enabled() {
+		return argv, nil
+	}
+	policy, err := agent.Sandbox.Policy(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox for agent %q: %w", agent.ID, err)
+	}
+	return sandbox.Command(argv, policy)
+}
+
+// headlessSlotFree reports an error when agent has no free slot or others
+// are waiting for one. The caller holds createMu.
+func (sm *Manager) headlessSlotFree(ctx context.Context, agent *registry.AgentConfig) error {
+	waiting, err := sm.waitlistRepo.List(ctx, agent.ID)
+	if err != nil {
+		return err
+	}
+	capacity, err := sm.schedulerCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	busy, limit := capacity.byAgent[agent.ID], agentCapacity(agent)
+	if busy >= limit || len(waiting) > 0 {
+		return fmt.Errorf("agent %q at capacity (%d/%d, %d waiting)", agent.ID, busy, limit, len(waiting))
+	}
+	return nil
+}
+
+// runHeadless streams a started run's output until it exits and records
+// the outcome.
+func (sm *Manager) runHeadless(ctx context.Context, cmd *exec.Cmd, handle *headlessHandle, run db.HeadlessRun, stdout, stderr io.Reader) {
+	defer sm.headlessWG.Done()
+	defer handle.cancel()
+
+	var out, errOut cappedOutput
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go sm.streamHeadless(&readers, &run, "stdout", stdout, &out)
+	go sm.streamHeadless(&readers, &run, "stderr", stderr, &errOut)
+	waited := make(chan error, 1)
+	go func() {
+		// Wait returns once the agent exited and its output was copied, or
+		// WaitDelay later when orphaned children hold the output open.
+		err := cmd.Wait()
+		cmd.Stdout.(io.Closer).Close()
+		cmd.Stderr.(io.Closer).Close()
+		waited <- err
+	}()
+	waitErr := <-waited
+	readers.Wait()
+	if errors.Is(waitErr, exec.ErrWaitDelay) {
+		waitErr = nil
+	}
+
+	sm.headlessMu.Lock()
+	cancelled := handle.cancelled
+	delete(sm.headless, run.ID)
+	sm.headlessMu.Unlock()
+
+	run.Stdout, run.Stderr = out.String(), errOut.String()
+	if state := cmd.ProcessState; state != nil && state.ExitCode() >= 0 {
+		code := state.ExitCode()
+		run.ExitCode = &code
+	}
+	switch {
+	case cancelled:
+		run.Status = HeadlessCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Status = HeadlessTimeout
+		run.Error = "timed out"
+	case ctx.Err() != nil:
+		run.Status = HeadlessFailed
+		run.Error = "interrupted by server shutdown"
+	case waitErr != nil:
+		run.Status = HeadlessFailed
+		run.Error = waitErr.Error()
+	default:
+		run.Status = HeadlessCompleted
+	}
+	if err := sm.headlessRepo.Finish(context.Background(), &run); err != nil {
+		slog.Warn("failed to record headless run", "run_id", run.ID, "error", err)
+	}
+	slog.Info("headless run finished", "run_id", run.ID, "status", run.Status)
+	sm.broadcastHeadlessRun(&run)
+	sm.wakeScheduler()
+}
+
+// streamHeadless copies one output stream of a run into buf, broadcasting
+// it line by line.
+func (sm *Manager) streamHeadless(wg *sync.WaitGroup, run *db.HeadlessRun, stream string, r io.Reader, buf *cappedOutput) {
+	defer wg.Done()
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			buf.Write(line)
+			if sm.hub != nil {
+				sm.hub.BroadcastHeadlessOutput(hub.HeadlessOutputMessage{
+					RunID:  run.ID,
+					TaskID: run.TaskID,
+					Stream: stream,
+					Text:   strings.TrimRight(line, "\r\n"),
+				})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sm *Manager) broadcastHeadlessRun(run *db.HeadlessRun) {
+	if sm.hub == nil {
+		return
+	}
+	sm.hub.BroadcastHeadlessRun(hub.HeadlessRunMessage{
+		RunID:     run.ID,
+		TaskID:    run.TaskID,
+		AgentType: run.AgentType,
+		Status:    run.Status,
+		ExitCode:  run.ExitCode,
+		Error:     run.Error,
+	})
+}
+
+// GetHeadlessRun returns a headless run.
+func (sm *Manager) GetHeadlessRun(ctx context.Context, id string) (*db.HeadlessRun, error) {
+	run, err := sm.headlessRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, errNotFound("headless run")
+	}
+	return run, nil
+}
+
+// ListHeadlessRuns returns a task's headless runs, newest first.
+func (sm *Manager) ListHeadlessRuns(ctx context.Context, taskID string) ([]*db.HeadlessRun, error) {
+	task, err := sm.taskRepo.Get(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, errNotFound("task")
+	}
+	return sm.headlessRepo.ListByTask(ctx, taskID)
+}
+
+// CancelHeadlessRun kills a running headless run. The run is recorded as
+// cancelled once its process has exited.
+func (sm *Manager) CancelHeadlessRun(ctx context.Context, id string) error {
+	run, err := sm.GetHeadlessRun(ctx, id)
+	if err != nil {
+		return err
+	}
+	sm.headlessMu.Lock()
+	handle := sm.headless[run.ID]
+	if handle != nil {
+		handle.cancelled = true
+	}
+	sm.headlessMu.Unlock()
+	if handle == nil {
+		return fmt.Errorf("headless run %s is not running", run.ID)
+	}
+	handle.cancel()
+	return nil
+}
+
+// failOrphanedHeadlessRuns marks runs left running by a previous server
+// process as failed; their processes died with it.
+func (sm *Manager) failOrphanedHeadlessRuns(ctx context.Context) {
+	runs, err := sm.headlessRepo.ListByStatus(ctx, HeadlessRunning)
+	if err != nil {
+		slog.Warn("failed to list orphaned headless runs", "error", err)
+		return
+	}
+	for _, run := range runs {
+		sm.headlessMu.Lock()
+		_, live := sm.headless[run.ID]
+		sm.headlessMu.Unlock()
+		if live {
+			continue
+		}
+		run.Status = HeadlessFailed
+		run.Error = "interrupted by server restart"
+		if err := sm.headlessRepo.Finish(ctx, run); err != nil {
+			slog.Warn("failed to fail orphaned headless run", "run_id", run.ID, "error", err)
+		}
+	}
+}
+
+// cappedOutput keeps the first maxHeadlessOutput bytes written to it.
+type cappedOutput struct {
+	b         strings.Builder
+	truncated bool
+}
+
+func (c *cappedOutput) Write(s string) {
+	if c.truncated {
+		return
+	}
+	if room := maxHeadlessOutput - c.b.Len(); len(s) > room {
+		s = s[:room]
+		c.truncated = true
+	}
+	c.b.WriteString(s)
+}
+
+func (c *cappedOutput) String() string {
+	if c.truncated {
+		return c.b.String() + "\n[output truncated]\n"
+	}
+	return c.b.String()
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestHeadlessRunCapturesOutputAndRespectsCapacity(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	for _, agent := range []*registry.AgentConfig{
+		{ID: "summarizer", Name: "S", Command: "s", SupportsHeadless: true, HeadlessCommand: `tr a-z A-Z; echo "$RUN_MODE" >&2; sleep "${HEADLESS_SLEEP:-0}"`, MaxParallelAgents: 1},
+		{ID: "tui-only", Name: "T", Command: "t"},
+		{ID: "forker", Name: "F", Command: "f", SupportsHeadless: true, HeadlessCommand: `echo started; (sleep 10 &)`},
+	} {
+		if err := reg.Save(agent); err != nil {
+			t.Fatalf("save agent: %v", err)
+		}
+	}
+	project := &db.Project{Name: "P1", RepoPath: t.TempDir(), Status: "active"}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	task := &db.Task{ProjectID: project.ID, Title: "T", Status: "pending", Env: environ.Map{"RUN_MODE": strPtr("headless"), "HEADLESS_SLEEP": strPtr("1")}}
+	if err := taskRepo.Create(ctx, task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	if _, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "tui-only", Prompt: "hi"}); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("StartHeadlessRun(tui-only) error=%v want unsupported", err)
+	}
+
+	run, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "summarizer", Prompt: "summarize this diff\n"})
+	if err != nil {
+		t.Fatalf("StartHeadlessRun: %v", err)
+	}
+	if run.Status != HeadlessRunning {
+		t.Fatalf("status=%q want running", run.Status)
+	}
+	if _, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "summarizer", Prompt: "again"}); err == nil || !strings.Contains(err.Error(), "at capacity (1/1") {
+		t.Fatalf("second StartHeadlessRun error=%v want at capacity", err)
+	}
+
+	waitRun := func(id string) *db.HeadlessRun {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got, err := lifecycle.GetHeadlessRun(ctx, id)
+			if err != nil {
+				t.Fatalf("GetHeadlessRun: %v", err)
+			}
+			if got.Status != HeadlessRunning {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("run %s still running", id)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	done := waitRun(run.ID)
+	if done.Status != HeadlessCompleted || done.ExitCode == nil || *done.ExitCode != 0 {
+		t.Fatalf("run=%+v want completed with exit 0", done)
+	}
+	if done.Stdout != "SUMMARIZE THIS DIFF\n" || done.Stderr != "headless\n" || done.FinishedAt.IsZero() {
+		t.Fatalf("stdout=%q stderr=%q finished=%v", done.Stdout, done.Stderr, done.FinishedAt)
+	}
+
+	slow, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "summarizer", Prompt: "x", Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("StartHeadlessRun: %v", err)
+	}
+	if got := waitRun(slow.ID); got.Status != HeadlessTimeout {
+		t.Fatalf("slow run=%+v want timeout", got)
+	}
+
+	cancelled, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "summarizer", Prompt: "x"})
+	if err != nil {
+		t.Fatalf("StartHeadlessRun: %v", err)
+	}
+	if err := lifecycle.CancelHeadlessRun(ctx, cancelled.ID); err != nil {
+		t.Fatalf("CancelHeadlessRun: %v", err)
+	}
+	if got := waitRun(cancelled.ID); got.Status != HeadlessCancelled {
+		t.Fatalf("cancelled run=%+v want cancelled", got)
+	}
+	if err := lifecycle.CancelHeadlessRun(ctx, cancelled.ID); err == nil || !strings.Contains(err.Error(), "is not running") {
+		t.Fatalf("cancel finished run error=%v want not running", err)
+	}
+
+	// An orphaned child holding the output open does not keep the run
+	// going past the kill delay.
+	forked, err := lifecycle.StartHeadlessRun(ctx, task.ID, HeadlessRunRequest{AgentType: "forker", Prompt: "x"})
+	if err != nil {
+		t.Fatalf("StartHeadlessRun: %v", err)
+	}
+	deadline := time.Now().Add(headlessKillDelay + 5*time.Second)
+	for {
+		got, err := lifecycle.GetHeadlessRun(ctx, forked.ID)
+		if err != nil {
+			t.Fatalf("GetHeadlessRun: %v", err)
+		}
+		if got.Status != HeadlessRunning {
+			if got.Status != HeadlessCompleted || got.Stdout != "started\n" {
+				t.Fatalf("forked run=%+v want completed with its output", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run with an orphaned child still running")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	runs, err := lifecycle.ListHeadlessRuns(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("ListHeadlessRuns: %v", err)
+	}
+	if len(runs) != 4 {
+		t.Fatalf("runs=%d want 4", len(runs))
+	}
+}
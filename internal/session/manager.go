@@ -7,14 +7,22 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/user/agenterm/internal/completion"
 	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/environ"
 	"github.com/user/agenterm/internal/hub"
+	"github.com/user/agenterm/internal/parser"
+	"github.com/user/agenterm/internal/policy"
 	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/vt"
 )
 
 const (
@@ -33,6 +41,9 @@ type CreateSessionRequest struct {
 	TaskID    string
 	AgentType string
 	Role      string
+	// Priority orders the request on the agent's waitlist when the agent
+	// is at capacity; higher starts first.
+	Priority int
 }
 
 type CommandOp string
@@ -43,6 +54,8 @@ const (
 	CommandOpInterrupt CommandOp = "interrupt"
 	CommandOpResize    CommandOp = "resize"
 	CommandOpClose     CommandOp = "close"
+	// CommandOpScript runs Steps in order as one queued command.
+	CommandOpScript CommandOp = "script"
 )
 
 type CommandRequest struct {
@@ -51,6 +64,17 @@ type CommandRequest struct {
 	Key  string
 	Cols int
 	Rows int
+
+	// WaitFor holds the command as pending until the session reaches the
+	// state, for at most Timeout (defaultCommandWaitTimeout when zero).
+	WaitFor CommandWait
+	Timeout time.Duration
+	// NotBefore holds the command as pending until the time passes; Timeout
+	// counts from then.
+	NotBefore time.Time
+
+	// Steps are the steps of a script command.
+	Steps []ScriptStep
 }
 
 type OutputEntry struct {
@@ -60,14 +84,22 @@ type OutputEntry struct {
 }
 
 type Manager struct {
-	backend      TerminalBackend
-	registry     *registry.Registry
-	hub          *hub.Hub
-	sessionRepo  *db.SessionRepo
-	commandRepo  *db.SessionCommandRepo
-	taskRepo     *db.TaskRepo
-	projectRepo  *db.ProjectRepo
-	worktreeRepo *db.WorktreeRepo
+	backend        TerminalBackend
+	registry       *registry.Registry
+	hub            *hub.Hub
+	sessionRepo    *db.SessionRepo
+	commandRepo    *db.SessionCommandRepo
+	taskRepo       *db.TaskRepo
+	projectRepo    *db.ProjectRepo
+	worktreeRepo   *db.WorktreeRepo
+	waitlistRepo   *db.WaitlistRepo
+	reviewRepo     *db.ReviewRepo
+	eventRepo      *db.SessionEventRepo
+	headlessRepo   *db.HeadlessRunRepo
+	transcriptRepo *db.TranscriptRepo
+	usageRepo      *db.UsageRepo
+	budgetRepo     *db.BudgetRepo
+	policyEvents   *db.PolicyEventRepo
 
 	idleTimeout   time.Duration
 	pollInterval  time.Duration
@@ -78,9 +110,68 @@ type Manager struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	monitors map[string]monitorHandle
+	// closed is set by Close; a closed Manager does not start again.
+	closed bool
+	// background tracks the goroutines started by goBackground.
+	background sync.WaitGroup
 
 	commandMu sync.Mutex
 	commandQ  map[string]chan queuedCommand
+	parked    map[string]context.CancelFunc
+
+	limitMu    sync.Mutex
+	limits     map[string]*limitHandle
+	oomKilled  map[string]bool
+	cgroupRoot string
+	sampler    *resources.Sampler
+	// statusSampler serves API reads, so that they do not move the CPU
+	// baseline of the limit watchers' sampler.
+	statusSampler *resources.Sampler
+
+	// createMu serializes capacity checks with the session starts they
+	// allow.
+	createMu sync.Mutex
+
+	schedMu        sync.Mutex
+	schedWake      chan struct{}
+	maxParallel    int
+	launchFailures map[string]launchFailure
+
+	// watchdogFired holds when each watchdog rule, by index, last fired
+	// for a session.
+	watchdogMu    sync.Mutex
+	watchdogFired map[string]map[int]time.Time
+
+	playbookMu   sync.Mutex
+	playbooksDir string
+
+	policyMu sync.Mutex
+	policies *policy.Store
+
+	// takeoverMu serializes changes to takeover leases; terminalBeats
+	// holds when terminal input last renewed a session's lease.
+	takeoverMu    sync.Mutex
+	terminalBeats map[string]time.Time
+
+	headlessMu sync.Mutex
+	headless   map[string]*headlessHandle
+	headlessWG sync.WaitGroup
+
+	transcriptQ       chan *db.TranscriptEntry
+	transcriptDropped atomic.Int64
+	transcriptWG      sync.WaitGroup
+	// transcriptOnce starts the transcript writer once per Manager, so
+	// that Close never waits on a writer its context does not cancel.
+	transcriptOnce sync.Once
+
+	usageMu sync.Mutex
+	meters  map[string]*usageMeter
+
+	responderMu sync.Mutex
+	responded   map[string]autoResponse
+
+	agentSessionMu      sync.Mutex
+	agentSessionWatches map[string]*agentSessionWatch
 }
 
 type monitorHandle struct {
@@ -113,12 +204,35 @@ func NewManager(conn *sql.DB, backend TerminalBackend, reg *registry.Registry, h
 		taskRepo:      db.NewTaskRepo(conn),
 		projectRepo:   db.NewProjectRepo(conn),
 		worktreeRepo:  db.NewWorktreeRepo(conn),
+		waitlistRepo:  db.NewWaitlistRepo(conn),
+		reviewRepo:    db.NewReviewRepo(conn),
+		eventRepo:     db.NewSessionEventRepo(conn),
+		headlessRepo:  db.NewHeadlessRunRepo(conn),
 		idleTimeout:   defaultIdleTimeout,
 		pollInterval:  defaultPollInterval,
 		ringBufferLen: defaultRingBufferLen,
 		captureLines:  defaultCaptureLines,
 		monitors:      make(map[string]monitorHandle),
 		commandQ:      make(map[string]chan queuedCommand),
+		parked:        make(map[string]context.CancelFunc),
+		limits:        make(map[string]*limitHandle),
+		oomKilled:     make(map[string]bool),
+		sampler:       resources.NewSampler(),
+		statusSampler: resources.NewSampler(),
+		schedWake:      make(chan struct{}, 1),
+		launchFailures: make(map[string]launchFailure),
+		watchdogFired:  make(map[string]map[int]time.Time),
+		headless:       make(map[string]*headlessHandle),
+		transcriptRepo: db.NewTranscriptRepo(conn),
+		transcriptQ:    make(chan *db.TranscriptEntry, transcriptQueueLen),
+		usageRepo:      db.NewUsageRepo(conn),
+		budgetRepo:     db.NewBudgetRepo(conn),
+		policyEvents:   db.NewPolicyEventRepo(conn),
+		meters:         make(map[string]*usageMeter),
+		responded:      make(map[string]autoResponse),
+
+		agentSessionWatches: make(map[string]*agentSessionWatch),
+		terminalBeats:       make(map[string]time.Time),
 	}
 }
 
@@ -128,6 +242,10 @@ func (sm *Manager) Start(ctx context.Context) error {
 	}
 
 	sm.mu.Lock()
+	if sm.closed {
+		sm.mu.Unlock()
+		return fmt.Errorf("session manager is closed")
+	}
 	if sm.cancel != nil {
 		sm.mu.Unlock()
 		return nil
@@ -143,11 +261,27 @@ func (sm *Manager) Start(ctx context.Context) error {
 		return err
 	}
 	for _, sess := range active {
-		// If the PTY process is still alive, just monitor it.
+		// If the PTY process is still alive (e.g. owned by the ptyd
+		// supervisor across a server restart), reattach and monitor it.
 		if sm.backend.SessionExists(context.Background(), sess.ID) {
+			if sess.Status == "suspended" {
+				// Pick up where the session left off: a session a human had
+				// taken over must not go back to automation.
+				sess.Status = sess.SuspendedStatus
+				if sess.Status == "" {
+					sess.Status = "working"
+				}
+				sess.SuspendedStatus = ""
+				if err := sm.sessionRepo.Update(context.Background(), sess); err != nil {
+					slog.Warn("failed to restore reattached session status", "session_id", sess.ID, "error", err)
+				} else if sm.hub != nil {
+					sm.hub.BroadcastSessionStatus(sess.ID, sess.Status)
+				}
+			}
 			if err := sm.ensureMonitorForSession(context.Background(), sess); err != nil {
 				slog.Warn("failed to start monitor for active session", "session_id", sess.ID, "error", err)
 			}
+			sm.applyLimits(context.Background(), sess)
 			continue
 		}
 
@@ -159,8 +293,22 @@ func (sm *Manager) Start(ctx context.Context) error {
 			if sm.hub != nil {
 				sm.hub.BroadcastSessionStatus(sess.ID, sess.Status)
 			}
+			if sess.Exit == nil {
+				sm.recordExit(context.Background(), sess, &db.SessionExit{Reason: ExitReasonUnknown, At: time.Now().UTC()})
+			}
 		}
 	}
+	sm.restorePendingCommands(sm.ctx)
+	sm.failOrphanedHeadlessRuns(context.Background())
+	go sm.runScheduler(sm.ctx)
+	go sm.runWatchdog(sm.ctx)
+	sm.transcriptOnce.Do(func() {
+		sm.transcriptWG.Add(1)
+		go sm.runTranscriptWriter(sm.ctx)
+	})
+	go sm.runUsagePoller(sm.ctx)
+	go sm.runAgentSessionScanner(sm.ctx)
+	go sm.runTakeoverSweeper(sm.ctx)
 	return nil
 }
 
@@ -180,11 +328,12 @@ func (sm *Manager) ResumeSession(ctx context.Context, sess *db.Session) error {
 	}
 
 	workDir := sm.resolveWorkDirForSession(ctx, sess)
-	resumeCmd := strings.TrimSpace(agent.ResumeCommand)
+	resumeCmd := resumeCommand(agent, sess.AgentSessionID)
+	env := sm.sessionEnvForSession(ctx, agent, sess)
 
 	slog.Info("resuming session", "session_id", sess.ID, "agent", sess.AgentType, "command", resumeCmd)
 
-	terminalID, err := sm.backend.CreateSession(ctx, sess.ID, agent.Name, resumeCmd, workDir)
+	terminalID, err := sm.spawn(ctx, agent, sess.ID, agent.Name, resumeCmd, workDir, env, sm.effectiveLimits(ctx, sess))
 	if err != nil {
 		return fmt.Errorf("spawn resume PTY: %w", err)
 	}
@@ -192,10 +341,17 @@ func (sm *Manager) ResumeSession(ctx context.Context, sess *db.Session) error {
 	sess.TmuxSessionName = terminalID
 	sess.TmuxWindowID = terminalID
 	sess.Status = "working"
+	sess.SuspendedStatus = ""
 	if err := sm.sessionRepo.Update(ctx, sess); err != nil {
 		_ = sm.backend.DestroySession(ctx, terminalID)
 		return err
 	}
+	if sess.Exit != nil {
+		if err := sm.sessionRepo.SetExit(ctx, sess.ID, nil); err != nil {
+			slog.Warn("failed to clear exit of resumed session", "session_id", sess.ID, "error", err)
+		}
+		sess.Exit = nil
+	}
 
 	// Handle auto-accept sequence if configured.
 	if seq, ok := autoAcceptSequence(agent.AutoAcceptMode); ok {
@@ -210,6 +366,7 @@ func (sm *Manager) ResumeSession(ctx context.Context, sess *db.Session) error {
 	if err := sm.ensureMonitorForSession(ctx, sess); err != nil {
 		slog.Warn("failed to start monitor for resumed session", "session_id", sess.ID, "error", err)
 	}
+	sm.applyLimits(ctx, sess)
 	if sm.hub != nil {
 		sm.hub.BroadcastSessionStatus(sess.ID, sess.Status)
 	}
@@ -229,6 +386,7 @@ func (sm *Manager) Close() {
 		for _, sess := range active {
 			switch strings.ToLower(strings.TrimSpace(sess.Status)) {
 			case "working", "idle", "waiting_review", "human_takeover":
+				sess.SuspendedStatus = sess.Status
 				sess.Status = "suspended"
 				_ = sm.sessionRepo.Update(context.Background(), sess)
 				slog.Info("session suspended for future resume", "session_id", sess.ID, "agent", sess.AgentType)
@@ -245,6 +403,7 @@ func (sm *Manager) Close() {
 		sm.cancel()
 		sm.cancel = nil
 	}
+	sm.closed = true
 	sm.monitors = make(map[string]monitorHandle)
 	commandQueues := sm.commandQ
 	sm.commandQ = make(map[string]chan queuedCommand)
@@ -257,9 +416,41 @@ func (sm *Manager) Close() {
 	for _, q := range commandQueues {
 		close(q)
 	}
+	sm.background.Wait()
+	// Cancelling the context killed the headless runs; wait for them to be
+	// recorded.
+	sm.headlessWG.Wait()
+	sm.transcriptWG.Wait()
+
+	// Stop limit watchers but keep cgroups: with ptyd or tmux the agents
+	// outlive this process and are re-limited on the next Start.
+	sm.limitMu.Lock()
+	for id, handle := range sm.limits {
+		handle.cancel()
+		delete(sm.limits, id)
+	}
+	sm.limitMu.Unlock()
 }
 
+// CreateSession starts an agent session for a task. When the agent has no
+// free slot, or others are already waiting for one, the request is put on
+// the agent's waitlist and a *WaitlistedError is returned instead.
 func (sm *Manager) CreateSession(ctx context.Context, req CreateSessionRequest) (*db.Session, error) {
+	return sm.createSession(ctx, req, createOptions{})
+}
+
+// createOptions adjusts createSession for internal callers.
+type createOptions struct {
+	// unclaimed fails with errTaskClaimed instead when the task already has
+	// a session or is waitlisted.
+	unclaimed bool
+	// replacing is a session that is closed once the new one started; its
+	// slot counts as free.
+	replacing *db.Session
+}
+
+// createSession is CreateSession with opts.
+func (sm *Manager) createSession(ctx context.Context, req CreateSessionRequest, opts createOptions) (*db.Session, error) {
 	if err := sm.ensureStarted(); err != nil {
 		return nil, err
 	}
@@ -285,7 +476,49 @@ func (sm *Manager) CreateSession(ctx context.Context, req CreateSessionRequest)
 	if task == nil {
 		return nil, errNotFound("task")
 	}
+	if err := sm.budgetBlocks(ctx, task); err != nil {
+		return nil, err
+	}
 
+	sm.createMu.Lock()
+	defer sm.createMu.Unlock()
+	if opts.unclaimed {
+		// The scheduler planned the launch without the lock; an explicit
+		// request may have started or queued the task since.
+		if err := sm.ensureTaskUnclaimed(ctx, task.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := sm.reserveSlot(ctx, req, agent, opts.replacing); err != nil {
+		return nil, err
+	}
+	return sm.startSession(ctx, req, agent, task)
+}
+
+// ensureTaskUnclaimed returns errTaskClaimed when a task has a session or a
+// waitlist entry. The caller holds createMu.
+func (sm *Manager) ensureTaskUnclaimed(ctx context.Context, taskID string) error {
+	sessions, err := sm.sessionRepo.ListByTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if len(sessions) > 0 {
+		return errTaskClaimed
+	}
+	waiting, err := sm.waitlistRepo.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, entry := range waiting {
+		if entry.TaskID == taskID {
+			return errTaskClaimed
+		}
+	}
+	return nil
+}
+
+// startSession spawns the agent for a task and records the session.
+func (sm *Manager) startSession(ctx context.Context, req CreateSessionRequest, agent *registry.AgentConfig, task *db.Task) (*db.Session, error) {
 	project, err := sm.projectRepo.Get(ctx, task.ProjectID)
 	if err != nil {
 		return nil, err
@@ -308,9 +541,16 @@ func (sm *Manager) CreateSession(ctx context.Context, req CreateSessionRequest)
 	if agentName == "" {
 		agentName = req.AgentType
 	}
-	agentCommand := agent.Command
+	agentCommand, agentSessionID, err := agentStartCommand(agent)
+	if err != nil {
+		return nil, err
+	}
+	env := sessionEnv(agent, project, task)
+	if err := sm.checkCompletionDetectors(ctx, &db.Session{TaskID: task.ID, AgentType: req.AgentType, Role: req.Role}); err != nil {
+		return nil, err
+	}
 
-	terminalID, err := sm.backend.CreateSession(ctx, sessionID, agentName, agentCommand, workDir)
+	terminalID, err := sm.spawn(ctx, agent, sessionID, agentName, agentCommand, workDir, env, agent.Limits.Merge(project.ResourceLimits))
 	if err != nil {
 		return nil, err
 	}
@@ -323,6 +563,7 @@ func (sm *Manager) CreateSession(ctx context.Context, req CreateSessionRequest)
 		Role:            req.Role,
 		Status:          "working",
 		HumanAttached:   false,
+		AgentSessionID:  agentSessionID,
 	}
 	session.ID = sessionID
 	if err := sm.sessionRepo.Create(ctx, session); err != nil {
@@ -344,6 +585,7 @@ func (sm *Manager) CreateSession(ctx context.Context, req CreateSessionRequest)
 	if err := sm.ensureMonitorForSession(ctx, session); err != nil {
 		slog.Warn("failed to start session monitor", "session_id", session.ID, "error", err)
 	}
+	sm.applyLimits(ctx, session)
 	if sm.hub != nil {
 		sm.hub.BroadcastSessionStatus(session.ID, session.Status)
 	}
@@ -379,6 +621,26 @@ func (sm *Manager) EnqueueCommand(ctx context.Context, sessionID string, req Com
 	if req.Op == "" {
 		return nil, fmt.Errorf("op is required")
 	}
+	if err := validateCommandWait(req); err != nil {
+		return nil, err
+	}
+	if req.Op == CommandOpScript {
+		if err := validateScript(req.Steps); err != nil {
+			return nil, err
+		}
+	}
+	deferred := req.deferred()
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess != nil && req.Op != CommandOpInterrupt && sess.Status == "paused" {
+		return nil, fmt.Errorf("session %s is paused by a budget", sessionID)
+	}
+	// Deferred commands wait for the takeover to end instead.
+	if sess != nil && !deferred && sess.Takeover.Active(time.Now().UTC()) {
+		return nil, takeoverError(sessionID, sess.Takeover)
+	}
 	payload, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("marshal command payload: %w", err)
@@ -389,15 +651,33 @@ func (sm *Manager) EnqueueCommand(ctx context.Context, sessionID string, req Com
 		PayloadJSON: string(payload),
 		Status:      "queued",
 	}
+	if deferred {
+		cmd.Status = "pending"
+	}
 	if err := sm.commandRepo.Create(ctx, cmd); err != nil {
 		return nil, err
 	}
+	// The queue owns cmd from here on.
+	snapshot := *cmd
 
 	item := queuedCommand{
 		cmd:  cmd,
 		req:  req,
 		done: make(chan commandResult, 1),
 	}
+	// Deferred commands wait outside the session queue so that they do not
+	// hold back the commands sent after them.
+	if deferred {
+		sm.parkCommand(item)
+		return &snapshot, nil
+	}
+	// Interrupts skip the queue: they are how a busy session is stopped.
+	if req.Op == CommandOpInterrupt {
+		if err := sm.dispatchCommandWithRetry(sessionID, cmd, req); err != nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
 	queue := sm.ensureSessionCommandQueue(sessionID)
 	if err := sendQueuedCommand(ctx, queue, item); err != nil {
 		cmd.Status = "failed"
@@ -406,6 +686,10 @@ func (sm *Manager) EnqueueCommand(ctx context.Context, sessionID string, req Com
 		_ = sm.commandRepo.Update(context.Background(), cmd)
 		return nil, err
 	}
+	// Scripts can run for minutes; callers follow them by command ID.
+	if req.Op == CommandOpScript {
+		return &snapshot, nil
+	}
 
 	select {
 	case <-ctx.Done():
@@ -441,7 +725,12 @@ func (sm *Manager) ensureSessionCommandQueue(sessionID string) chan queuedComman
 func (sm *Manager) runSessionCommandQueue(sessionID string, q chan queuedCommand) {
 	for item := range q {
 		cmd := item.cmd
-		err := sm.dispatchCommandWithRetry(sessionID, cmd, item.req)
+		var err error
+		if item.req.Op == CommandOpScript {
+			err = sm.runScriptCommand(sessionID, cmd, item.req)
+		} else {
+			err = sm.dispatchCommandWithRetry(sessionID, cmd, item.req)
+		}
 		if err == nil {
 			item.done <- commandResult{cmd: cmd, err: nil}
 			close(item.done)
@@ -534,6 +823,9 @@ func (sm *Manager) dispatchCommand(ctx context.Context, sessionID string, req Co
 	if terminalID == "" {
 		return fmt.Errorf("session has no terminal")
 	}
+	if session.Takeover.Active(time.Now().UTC()) {
+		return takeoverError(sessionID, session.Takeover)
+	}
 
 	switch req.Op {
 	case CommandOpSendText:
@@ -541,10 +833,7 @@ func (sm *Manager) dispatchCommand(ctx context.Context, sessionID string, req Co
 			return fmt.Errorf("text is required")
 		}
 		workDir := sm.resolveWorkDirForSession(ctx, session)
-		if err := enforceCommandPolicy(req.Text, workDir); err != nil {
-			if policyErr, ok := err.(*CommandPolicyError); ok {
-				auditCommandPolicyViolation(workDir, sessionID, req.Text, policyErr)
-			}
+		if err := sm.checkSessionCommand(ctx, session, workDir, req.Text); err != nil {
 			return err
 		}
 		normalized := normalizeSessionCommandText(req.Text)
@@ -552,15 +841,12 @@ func (sm *Manager) dispatchCommand(ctx context.Context, sessionID string, req Co
 		if submit {
 			normalized = strings.TrimSuffix(normalized, "\r")
 		}
-		if normalized != "" {
-			if err := sm.backend.SendInput(ctx, terminalID, normalized); err != nil {
-				return err
-			}
+		var paste registry.PasteConfig
+		if agent := sm.registry.Get(session.AgentType); agent != nil {
+			paste = agent.Paste
 		}
-		if submit {
-			if err := sm.backend.SendInput(ctx, terminalID, "\r"); err != nil {
-				return err
-			}
+		if err := sm.deliverText(ctx, terminalID, workDir, normalized, submit, paste); err != nil {
+			return err
 		}
 	case CommandOpSendKey:
 		key := ValidateControlKey(req.Key)
@@ -587,6 +873,10 @@ func (sm *Manager) dispatchCommand(ctx context.Context, sessionID string, req Co
 		return fmt.Errorf("unsupported op %q", req.Op)
 	}
 
+	// The interrupt that pauses a session must not mark it working again.
+	if session.Status == "paused" {
+		return nil
+	}
 	session.Status = "working"
 	if err := sm.sessionRepo.Update(ctx, session); err != nil {
 		return err
@@ -649,6 +939,62 @@ func (sm *Manager) GetOutput(ctx context.Context, sessionID string, since time.T
 	return handle.monitor.OutputSince(since), nil
 }
 
+// RecordingPath returns the asciicast recording file for a session. It
+// reports "recording not found" when the backend does not record or no
+// output has been captured yet.
+func (sm *Manager) RecordingPath(ctx context.Context, sessionID string) (string, error) {
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		return "", errNotFound("session")
+	}
+	recorder, ok := sm.backend.(RecordingBackend)
+	if !ok {
+		return "", errNotFound("recording")
+	}
+	terminalID := session.TmuxWindowID
+	if terminalID == "" {
+		terminalID = session.ID
+	}
+	path := recorder.RecordingPath(terminalID)
+	if path == "" {
+		return "", errNotFound("recording")
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", errNotFound("recording")
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// GetScreen returns the rendered terminal screen of a session as a human
+// attached to it would see it.
+func (sm *Manager) GetScreen(ctx context.Context, sessionID string) (vt.Snapshot, error) {
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return vt.Snapshot{}, err
+	}
+	if session == nil {
+		return vt.Snapshot{}, errNotFound("session")
+	}
+	screens, ok := sm.backend.(ScreenBackend)
+	if !ok {
+		return vt.Snapshot{}, errNotFound("screen")
+	}
+	terminalID := session.TmuxWindowID
+	if terminalID == "" {
+		terminalID = session.ID
+	}
+	if !sm.backend.SessionExists(ctx, terminalID) {
+		return vt.Snapshot{}, errNotFound("screen")
+	}
+	return screens.Screen(ctx, terminalID)
+}
+
 func (sm *Manager) GetIdleState(ctx context.Context, sessionID string) (IdleStateResult, error) {
 	session, err := sm.sessionRepo.Get(ctx, sessionID)
 	if err != nil {
@@ -783,31 +1129,13 @@ func isClaudeLandingState(lastText string) bool {
 	return strings.Contains(text, "/ide forcursor") || strings.Contains(text, "try\"")
 }
 
-func (sm *Manager) SetTakeover(ctx context.Context, sessionID string, takeover bool) error {
-	session, err := sm.sessionRepo.Get(ctx, sessionID)
-	if err != nil {
-		return err
-	}
-	if session == nil {
-		return errNotFound("session")
-	}
-
-	session.HumanAttached = takeover
-	if takeover {
-		session.Status = "human_takeover"
-	} else {
-		session.Status = "idle"
-	}
-	if err := sm.sessionRepo.Update(ctx, session); err != nil {
-		return err
-	}
-	if sm.hub != nil {
-		sm.hub.BroadcastSessionStatus(sessionID, session.Status)
-	}
-	return nil
+func (sm *Manager) DestroySession(ctx context.Context, sessionID string) error {
+	return sm.destroySession(ctx, sessionID, "completed", ExitReasonKilled)
 }
 
-func (sm *Manager) DestroySession(ctx context.Context, sessionID string) error {
+// destroySession kills the session's terminal and records status as its
+// final state and reason as why it exited.
+func (sm *Manager) destroySession(ctx context.Context, sessionID string, status string, reason string) error {
 	session, err := sm.sessionRepo.Get(ctx, sessionID)
 	if err != nil {
 		return err
@@ -818,17 +1146,27 @@ func (sm *Manager) DestroySession(ctx context.Context, sessionID string) error {
 
 	sm.stopMonitor(sessionID)
 	sm.stopSessionCommandQueue(sessionID)
-	if err := sm.backend.DestroySession(ctx, session.TmuxWindowID); err != nil {
-		return err
+	// The terminal may already be gone, e.g. after the agent exited.
+	if sm.backend.SessionExists(ctx, session.TmuxWindowID) {
+		if err := sm.backend.DestroySession(ctx, session.TmuxWindowID); err != nil {
+			return err
+		}
 	}
+	sm.releaseLimits(sessionID)
+	sm.limitMu.Lock()
+	delete(sm.oomKilled, sessionID)
+	sm.limitMu.Unlock()
 
-	session.Status = "completed"
+	session.Status = status
 	if err := sm.sessionRepo.Update(ctx, session); err != nil {
 		return err
 	}
 	if sm.hub != nil {
 		sm.hub.BroadcastSessionStatus(sessionID, session.Status)
 	}
+	if session.Exit == nil {
+		sm.recordExit(ctx, session, &db.SessionExit{Reason: reason, At: time.Now().UTC()})
+	}
 	return nil
 }
 
@@ -884,9 +1222,34 @@ func (sm *Manager) ObserveParsedOutput(sessionID string, windowID string, text s
 			continue
 		}
 		handle.monitor.IngestParsed(text, class, timestamp)
+		sm.recordTranscript(handle.monitor.sessionID, text, class, timestamp)
+		sm.meterOutput(handle.monitor.sessionID, text)
+		sm.captureAgentSessionID(handle.monitor.sessionID, text)
+		if class == string(parser.ClassPrompt) {
+			sm.autoRespond(handle.monitor.sessionID, text, timestamp)
+		}
 	}
 }
 
+// goBackground runs fn in a goroutine that Close cancels, through ctx, and
+// waits for. Once the Manager is closed fn is not run.
+func (sm *Manager) goBackground(fn func(ctx context.Context)) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.closed {
+		return
+	}
+	ctx := sm.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sm.background.Add(1)
+	go func() {
+		defer sm.background.Done()
+		fn(ctx)
+	}()
+}
+
 func (sm *Manager) ensureStarted() error {
 	if sm == nil {
 		return fmt.Errorf("session manager unavailable")
@@ -935,6 +1298,64 @@ func (sm *Manager) resolveWorkDirForSession(ctx context.Context, session *db.Ses
 	return workDir
 }
 
+// spawn starts a terminal for agent, inside its sandbox when one is
+// configured. A sandboxed agent is never started unconfined.
+func (sm *Manager) spawn(ctx context.Context, agent *registry.AgentConfig, id, name, command, workDir string, env []string, limits resources.Limits) (string, error) {
+	cgroup := sm.prepareCgroup(id, limits)
+	if !agent.Sandbox.Enabled() {
+		if cgroup != "" {
+			command = resources.JoinCommand(cgroup, command)
+		}
+		return sm.backend.CreateSession(ctx, id, name, command, workDir, env)
+	}
+	sandboxed, ok := sm.backend.(SandboxBackend)
+	if !ok {
+		return "", fmt.Errorf("agent %q requires a sandbox, which is unsupported by the terminal backend", agent.ID)
+	}
+	policy, err := agent.Sandbox.Policy(workDir)
+	if err != nil {
+		return "", fmt.Errorf("sandbox for agent %q: %w", agent.ID, err)
+	}
+	policy.Cgroup = cgroup
+	slog.Info("spawning sandboxed session", "session_id", id, "agent", agent.ID, "mode", policy.Mode, "writable", policy.Writable)
+	return sandboxed.CreateSandboxedSession(ctx, id, name, command, workDir, env, policy)
+}
+
+// sessionEnv layers the agent, project and task env over the server's
+// environment. It returns nil, inheriting the environment unchanged, when no
+// layer sets anything.
+func sessionEnv(agent *registry.AgentConfig, project *db.Project, task *db.Task) []string {
+	var layers []environ.Map
+	if agent != nil && len(agent.Env) > 0 {
+		layers = append(layers, agent.Env)
+	}
+	if project != nil && len(project.Env) > 0 {
+		layers = append(layers, project.Env)
+	}
+	if task != nil && len(task.Env) > 0 {
+		layers = append(layers, task.Env)
+	}
+	if len(layers) == 0 {
+		return nil
+	}
+	return environ.Build(os.Environ(), layers...)
+}
+
+func (sm *Manager) sessionEnvForSession(ctx context.Context, agent *registry.AgentConfig, session *db.Session) []string {
+	if session == nil || session.TaskID == "" {
+		return sessionEnv(agent, nil, nil)
+	}
+	task, err := sm.taskRepo.Get(ctx, session.TaskID)
+	if err != nil || task == nil {
+		return sessionEnv(agent, nil, nil)
+	}
+	project, err := sm.projectRepo.Get(ctx, task.ProjectID)
+	if err != nil {
+		project = nil
+	}
+	return sessionEnv(agent, project, task)
+}
+
 func (sm *Manager) ensureMonitorForSession(ctx context.Context, session *db.Session) error {
 	if session == nil {
 		return fmt.Errorf("session is required")
@@ -954,7 +1375,8 @@ func (sm *Manager) ensureMonitorForSession(ctx context.Context, session *db.Sess
 	}
 	childCtx, cancel := context.WithCancel(monitorCtx)
 	workDir := sm.resolveWorkDirForSession(ctx, session)
-	mon := NewMonitor(MonitorConfig{
+	done, review := sm.completionDetectors(ctx, session)
+	mon, err := NewMonitor(MonitorConfig{
 		SessionID:      session.ID,
 		TmuxSession:    session.TmuxSessionName,
 		WindowID:       session.TmuxWindowID,
@@ -966,7 +1388,21 @@ func (sm *Manager) ensureMonitorForSession(ctx context.Context, session *db.Sess
 		PollInterval:   sm.pollInterval,
 		RingBufferSize: sm.ringBufferLen,
 		CaptureLines:   sm.captureLines,
+		OnExit: func(ctx context.Context) {
+			sm.sessionExited(ctx, session.ID)
+		},
+		Done:            done,
+		Review:          review,
+		DetectorCommand: sm.detectorCommand(ctx, session, workDir),
+		OnCompletion: func(ctx context.Context, kind string, result completion.Result) {
+			sm.recordCompletion(ctx, session.ID, kind, result)
+		},
 	})
+	if err != nil {
+		sm.mu.Unlock()
+		cancel()
+		return err
+	}
 	sm.monitors[session.ID] = monitorHandle{monitor: mon, cancel: cancel}
 	sm.mu.Unlock()
 
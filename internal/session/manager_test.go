@@ -2,42 +2,65 @@ package session
 
 import (
 	"context"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/pty"
 	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/resources"
+	"github.com/user/agenterm/internal/sandbox"
 )
 
 // fakeBackend implements TerminalBackend for tests.
 type fakeBackend struct {
+	// mu guards the fields against commands sent in the background; tests
+	// that only touch them from their own goroutine read them directly.
+	mu       sync.Mutex
 	sessions map[string]bool
+	envs     map[string][]string
+	commands map[string]string
 	inputs   []string
 	keys     []string
 }
 
 func newFakeBackend() *fakeBackend {
-	return &fakeBackend{sessions: make(map[string]bool)}
+	return &fakeBackend{sessions: make(map[string]bool), envs: make(map[string][]string), commands: make(map[string]string)}
 }
 
-func (f *fakeBackend) CreateSession(_ context.Context, id, name, command, workDir string) (string, error) {
+func (f *fakeBackend) CreateSession(_ context.Context, id, name, command, workDir string, env []string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.sessions[id] = true
+	f.envs[id] = env
+	f.commands[id] = command
 	return id, nil
 }
 
 func (f *fakeBackend) DestroySession(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	delete(f.sessions, id)
 	return nil
 }
 
 func (f *fakeBackend) SendInput(_ context.Context, id, data string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.inputs = append(f.inputs, id+":"+data)
 	return nil
 }
 
 func (f *fakeBackend) SendKey(_ context.Context, id, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.keys = append(f.keys, id+":"+key)
 	return nil
 }
@@ -51,9 +74,18 @@ func (f *fakeBackend) CaptureOutput(_ context.Context, id string, lines int) ([]
 }
 
 func (f *fakeBackend) SessionExists(_ context.Context, id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return f.sessions[id]
 }
 
+// sentInputs returns the inputs sent so far.
+func (f *fakeBackend) sentInputs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.inputs...)
+}
+
 func TestAutoAcceptSequence(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -240,6 +272,120 @@ func TestManagerCloseMarksSuspended(t *testing.T) {
 	}
 }
 
+func TestManagerDoesNotRestartAfterClose(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(context.Background()); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	lifecycle.Close()
+
+	// A command that lands after Close, as from a budget pause, must not
+	// bring the Manager back.
+	if _, err := lifecycle.EnqueueCommand(context.Background(), sess.ID, CommandRequest{Op: CommandOpInterrupt}); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("EnqueueCommand after Close error=%v", err)
+	}
+	ran := false
+	lifecycle.goBackground(func(context.Context) { ran = true })
+	lifecycle.Close()
+	if ran {
+		t.Fatal("background work ran after Close")
+	}
+	if got, _ := sessionRepo.Get(context.Background(), sess.ID); got.Status != "suspended" {
+		t.Fatalf("status=%q want suspended", got.Status)
+	}
+}
+
+func TestManagerStartReattachesSuspendedSessionStillRunning(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+
+	created := time.Now().UTC().Add(-time.Minute)
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, created)
+	sess.Status = "suspended"
+	if err := sessionRepo.Update(context.Background(), sess); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	// The PTY outlived the previous server (held by the supervisor).
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(context.Background()); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	updated, err := sessionRepo.Get(context.Background(), sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if updated.Status != "working" {
+		t.Fatalf("status=%q want working", updated.Status)
+	}
+}
+
+func TestManagerRestartRestoresPreSuspendStatus(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+	sess.Status = "human_takeover"
+	sess.HumanAttached = true
+	if err := sessionRepo.Update(context.Background(), sess); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+
+	NewManager(database.SQL(), backend, reg, nil).Close()
+	suspended, err := sessionRepo.Get(context.Background(), sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if suspended.Status != "suspended" || suspended.SuspendedStatus != "human_takeover" {
+		t.Fatalf("status=%q suspended_status=%q after close", suspended.Status, suspended.SuspendedStatus)
+	}
+
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(context.Background()); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+	restored, err := sessionRepo.Get(context.Background(), sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if restored.Status != "human_takeover" || restored.SuspendedStatus != "" {
+		t.Fatalf("status=%q suspended_status=%q after restart", restored.Status, restored.SuspendedStatus)
+	}
+}
+
 func TestListActiveExcludesTerminalStatuses(t *testing.T) {
 	database := openSessionTestDB(t)
 	sessionRepo := db.NewSessionRepo(database.SQL())
@@ -342,3 +488,410 @@ func TestManagerObserveParsedOutputFeedsRingBuffer(t *testing.T) {
 		t.Fatalf("output=%v want trailing line-1", out)
 	}
 }
+
+// processFakeBackend reports a fixed root pid for every terminal.
+type processFakeBackend struct {
+	*fakeBackend
+	pid int
+}
+
+func (f *processFakeBackend) ProcessID(_ context.Context, id string) (int, error) {
+	return f.pid, nil
+}
+
+func TestManagerGetResourceStatusMergesAgentAndProjectLimits(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	task, err := taskRepo.Get(ctx, sess.TaskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	project, err := projectRepo.Get(ctx, task.ProjectID)
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	project.ResourceLimits = resources.Limits{MemoryMB: 256, WallClockSeconds: 600}
+	if err := projectRepo.Update(ctx, project); err != nil {
+		t.Fatalf("update project: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{
+		ID:      "codex",
+		Name:    "Codex",
+		Command: "codex",
+		Limits:  resources.Limits{MemoryMB: 1024, MaxPids: 32},
+	}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+
+	backend := &processFakeBackend{fakeBackend: newFakeBackend(), pid: os.Getpid()}
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	status, err := lifecycle.GetResourceStatus(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("GetResourceStatus: %v", err)
+	}
+	want := resources.Limits{MemoryMB: 256, MaxPids: 32, WallClockSeconds: 600}
+	if status.Limits != want {
+		t.Fatalf("limits=%+v want %+v", status.Limits, want)
+	}
+	if status.PID != os.Getpid() {
+		t.Fatalf("pid=%d want %d", status.PID, os.Getpid())
+	}
+	if runtime.GOOS == "linux" && (status.Usage == nil || status.Usage.Processes < 1) {
+		t.Fatalf("usage=%+v want sampled usage", status.Usage)
+	}
+
+	if _, err := lifecycle.GetResourceStatus(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("GetResourceStatus(missing) error=%v want not found", err)
+	}
+}
+
+func TestManagerSignalProcessTargetsOnlyDescendants(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process trees are read from /proc")
+	}
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	backend := &processFakeBackend{fakeBackend: newFakeBackend(), pid: cmd.Process.Pid}
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+
+	var tree []resources.Process
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tree) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sleep child never appeared; tree=%+v", tree)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if tree, err = lifecycle.ListProcesses(ctx, sess.ID); err != nil {
+			t.Fatalf("ListProcesses: %v", err)
+		}
+	}
+	if tree[0].PID != cmd.Process.Pid || tree[0].Cwd == "" {
+		t.Fatalf("root=%+v want pid %d with cwd", tree[0], cmd.Process.Pid)
+	}
+	child := tree[1]
+	if !strings.Contains(child.Command, "sleep 30") {
+		t.Fatalf("child command=%q want sleep 30", child.Command)
+	}
+
+	if err := lifecycle.SignalProcess(ctx, sess.ID, cmd.Process.Pid, "KILL"); err == nil || !strings.Contains(err.Error(), "cannot be signaled") {
+		t.Fatalf("signal root error=%v want refusal", err)
+	}
+	if err := lifecycle.SignalProcess(ctx, sess.ID, os.Getpid(), "KILL"); err == nil || !IsNotFound(err) {
+		t.Fatalf("signal unrelated pid error=%v want not found", err)
+	}
+	if err := lifecycle.SignalProcess(ctx, sess.ID, child.PID, "BOGUS"); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("signal bogus error=%v want unsupported", err)
+	}
+	if err := lifecycle.SignalProcess(ctx, sess.ID, child.PID, "TERM"); err != nil {
+		t.Fatalf("signal child: %v", err)
+	}
+
+	// The shell's wait returns once its child is gone, so the root exits
+	// on its own while the agent was never signaled.
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("root exited with %v, want clean exit after child terminated", err)
+	}
+}
+
+func TestReactiveLimitViolation(t *testing.T) {
+	handle := &limitHandle{
+		limits:      resources.Limits{MemoryMB: 64, MaxPids: 4},
+		enforcement: resources.Enforcement{Mechanism: resources.MechanismCgroup, Unenforced: []string{"max_pids"}},
+	}
+	if got := reactiveLimitViolation(handle, resources.Usage{Processes: 4, RSSBytes: 1 << 30}); got != "" {
+		t.Fatalf("violation=%q want none: memory is enforced by the kernel", got)
+	}
+	if got := reactiveLimitViolation(handle, resources.Usage{Processes: 5}); !strings.Contains(got, "max_pids") {
+		t.Fatalf("violation=%q want max_pids", got)
+	}
+
+	handle.enforcement = resources.Enforcement{Mechanism: resources.MechanismNone}
+	if got := reactiveLimitViolation(handle, resources.Usage{Processes: 1, RSSBytes: 65 << 20}); !strings.Contains(got, "memory_mb") {
+		t.Fatalf("violation=%q want memory_mb", got)
+	}
+}
+
+func TestManagerResumeLayersAgentProjectAndTaskEnv(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+
+	t.Setenv("AGENTERM_TEST_HOME", "/home/agent")
+	t.Setenv("AGENTERM_TEST_DROP", "1")
+
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+	task, err := taskRepo.Get(ctx, sess.TaskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	task.Env = environ.Map{"WORKTREE": strPtr("$AGENTERM_TEST_HOME/wt"), "API_BASE": strPtr("https://task.example.com")}
+	if err := taskRepo.Update(ctx, task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	project, err := projectRepo.Get(ctx, task.ProjectID)
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	project.Env = environ.Map{"API_BASE": strPtr("https://project.example.com"), "https_proxy": nil}
+	if err := projectRepo.Update(ctx, project); err != nil {
+		t.Fatalf("update project: %v", err)
+	}
+	sess.Status = "suspended"
+	if err := sessionRepo.Update(ctx, sess); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{
+		ID:                    "codex",
+		Name:                  "Codex",
+		Command:               "codex",
+		ResumeCommand:         "codex --continue",
+		SupportsSessionResume: true,
+		Env: environ.Map{
+			"https_proxy":        strPtr("http://127.0.0.1:10808"),
+			"AGENTERM_TEST_DROP": nil,
+		},
+	}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+
+	backend := newFakeBackend()
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	env := map[string]string{}
+	for _, kv := range backend.envs[sess.ID] {
+		name, value, _ := strings.Cut(kv, "=")
+		env[name] = value
+	}
+	if env["API_BASE"] != "https://task.example.com" {
+		t.Fatalf("API_BASE=%q want task value", env["API_BASE"])
+	}
+	if env["WORKTREE"] != "/home/agent/wt" {
+		t.Fatalf("WORKTREE=%q want expanded value", env["WORKTREE"])
+	}
+	if _, ok := env["https_proxy"]; ok {
+		t.Fatalf("https_proxy should be unset by the project layer")
+	}
+	if _, ok := env["AGENTERM_TEST_DROP"]; ok {
+		t.Fatalf("AGENTERM_TEST_DROP should be unset by the agent layer")
+	}
+}
+
+// sandboxFakeBackend records the policy of sandboxed sessions.
+type sandboxFakeBackend struct {
+	*fakeBackend
+	policies map[string]sandbox.Policy
+}
+
+func (f *sandboxFakeBackend) CreateSandboxedSession(ctx context.Context, id, name, command, workDir string, env []string, policy sandbox.Policy) (string, error) {
+	f.policies[id] = policy
+	return f.CreateSession(ctx, id, name, command, workDir, env)
+}
+
+func TestManagerResumeSpawnsSandboxedAgentsOnlyInSandbox(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	agent := &registry.AgentConfig{
+		ID:                    "codex",
+		Name:                  "Codex",
+		Command:               "codex --dangerously-bypass-approvals-and-sandbox",
+		ResumeCommand:         "codex resume",
+		SupportsSessionResume: true,
+		Sandbox:               sandbox.Config{Mode: sandbox.ModeReadOnly},
+	}
+	if err := reg.Save(agent); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+
+	plain := newFakeBackend()
+	if err := NewManager(database.SQL(), plain, reg, nil).ResumeSession(ctx, sess); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("ResumeSession on plain backend error=%v want unsupported", err)
+	}
+	if plain.sessions[sess.ID] {
+		t.Fatalf("sandboxed agent was started without a sandbox")
+	}
+
+	backend := &sandboxFakeBackend{fakeBackend: newFakeBackend(), policies: map[string]sandbox.Policy{}}
+	if err := NewManager(database.SQL(), backend, reg, nil).ResumeSession(ctx, sess); err != nil {
+		t.Fatalf("ResumeSession: %v", err)
+	}
+	policy, ok := backend.policies[sess.ID]
+	if !ok {
+		t.Fatalf("session was not spawned through the sandbox")
+	}
+	project, err := projectRepo.List(ctx, db.ProjectFilter{})
+	if err != nil || len(project) != 1 {
+		t.Fatalf("list projects: %v", err)
+	}
+	if policy.Mode != sandbox.ModeReadOnly || policy.Writable[0] != project[0].RepoPath {
+		t.Fatalf("policy=%+v want readonly with worktree %q writable first", policy, project[0].RepoPath)
+	}
+}
+
+func TestSessionEnvWithoutLayersInherits(t *testing.T) {
+	if env := sessionEnv(&registry.AgentConfig{}, &db.Project{}, &db.Task{}); env != nil {
+		t.Fatalf("sessionEnv()=%q want nil", env)
+	}
+}
+
+// exitFakeBackend reports a fixed exit status for every terminal.
+type exitFakeBackend struct {
+	*fakeBackend
+	exit pty.ExitStatus
+}
+
+func (f *exitFakeBackend) ExitStatus(_ context.Context, id string) (pty.ExitStatus, error) {
+	return f.exit, nil
+}
+
+func TestManagerRecordsSessionExit(t *testing.T) {
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	exitedAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	backend := &exitFakeBackend{fakeBackend: newFakeBackend(), exit: pty.ExitStatus{Code: -1, Signal: 11, At: exitedAt}}
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+
+	crashed := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	lifecycle.sessionExited(ctx, crashed.ID)
+	got, err := sessionRepo.Get(ctx, crashed.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Exit == nil || got.Exit.Code == nil || *got.Exit.Code != -1 || got.Exit.Signal != "SIGSEGV" || got.Exit.Reason != ExitReasonCrashed || !got.Exit.At.Equal(exitedAt) {
+		t.Fatalf("exit=%+v want crash by SIGSEGV at %s", got.Exit, exitedAt)
+	}
+
+	killed := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	killed.TmuxWindowID = "killed-terminal"
+	if err := sessionRepo.Update(ctx, killed); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+	backend.sessions["killed-terminal"] = true
+	if err := lifecycle.DestroySession(ctx, killed.ID); err != nil {
+		t.Fatalf("DestroySession: %v", err)
+	}
+	got, err = sessionRepo.Get(ctx, killed.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Exit == nil || got.Exit.Reason != ExitReasonKilled || got.Exit.Code != nil {
+		t.Fatalf("exit=%+v want user kill", got.Exit)
+	}
+
+	// A resumed session is running again and has no exit.
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", ResumeCommand: "codex resume", SupportsSessionResume: true}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	if err := lifecycle.ResumeSession(ctx, got); err != nil {
+		t.Fatalf("ResumeSession: %v", err)
+	}
+	lifecycle.Close()
+	if got, _ = sessionRepo.Get(ctx, killed.ID); got.Exit != nil {
+		t.Fatalf("exit=%+v after resume want none", got.Exit)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestManagerSpawnJoinsCgroupBeforeExec(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are linux-only")
+	}
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	ctx := context.Background()
+
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-time.Minute))
+	sess.Status = "suspended"
+	if err := sessionRepo.Update(ctx, sess); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{
+		ID:                    "codex",
+		Name:                  "Codex",
+		Command:               "codex",
+		ResumeCommand:         "codex --continue",
+		SupportsSessionResume: true,
+		Limits:                resources.Limits{MemoryMB: 512},
+	}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+
+	cgroupRoot := t.TempDir()
+	backend := newFakeBackend()
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	lifecycle.SetCgroupRoot(cgroupRoot)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	dir := filepath.Join(cgroupRoot, "agenterm-"+sess.ID)
+	if want := resources.JoinCommand(dir, "codex --continue"); backend.commands[sess.ID] != want {
+		t.Fatalf("command=%q want %q", backend.commands[sess.ID], want)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "memory.max")); err != nil || string(got) != "536870912" {
+		t.Fatalf("memory.max=%q err=%v", got, err)
+	}
+}
@@ -2,18 +2,21 @@ package session
 
 import (
 	"context"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/user/agenterm/internal/completion"
 	"github.com/user/agenterm/internal/db"
 	"github.com/user/agenterm/internal/hub"
 	"github.com/user/agenterm/internal/parser"
 )
 
+// completionOutputLines is the number of recent output lines that output
+// detectors are matched against.
+const completionOutputLines = 200
+
 type MonitorConfig struct {
 	SessionID      string
 	TmuxSession    string
@@ -26,6 +29,19 @@ type MonitorConfig struct {
 	PollInterval   time.Duration
 	RingBufferSize int
 	CaptureLines   int
+	// OnExit, when set, is called after the exit status has been persisted
+	// once the session's process is gone.
+	OnExit func(ctx context.Context)
+	// Done and Review decide when the session is complete or ready for
+	// review; zero values use completion.DefaultDone and DefaultReview.
+	Done   completion.Detector
+	Review completion.Detector
+	// DetectorCommand, when set, returns the command line a command
+	// detector runs as, so that it gets the session's sandbox and limits.
+	DetectorCommand func(command string) ([]string, error)
+	// OnCompletion, when set, is called when Done ("done") or Review
+	// ("review") starts firing, with the detector that fired.
+	OnCompletion func(ctx context.Context, kind string, result completion.Result)
 }
 
 type Monitor struct {
@@ -36,6 +52,12 @@ type Monitor struct {
 	backend     TerminalBackend
 	sessionRepo *db.SessionRepo
 	hub         *hub.Hub
+	onExit      func(ctx context.Context)
+
+	done         completion.Detector
+	review       completion.Detector
+	evaluator    *completion.Evaluator
+	onCompletion func(ctx context.Context, kind string, result completion.Result)
 
 	idleTimeout  time.Duration
 	pollInterval time.Duration
@@ -49,12 +71,15 @@ type Monitor struct {
 	buffer     *ringBuffer
 
 	lastCompletionCheck time.Time
-	markerDoneCached    bool
-	readyCommitCached   bool
+	doneCached          bool
+	reviewCached        bool
+	quiet               bool
 	bootstrapAttemptAt  time.Time
 }
 
-func NewMonitor(cfg MonitorConfig) *Monitor {
+// NewMonitor returns a monitor for cfg, or an error when one of its
+// completion detectors is invalid.
+func NewMonitor(cfg MonitorConfig) (*Monitor, error) {
 	idleTimeout := cfg.IdleTimeout
 	if idleTimeout <= 0 {
 		idleTimeout = defaultIdleTimeout
@@ -71,6 +96,21 @@ func NewMonitor(cfg MonitorConfig) *Monitor {
 	if size <= 0 {
 		size = defaultRingBufferLen
 	}
+	done, review := cfg.Done, cfg.Review
+	if done.IsZero() {
+		done = completion.DefaultDone
+	}
+	if review.IsZero() {
+		review = completion.DefaultReview
+	}
+	if err := done.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid done detector: %w", err)
+	}
+	if err := review.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid review detector: %w", err)
+	}
+	evaluator := completion.NewEvaluator()
+	evaluator.Argv = cfg.DetectorCommand
 
 	return &Monitor{
 		sessionID:    cfg.SessionID,
@@ -80,13 +120,18 @@ func NewMonitor(cfg MonitorConfig) *Monitor {
 		backend:      cfg.Backend,
 		sessionRepo:  cfg.SessionRepo,
 		hub:          cfg.Hub,
+		onExit:       cfg.OnExit,
+		done:         done,
+		review:       review,
+		evaluator:    evaluator,
+		onCompletion: cfg.OnCompletion,
 		idleTimeout:  idleTimeout,
 		pollInterval: poll,
 		captureLines: capLines,
 		lastOutput:   time.Now().UTC(),
 		lastStatus:   "working",
 		buffer:       newRingBuffer(size),
-	}
+	}, nil
 }
 
 func (m *Monitor) Run(ctx context.Context) {
@@ -104,6 +149,9 @@ func (m *Monitor) Run(ctx context.Context) {
 		case <-ticker.C:
 			if m.backend != nil && !m.backend.SessionExists(context.Background(), m.sessionID) {
 				m.persistStatus(context.Background(), m.statusOnSessionExit())
+				if m.onExit != nil {
+					m.onExit(context.Background())
+				}
 				return
 			}
 			m.touchActivity(context.Background())
@@ -234,22 +282,37 @@ func (m *Monitor) IdleState() IdleStateResult {
 }
 
 func (m *Monitor) detectStatus() string {
-	if m.hasPrompt() {
+	prompt, idle := m.hasPrompt(), m.isIdle()
+	m.noteQuiet(prompt || idle)
+	if prompt {
 		return "waiting_review"
 	}
-	if m.isIdle() {
+	if idle {
 		return "idle"
 	}
 	m.refreshCompletionSignals(false)
-	if m.isMarkerDoneCached() {
+	if m.isDoneCached() {
 		return "completed"
 	}
-	if m.hasReadyForReviewCommitCached() {
+	if m.isReviewReadyCached() {
 		return "waiting_review"
 	}
 	return "working"
 }
 
+// noteQuiet runs the completion detectors, commands included, when the
+// agent goes idle or shows its prompt. Command detectors are often test
+// suites: only then is their verdict worth the run.
+func (m *Monitor) noteQuiet(quiet bool) {
+	m.mu.Lock()
+	started := quiet && !m.quiet
+	m.quiet = quiet
+	m.mu.Unlock()
+	if started {
+		go m.refreshCompletionSignals(true)
+	}
+}
+
 func (m *Monitor) currentStatus() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -274,41 +337,21 @@ func (m *Monitor) hasPrompt() bool {
 	return false
 }
 
-func (m *Monitor) isMarkerDone() bool {
-	if strings.TrimSpace(m.workDir) == "" {
-		return false
-	}
-	_, err := os.Stat(filepath.Join(m.workDir, ".orchestra", "done"))
-	return err == nil
-}
-
-func (m *Monitor) hasReadyForReviewCommit() bool {
-	if strings.TrimSpace(m.workDir) == "" {
-		return false
-	}
-	cmd := exec.Command("git", "-C", m.workDir, "log", "-1", "--pretty=%B")
-	out, err := cmd.Output()
-	if err != nil {
-		return false
-	}
-	return strings.Contains(string(out), "[READY_FOR_REVIEW]")
-}
-
 func (m *Monitor) statusOnSessionExit() string {
 	m.refreshCompletionSignals(true)
-	if m.isMarkerDoneCached() {
+	if m.isDoneCached() {
 		return "completed"
 	}
-	if m.hasReadyForReviewCommitCached() {
+	if m.isReviewReadyCached() {
 		return "waiting_review"
 	}
 	return "failed"
 }
 
+// refreshCompletionSignals evaluates the done and review detectors, at
+// most every five seconds unless forced, and reports detectors that start
+// firing.
 func (m *Monitor) refreshCompletionSignals(force bool) {
-	if strings.TrimSpace(m.workDir) == "" {
-		return
-	}
 	now := time.Now().UTC()
 	m.mu.RLock()
 	lastCheck := m.lastCompletionCheck
@@ -316,25 +359,45 @@ func (m *Monitor) refreshCompletionSignals(force bool) {
 	if !force && !lastCheck.IsZero() && now.Sub(lastCheck) < 5*time.Second {
 		return
 	}
-	marker := m.isMarkerDone()
-	ready := m.hasReadyForReviewCommit()
+
+	lines := m.buffer.Last(completionOutputLines)
+	in := completion.Input{WorkDir: m.workDir, Output: make([]string, len(lines)), Force: force}
+	for i, entry := range lines {
+		in.Output[i] = entry.Text
+	}
+	ctx := context.Background()
+	doneResult, done := m.evaluator.Evaluate(ctx, m.done, in)
+	reviewResult, review := m.evaluator.Evaluate(ctx, m.review, in)
+
 	m.mu.Lock()
+	newlyDone := done && !m.doneCached
+	newlyReview := review && !m.reviewCached
 	m.lastCompletionCheck = now
-	m.markerDoneCached = marker
-	m.readyCommitCached = ready
+	m.doneCached = done
+	m.reviewCached = review
 	m.mu.Unlock()
+
+	if m.onCompletion == nil {
+		return
+	}
+	if newlyDone {
+		m.onCompletion(ctx, "done", doneResult)
+	}
+	if newlyReview {
+		m.onCompletion(ctx, "review", reviewResult)
+	}
 }
 
-func (m *Monitor) isMarkerDoneCached() bool {
+func (m *Monitor) isDoneCached() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.markerDoneCached
+	return m.doneCached
 }
 
-func (m *Monitor) hasReadyForReviewCommitCached() bool {
+func (m *Monitor) isReviewReadyCached() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.readyCommitCached
+	return m.reviewCached
 }
 
 func (m *Monitor) persistStatus(ctx context.Context, status string) {
@@ -349,7 +412,7 @@ func (m *Monitor) persistStatus(ctx context.Context, status string) {
 	if err != nil || sess == nil {
 		return
 	}
-	if sess.HumanAttached {
+	if sess.HumanAttached || sess.Status == "paused" {
 		return
 	}
 	sess.Status = status
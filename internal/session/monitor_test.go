@@ -4,9 +4,12 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/user/agenterm/internal/completion"
 	"github.com/user/agenterm/internal/db"
 )
 
@@ -57,6 +60,15 @@ func seedSession(t *testing.T, sessionRepo *db.SessionRepo, taskRepo *db.TaskRep
 	return sess
 }
 
+func newTestMonitor(t *testing.T, cfg MonitorConfig) *Monitor {
+	t.Helper()
+	m, err := NewMonitor(cfg)
+	if err != nil {
+		t.Fatalf("new monitor: %v", err)
+	}
+	return m
+}
+
 func TestMonitorDetectStatusPromptBeatsMarker(t *testing.T) {
 	workDir := t.TempDir()
 	if err := os.MkdirAll(filepath.Join(workDir, ".orchestra"), 0o755); err != nil {
@@ -66,7 +78,7 @@ func TestMonitorDetectStatusPromptBeatsMarker(t *testing.T) {
 		t.Fatalf("write marker: %v", err)
 	}
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s1",
 		TmuxSession:  "s1",
 		WindowID:     "s1",
@@ -90,7 +102,7 @@ func TestMonitorDetectStatusIdleBeatsMarker(t *testing.T) {
 		t.Fatalf("write marker: %v", err)
 	}
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s2",
 		TmuxSession:  "s2",
 		WindowID:     "s2",
@@ -107,6 +119,97 @@ func TestMonitorDetectStatusIdleBeatsMarker(t *testing.T) {
 	}
 }
 
+func TestMonitorReportsCompletionDetector(t *testing.T) {
+	var reports []string
+	m := newTestMonitor(t, MonitorConfig{
+		SessionID:    "s3",
+		TmuxSession:  "s3",
+		WindowID:     "s3",
+		WorkDir:      t.TempDir(),
+		IdleTimeout:  30 * time.Second,
+		PollInterval: 10 * time.Millisecond,
+		Done:         completion.Detector{Name: "qa", Output: `^QA PASSED$`},
+		OnCompletion: func(_ context.Context, kind string, result completion.Result) {
+			reports = append(reports, kind+" "+result.Detector)
+		},
+	})
+	m.IngestParsed("running checks", "normal", time.Now().UTC())
+	if got := m.statusOnSessionExit(); got != "failed" {
+		t.Fatalf("statusOnSessionExit()=%q want failed before the detector fires", got)
+	}
+	m.IngestParsed("QA PASSED", "normal", time.Now().UTC())
+	if got := m.statusOnSessionExit(); got != "completed" {
+		t.Fatalf("statusOnSessionExit()=%q want completed", got)
+	}
+	m.refreshCompletionSignals(true)
+	if len(reports) != 1 || reports[0] != "done qa" {
+		t.Fatalf("reports=%q want one done report from qa", reports)
+	}
+}
+
+func TestMonitorRejectsInvalidDetector(t *testing.T) {
+	_, err := NewMonitor(MonitorConfig{SessionID: "s4", Done: completion.Detector{Output: "("}})
+	if err == nil || !strings.Contains(err.Error(), "invalid done detector") {
+		t.Fatalf("NewMonitor error=%v want invalid done detector", err)
+	}
+	_, err = NewMonitor(MonitorConfig{SessionID: "s4", Review: completion.Detector{FileExists: "a", Output: "b"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid review detector") {
+		t.Fatalf("NewMonitor error=%v want invalid review detector", err)
+	}
+}
+
+func TestMonitorRunsCommandDetectorsWhenQuiet(t *testing.T) {
+	workDir := t.TempDir()
+	var mu sync.Mutex
+	runs := 0
+	m := newTestMonitor(t, MonitorConfig{
+		SessionID:    "s5",
+		TmuxSession:  "s5",
+		WindowID:     "s5",
+		WorkDir:      workDir,
+		IdleTimeout:  30 * time.Second,
+		PollInterval: 10 * time.Millisecond,
+		Done:         completion.Detector{Name: "tests", Command: "true"},
+		DetectorCommand: func(command string) ([]string, error) {
+			mu.Lock()
+			runs++
+			mu.Unlock()
+			return []string{"sh", "-c", command}, nil
+		},
+	})
+	countRuns := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs
+	}
+
+	m.IngestParsed("compiling", "normal", time.Now().UTC())
+	m.mu.Lock()
+	m.lastCompletionCheck = time.Time{}
+	m.mu.Unlock()
+	if got := m.detectStatus(); got != "working" {
+		t.Fatalf("detectStatus()=%q want working", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := countRuns(); n != 0 {
+		t.Fatalf("command detector ran %d times while working", n)
+	}
+
+	m.IngestParsed("$ ", "prompt", time.Now().UTC())
+	m.detectStatus()
+	m.detectStatus()
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.isDoneCached() {
+		if time.Now().After(deadline) {
+			t.Fatalf("command detector did not run at the prompt")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := countRuns(); n != 1 {
+		t.Fatalf("command detector ran %d times, want once per transition", n)
+	}
+}
+
 func TestMonitorRunRefreshesLastActivityWithoutStatusChange(t *testing.T) {
 	database := openSessionTestDB(t)
 	sessionRepo := db.NewSessionRepo(database.SQL())
@@ -119,7 +222,7 @@ func TestMonitorRunRefreshesLastActivityWithoutStatusChange(t *testing.T) {
 	backend := newFakeBackend()
 	backend.sessions[sess.ID] = true
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    sess.ID,
 		TmuxSession:  sess.TmuxSessionName,
 		WindowID:     sess.TmuxWindowID,
@@ -161,7 +264,7 @@ func TestMonitorRunMarksFailedWhenSessionDisappearsWithoutCompletionSignal(t *te
 	// Backend returns false for SessionExists — session is gone.
 	backend := newFakeBackend()
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    sess.ID,
 		TmuxSession:  sess.TmuxSessionName,
 		WindowID:     sess.TmuxWindowID,
@@ -196,7 +299,7 @@ func TestMonitorOutputSinceBootstrapsFromBackend(t *testing.T) {
 	}
 	backend.sessions["s-bootstrap"] = true
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-bootstrap",
 		TmuxSession:  "s-bootstrap",
 		WindowID:     "s-bootstrap",
@@ -239,7 +342,7 @@ func TestMonitorReadyStateUsesPromptFromBootstrapSnapshot(t *testing.T) {
 	}
 	backend.sessions["s-ready"] = true
 
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-ready",
 		TmuxSession:  "s-ready",
 		WindowID:     "s-ready",
@@ -255,7 +358,7 @@ func TestMonitorReadyStateUsesPromptFromBootstrapSnapshot(t *testing.T) {
 }
 
 func TestOutputEntryCarriesClassThroughRingBuffer(t *testing.T) {
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-class",
 		TmuxSession:  "s-class",
 		WindowID:     "s-class",
@@ -284,7 +387,7 @@ func TestOutputEntryCarriesClassThroughRingBuffer(t *testing.T) {
 }
 
 func TestIdleStateReturnsPromptDetected(t *testing.T) {
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-idle",
 		TmuxSession:  "s-idle",
 		WindowID:     "s-idle",
@@ -310,7 +413,7 @@ func TestIdleStateReturnsPromptDetected(t *testing.T) {
 }
 
 func TestIdleStateReturnsWorkingWhenActive(t *testing.T) {
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-active",
 		TmuxSession:  "s-active",
 		WindowID:     "s-active",
@@ -333,7 +436,7 @@ func TestIdleStateReturnsWorkingWhenActive(t *testing.T) {
 }
 
 func TestIdleStateReturnsNoOutputWhenTimedOut(t *testing.T) {
-	m := NewMonitor(MonitorConfig{
+	m := newTestMonitor(t, MonitorConfig{
 		SessionID:    "s-timeout",
 		TmuxSession:  "s-timeout",
 		WindowID:     "s-timeout",
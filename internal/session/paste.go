@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/user/agenterm/internal/registry"
+)
+
+const (
+	bracketedPasteStart = "\x1b[200~"
+	bracketedPasteEnd   = "\x1b[201~"
+
+	// promptFileDir holds prompts too long to paste, relative to the
+	// worktree.
+	promptFileDir       = ".orchestra/prompts"
+	defaultFileTemplate = "Read {path} and follow the instructions in it."
+)
+
+// deliverText types text into a terminal as configured for the agent and
+// submits it with Enter when submit is set.
+func (sm *Manager) deliverText(ctx context.Context, terminalID, workDir, text string, submit bool, cfg registry.PasteConfig) error {
+	if cfg.FileThreshold > 0 && len(text) > cfg.FileThreshold && workDir != "" {
+		rel, err := writePromptFile(workDir, text)
+		if err != nil {
+			return err
+		}
+		template := cfg.FileTemplate
+		if template == "" {
+			template = defaultFileTemplate
+		}
+		text = strings.ReplaceAll(template, "{path}", rel)
+	}
+
+	if text != "" {
+		if cfg.Bracketed {
+			if err := sm.backend.SendInput(ctx, terminalID, bracketedPasteStart); err != nil {
+				return err
+			}
+			// A stray end marker would let the rest of the text be read as
+			// keystrokes.
+			text = strings.ReplaceAll(text, bracketedPasteEnd, "")
+		}
+		for _, chunk := range splitChunks(text, cfg.ChunkSize) {
+			if err := sm.backend.SendInput(ctx, terminalID, chunk); err != nil {
+				return err
+			}
+			if err := sleepContext(ctx, time.Duration(cfg.ChunkDelayMS)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+		if cfg.Bracketed {
+			if err := sm.backend.SendInput(ctx, terminalID, bracketedPasteEnd); err != nil {
+				return err
+			}
+		}
+		if submit {
+			if err := sleepContext(ctx, time.Duration(cfg.SubmitDelayMS)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+	}
+	if submit {
+		return sm.backend.SendInput(ctx, terminalID, "\r")
+	}
+	return nil
+}
+
+// splitChunks splits text into pieces of at most size bytes without
+// breaking UTF-8 sequences. A size of 0 keeps text whole.
+func splitChunks(text string, size int) []string {
+	if size <= 0 || len(text) <= size {
+		return []string{text}
+	}
+	var chunks []string
+	for len(text) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// A single rune longer than size.
+			_, cut = utf8.DecodeRuneInString(text)
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// writePromptFile stores text under promptFileDir in workDir and returns its
+// path relative to workDir. The file is named after its content, so the
+// retries of a command reuse the file its first attempt wrote.
+func writePromptFile(workDir, text string) (string, error) {
+	dir := filepath.Join(workDir, filepath.FromSlash(promptFileDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create prompt dir: %w", err)
+	}
+	sum := sha256.Sum256([]byte(text))
+	name := fmt.Sprintf("prompt-%x.md", sum[:8])
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			return "", fmt.Errorf("write prompt file: %w", err)
+		}
+	}
+	return promptFileDir + "/" + name, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestDeliverTextBracketedAndChunked(t *testing.T) {
+	fb := newFakeBackend()
+	sm := &Manager{backend: fb}
+
+	cfg := registry.PasteConfig{Bracketed: true, ChunkSize: 2}
+	if err := sm.deliverText(context.Background(), "t1", "", "héllo\x1b[201~!", true, cfg); err != nil {
+		t.Fatalf("deliverText: %v", err)
+	}
+	want := []string{"t1:\x1b[200~", "t1:h", "t1:é", "t1:ll", "t1:o!", "t1:\x1b[201~", "t1:\r"}
+	if !reflect.DeepEqual(fb.inputs, want) {
+		t.Fatalf("inputs=%q want %q", fb.inputs, want)
+	}
+}
+
+func TestDeliverTextZeroConfigSendsVerbatim(t *testing.T) {
+	fb := newFakeBackend()
+	sm := &Manager{backend: fb}
+
+	if err := sm.deliverText(context.Background(), "t1", "", "ls -la", true, registry.PasteConfig{}); err != nil {
+		t.Fatalf("deliverText: %v", err)
+	}
+	want := []string{"t1:ls -la", "t1:\r"}
+	if !reflect.DeepEqual(fb.inputs, want) {
+		t.Fatalf("inputs=%q want %q", fb.inputs, want)
+	}
+}
+
+func TestDeliverTextWritesLongPromptsToFile(t *testing.T) {
+	fb := newFakeBackend()
+	sm := &Manager{backend: fb}
+	workDir := t.TempDir()
+	prompt := strings.Repeat("x", 64)
+
+	cfg := registry.PasteConfig{FileThreshold: 32, FileTemplate: "Follow @{path}"}
+	if err := sm.deliverText(context.Background(), "t1", workDir, prompt, false, cfg); err != nil {
+		t.Fatalf("deliverText: %v", err)
+	}
+	if len(fb.inputs) != 1 {
+		t.Fatalf("inputs=%q want a single reference", fb.inputs)
+	}
+	rel, ok := strings.CutPrefix(fb.inputs[0], "t1:Follow @")
+	if !ok || !strings.HasPrefix(rel, promptFileDir+"/") {
+		t.Fatalf("input=%q want reference into %s", fb.inputs[0], promptFileDir)
+	}
+	raw, err := os.ReadFile(filepath.Join(workDir, rel))
+	if err != nil {
+		t.Fatalf("read prompt file: %v", err)
+	}
+	if string(raw) != prompt {
+		t.Fatalf("prompt file=%q want %q", raw, prompt)
+	}
+
+	// A retry of the same command reuses the file.
+	if err := sm.deliverText(context.Background(), "t1", workDir, prompt, false, cfg); err != nil {
+		t.Fatalf("deliverText retry: %v", err)
+	}
+	files, err := os.ReadDir(filepath.Join(workDir, promptFileDir))
+	if err != nil || len(files) != 1 || fb.inputs[1] != fb.inputs[0] {
+		t.Fatalf("prompt files=%v inputs=%q err=%v want one file referenced twice", files, fb.inputs, err)
+	}
+}
@@ -0,0 +1,311 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/resources"
+)
+
+// limitCheckInterval is how often wall clock limits and limits the kernel
+// does not enforce are checked.
+const limitCheckInterval = 2 * time.Second
+
+// ResourceStatus is the effective limits and live usage of a session's
+// process tree.
+type ResourceStatus struct {
+	PID         int                   `json:"pid,omitempty"`
+	Limits      resources.Limits      `json:"limits"`
+	Enforcement resources.Enforcement `json:"enforcement"`
+	StartedAt   time.Time             `json:"started_at,omitempty"`
+	Usage       *resources.Usage      `json:"usage,omitempty"`
+}
+
+type limitHandle struct {
+	pid         int
+	limits      resources.Limits
+	enforcement resources.Enforcement
+	startedAt   time.Time
+	cancel      context.CancelFunc
+}
+
+// SetCgroupRoot sets the delegated cgroup v2 directory under which
+// per-session cgroups are created. Without one, limits are checked
+// reactively.
+func (sm *Manager) SetCgroupRoot(dir string) {
+	sm.limitMu.Lock()
+	defer sm.limitMu.Unlock()
+	sm.cgroupRoot = strings.TrimSpace(dir)
+}
+
+// prepareCgroup creates the cgroup of a session about to be spawned, so its
+// launcher can join it before exec. It returns "" when limits are not
+// enforced with a cgroup.
+func (sm *Manager) prepareCgroup(sessionID string, limits resources.Limits) string {
+	sm.limitMu.Lock()
+	cgroupRoot := sm.cgroupRoot
+	sm.limitMu.Unlock()
+	dir, err := resources.Prepare(sessionID, limits, cgroupRoot)
+	if err != nil {
+		slog.Warn("session cgroup not prepared; limits apply once the agent runs", "session_id", sessionID, "error", err)
+		return ""
+	}
+	return dir
+}
+
+// effectiveLimits combines the limits of the session's agent and project.
+func (sm *Manager) effectiveLimits(ctx context.Context, sess *db.Session) resources.Limits {
+	var limits resources.Limits
+	if agent := sm.registry.Get(sess.AgentType); agent != nil {
+		limits = agent.Limits
+	}
+	if sess.TaskID == "" {
+		return limits
+	}
+	task, err := sm.taskRepo.Get(ctx, sess.TaskID)
+	if err != nil || task == nil {
+		return limits
+	}
+	project, err := sm.projectRepo.Get(ctx, task.ProjectID)
+	if err != nil || project == nil {
+		return limits
+	}
+	return limits.Merge(project.ResourceLimits)
+}
+
+func (sm *Manager) sessionPID(ctx context.Context, sess *db.Session) int {
+	procs, ok := sm.backend.(ProcessBackend)
+	if !ok {
+		return 0
+	}
+	terminalID := sess.TmuxWindowID
+	if terminalID == "" {
+		terminalID = sess.ID
+	}
+	pid, err := procs.ProcessID(ctx, terminalID)
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// applyLimits enforces the session's limits on its process tree and starts
+// the watcher for the ones the kernel does not enforce. Failures are logged;
+// an agent is never refused because its limits could not be applied.
+func (sm *Manager) applyLimits(ctx context.Context, sess *db.Session) {
+	limits := sm.effectiveLimits(ctx, sess)
+	if limits.IsZero() {
+		return
+	}
+	pid := sm.sessionPID(ctx, sess)
+	if pid <= 0 {
+		slog.Warn("resource limits not applied: session pid unavailable", "session_id", sess.ID)
+		return
+	}
+
+	sm.limitMu.Lock()
+	cgroupRoot := sm.cgroupRoot
+	sm.limitMu.Unlock()
+	enforcement, err := resources.Apply(pid, sess.ID, limits, cgroupRoot)
+	if err != nil {
+		slog.Warn("resource limits not enforced by kernel", "session_id", sess.ID, "pid", pid, "error", err)
+	}
+
+	startedAt := time.Now().UTC()
+	if tree, err := resources.Tree(pid); err == nil && !tree[0].StartedAt.IsZero() {
+		startedAt = tree[0].StartedAt.UTC()
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	handle := &limitHandle{pid: pid, limits: limits, enforcement: enforcement, startedAt: startedAt, cancel: cancel}
+
+	sm.limitMu.Lock()
+	if prev := sm.limits[sess.ID]; prev != nil {
+		prev.cancel()
+	}
+	sm.limits[sess.ID] = handle
+	sm.limitMu.Unlock()
+
+	slog.Info("resource limits applied", "session_id", sess.ID, "pid", pid, "mechanism", enforcement.Mechanism, "unenforced", enforcement.Unenforced)
+	go sm.watchLimits(watchCtx, sess.ID, handle)
+}
+
+// watchLimits samples the session's process tree until it exits, and
+// terminates the session when it exceeds its wall clock or a limit its
+// enforcement mechanism could not apply.
+func (sm *Manager) watchLimits(ctx context.Context, sessionID string, handle *limitHandle) {
+	ticker := time.NewTicker(limitCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		usage, err := sm.sampler.Sample(handle.pid)
+		if err != nil {
+			// The process tree is gone; nothing left to watch.
+			sm.releaseLimits(sessionID)
+			return
+		}
+		reason := reactiveLimitViolation(handle, usage)
+		if wall := handle.limits.WallClock(); wall > 0 && time.Since(handle.startedAt) >= wall {
+			reason = fmt.Sprintf("wall clock limit of %s exceeded", wall)
+		}
+		if reason == "" {
+			continue
+		}
+
+		slog.Warn("terminating session over resource limit", "session_id", sessionID, "reason", reason)
+		if err := sm.destroySession(context.Background(), sessionID, "terminated", ExitReasonLimitExceeded); err != nil {
+			slog.Warn("failed to terminate session over resource limit", "session_id", sessionID, "error", err)
+		}
+		return
+	}
+}
+
+func reactiveLimitViolation(handle *limitHandle, usage resources.Usage) string {
+	l, e := handle.limits, handle.enforcement
+	if l.MaxPids > 0 && !e.Enforces("max_pids") && usage.Processes > l.MaxPids {
+		return fmt.Sprintf("%d processes exceed max_pids %d", usage.Processes, l.MaxPids)
+	}
+	if l.MemoryMB > 0 && !e.Enforces("memory_mb") && usage.RSSBytes > int64(l.MemoryMB)<<20 {
+		return fmt.Sprintf("rss of %d MiB exceeds memory_mb %d", usage.RSSBytes>>20, l.MemoryMB)
+	}
+	return ""
+}
+
+// releaseLimits stops the limit watcher and removes the session's cgroup.
+func (sm *Manager) releaseLimits(sessionID string) {
+	sm.limitMu.Lock()
+	handle := sm.limits[sessionID]
+	delete(sm.limits, sessionID)
+	sm.limitMu.Unlock()
+	if handle == nil {
+		return
+	}
+	handle.cancel()
+	sm.sampler.Forget(handle.pid)
+	sm.statusSampler.Forget(handle.pid)
+	if n, err := resources.OOMKills(handle.enforcement); err == nil && n > 0 {
+		sm.limitMu.Lock()
+		sm.oomKilled[sessionID] = true
+		sm.limitMu.Unlock()
+	}
+	if err := resources.Release(handle.enforcement); err != nil {
+		slog.Debug("failed to release session cgroup", "session_id", sessionID, "error", err)
+	}
+}
+
+// GetResourceStatus returns the limits and live usage of a session. Usage
+// is omitted when the session's process is not running or the platform
+// cannot sample it.
+func (sm *Manager) GetResourceStatus(ctx context.Context, sessionID string) (*ResourceStatus, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errNotFound("session")
+	}
+
+	sm.limitMu.Lock()
+	handle := sm.limits[sessionID]
+	sm.limitMu.Unlock()
+
+	status := &ResourceStatus{Enforcement: resources.Enforcement{Mechanism: resources.MechanismNone}}
+	if handle != nil {
+		status.PID = handle.pid
+		status.Limits = handle.limits
+		status.Enforcement = handle.enforcement
+		status.StartedAt = handle.startedAt
+	} else {
+		status.Limits = sm.effectiveLimits(ctx, sess)
+		if isActiveSessionStatus(sess.Status) {
+			status.PID = sm.sessionPID(ctx, sess)
+		}
+	}
+	if status.PID > 0 {
+		if usage, err := sm.statusSampler.Sample(status.PID); err == nil {
+			status.Usage = &usage
+		}
+	}
+	return status, nil
+}
+
+// ListProcesses returns the live process tree of a session, root first.
+func (sm *Manager) ListProcesses(ctx context.Context, sessionID string) ([]resources.Process, error) {
+	pid, err := sm.rootPID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := resources.Tree(pid)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound("process")
+	}
+	return tree, err
+}
+
+// SignalProcess sends a signal to one descendant of a session's root
+// process, e.g. to stop a hung test run without interrupting the agent. The
+// root process itself is refused; DestroySession stops the agent.
+func (sm *Manager) SignalProcess(ctx context.Context, sessionID string, pid int, signal string) error {
+	sig, err := resources.ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+	tree, err := sm.ListProcesses(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if pid == tree[0].PID {
+		return fmt.Errorf("pid %d is the agent process and cannot be signaled; destroy the session instead", pid)
+	}
+	for _, p := range tree[1:] {
+		if p.PID == pid {
+			slog.Info("signaling session process", "session_id", sessionID, "pid", pid, "signal", sig.String(), "command", p.Command)
+			return resources.Signal(pid, sig)
+		}
+	}
+	return errNotFound("process")
+}
+
+func (sm *Manager) rootPID(ctx context.Context, sessionID string) (int, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if sess == nil {
+		return 0, errNotFound("session")
+	}
+	if _, ok := sm.backend.(ProcessBackend); !ok {
+		return 0, fmt.Errorf("process inspection unsupported by terminal backend")
+	}
+	sm.limitMu.Lock()
+	handle := sm.limits[sessionID]
+	sm.limitMu.Unlock()
+	if handle != nil {
+		return handle.pid, nil
+	}
+	pid := sm.sessionPID(ctx, sess)
+	if pid <= 0 {
+		return 0, errNotFound("process")
+	}
+	return pid, nil
+}
+
+func isActiveSessionStatus(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "completed", "handed_off", "failed", "terminated", "closed", "dead":
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/parser"
+	"github.com/user/agenterm/internal/responder"
+)
+
+const (
+	// SessionEventAutoResponse is the kind of events recorded when a
+	// responder rule answers a prompt.
+	SessionEventAutoResponse = "auto_response"
+	// autoResponseCooldown keeps a prompt that is redrawn from being
+	// answered twice.
+	autoResponseCooldown = 10 * time.Second
+)
+
+// autoResponse is the last prompt claimed for answering in a session.
+type autoResponse struct {
+	text string
+	at   time.Time
+}
+
+// autoRespond answers a prompt of an unattended session from its project's
+// and agent's responder rules. The answer is sent in the background, until
+// Close, so that output parsing never waits on the command queue.
+func (sm *Manager) autoRespond(sessionID, text string, at time.Time) {
+	if !sm.claimPrompt(sessionID, text, at) {
+		return
+	}
+	sm.goBackground(func(ctx context.Context) {
+		sm.answerPrompt(ctx, sessionID, text)
+	})
+}
+
+// claimPrompt reports whether the prompt text was not already claimed for
+// the session within the cooldown.
+func (sm *Manager) claimPrompt(sessionID, text string, at time.Time) bool {
+	sm.responderMu.Lock()
+	defer sm.responderMu.Unlock()
+	for id, claimed := range sm.responded {
+		if at.Sub(claimed.at) >= autoResponseCooldown {
+			delete(sm.responded, id)
+		}
+	}
+	last, ok := sm.responded[sessionID]
+	if ok && last.text == text && at.Sub(last.at) < autoResponseCooldown {
+		return false
+	}
+	sm.responded[sessionID] = autoResponse{text: text, at: at}
+	return true
+}
+
+func (sm *Manager) answerPrompt(ctx context.Context, sessionID, text string) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil || sess == nil {
+		return
+	}
+	if sess.Takeover.Active(time.Now().UTC()) || sess.Status == "paused" || !sessionRunning(sess) {
+		return
+	}
+	var agentRules, projectRules responder.Rules
+	if agent := sm.registry.Get(sess.AgentType); agent != nil {
+		agentRules = agent.Responder
+	}
+	if task, err := sm.taskRepo.Get(ctx, sess.TaskID); err == nil && task != nil {
+		if project, err := sm.projectRepo.Get(ctx, task.ProjectID); err == nil && project != nil {
+			projectRules = project.ResponderRules
+		}
+	}
+	if len(agentRules) == 0 && len(projectRules) == 0 {
+		return
+	}
+
+	resp, ok := responder.Match(responder.Prompt{
+		Text:      text,
+		AgentType: sess.AgentType,
+		Role:      sess.Role,
+		WorkDir:   sm.resolveWorkDirForSession(ctx, sess),
+		Actions:   parser.QuickActions(text),
+	}, projectRules, agentRules)
+	if !ok {
+		return
+	}
+
+	detail := truncateRunes(text, 200)
+	if resp.Path != "" {
+		detail = fmt.Sprintf("%s (path %s)", detail, resp.Path)
+	}
+	if _, err := sm.EnqueueCommand(ctx, sess.ID, responseCommand(resp.Keys)); err != nil {
+		slog.Warn("auto-response failed", "session_id", sess.ID, "rule", resp.Rule.Label(), "error", err)
+		detail = fmt.Sprintf("%s (answer failed: %v)", detail, err)
+	} else {
+		slog.Info("prompt answered automatically", "session_id", sess.ID, "rule", resp.Rule.Label(), "answer", resp.Label)
+	}
+	sm.recordSessionEvent(ctx, &db.SessionEvent{
+		SessionID: sess.ID,
+		Kind:      SessionEventAutoResponse,
+		Rule:      resp.Rule.Label(),
+		Action:    resp.Label,
+		Detail:    detail,
+	})
+}
+
+// responseCommand turns the keys of an answer into a session command.
+func responseCommand(keys string) CommandRequest {
+	switch keys {
+	case "\x03":
+		return CommandRequest{Op: CommandOpInterrupt}
+	case "\n", "\r":
+		return CommandRequest{Op: CommandOpSendKey, Key: "enter"}
+	default:
+		return CommandRequest{Op: CommandOpSendText, Text: keys}
+	}
+}
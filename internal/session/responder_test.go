@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/responder"
+)
+
+func TestUnattendedPromptsAreAnsweredByRules(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	task, err := taskRepo.Get(ctx, sess.TaskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	project, err := projectRepo.Get(ctx, task.ProjectID)
+	if err != nil {
+		t.Fatalf("get project: %v", err)
+	}
+	project.ResponderRules = responder.Rules{
+		{Name: "edits in worktree", Match: `Allow edit to (?P<path>\S+)\? \[y/N\]`, Action: "Yes", RequirePathInWorktree: true},
+	}
+	if err := projectRepo.Update(ctx, project); err != nil {
+		t.Fatalf("update project: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", Responder: responder.Rules{
+		{Name: "continue", Match: `Press enter to continue`, Action: "Continue"},
+	}}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	waitEvents := func(n int) []*db.SessionEvent {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			events, err := lifecycle.ListSessionEvents(ctx, sess.ID)
+			if err != nil {
+				t.Fatalf("ListSessionEvents: %v", err)
+			}
+			if len(events) >= n || time.Now().After(deadline) {
+				return events
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	now := time.Now().UTC()
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Allow edit to src/main.go? [y/N]", "prompt", now)
+	events := waitEvents(1)
+	if len(events) != 1 || events[0].Kind != SessionEventAutoResponse || events[0].Rule != "edits in worktree" || events[0].Action != "Yes" ||
+		!strings.Contains(events[0].Detail, "src/main.go") {
+		t.Fatalf("events=%+v want one auto-response by the project rule", events)
+	}
+	// The redrawn prompt is not answered twice; a path outside the
+	// worktree is left to a human.
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Allow edit to src/main.go? [y/N]", "prompt", now.Add(time.Second))
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Allow edit to /etc/passwd? [y/N]", "prompt", now.Add(2*time.Second))
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Press enter to continue", "prompt", now.Add(3*time.Second))
+	events = waitEvents(2)
+	if len(events) != 2 || events[1].Rule != "continue" || events[1].Action != "Continue" {
+		t.Fatalf("events=%+v want the agent rule to answer second", events)
+	}
+	terminal := sess.TmuxSessionName + ":"
+	if strings.Join(backend.sentInputs(), ",") != terminal+"y,"+terminal+"\r" || strings.Join(backend.keys, ",") != terminal+"C-m" {
+		t.Fatalf("inputs=%q keys=%q want y submitted, then enter", backend.inputs, backend.keys)
+	}
+
+	if _, err := lifecycle.AcquireTakeover(ctx, sess.ID, "alice", time.Minute); err != nil {
+		t.Fatalf("AcquireTakeover: %v", err)
+	}
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Press enter to continue", "prompt", now.Add(time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	if events := waitEvents(0); len(events) != 3 || events[2].Kind != SessionEventTakeover {
+		t.Fatalf("events=%+v want no answer while a human holds the session", events)
+	}
+}
@@ -0,0 +1,523 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/user/agenterm/internal/db"
+	gitops "github.com/user/agenterm/internal/git"
+)
+
+const (
+	// schedulerInterval is how often the scheduler re-evaluates projects
+	// when nothing wakes it earlier.
+	schedulerInterval = 5 * time.Second
+	// launchRetryDelay is how long a task whose launch failed is left
+	// alone before the scheduler tries again.
+	launchRetryDelay = time.Minute
+	// defaultScheduledRole is the role of sessions the scheduler starts in
+	// projects without a playbook.
+	defaultScheduledRole = "coder"
+)
+
+// errTaskClaimed is returned when a task the scheduler is about to launch
+// got a session or waitlist entry from someone else first.
+var errTaskClaimed = errors.New("task already has a session")
+
+// Schedule states of a task.
+const (
+	ScheduleDone    = "done"
+	ScheduleRunning = "running"
+	// ScheduleReady tasks have all dependencies done and start as soon as
+	// their agent and the global limit have capacity.
+	ScheduleReady = "ready"
+	// ScheduleWaiting tasks have dependencies that are not done yet.
+	ScheduleWaiting = "waiting"
+	// ScheduleBlocked tasks need a human: their last session did not
+	// complete, or their dependencies or agent cannot be resolved.
+	ScheduleBlocked = "blocked"
+	// ScheduleManual tasks have no agent type, or a status other than
+	// pending or ready, and are never started automatically.
+	ScheduleManual = "manual"
+)
+
+// Schedule is the scheduler's view of one project's tasks, in creation
+// order.
+type Schedule struct {
+	ProjectID string `json:"project_id"`
+	// AutoSchedule reports whether ready tasks are actually started; when
+	// it is off the schedule only shows what would be.
+	AutoSchedule bool `json:"auto_schedule"`
+	// Running counts active sessions across all projects.
+	Running int `json:"running"`
+	// GlobalLimit is the maximum of running sessions; 0 is unlimited.
+	GlobalLimit int             `json:"global_limit"`
+	Entries     []ScheduleEntry `json:"entries"`
+}
+
+// ScheduleEntry is the scheduling state of one task.
+type ScheduleEntry struct {
+	TaskID    string `json:"task_id"`
+	Title     string `json:"title"`
+	AgentType string `json:"agent_type,omitempty"`
+	// Role is the role a session started for the task gets.
+	Role      string   `json:"role,omitempty"`
+	State     string   `json:"state"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	// WaitingOn lists the dependencies that are not done yet.
+	WaitingOn []string `json:"waiting_on,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+// scheduledLaunch is a ready task and the role to start it in.
+type scheduledLaunch struct {
+	task *db.Task
+	role string
+}
+
+type launchFailure struct {
+	at  time.Time
+	err string
+}
+
+// schedulerCapacity tracks running sessions while a pass launches more.
+type schedulerCapacity struct {
+	total   int
+	byAgent map[string]int
+}
+
+// SetMaxParallel sets the global limit of running sessions the scheduler
+// launches up to. Zero or less is unlimited.
+func (sm *Manager) SetMaxParallel(n int) {
+	sm.schedMu.Lock()
+	defer sm.schedMu.Unlock()
+	sm.maxParallel = n
+}
+
+// ProjectSchedule returns the scheduling state of a project's tasks.
+func (sm *Manager) ProjectSchedule(ctx context.Context, projectID string) (*Schedule, error) {
+	project, err := sm.projectRepo.Get(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, errNotFound("project")
+	}
+	capacity, err := sm.schedulerCapacity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, _, err := sm.planProject(ctx, project, capacity)
+	return schedule, err
+}
+
+// wakeScheduler makes the scheduler run a pass now, e.g. after a session
+// exited.
+func (sm *Manager) wakeScheduler() {
+	select {
+	case sm.schedWake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler launches ready tasks until ctx is done.
+func (sm *Manager) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		sm.schedulePass(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-sm.schedWake:
+		}
+	}
+}
+
+// schedulePass starts queued sessions, then, in projects with auto_schedule
+// on, a session for every ready task that fits the agent and global limits,
+// oldest tasks first.
+func (sm *Manager) schedulePass(ctx context.Context) {
+	// Explicit requests waiting for a slot go before scheduled tasks.
+	sm.drainWaitlist(ctx)
+
+	projects, err := sm.projectRepo.List(ctx, db.ProjectFilter{})
+	if err != nil {
+		slog.Debug("scheduler: list projects failed", "error", err)
+		return
+	}
+	capacity, err := sm.schedulerCapacity(ctx)
+	if err != nil {
+		slog.Debug("scheduler: count running sessions failed", "error", err)
+		return
+	}
+	sort.SliceStable(projects, func(i, j int) bool {
+		return projects[i].CreatedAt.Before(projects[j].CreatedAt)
+	})
+	for _, project := range projects {
+		if ctx.Err() != nil {
+			return
+		}
+		if !project.AutoSchedule || strings.EqualFold(project.Status, "archived") {
+			continue
+		}
+		_, ready, err := sm.planProject(ctx, project, capacity)
+		if err != nil {
+			slog.Debug("scheduler: plan failed", "project_id", project.ID, "error", err)
+			continue
+		}
+		for _, launch := range ready {
+			if sm.launchTask(ctx, project, launch) {
+				capacity.total++
+				capacity.byAgent[launch.task.AgentType]++
+			}
+		}
+	}
+}
+
+// launchTask starts a session for a ready task and reports whether it did.
+func (sm *Manager) launchTask(ctx context.Context, project *db.Project, launch scheduledLaunch) bool {
+	task := launch.task
+	err := sm.prepareWorktree(ctx, project, task)
+	if err == nil {
+		var sess *db.Session
+		sess, err = sm.createSession(ctx, CreateSessionRequest{TaskID: task.ID, AgentType: task.AgentType, Role: launch.role}, createOptions{unclaimed: true})
+		var waitlisted *WaitlistedError
+		if errors.As(err, &waitlisted) || errors.Is(err, errTaskClaimed) {
+			// The waitlist starts it once the agent has a slot, or an
+			// explicit request got there first.
+			return false
+		}
+		if err == nil {
+			slog.Info("scheduler launched task", "project_id", project.ID, "task_id", task.ID, "agent", task.AgentType, "session_id", sess.ID)
+		}
+	}
+
+	sm.schedMu.Lock()
+	defer sm.schedMu.Unlock()
+	if err != nil {
+		slog.Warn("scheduler failed to launch task", "project_id", project.ID, "task_id", task.ID, "agent", task.AgentType, "error", err)
+		sm.launchFailures[task.ID] = launchFailure{at: time.Now(), err: err.Error()}
+		return false
+	}
+	delete(sm.launchFailures, task.ID)
+	return true
+}
+
+// prepareWorktree creates the worktree planned for a task, e.g. by a
+// blueprint, the first time the task is launched.
+func (sm *Manager) prepareWorktree(ctx context.Context, project *db.Project, task *db.Task) error {
+	if task.WorktreeID == "" {
+		return nil
+	}
+	wt, err := sm.worktreeRepo.Get(ctx, task.WorktreeID)
+	if err != nil || wt == nil || strings.TrimSpace(wt.Path) != "" {
+		return err
+	}
+	repoRoot, err := gitops.GetRepoRoot(project.RepoPath)
+	if err != nil {
+		return fmt.Errorf("resolve repo root: %w", err)
+	}
+	branch := strings.TrimSpace(wt.BranchName)
+	if branch == "" {
+		branch = "feature/" + task.ID
+	}
+	path := filepath.Join(repoRoot, ".worktrees", strings.ReplaceAll(branch, "/", "-"))
+	if err := gitops.CreateWorktree(repoRoot, path, branch); err != nil {
+		return fmt.Errorf("create worktree: %w", err)
+	}
+	wt.BranchName = branch
+	wt.Path = path
+	wt.Status = "active"
+	return sm.worktreeRepo.Update(ctx, wt)
+}
+
+// schedulerCapacity counts the sessions whose agent process is running.
+func (sm *Manager) schedulerCapacity(ctx context.Context) (*schedulerCapacity, error) {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	capacity := &schedulerCapacity{byAgent: map[string]int{}}
+	for _, sess := range active {
+		if sessionRunning(sess) {
+			capacity.total++
+			capacity.byAgent[sess.AgentType]++
+		}
+	}
+	// Headless runs take slots like sessions do.
+	sm.headlessMu.Lock()
+	for _, handle := range sm.headless {
+		capacity.total++
+		capacity.byAgent[handle.agentType]++
+	}
+	sm.headlessMu.Unlock()
+	return capacity, nil
+}
+
+// planProject computes the schedule of a project and returns the ready
+// tasks that fit in capacity, which it does not modify.
+func (sm *Manager) planProject(ctx context.Context, project *db.Project, capacity *schedulerCapacity) (*Schedule, []scheduledLaunch, error) {
+	tasks, err := sm.taskRepo.ListByProject(ctx, project.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+
+	sm.schedMu.Lock()
+	globalLimit := sm.maxParallel
+	failures := make(map[string]launchFailure, len(sm.launchFailures))
+	for id, f := range sm.launchFailures {
+		failures[id] = f
+	}
+	sm.schedMu.Unlock()
+
+	waiting, err := sm.waitlistRepo.List(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	waitlisted := make(map[string]bool, len(waiting))
+	for _, w := range waiting {
+		waitlisted[w.TaskID] = true
+	}
+
+	schedule := &Schedule{ProjectID: project.ID, AutoSchedule: project.AutoSchedule, Running: capacity.total, GlobalLimit: globalLimit, Entries: make([]ScheduleEntry, 0, len(tasks))}
+	byID := make(map[string]*db.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	// First pass: what each task's own status and sessions say.
+	entries := make(map[string]*ScheduleEntry, len(tasks))
+	for _, task := range tasks {
+		entry := &ScheduleEntry{TaskID: task.ID, Title: task.Title, AgentType: task.AgentType, DependsOn: task.DependsOn}
+		entries[task.ID] = entry
+		if isTaskDone(task.Status) {
+			entry.State = ScheduleDone
+			continue
+		}
+		sessions, err := sm.sessionRepo.ListByTask(ctx, task.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(sessions) > 0 {
+			latest := sessions[0]
+			entry.SessionID = latest.ID
+			switch {
+			case sessionRunning(latest):
+				entry.State = ScheduleRunning
+			case strings.EqualFold(latest.Status, "completed"):
+				entry.State = ScheduleDone
+			default:
+				entry.State = ScheduleBlocked
+				entry.Reason = fmt.Sprintf("last session is %s", latest.Status)
+			}
+			continue
+		}
+		if !isTaskSchedulable(task.Status) {
+			entry.State = ScheduleManual
+			entry.Reason = fmt.Sprintf("task is %s", task.Status)
+		}
+	}
+
+	// Second pass: dependencies and capacity of tasks without sessions.
+	var ready []scheduledLaunch
+	planned := map[string]int{}
+	plannedTotal := 0
+	for _, task := range tasks {
+		entry := entries[task.ID]
+		if entry.State != "" {
+			continue
+		}
+		for _, dep := range task.DependsOn {
+			depEntry, ok := entries[dep]
+			switch {
+			case !ok:
+				entry.State = ScheduleBlocked
+				entry.Reason = fmt.Sprintf("unknown dependency %q", dep)
+			case depEntry.State != ScheduleDone:
+				entry.WaitingOn = append(entry.WaitingOn, dep)
+			}
+		}
+		if entry.State != "" {
+			continue
+		}
+		if len(entry.WaitingOn) > 0 {
+			entry.State = ScheduleWaiting
+			if dependsOnItself(task.ID, byID) {
+				entry.State = ScheduleBlocked
+				entry.Reason = "dependency cycle"
+			}
+			continue
+		}
+		if strings.TrimSpace(task.AgentType) == "" {
+			entry.State = ScheduleManual
+			continue
+		}
+		agent := sm.registry.Get(task.AgentType)
+		if agent == nil {
+			entry.State = ScheduleBlocked
+			entry.Reason = fmt.Sprintf("unknown agent type %q", task.AgentType)
+			continue
+		}
+		role, err := sm.scheduledRole(project, task.AgentType)
+		if err != nil {
+			entry.State = ScheduleBlocked
+			entry.Reason = err.Error()
+			continue
+		}
+		entry.Role = role
+
+		entry.State = ScheduleReady
+		if waitlisted[task.ID] {
+			entry.Reason = "queued on agent waitlist"
+			continue
+		}
+		if f, ok := failures[task.ID]; ok && time.Since(f.at) < launchRetryDelay {
+			entry.Reason = "launch failed: " + f.err
+			continue
+		}
+		agentLimit := agentCapacity(agent)
+		if busy := capacity.byAgent[task.AgentType] + planned[task.AgentType]; busy >= agentLimit {
+			entry.Reason = fmt.Sprintf("agent %s at capacity (%d/%d)", task.AgentType, busy, agentLimit)
+			continue
+		}
+		if globalLimit > 0 && capacity.total+plannedTotal >= globalLimit {
+			entry.Reason = fmt.Sprintf("global limit reached (%d/%d)", capacity.total+plannedTotal, globalLimit)
+			continue
+		}
+		planned[task.AgentType]++
+		plannedTotal++
+		ready = append(ready, scheduledLaunch{task: task, role: role})
+	}
+
+	for _, task := range tasks {
+		schedule.Entries = append(schedule.Entries, *entries[task.ID])
+	}
+	return schedule, ready, nil
+}
+
+// dependsOnItself reports whether id is reachable from its own
+// dependencies.
+func dependsOnItself(id string, byID map[string]*db.Task) bool {
+	seen := map[string]bool{}
+	stack := append([]string{}, byID[id].DependsOn...)
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if next == id {
+			return true
+		}
+		if seen[next] || byID[next] == nil {
+			continue
+		}
+		seen[next] = true
+		stack = append(stack, byID[next].DependsOn...)
+	}
+	return false
+}
+
+// sessionRunning reports whether a session's agent process is still
+// running and so takes up a slot.
+func sessionRunning(sess *db.Session) bool {
+	return sess.Exit == nil && isActiveSessionStatus(sess.Status)
+}
+
+// isTaskSchedulable reports whether a task's status lets the scheduler
+// start it: cancelled, blocked or otherwise parked tasks are left alone.
+func isTaskSchedulable(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "pending", "ready":
+		return true
+	default:
+		return false
+	}
+}
+
+// scheduledRole returns the role scheduled sessions of agentType start in:
+// the first worker role of the project's playbook that allows the agent, or
+// defaultScheduledRole in projects without a playbook.
+func (sm *Manager) scheduledRole(project *db.Project, agentType string) (string, error) {
+	id := strings.TrimSpace(project.Playbook)
+	if id == "" {
+		return defaultScheduledRole, nil
+	}
+	data, err := sm.readPlaybook(id)
+	if err != nil {
+		return "", fmt.Errorf("playbook %s: %w", id, err)
+	}
+	if data == nil {
+		return "", fmt.Errorf("playbook %s not found", id)
+	}
+	role, err := playbookWorkerRole(data, agentType)
+	if err != nil {
+		return "", fmt.Errorf("playbook %s: %w", id, err)
+	}
+	if role == "" {
+		return "", fmt.Errorf("playbook %s has no worker role for agent %s", id, agentType)
+	}
+	return role, nil
+}
+
+// playbookRole is the part of a playbook workflow role the scheduler reads.
+type playbookRole struct {
+	Name          string   `yaml:"name"`
+	Mode          string   `yaml:"mode"`
+	AllowedAgents []string `yaml:"allowed_agents"`
+}
+
+// playbookWorkerRole returns the first role with mode worker, in workflow
+// stage order, that allows agentType, or "" when there is none.
+func playbookWorkerRole(data []byte, agentType string) (string, error) {
+	var pb struct {
+		// A node keeps the stages in the order they are written.
+		Workflow yaml.Node `yaml:"workflow"`
+	}
+	if err := yaml.Unmarshal(data, &pb); err != nil {
+		return "", fmt.Errorf("parse playbook: %w", err)
+	}
+	stages := pb.Workflow.Content
+	for i := 1; i < len(stages); i += 2 {
+		var stage struct {
+			Roles []playbookRole `yaml:"roles"`
+		}
+		if err := stages[i].Decode(&stage); err != nil {
+			return "", fmt.Errorf("parse playbook stage %s: %w", stages[i-1].Value, err)
+		}
+		for _, role := range stage.Roles {
+			if role.Mode != "worker" {
+				continue
+			}
+			if len(role.AllowedAgents) == 0 {
+				return role.Name, nil
+			}
+			for _, allowed := range role.AllowedAgents {
+				if allowed == agentType {
+					return role.Name, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+func isTaskDone(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "done", "completed":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestSchedulerLaunchesReadyTasksWithinCapacity(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	sessionRepo := db.NewSessionRepo(database.SQL())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", MaxParallelAgents: 1}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+
+	created := time.Now().UTC().Add(-time.Hour)
+	project := &db.Project{Name: "P1", RepoPath: t.TempDir(), Status: "active", AutoSchedule: true, CreatedAt: created, UpdatedAt: created}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	// Projects are only scheduled once they opt in.
+	optedOut := &db.Project{Name: "P2", RepoPath: t.TempDir(), Status: "active", CreatedAt: created, UpdatedAt: created}
+	if err := projectRepo.Create(ctx, optedOut); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	optedOutTask := &db.Task{ProjectID: optedOut.ID, Title: "opted out", AgentType: "codex", Status: "pending", CreatedAt: created, UpdatedAt: created}
+	if err := taskRepo.Create(ctx, optedOutTask); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	ids := map[string]string{}
+	seed := func(title, agent, status string, deps ...string) {
+		t.Helper()
+		created = created.Add(time.Second)
+		task := &db.Task{ProjectID: project.ID, Title: title, AgentType: agent, Status: status, CreatedAt: created, UpdatedAt: created}
+		for _, dep := range deps {
+			if id, ok := ids[dep]; ok {
+				dep = id
+			}
+			task.DependsOn = append(task.DependsOn, dep)
+		}
+		if err := taskRepo.Create(ctx, task); err != nil {
+			t.Fatalf("create task %s: %v", title, err)
+		}
+		ids[title] = task.ID
+	}
+	seed("done", "codex", "done")
+	seed("first", "codex", "pending", "done")
+	seed("second", "codex", "pending", "first")
+	seed("parallel", "codex", "pending")
+	seed("manual", "", "pending")
+	seed("cancelled", "codex", "cancelled")
+	seed("orphan", "codex", "pending", "missing-task")
+
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sessions, err := sessionRepo.ListByTask(ctx, ids["first"])
+		if err != nil {
+			t.Fatalf("list sessions: %v", err)
+		}
+		if len(sessions) > 0 {
+			if sessions[0].AgentType != "codex" || sessions[0].Role != defaultScheduledRole {
+				t.Fatalf("launched session=%+v want codex %s", sessions[0], defaultScheduledRole)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduler did not launch the first ready task")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	schedule, err := lifecycle.ProjectSchedule(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("ProjectSchedule: %v", err)
+	}
+	if schedule.Running != 1 {
+		t.Fatalf("running=%d want 1", schedule.Running)
+	}
+	want := map[string]string{
+		"done":      ScheduleDone,
+		"first":     ScheduleRunning,
+		"second":    ScheduleWaiting,
+		"parallel":  ScheduleReady,
+		"manual":    ScheduleManual,
+		"cancelled": ScheduleManual,
+		"orphan":    ScheduleBlocked,
+	}
+	for _, entry := range schedule.Entries {
+		if entry.State != want[entry.Title] {
+			t.Fatalf("task %s state=%q want %q (reason %q)", entry.Title, entry.State, want[entry.Title], entry.Reason)
+		}
+		switch entry.Title {
+		case "second":
+			if len(entry.WaitingOn) != 1 || entry.WaitingOn[0] != ids["first"] {
+				t.Fatalf("second waiting_on=%v want [%s]", entry.WaitingOn, ids["first"])
+			}
+		case "parallel":
+			if !strings.Contains(entry.Reason, "at capacity (1/1)") {
+				t.Fatalf("parallel reason=%q want agent capacity", entry.Reason)
+			}
+		}
+	}
+	if len(schedule.Entries) != len(want) {
+		t.Fatalf("entries=%d want %d", len(schedule.Entries), len(want))
+	}
+	if sessions, err := sessionRepo.ListByTask(ctx, optedOutTask.ID); err != nil || len(sessions) != 0 {
+		t.Fatalf("opted-out project sessions=%v err=%v", sessions, err)
+	}
+
+	if _, err := lifecycle.ProjectSchedule(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("ProjectSchedule(missing) error=%v want not found", err)
+	}
+}
+
+func TestPlanProjectRespectsGlobalLimitAndCycles(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", MaxParallelAgents: 5}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	project := &db.Project{Name: "P1", RepoPath: t.TempDir(), Status: "active", AutoSchedule: true}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	var tasks []*db.Task
+	for i := 0; i < 4; i++ {
+		task := &db.Task{ProjectID: project.ID, Title: "T", AgentType: "codex", Status: "pending", CreatedAt: time.Now().UTC().Add(time.Duration(i) * time.Second)}
+		if err := taskRepo.Create(ctx, task); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+	tasks[2].DependsOn = []string{tasks[3].ID}
+	tasks[3].DependsOn = []string{tasks[2].ID}
+	for _, task := range tasks[2:] {
+		if err := taskRepo.Update(ctx, task); err != nil {
+			t.Fatalf("update task: %v", err)
+		}
+	}
+
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	lifecycle.SetMaxParallel(2)
+	schedule, ready, err := lifecycle.planProject(ctx, project, &schedulerCapacity{total: 1, byAgent: map[string]int{}})
+	if err != nil {
+		t.Fatalf("planProject: %v", err)
+	}
+	if len(ready) != 1 || ready[0].task.ID != tasks[0].ID {
+		t.Fatalf("ready=%v want only the oldest task", ready)
+	}
+	if got := schedule.Entries[1]; got.State != ScheduleReady || !strings.Contains(got.Reason, "global limit") {
+		t.Fatalf("second entry=%+v want ready at global limit", got)
+	}
+	for _, entry := range schedule.Entries[2:] {
+		if entry.State != ScheduleBlocked || entry.Reason != "dependency cycle" {
+			t.Fatalf("entry=%+v want blocked by dependency cycle", entry)
+		}
+	}
+}
+
+func TestScheduledRoleComesFromPlaybook(t *testing.T) {
+	database := openSessionTestDB(t)
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	dir := t.TempDir()
+	lifecycle.SetPlaybooksDir(dir)
+	playbook := `
+workflow:
+  plan:
+    roles:
+    - name: planner
+      mode: planner
+  build:
+    roles:
+    - name: reviewer
+      mode: reviewer
+    - name: test-writer
+      mode: worker
+      allowed_agents: [gemini-cli]
+    - name: implementer
+      mode: worker
+      allowed_agents: [codex, gemini-cli]
+`
+	if err := os.WriteFile(filepath.Join(dir, "custom.yaml"), []byte(playbook), 0o644); err != nil {
+		t.Fatalf("write playbook: %v", err)
+	}
+
+	cases := []struct {
+		playbook, agent, role, err string
+	}{
+		{"", "codex", defaultScheduledRole, ""},
+		{"custom", "codex", "implementer", ""},
+		{"custom", "gemini-cli", "test-writer", ""},
+		{"custom", "kimi-cli", "", "no worker role for agent kimi-cli"},
+		{"tdd", "codex", "test-writer", ""},
+		{"missing", "codex", "", "not found"},
+	}
+	for _, tc := range cases {
+		role, err := lifecycle.scheduledRole(&db.Project{Playbook: tc.playbook}, tc.agent)
+		if role != tc.role || (tc.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("scheduledRole(%q, %q) = %q, %v; want %q, %q", tc.playbook, tc.agent, role, err, tc.role, tc.err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+const (
+	// SessionEventTakeover is the kind of events recorded when a human
+	// takes a session over and when it goes back to automation.
+	SessionEventTakeover = "takeover"
+
+	// TakeoverOwnerTerminal owns the leases taken by attaching to or typing
+	// into a session's terminal, and by the human_takeover flag.
+	TakeoverOwnerTerminal = "terminal"
+	// DefaultTakeoverTTL is how long a lease lasts without a heartbeat.
+	DefaultTakeoverTTL = 5 * time.Minute
+	maxTakeoverTTL     = time.Hour
+
+	// takeoverSweepInterval is how often lapsed leases are handed back to
+	// automation.
+	takeoverSweepInterval = 5 * time.Second
+	// terminalHeartbeatInterval throttles the heartbeats sent for terminal
+	// activity.
+	terminalHeartbeatInterval = 30 * time.Second
+)
+
+// takeoverError rejects automation while lease is held.
+func takeoverError(sessionID string, lease *db.TakeoverLease) error {
+	return fmt.Errorf("session %s is under human takeover by %s %s; hand it back to automation first",
+		sessionID, lease.Owner, leaseUntil(lease))
+}
+
+func leaseUntil(lease *db.TakeoverLease) string {
+	if lease.ExpiresAt.IsZero() {
+		return "until handed back"
+	}
+	return "until " + lease.ExpiresAt.Format(time.RFC3339)
+}
+
+func takeoverTTL(ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl == 0:
+		return DefaultTakeoverTTL, nil
+	case ttl < 0 || ttl > maxTakeoverTTL:
+		return 0, fmt.Errorf("invalid takeover ttl %s: must be between 0 and %s", ttl, maxTakeoverTTL)
+	}
+	return ttl, nil
+}
+
+// AcquireTakeover gives owner the takeover lease of a session for ttl
+// (DefaultTakeoverTTL when zero), or renews it when owner already holds
+// it. While the lease is held, commands from the API and automation are
+// refused or, when deferred, wait.
+func (sm *Manager) AcquireTakeover(ctx context.Context, sessionID, owner string, ttl time.Duration) (*db.Session, error) {
+	owner = strings.TrimSpace(owner)
+	if owner == "" {
+		return nil, fmt.Errorf("takeover owner is required")
+	}
+	ttl, err := takeoverTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	return sm.holdTakeover(ctx, sessionID, owner, ttl)
+}
+
+// holdTakeover gives owner the takeover lease of a session for ttl, or
+// until it is handed back when ttl is zero. Renewing a lease without
+// expiry keeps it that way.
+func (sm *Manager) holdTakeover(ctx context.Context, sessionID, owner string, ttl time.Duration) (*db.Session, error) {
+	sm.takeoverMu.Lock()
+	defer sm.takeoverMu.Unlock()
+
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errNotFound("session")
+	}
+	if !isActiveSessionStatus(session.Status) || session.Exit != nil {
+		return nil, fmt.Errorf("session %s is not running", sessionID)
+	}
+	now := time.Now().UTC()
+	lease := session.Takeover
+	if lease.Active(now) && lease.Owner != owner {
+		return nil, takeoverError(sessionID, lease)
+	}
+	acquired := !lease.Active(now)
+	if acquired {
+		lease = &db.TakeoverLease{Owner: owner, AcquiredAt: now}
+	}
+	lease.HeartbeatAt = now
+	switch {
+	case ttl == 0:
+		lease.ExpiresAt = time.Time{}
+	case acquired || !lease.ExpiresAt.IsZero():
+		lease.ExpiresAt = now.Add(ttl)
+	}
+	if err := sm.sessionRepo.SetTakeoverLease(ctx, sessionID, lease); err != nil {
+		return nil, err
+	}
+	session.Takeover = lease
+	if !session.HumanAttached || session.Status != "human_takeover" {
+		session.HumanAttached = true
+		session.Status = "human_takeover"
+		if err := sm.sessionRepo.Update(ctx, session); err != nil {
+			return nil, err
+		}
+		if sm.hub != nil {
+			sm.hub.BroadcastSessionStatus(sessionID, session.Status)
+		}
+	}
+	if acquired {
+		sm.recordSessionEvent(ctx, &db.SessionEvent{
+			SessionID: sessionID,
+			Kind:      SessionEventTakeover,
+			Action:    "acquired",
+			Detail:    fmt.Sprintf("taken over by %s %s", owner, leaseUntil(lease)),
+		})
+	}
+	return session, nil
+}
+
+// HeartbeatTakeover extends owner's lease on a session by ttl
+// (DefaultTakeoverTTL when zero). A lease without expiry is left as is.
+func (sm *Manager) HeartbeatTakeover(ctx context.Context, sessionID, owner string, ttl time.Duration) (*db.Session, error) {
+	ttl, err := takeoverTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	sm.takeoverMu.Lock()
+	defer sm.takeoverMu.Unlock()
+
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errNotFound("session")
+	}
+	now := time.Now().UTC()
+	lease := session.Takeover
+	if !lease.Active(now) || lease.Owner != strings.TrimSpace(owner) {
+		return nil, fmt.Errorf("takeover lease of session %s is not held by %q", sessionID, owner)
+	}
+	lease.HeartbeatAt = now
+	if !lease.ExpiresAt.IsZero() {
+		lease.ExpiresAt = now.Add(ttl)
+	}
+	if err := sm.sessionRepo.SetTakeoverLease(ctx, sessionID, lease); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ReleaseTakeover hands a session back to automation. A non-empty owner
+// must hold the lease; an empty one releases whoever holds it. Commands
+// waiting for the takeover to end are sent afterwards.
+func (sm *Manager) ReleaseTakeover(ctx context.Context, sessionID, owner string) (*db.Session, error) {
+	sm.takeoverMu.Lock()
+	defer sm.takeoverMu.Unlock()
+
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errNotFound("session")
+	}
+	owner = strings.TrimSpace(owner)
+	lease := session.Takeover
+	if owner != "" && lease.Active(time.Now().UTC()) && lease.Owner != owner {
+		return nil, fmt.Errorf("takeover lease of session %s is not held by %q", sessionID, owner)
+	}
+	detail := "handed back to automation"
+	if owner != "" {
+		detail += " by " + owner
+	}
+	if err := sm.endTakeover(ctx, session, "released", detail); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// endTakeover clears the lease of session and returns it to automation.
+func (sm *Manager) endTakeover(ctx context.Context, session *db.Session, action, detail string) error {
+	held := session.Takeover != nil
+	if held {
+		if err := sm.sessionRepo.SetTakeoverLease(ctx, session.ID, nil); err != nil {
+			return err
+		}
+		session.Takeover = nil
+	}
+	if session.HumanAttached || session.Status == "human_takeover" {
+		session.HumanAttached = false
+		if session.Status == "human_takeover" {
+			session.Status = "idle"
+		}
+		if err := sm.sessionRepo.Update(ctx, session); err != nil {
+			return err
+		}
+		if sm.hub != nil {
+			sm.hub.BroadcastSessionStatus(session.ID, session.Status)
+		}
+	}
+	if held {
+		sm.recordSessionEvent(ctx, &db.SessionEvent{
+			SessionID: session.ID,
+			Kind:      SessionEventTakeover,
+			Action:    action,
+			Detail:    detail,
+		})
+	}
+	return nil
+}
+
+// SetTakeover sets the human_takeover flag of a session: it takes the
+// session over for its terminal until handed back, or hands it back from
+// whoever holds it.
+func (sm *Manager) SetTakeover(ctx context.Context, sessionID string, takeover bool) error {
+	var err error
+	if takeover {
+		_, err = sm.holdTakeover(ctx, sessionID, TakeoverOwnerTerminal, 0)
+	} else {
+		_, err = sm.ReleaseTakeover(ctx, sessionID, "")
+	}
+	return err
+}
+
+// NoteTerminalActivity keeps the terminal's lease on a session alive while
+// a human has its terminal open or types into it, taking the session over
+// again if the lease lapsed.
+func (sm *Manager) NoteTerminalActivity(sessionID string) {
+	if strings.TrimSpace(sessionID) == "" {
+		return
+	}
+	now := time.Now()
+	sm.takeoverMu.Lock()
+	last, ok := sm.terminalBeats[sessionID]
+	if ok && now.Sub(last) < terminalHeartbeatInterval {
+		sm.takeoverMu.Unlock()
+		return
+	}
+	sm.terminalBeats[sessionID] = now
+	sm.takeoverMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := sm.AcquireTakeover(ctx, sessionID, TakeoverOwnerTerminal, 0); err != nil {
+		slog.Debug("terminal activity did not renew takeover", "session_id", sessionID, "error", err)
+	}
+}
+
+// activeTakeover returns the lease held on a session, or nil.
+func (sm *Manager) activeTakeover(ctx context.Context, sessionID string) (*db.TakeoverLease, error) {
+	session, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || !session.Takeover.Active(time.Now().UTC()) {
+		return nil, nil
+	}
+	return session.Takeover, nil
+}
+
+// waitForHandback blocks until no lease is held on a session.
+func (sm *Manager) waitForHandback(ctx context.Context, sessionID string) error {
+	for {
+		lease, err := sm.activeTakeover(ctx, sessionID)
+		if err != nil || lease == nil {
+			return err
+		}
+		if err := sleepContext(ctx, commandWaitPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// runTakeoverSweeper hands sessions whose lease lapsed back to automation
+// until ctx is done.
+func (sm *Manager) runTakeoverSweeper(ctx context.Context) {
+	ticker := time.NewTicker(takeoverSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sm.sweepTakeovers(ctx)
+	}
+}
+
+func (sm *Manager) sweepTakeovers(ctx context.Context) {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		slog.Warn("takeover sweeper failed to list sessions", "error", err)
+		return
+	}
+	for _, sess := range active {
+		if sess.Takeover == nil {
+			continue
+		}
+		sm.takeoverMu.Lock()
+		// Reread under the lock: the owner may have just heartbeated.
+		current, err := sm.sessionRepo.Get(ctx, sess.ID)
+		if err == nil && current != nil && current.Takeover != nil && !current.Takeover.Active(time.Now().UTC()) {
+			detail := fmt.Sprintf("lease of %s expired at %s", current.Takeover.Owner, current.Takeover.ExpiresAt.Format(time.RFC3339))
+			err = sm.endTakeover(ctx, current, "expired", detail)
+		}
+		sm.takeoverMu.Unlock()
+		if err != nil {
+			slog.Warn("failed to expire takeover lease", "session_id", sess.ID, "error", err)
+		}
+	}
+	sm.takeoverMu.Lock()
+	for id, at := range sm.terminalBeats {
+		if time.Since(at) > terminalHeartbeatInterval {
+			delete(sm.terminalBeats, id)
+		}
+	}
+	sm.takeoverMu.Unlock()
+}
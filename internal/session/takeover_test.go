@@ -0,0 +1,197 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestTakeoverLeaseHoldsBackAutomation(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	commandRepo := db.NewSessionCommandRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	held, err := lifecycle.AcquireTakeover(ctx, sess.ID, "alice", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireTakeover: %v", err)
+	}
+	if held.Status != "human_takeover" || !held.HumanAttached || held.Takeover == nil || held.Takeover.Owner != "alice" {
+		t.Fatalf("session=%+v", held)
+	}
+	if _, err := lifecycle.AcquireTakeover(ctx, sess.ID, "bob", time.Minute); err == nil || !strings.Contains(err.Error(), "under human takeover by alice") {
+		t.Fatalf("second owner error=%v", err)
+	}
+	if _, err := lifecycle.HeartbeatTakeover(ctx, sess.ID, "bob", 0); err == nil {
+		t.Fatalf("expected heartbeat by a non-holder to fail")
+	}
+	if _, err := lifecycle.HeartbeatTakeover(ctx, sess.ID, "alice", 2*time.Minute); err != nil {
+		t.Fatalf("HeartbeatTakeover: %v", err)
+	}
+
+	// The lease holder shows up in listings.
+	listed, err := sessionRepo.List(ctx, db.SessionFilter{TaskID: sess.TaskID})
+	if err != nil || len(listed) != 1 || listed[0].Takeover == nil || listed[0].Takeover.Owner != "alice" ||
+		listed[0].Takeover.ExpiresAt.Before(time.Now().Add(time.Minute)) {
+		t.Fatalf("listed=%+v err=%v", listed, err)
+	}
+
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "make test\n"}); err == nil || !strings.Contains(err.Error(), "hand it back to automation") {
+		t.Fatalf("EnqueueCommand during takeover error=%v", err)
+	}
+	// A deferred command waits for the human to hand the session back.
+	pending, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "later\n", NotBefore: time.Now().Add(50 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("EnqueueCommand deferred: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if got, _ := commandRepo.Get(ctx, pending.ID); got.Status != "pending" || len(backend.inputs) != 0 {
+		t.Fatalf("command=%+v inputs=%v while taken over", got, backend.inputs)
+	}
+
+	if _, err := lifecycle.ReleaseTakeover(ctx, sess.ID, "bob"); err == nil {
+		t.Fatalf("expected release by a non-holder to fail")
+	}
+	released, err := lifecycle.ReleaseTakeover(ctx, sess.ID, "alice")
+	if err != nil {
+		t.Fatalf("ReleaseTakeover: %v", err)
+	}
+	if released.Takeover != nil || released.HumanAttached || released.Status != "idle" {
+		t.Fatalf("released=%+v", released)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		got, _ := commandRepo.Get(ctx, pending.ID)
+		if got.Status == "completed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deferred command status=%s after handback", got.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	events, err := db.NewSessionEventRepo(database.SQL()).ListBySession(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var actions []string
+	for _, event := range events {
+		if event.Kind == SessionEventTakeover {
+			actions = append(actions, event.Action)
+		}
+	}
+	if strings.Join(actions, ",") != "acquired,released" {
+		t.Fatalf("takeover events=%v", actions)
+	}
+}
+
+func TestTakeoverLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+
+	if err := lifecycle.SetTakeover(ctx, sess.ID, true); err != nil {
+		t.Fatalf("SetTakeover: %v", err)
+	}
+	// Lapse the terminal's lease.
+	lease := &db.TakeoverLease{Owner: TakeoverOwnerTerminal, AcquiredAt: time.Now().Add(-time.Hour), HeartbeatAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := sessionRepo.SetTakeoverLease(ctx, sess.ID, lease); err != nil {
+		t.Fatalf("SetTakeoverLease: %v", err)
+	}
+	// A lapsed lease no longer holds back automation.
+	if lease, err := lifecycle.activeTakeover(ctx, sess.ID); err != nil || lease != nil {
+		t.Fatalf("active lease=%+v err=%v", lease, err)
+	}
+
+	lifecycle.sweepTakeovers(ctx)
+	got, err := sessionRepo.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Takeover != nil || got.HumanAttached || got.Status != "idle" {
+		t.Fatalf("session after sweep=%+v", got)
+	}
+}
+
+func TestLegacyTakeoverHoldsUntilHandedBack(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+
+	if err := lifecycle.SetTakeover(ctx, sess.ID, true); err != nil {
+		t.Fatalf("SetTakeover: %v", err)
+	}
+	// Terminal activity renews the hold without giving it an expiry.
+	lifecycle.NoteTerminalActivity(sess.ID)
+	lifecycle.sweepTakeovers(ctx)
+	got, err := sessionRepo.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Takeover == nil || got.Takeover.Owner != TakeoverOwnerTerminal || !got.Takeover.ExpiresAt.IsZero() || got.Status != "human_takeover" {
+		t.Fatalf("session after sweep=%+v lease=%+v", got, got.Takeover)
+	}
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "ls\n"}); err == nil || !strings.Contains(err.Error(), "until handed back") {
+		t.Fatalf("EnqueueCommand during takeover error=%v", err)
+	}
+
+	if err := lifecycle.SetTakeover(ctx, sess.ID, false); err != nil {
+		t.Fatalf("SetTakeover(false): %v", err)
+	}
+	if got, _ := sessionRepo.Get(ctx, sess.ID); got.Takeover != nil || got.Status != "idle" {
+		t.Fatalf("session after handback=%+v", got)
+	}
+
+	// An attached terminal's lease is renewed by its activity.
+	if _, err := lifecycle.AcquireTakeover(ctx, sess.ID, TakeoverOwnerTerminal, 0); err != nil {
+		t.Fatalf("AcquireTakeover: %v", err)
+	}
+	lease := &db.TakeoverLease{Owner: TakeoverOwnerTerminal, AcquiredAt: time.Now().Add(-time.Hour), HeartbeatAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(time.Second)}
+	if err := sessionRepo.SetTakeoverLease(ctx, sess.ID, lease); err != nil {
+		t.Fatalf("SetTakeoverLease: %v", err)
+	}
+	delete(lifecycle.terminalBeats, sess.ID) // past the throttle
+	lifecycle.NoteTerminalActivity(sess.ID)
+	if got, _ := sessionRepo.Get(ctx, sess.ID); got.Takeover == nil || got.Takeover.ExpiresAt.Before(time.Now().Add(time.Minute)) {
+		t.Fatalf("lease after activity=%+v", got.Takeover)
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+)
+
+const (
+	transcriptFlushInterval = 500 * time.Millisecond
+	transcriptBatchSize     = 256
+	transcriptQueueLen      = 4096
+)
+
+// recordTranscript queues a parsed output line for the session's durable
+// transcript. It never blocks the parser: lines are dropped, and counted,
+// when the writer falls behind.
+func (sm *Manager) recordTranscript(sessionID, text, class string, ts time.Time) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	entry := &db.TranscriptEntry{
+		SessionID: sessionID,
+		Text:      text,
+		Class:     strings.ToLower(strings.TrimSpace(class)),
+		CreatedAt: ts.UTC(),
+	}
+	select {
+	case sm.transcriptQ <- entry:
+	default:
+		sm.transcriptDropped.Add(1)
+	}
+}
+
+// runTranscriptWriter appends queued transcript lines in batches until ctx
+// is cancelled, then writes what is left.
+func (sm *Manager) runTranscriptWriter(ctx context.Context) {
+	defer sm.transcriptWG.Done()
+	ticker := time.NewTicker(transcriptFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*db.TranscriptEntry, 0, transcriptBatchSize)
+	flush := func() {
+		if dropped := sm.transcriptDropped.Swap(0); dropped > 0 {
+			slog.Warn("transcript writer fell behind, lines dropped", "lines", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := sm.transcriptRepo.Append(context.Background(), batch); err != nil {
+			slog.Warn("failed to persist session transcript", "lines", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-sm.transcriptQ:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		case entry := <-sm.transcriptQ:
+			batch = append(batch, entry)
+			if len(batch) >= transcriptBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// ListTranscript returns a session's durable transcript after the given
+// sequence number, oldest first.
+func (sm *Manager) ListTranscript(ctx context.Context, sessionID string, afterSeq int64, limit int) ([]*db.TranscriptEntry, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errNotFound("session")
+	}
+	return sm.transcriptRepo.ListBySession(ctx, sessionID, afterSeq, limit)
+}
+
+// SearchTranscripts finds transcript lines across sessions.
+func (sm *Manager) SearchTranscripts(ctx context.Context, filter db.TranscriptFilter) ([]*db.TranscriptHit, error) {
+	if strings.TrimSpace(filter.Query) == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+	return sm.transcriptRepo.Search(ctx, filter)
+}
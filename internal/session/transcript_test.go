@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestTranscriptSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex"}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for i, line := range []string{"$ go run ./cmd/migrate", "applying 0012_add_index", "Error: migration 0012 failed: no such table: users", "  "} {
+		lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, line, "normal", now.Add(time.Duration(i)*time.Millisecond))
+	}
+	lifecycle.ObserveParsedOutput("other-terminal", "other-terminal", "migration from another terminal", "normal", now)
+	lifecycle.Close()
+
+	restarted := NewManager(database.SQL(), backend, reg, nil)
+	if err := restarted.Start(ctx); err != nil {
+		t.Fatalf("restart lifecycle: %v", err)
+	}
+	defer restarted.Close()
+
+	hits, err := restarted.SearchTranscripts(ctx, db.TranscriptFilter{Query: "migration failed", Context: 1, TaskID: sess.TaskID})
+	if err != nil {
+		t.Fatalf("SearchTranscripts: %v", err)
+	}
+	if len(hits) != 1 || hits[0].SessionID != sess.ID || hits[0].Seq != 3 {
+		t.Fatalf("hits=%+v want the migration error", hits)
+	}
+	if len(hits[0].Before) != 1 || hits[0].Before[0].Text != "applying 0012_add_index" || len(hits[0].After) != 0 {
+		t.Fatalf("context before=%+v after=%+v", hits[0].Before, hits[0].After)
+	}
+	if _, err := restarted.SearchTranscripts(ctx, db.TranscriptFilter{}); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Fatalf("empty search error=%v want required", err)
+	}
+
+	entries, err := restarted.ListTranscript(ctx, sess.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("ListTranscript: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Text != "$ go run ./cmd/migrate" {
+		t.Fatalf("entries=%+v want 3 non-blank lines", entries)
+	}
+	if _, err := restarted.ListTranscript(ctx, "missing", 0, 0); !IsNotFound(err) {
+		t.Fatalf("ListTranscript(missing) error=%v want not found", err)
+	}
+}
@@ -0,0 +1,516 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/usage"
+)
+
+const (
+	UsageSourceOutput = "output"
+	UsageSourceLog    = "log"
+
+	BudgetWarn  = "warn"
+	BudgetPause = "pause"
+
+	// SessionEventBudget is the kind of events recorded on sessions when a
+	// budget covering them is exceeded.
+	SessionEventBudget = "budget"
+
+	usagePollInterval = 15 * time.Second
+)
+
+// usageMeter reads the usage of one session. The task, requirement and
+// project are resolved once, when the session is first metered.
+type usageMeter struct {
+	mu            sync.Mutex
+	agentType     string
+	taskID        string
+	requirementID string
+	projectID     string
+	output        *usage.Meter
+	log           *usage.LogTailer
+}
+
+// meterFor returns the usage meter of a session, or nil when its agent
+// reports no usage.
+func (sm *Manager) meterFor(ctx context.Context, sessionID string) *usageMeter {
+	sm.usageMu.Lock()
+	defer sm.usageMu.Unlock()
+	if m, ok := sm.meters[sessionID]; ok {
+		return m
+	}
+	m, err := sm.newUsageMeter(ctx, sessionID)
+	if err != nil {
+		// Not retried for every line; the meter is set up again once the
+		// session stops running and is pruned.
+		slog.Warn("failed to set up usage metering", "session_id", sessionID, "error", err)
+	}
+	sm.meters[sessionID] = m
+	return m
+}
+
+func (sm *Manager) newUsageMeter(ctx context.Context, sessionID string) (*usageMeter, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errNotFound("session")
+	}
+	agent := sm.registry.Get(sess.AgentType)
+	if agent == nil || agent.Usage.IsZero() {
+		return nil, nil
+	}
+	m := &usageMeter{agentType: sess.AgentType, taskID: sess.TaskID}
+	if sess.TaskID != "" {
+		if task, err := sm.taskRepo.Get(ctx, sess.TaskID); err == nil && task != nil {
+			m.requirementID = task.RequirementID
+			m.projectID = task.ProjectID
+		}
+	}
+	if len(agent.Usage.Patterns) > 0 {
+		counted, err := sm.usageRepo.Totals(ctx, db.UsageFilter{SessionID: sessionID}, UsageSourceOutput)
+		if err != nil {
+			return nil, err
+		}
+		if m.output, err = usage.NewMeter(agent.Usage, usageFromTotals(counted)); err != nil {
+			return nil, err
+		}
+	}
+	if agent.Usage.Log != nil {
+		counted, err := sm.usageRepo.Totals(ctx, db.UsageFilter{SessionID: sessionID}, UsageSourceLog)
+		if err != nil {
+			return nil, err
+		}
+		// After a restart the log offsets are gone; only count what is
+		// appended from now on rather than counting entries twice.
+		since := sess.CreatedAt
+		if counted != (db.UsageTotals{}) {
+			since = time.Now().UTC()
+		}
+		m.log = usage.NewLogTailer(agent.Usage, sm.resolveWorkDirForSession(ctx, sess), since)
+	}
+	return m, nil
+}
+
+func usageFromTotals(t db.UsageTotals) usage.Usage {
+	return usage.Usage{InputTokens: t.InputTokens, OutputTokens: t.OutputTokens, TotalTokens: t.TotalTokens, CostUSD: t.CostUSD}
+}
+
+// meterOutput records the usage an output line of a session reports.
+func (sm *Manager) meterOutput(sessionID, text string) {
+	m := sm.meterFor(context.Background(), sessionID)
+	if m == nil || m.output == nil {
+		return
+	}
+	m.mu.Lock()
+	u, ok := m.output.Observe(text)
+	m.mu.Unlock()
+	if ok {
+		sm.recordUsage(context.Background(), sessionID, m, UsageSourceOutput, u)
+	}
+}
+
+// runUsagePoller reads the usage logs of running sessions until ctx is
+// done.
+func (sm *Manager) runUsagePoller(ctx context.Context) {
+	ticker := time.NewTicker(usagePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sm.usagePollPass(ctx)
+	}
+}
+
+func (sm *Manager) usagePollPass(ctx context.Context) {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		slog.Warn("usage poller failed to list sessions", "error", err)
+		return
+	}
+	running := make(map[string]bool, len(active))
+	for _, sess := range active {
+		if !sessionRunning(sess) {
+			continue
+		}
+		running[sess.ID] = true
+		m := sm.meterFor(ctx, sess.ID)
+		if m == nil || m.log == nil {
+			continue
+		}
+		m.mu.Lock()
+		u, err := m.log.Poll()
+		m.mu.Unlock()
+		if err != nil {
+			slog.Warn("failed to read usage log", "session_id", sess.ID, "error", err)
+		}
+		if !u.IsZero() {
+			sm.recordUsage(ctx, sess.ID, m, UsageSourceLog, u)
+		}
+	}
+
+	sm.usageMu.Lock()
+	for id := range sm.meters {
+		if !running[id] {
+			delete(sm.meters, id)
+		}
+	}
+	sm.usageMu.Unlock()
+}
+
+func (sm *Manager) recordUsage(ctx context.Context, sessionID string, m *usageMeter, source string, u usage.Usage) {
+	record := &db.UsageRecord{
+		SessionID:     sessionID,
+		TaskID:        m.taskID,
+		RequirementID: m.requirementID,
+		ProjectID:     m.projectID,
+		AgentType:     m.agentType,
+		Source:        source,
+		InputTokens:   u.InputTokens,
+		OutputTokens:  u.OutputTokens,
+		TotalTokens:   u.TotalTokens,
+		CostUSD:       u.CostUSD,
+	}
+	if err := sm.usageRepo.Create(ctx, record); err != nil {
+		slog.Warn("failed to record usage", "session_id", sessionID, "error", err)
+		return
+	}
+	if m.projectID != "" {
+		sm.enforceBudgets(ctx, m.projectID, sessionID)
+	}
+}
+
+// UsageReport is the usage of a project broken down by requirement, task,
+// session and agent, with the state of its budgets.
+type UsageReport struct {
+	Total        db.UsageTotals   `json:"total"`
+	Budgets      []*BudgetStatus  `json:"budgets"`
+	Requirements []*db.UsageGroup `json:"requirements"`
+	Tasks        []*db.UsageGroup `json:"tasks"`
+	Sessions     []*db.UsageGroup `json:"sessions"`
+	Agents       []*db.UsageGroup `json:"agents"`
+}
+
+// BudgetStatus is a budget with what has been spent against it.
+type BudgetStatus struct {
+	*db.Budget
+	Spent    db.UsageTotals `json:"spent"`
+	Exceeded bool           `json:"exceeded"`
+}
+
+// ProjectUsage reports the usage of a project.
+func (sm *Manager) ProjectUsage(ctx context.Context, projectID string) (*UsageReport, error) {
+	project, err := sm.projectRepo.Get(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, errNotFound("project")
+	}
+	filter := db.UsageFilter{ProjectID: projectID}
+	report := &UsageReport{}
+	if report.Total, err = sm.usageRepo.Totals(ctx, filter, ""); err != nil {
+		return nil, err
+	}
+	if report.Budgets, err = sm.budgetStatuses(ctx, projectID); err != nil {
+		return nil, err
+	}
+	for column, dst := range map[string]*[]*db.UsageGroup{
+		"requirement_id": &report.Requirements,
+		"task_id":        &report.Tasks,
+		"session_id":     &report.Sessions,
+		"agent_type":     &report.Agents,
+	} {
+		if *dst, err = sm.usageRepo.GroupBy(ctx, filter, column); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// SessionUsage sums the usage of a session.
+func (sm *Manager) SessionUsage(ctx context.Context, sessionID string) (db.UsageTotals, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return db.UsageTotals{}, err
+	}
+	if sess == nil {
+		return db.UsageTotals{}, errNotFound("session")
+	}
+	return sm.usageRepo.Totals(ctx, db.UsageFilter{SessionID: sessionID}, "")
+}
+
+// SetBudget creates or replaces the budget of a project or of one of its
+// requirements. Sessions paused by budgets that are no longer exceeded are
+// let go; budgets still exceeded act again.
+func (sm *Manager) SetBudget(ctx context.Context, budget *db.Budget) (*BudgetStatus, error) {
+	if budget == nil {
+		return nil, fmt.Errorf("budget is required")
+	}
+	budget.Action = strings.ToLower(strings.TrimSpace(budget.Action))
+	if budget.Action == "" {
+		budget.Action = BudgetWarn
+	}
+	if budget.Action != BudgetWarn && budget.Action != BudgetPause {
+		return nil, fmt.Errorf("invalid budget action %q: must be %s or %s", budget.Action, BudgetWarn, BudgetPause)
+	}
+	if budget.MaxCostUSD < 0 || budget.MaxTokens < 0 {
+		return nil, fmt.Errorf("invalid budget: maximums must not be negative")
+	}
+	if budget.MaxCostUSD == 0 && budget.MaxTokens == 0 {
+		return nil, fmt.Errorf("max_cost_usd or max_tokens is required")
+	}
+	project, err := sm.projectRepo.Get(ctx, budget.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, errNotFound("project")
+	}
+	if err := sm.budgetRepo.Upsert(ctx, budget); err != nil {
+		return nil, err
+	}
+	sm.releasePausedSessions(ctx, budget.ProjectID)
+	sm.enforceBudgets(ctx, budget.ProjectID, "")
+
+	statuses, err := sm.budgetStatuses(ctx, budget.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.ID == budget.ID {
+			return status, nil
+		}
+	}
+	return nil, errNotFound("budget")
+}
+
+// DeleteBudget removes a budget, letting go of the sessions it paused.
+func (sm *Manager) DeleteBudget(ctx context.Context, projectID, budgetID string) error {
+	budget, err := sm.budgetRepo.Get(ctx, budgetID)
+	if err != nil {
+		return err
+	}
+	if budget == nil || budget.ProjectID != projectID {
+		return errNotFound("budget")
+	}
+	if err := sm.budgetRepo.Delete(ctx, budgetID); err != nil {
+		return err
+	}
+	sm.releasePausedSessions(ctx, projectID)
+	return nil
+}
+
+// ListBudgets returns a project's budgets with what has been spent.
+func (sm *Manager) ListBudgets(ctx context.Context, projectID string) ([]*BudgetStatus, error) {
+	project, err := sm.projectRepo.Get(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, errNotFound("project")
+	}
+	return sm.budgetStatuses(ctx, projectID)
+}
+
+func (sm *Manager) budgetStatuses(ctx context.Context, projectID string) ([]*BudgetStatus, error) {
+	budgets, err := sm.budgetRepo.ListByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		spent, err := sm.usageRepo.Totals(ctx, db.UsageFilter{ProjectID: projectID, RequirementID: budget.RequirementID}, "")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &BudgetStatus{Budget: budget, Spent: spent, Exceeded: budgetExceeded(budget, spent)})
+	}
+	return out, nil
+}
+
+func budgetExceeded(budget *db.Budget, spent db.UsageTotals) bool {
+	return (budget.MaxCostUSD > 0 && spent.CostUSD >= budget.MaxCostUSD) ||
+		(budget.MaxTokens > 0 && spent.TotalTokens >= budget.MaxTokens)
+}
+
+// enforceBudgets acts on the budgets of a project that are exceeded for the
+// first time. sessionID is the session whose usage was just recorded, if
+// any.
+func (sm *Manager) enforceBudgets(ctx context.Context, projectID, sessionID string) {
+	statuses, err := sm.budgetStatuses(ctx, projectID)
+	if err != nil {
+		slog.Warn("failed to check budgets", "project_id", projectID, "error", err)
+		return
+	}
+	for _, status := range statuses {
+		if !status.Exceeded || !status.ExceededAt.IsZero() {
+			continue
+		}
+		marked, err := sm.budgetRepo.MarkExceeded(ctx, status.ID, time.Now().UTC())
+		if err != nil {
+			slog.Warn("failed to mark budget exceeded", "budget_id", status.ID, "error", err)
+			continue
+		}
+		if marked {
+			sm.applyBudgetAction(ctx, status, sessionID)
+		}
+	}
+}
+
+func (sm *Manager) applyBudgetAction(ctx context.Context, status *BudgetStatus, sessionID string) {
+	scope := "project"
+	if status.RequirementID != "" {
+		scope = "requirement"
+	}
+	detail := describeBudget(status)
+	slog.Warn("budget exceeded", "project_id", status.ProjectID, "requirement_id", status.RequirementID, "action", status.Action, "detail", detail)
+	if sm.hub != nil {
+		sm.hub.BroadcastProjectEvent(status.ProjectID, "budget_exceeded", map[string]any{
+			"budget_id":      status.ID,
+			"requirement_id": status.RequirementID,
+			"action":         status.Action,
+			"spent":          status.Spent,
+			"detail":         detail,
+		})
+	}
+
+	if status.Action != BudgetPause {
+		if sessionID != "" {
+			sm.recordSessionEvent(ctx, &db.SessionEvent{SessionID: sessionID, Kind: SessionEventBudget, Rule: scope, Action: BudgetWarn, Detail: detail})
+		}
+		return
+	}
+	for _, sess := range sm.sessionsInBudget(ctx, status.Budget) {
+		if sess.Status == "paused" {
+			continue
+		}
+		if err := sm.pauseSession(ctx, sess); err != nil {
+			slog.Warn("failed to pause session over budget", "session_id", sess.ID, "error", err)
+			continue
+		}
+		sm.recordSessionEvent(ctx, &db.SessionEvent{SessionID: sess.ID, Kind: SessionEventBudget, Rule: scope, Action: BudgetPause, Detail: detail})
+	}
+}
+
+func describeBudget(status *BudgetStatus) string {
+	scope := "project budget"
+	if status.RequirementID != "" {
+		scope = "requirement " + status.RequirementID + " budget"
+	}
+	var parts []string
+	if status.MaxCostUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f of $%.2f", status.Spent.CostUSD, status.MaxCostUSD))
+	}
+	if status.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d tokens", status.Spent.TotalTokens, status.MaxTokens))
+	}
+	return scope + " exceeded: " + strings.Join(parts, ", ")
+}
+
+// sessionsInBudget returns the running sessions whose usage counts against
+// budget.
+func (sm *Manager) sessionsInBudget(ctx context.Context, budget *db.Budget) []*db.Session {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		slog.Warn("failed to list sessions for budget", "budget_id", budget.ID, "error", err)
+		return nil
+	}
+	var out []*db.Session
+	for _, sess := range active {
+		if !sessionRunning(sess) || sess.TaskID == "" {
+			continue
+		}
+		task, err := sm.taskRepo.Get(ctx, sess.TaskID)
+		if err != nil || task == nil || task.ProjectID != budget.ProjectID {
+			continue
+		}
+		if budget.RequirementID != "" && task.RequirementID != budget.RequirementID {
+			continue
+		}
+		out = append(out, sess)
+	}
+	return out
+}
+
+// pauseSession stops an agent from spending more: the session is marked
+// paused, which refuses further input, and the agent is interrupted.
+func (sm *Manager) pauseSession(ctx context.Context, sess *db.Session) error {
+	sess.Status = "paused"
+	if err := sm.sessionRepo.Update(ctx, sess); err != nil {
+		return err
+	}
+	if sm.hub != nil {
+		sm.hub.BroadcastSessionStatus(sess.ID, sess.Status)
+	}
+	id := sess.ID
+	sm.goBackground(func(ctx context.Context) {
+		if _, err := sm.EnqueueCommand(ctx, id, CommandRequest{Op: CommandOpInterrupt}); err != nil {
+			slog.Warn("failed to interrupt paused session", "session_id", id, "error", err)
+		}
+	})
+	return nil
+}
+
+// releasePausedSessions resumes the paused sessions of a project that no
+// exceeded pause budget covers any more.
+func (sm *Manager) releasePausedSessions(ctx context.Context, projectID string) {
+	statuses, err := sm.budgetStatuses(ctx, projectID)
+	if err != nil {
+		slog.Warn("failed to check budgets", "project_id", projectID, "error", err)
+		return
+	}
+	held := make(map[string]bool)
+	for _, status := range statuses {
+		if status.Action != BudgetPause || !status.Exceeded {
+			continue
+		}
+		for _, sess := range sm.sessionsInBudget(ctx, status.Budget) {
+			held[sess.ID] = true
+		}
+	}
+	for _, sess := range sm.sessionsInBudget(ctx, &db.Budget{ProjectID: projectID}) {
+		if sess.Status != "paused" || held[sess.ID] {
+			continue
+		}
+		sess.Status = "idle"
+		if err := sm.sessionRepo.Update(ctx, sess); err != nil {
+			slog.Warn("failed to release paused session", "session_id", sess.ID, "error", err)
+			continue
+		}
+		if sm.hub != nil {
+			sm.hub.BroadcastSessionStatus(sess.ID, sess.Status)
+		}
+	}
+}
+
+// budgetBlocks returns an error when an exceeded pause budget covers a
+// task, so that no new session is started for it.
+func (sm *Manager) budgetBlocks(ctx context.Context, task *db.Task) error {
+	statuses, err := sm.budgetStatuses(ctx, task.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Action != BudgetPause || !status.Exceeded {
+			continue
+		}
+		if status.RequirementID != "" && status.RequirementID != task.RequirementID {
+			continue
+		}
+		return errors.New(describeBudget(status))
+	}
+	return nil
+}
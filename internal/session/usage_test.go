@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+	"github.com/user/agenterm/internal/usage"
+)
+
+func TestUsageIsMeteredAndBudgetsPauseSessions(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC())
+	task, err := taskRepo.Get(ctx, sess.TaskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", Usage: usage.Config{
+		Patterns: []usage.Pattern{
+			{Regex: `Total cost: (?P<cost>\$[\d.]+)`, Cumulative: true},
+			{Regex: `tokens: (?P<input>\d+) in, (?P<output>\d+) out`},
+		},
+		InputUSDPerMTok:  2,
+		OutputUSDPerMTok: 10,
+	}}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	warn, err := lifecycle.SetBudget(ctx, &db.Budget{ProjectID: task.ProjectID, MaxTokens: 1000})
+	if err != nil {
+		t.Fatalf("SetBudget(warn): %v", err)
+	}
+	if warn.Action != BudgetWarn || warn.Exceeded {
+		t.Fatalf("budget=%+v want unexceeded warn", warn)
+	}
+	if _, err := lifecycle.SetBudget(ctx, &db.Budget{ProjectID: task.ProjectID, RequirementID: "r1", MaxCostUSD: 1, Action: "stop"}); err == nil || !strings.Contains(err.Error(), "invalid budget action") {
+		t.Fatalf("SetBudget(stop) error=%v want invalid action", err)
+	}
+
+	now := time.Now().UTC()
+	for i, line := range []string{"tokens: 1000 in, 100 out", "Total cost: $0.20", "Total cost: $0.50", "unrelated"} {
+		lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, line, "normal", now.Add(time.Duration(i)*time.Millisecond))
+	}
+	totals, err := lifecycle.SessionUsage(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("SessionUsage: %v", err)
+	}
+	// 1000*2/1e6 + 100*10/1e6 = $0.003 from tokens, $0.50 from the total.
+	if totals.TotalTokens != 1100 || math.Abs(totals.CostUSD-0.503) > 1e-9 {
+		t.Fatalf("totals=%+v want 1100 tokens and $0.503", totals)
+	}
+	events, err := lifecycle.ListSessionEvents(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("ListSessionEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Kind != SessionEventBudget || events[0].Action != BudgetWarn {
+		t.Fatalf("events=%+v want one budget warning", events)
+	}
+
+	pause, err := lifecycle.SetBudget(ctx, &db.Budget{ProjectID: task.ProjectID, MaxCostUSD: 0.25, Action: BudgetPause})
+	if err != nil {
+		t.Fatalf("SetBudget(pause): %v", err)
+	}
+	if !pause.Exceeded || pause.ExceededAt.IsZero() || pause.ID != warn.ID {
+		t.Fatalf("budget=%+v want the project budget replaced and exceeded", pause)
+	}
+	got, err := sessionRepo.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Status != "paused" {
+		t.Fatalf("status=%q want paused", got.Status)
+	}
+	if _, err := lifecycle.EnqueueCommand(ctx, sess.ID, CommandRequest{Op: CommandOpSendText, Text: "continue\n"}); err == nil || !strings.Contains(err.Error(), "is paused") {
+		t.Fatalf("EnqueueCommand error=%v want paused", err)
+	}
+	if _, err := lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: task.ID, AgentType: "codex", Role: "coder"}); err == nil || !strings.Contains(err.Error(), "budget exceeded") {
+		t.Fatalf("CreateSession error=%v want budget exceeded", err)
+	}
+
+	if _, err := lifecycle.SetBudget(ctx, &db.Budget{ProjectID: task.ProjectID, MaxCostUSD: 5, Action: BudgetPause}); err != nil {
+		t.Fatalf("SetBudget(raise): %v", err)
+	}
+	if got, _ := sessionRepo.Get(ctx, sess.ID); got.Status != "idle" {
+		t.Fatalf("status=%q want idle after raising the budget", got.Status)
+	}
+
+	report, err := lifecycle.ProjectUsage(ctx, task.ProjectID)
+	if err != nil {
+		t.Fatalf("ProjectUsage: %v", err)
+	}
+	if report.Total != totals || len(report.Tasks) != 1 || report.Tasks[0].ID != task.ID || len(report.Agents) != 1 || len(report.Requirements) != 0 || len(report.Budgets) != 1 {
+		t.Fatalf("report=%+v", report)
+	}
+}
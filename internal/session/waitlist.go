@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/hub"
+	"github.com/user/agenterm/internal/registry"
+)
+
+// WaitlistedError reports that CreateSession queued the request because the
+// agent was at capacity.
+type WaitlistedError struct {
+	Entry *db.WaitlistEntry
+	// Position is the 1-based place of Entry on the agent's waitlist.
+	Position int
+}
+
+func (e *WaitlistedError) Error() string {
+	return fmt.Sprintf("agent %q at capacity: queued at position %d", e.Entry.AgentType, e.Position)
+}
+
+// agentCapacity is the number of sessions an agent may run at once.
+func agentCapacity(agent *registry.AgentConfig) int {
+	if agent.MaxParallelAgents <= 0 {
+		return 1
+	}
+	return agent.MaxParallelAgents
+}
+
+// reserveSlot returns nil when req may start now. Otherwise it queues req,
+// or finds its existing entry, and returns a *WaitlistedError. The caller
+// holds createMu.
+func (sm *Manager) reserveSlot(ctx context.Context, req CreateSessionRequest, agent *registry.AgentConfig, replacing *db.Session) error {
+	waiting, err := sm.waitlistRepo.List(ctx, req.AgentType)
+	if err != nil {
+		return err
+	}
+	if len(waiting) == 0 {
+		capacity, err := sm.schedulerCapacity(ctx)
+		if err != nil {
+			return err
+		}
+		busy := capacity.byAgent[req.AgentType]
+		if replacing != nil && replacing.AgentType == req.AgentType && sessionRunning(replacing) {
+			busy--
+		}
+		if busy < agentCapacity(agent) {
+			return nil
+		}
+	}
+
+	entry, err := sm.waitlistRepo.Find(ctx, req.TaskID, req.AgentType, req.Role)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &db.WaitlistEntry{TaskID: req.TaskID, AgentType: req.AgentType, Role: req.Role, Priority: req.Priority}
+		if err := sm.waitlistRepo.Create(ctx, entry); err != nil {
+			return err
+		}
+		slog.Info("session waitlisted", "task_id", req.TaskID, "agent", req.AgentType, "priority", req.Priority)
+		if waiting, err = sm.waitlistRepo.List(ctx, req.AgentType); err != nil {
+			return err
+		}
+	}
+	position := 0
+	for i, w := range waiting {
+		if w.ID == entry.ID {
+			position = i + 1
+			break
+		}
+	}
+	return &WaitlistedError{Entry: entry, Position: position}
+}
+
+// Waitlist returns an agent's queued session requests in start order.
+func (sm *Manager) Waitlist(ctx context.Context, agentType string) ([]*db.WaitlistEntry, error) {
+	entries, err := sm.waitlistRepo.List(ctx, agentType)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 && sm.registry.Get(agentType) == nil {
+		return nil, errNotFound("agent")
+	}
+	return entries, nil
+}
+
+// CancelWaitlist removes one entry from an agent's waitlist, or all of them
+// when entryID is empty, and returns the number removed.
+func (sm *Manager) CancelWaitlist(ctx context.Context, agentType, entryID string) (int, error) {
+	entries, err := sm.Waitlist(ctx, agentType)
+	if err != nil {
+		return 0, err
+	}
+	if entryID == "" {
+		return sm.waitlistRepo.DeleteByAgent(ctx, agentType)
+	}
+	for _, entry := range entries {
+		if entry.ID == entryID {
+			if _, err := sm.waitlistRepo.Delete(ctx, entryID); err != nil {
+				return 0, err
+			}
+			return 1, nil
+		}
+	}
+	return 0, errNotFound("waitlist entry")
+}
+
+// drainWaitlist starts queued sessions, highest priority first, while their
+// agents have free slots. An entry whose start fails stays queued and is
+// retried after launchRetryDelay, unless its task is gone.
+func (sm *Manager) drainWaitlist(ctx context.Context) {
+	sm.createMu.Lock()
+	defer sm.createMu.Unlock()
+
+	entries, err := sm.waitlistRepo.List(ctx, "")
+	if err != nil || len(entries) == 0 {
+		if err != nil {
+			slog.Debug("waitlist: list failed", "error", err)
+		}
+		return
+	}
+	capacity, err := sm.schedulerCapacity(ctx)
+	if err != nil {
+		slog.Debug("waitlist: count running sessions failed", "error", err)
+		return
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		// Entries of a removed agent wait until it is back or they are
+		// cancelled.
+		agent := sm.registry.Get(entry.AgentType)
+		if agent == nil || capacity.byAgent[entry.AgentType] >= agentCapacity(agent) {
+			continue
+		}
+		// Failures are kept by entry ID next to those of scheduled tasks.
+		sm.schedMu.Lock()
+		failure, failed := sm.launchFailures[entry.ID]
+		sm.schedMu.Unlock()
+		if failed && time.Since(failure.at) < launchRetryDelay {
+			continue
+		}
+		sess, err := sm.startWaitlisted(ctx, entry, agent)
+		if err != nil && !IsNotFound(err) {
+			slog.Warn("waitlist: failed to start queued session; will retry", "entry_id", entry.ID, "task_id", entry.TaskID, "agent", entry.AgentType, "error", err)
+			sm.schedMu.Lock()
+			sm.launchFailures[entry.ID] = launchFailure{at: time.Now(), err: err.Error()}
+			sm.schedMu.Unlock()
+			continue
+		}
+		sm.schedMu.Lock()
+		delete(sm.launchFailures, entry.ID)
+		sm.schedMu.Unlock()
+		if _, delErr := sm.waitlistRepo.Delete(ctx, entry.ID); delErr != nil {
+			slog.Warn("waitlist: delete entry failed", "entry_id", entry.ID, "error", delErr)
+		}
+		msg := hub.SessionDequeuedMessage{
+			EntryID:   entry.ID,
+			TaskID:    entry.TaskID,
+			AgentType: entry.AgentType,
+			Role:      entry.Role,
+			WaitedMS:  time.Since(entry.CreatedAt).Milliseconds(),
+		}
+		if err != nil {
+			slog.Warn("waitlist: dropped entry of a missing task", "entry_id", entry.ID, "task_id", entry.TaskID, "agent", entry.AgentType, "error", err)
+			msg.Error = err.Error()
+		} else {
+			slog.Info("waitlist: started queued session", "entry_id", entry.ID, "task_id", entry.TaskID, "agent", entry.AgentType, "session_id", sess.ID)
+			msg.SessionID = sess.ID
+			capacity.byAgent[entry.AgentType]++
+			capacity.total++
+		}
+		if sm.hub != nil {
+			sm.hub.BroadcastSessionDequeued(msg)
+		}
+	}
+}
+
+func (sm *Manager) startWaitlisted(ctx context.Context, entry *db.WaitlistEntry, agent *registry.AgentConfig) (*db.Session, error) {
+	task, err := sm.taskRepo.Get(ctx, entry.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, errNotFound("task")
+	}
+	return sm.startSession(ctx, CreateSessionRequest{TaskID: entry.TaskID, AgentType: entry.AgentType, Role: entry.Role, Priority: entry.Priority}, agent, task)
+}
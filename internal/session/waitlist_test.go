@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestCreateSessionWaitlistsOverCapacity(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	sessionRepo := db.NewSessionRepo(database.SQL())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", MaxParallelAgents: 1}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	project := &db.Project{Name: "P1", RepoPath: t.TempDir(), Status: "active"}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	var tasks []*db.Task
+	for i := 0; i < 3; i++ {
+		task := &db.Task{ProjectID: project.ID, Title: "T", Status: "pending"}
+		if err := taskRepo.Create(ctx, task); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	lifecycle := NewManager(database.SQL(), newFakeBackend(), reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	first, err := lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: tasks[0].ID, AgentType: "codex", Role: "coder"})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	var waitlisted *WaitlistedError
+	_, err = lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: tasks[1].ID, AgentType: "codex", Role: "coder"})
+	if !errors.As(err, &waitlisted) || waitlisted.Position != 1 {
+		t.Fatalf("CreateSession over capacity error=%v want waitlisted at 1", err)
+	}
+	_, err = lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: tasks[2].ID, AgentType: "codex", Role: "coder", Priority: 5})
+	if !errors.As(err, &waitlisted) || waitlisted.Position != 1 {
+		t.Fatalf("CreateSession with priority error=%v want waitlisted at 1", err)
+	}
+	// Asking again keeps the existing entry.
+	_, err = lifecycle.CreateSession(ctx, CreateSessionRequest{TaskID: tasks[1].ID, AgentType: "codex", Role: "coder"})
+	if !errors.As(err, &waitlisted) || waitlisted.Position != 2 {
+		t.Fatalf("repeated CreateSession error=%v want waitlisted at 2", err)
+	}
+
+	entries, err := lifecycle.Waitlist(ctx, "codex")
+	if err != nil {
+		t.Fatalf("Waitlist: %v", err)
+	}
+	if len(entries) != 2 || entries[0].TaskID != tasks[2].ID || entries[1].TaskID != tasks[1].ID {
+		t.Fatalf("waitlist=%+v want priority task first", entries)
+	}
+
+	if err := lifecycle.DestroySession(ctx, first.ID); err != nil {
+		t.Fatalf("DestroySession: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sessions, err := sessionRepo.ListByTask(ctx, tasks[2].ID)
+		if err != nil {
+			t.Fatalf("list sessions: %v", err)
+		}
+		if len(sessions) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued session was not started after a slot freed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if sessions, _ := sessionRepo.ListByTask(ctx, tasks[1].ID); len(sessions) != 0 {
+		t.Fatalf("lower priority entry started while the agent was full")
+	}
+
+	if n, err := lifecycle.CancelWaitlist(ctx, "codex", ""); err != nil || n != 1 {
+		t.Fatalf("CancelWaitlist=%d, %v want 1 removed", n, err)
+	}
+	if _, err := lifecycle.Waitlist(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("Waitlist(missing) error=%v want not found", err)
+	}
+}
+
+// failingBackend refuses to create sessions while fail is set.
+type failingBackend struct {
+	*fakeBackend
+	fail bool
+}
+
+func (f *failingBackend) CreateSession(ctx context.Context, id, name, command, workDir string, env []string) (string, error) {
+	if f.fail {
+		return "", errors.New("terminal unavailable")
+	}
+	return f.fakeBackend.CreateSession(ctx, id, name, command, workDir, env)
+}
+
+func TestWaitlistKeepsEntriesWhoseStartFails(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	projectRepo := db.NewProjectRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	waitlistRepo := db.NewWaitlistRepo(database.SQL())
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", MaxParallelAgents: 1}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	project := &db.Project{Name: "P1", RepoPath: t.TempDir(), Status: "active"}
+	if err := projectRepo.Create(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	task := &db.Task{ProjectID: project.ID, Title: "T", Status: "pending"}
+	if err := taskRepo.Create(ctx, task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	entry := &db.WaitlistEntry{TaskID: task.ID, AgentType: "codex", Role: "coder"}
+	if err := waitlistRepo.Create(ctx, entry); err != nil {
+		t.Fatalf("create waitlist entry: %v", err)
+	}
+
+	backend := &failingBackend{fakeBackend: newFakeBackend(), fail: true}
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	lifecycle.drainWaitlist(ctx)
+	if entries, _ := waitlistRepo.List(ctx, "codex"); len(entries) != 1 {
+		t.Fatalf("waitlist=%+v want the entry kept after a failed start", entries)
+	}
+
+	// The next attempt waits for the retry delay.
+	backend.fail = false
+	lifecycle.drainWaitlist(ctx)
+	if sessions, _ := sessionRepo.ListByTask(ctx, task.ID); len(sessions) != 0 {
+		t.Fatalf("sessions=%+v started before the retry delay", sessions)
+	}
+	lifecycle.launchFailures[entry.ID] = launchFailure{at: time.Now().Add(-launchRetryDelay)}
+	lifecycle.drainWaitlist(ctx)
+	if sessions, _ := sessionRepo.ListByTask(ctx, task.ID); len(sessions) != 1 {
+		t.Fatalf("sessions=%+v want the entry started on retry", sessions)
+	}
+	if entries, _ := waitlistRepo.List(ctx, "codex"); len(entries) != 0 {
+		t.Fatalf("waitlist=%+v want the started entry removed", entries)
+	}
+}
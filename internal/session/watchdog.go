@@ -0,0 +1,252 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	gitops "github.com/user/agenterm/internal/git"
+	"github.com/user/agenterm/internal/hub"
+	"github.com/user/agenterm/internal/registry"
+)
+
+const (
+	// watchdogInterval is how often running sessions are checked against
+	// their agent's watchdog rules.
+	watchdogInterval = 5 * time.Second
+	// SessionEventWatchdog is the kind of events recorded when a watchdog
+	// rule fires.
+	SessionEventWatchdog = "watchdog"
+)
+
+// ListSessionEvents returns the events recorded for a session, oldest
+// first.
+func (sm *Manager) ListSessionEvents(ctx context.Context, sessionID string) ([]*db.SessionEvent, error) {
+	sess, err := sm.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errNotFound("session")
+	}
+	return sm.eventRepo.ListBySession(ctx, sessionID)
+}
+
+// recordSessionEvent persists event and announces it to clients.
+func (sm *Manager) recordSessionEvent(ctx context.Context, event *db.SessionEvent) {
+	if err := sm.eventRepo.Create(ctx, event); err != nil {
+		slog.Warn("failed to record session event", "session_id", event.SessionID, "kind", event.Kind, "error", err)
+		return
+	}
+	if sm.hub != nil {
+		sm.hub.BroadcastSessionEvent(hub.SessionEventMessage{
+			SessionID: event.SessionID,
+			EventID:   event.ID,
+			Kind:      event.Kind,
+			Rule:      event.Rule,
+			Action:    event.Action,
+			Detail:    event.Detail,
+			Ts:        event.CreatedAt.Unix(),
+		})
+	}
+}
+
+// runWatchdog checks running sessions for stuck agents until ctx is done.
+func (sm *Manager) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sm.watchdogPass(ctx, time.Now().UTC())
+	}
+}
+
+// watchdogPass evaluates every rule of every running session once and acts
+// on the ones that fire.
+func (sm *Manager) watchdogPass(ctx context.Context, now time.Time) {
+	active, err := sm.sessionRepo.ListActive(ctx)
+	if err != nil {
+		slog.Warn("watchdog failed to list sessions", "error", err)
+		return
+	}
+	seen := make(map[string]bool, len(active))
+	for _, sess := range active {
+		seen[sess.ID] = true
+		if !sessionRunning(sess) {
+			continue
+		}
+		agent := sm.registry.Get(sess.AgentType)
+		if agent == nil || len(agent.Watchdog) == 0 {
+			continue
+		}
+		for i, rule := range agent.Watchdog {
+			if !rule.AppliesTo(sess.Role) {
+				continue
+			}
+			detail := sm.watchdogFires(ctx, sess, i, rule, now)
+			if detail == "" {
+				continue
+			}
+			sm.setWatchdogFired(sess.ID, i, now)
+			sm.applyWatchdogAction(ctx, sess, rule, detail)
+			if rule.Action == registry.WatchdogTerminate {
+				break
+			}
+		}
+	}
+
+	sm.watchdogMu.Lock()
+	for id := range sm.watchdogFired {
+		if !seen[id] {
+			delete(sm.watchdogFired, id)
+		}
+	}
+	sm.watchdogMu.Unlock()
+}
+
+// watchdogFires returns why rule fires for sess now, or "" when it does
+// not. A rule fires at most once per occurrence of its condition.
+func (sm *Manager) watchdogFires(ctx context.Context, sess *db.Session, index int, rule registry.WatchdogRule, now time.Time) string {
+	after := time.Duration(rule.AfterSeconds) * time.Second
+	firedAt := sm.watchdogFiredAt(sess.ID, index)
+
+	switch rule.Trigger {
+	case registry.WatchdogMaxWallTime:
+		if firedAt.IsZero() && now.Sub(sess.CreatedAt) >= after {
+			return fmt.Sprintf("running for %s, over the %s limit", now.Sub(sess.CreatedAt).Round(time.Second), after)
+		}
+	case registry.WatchdogNoCommit:
+		anchor := sess.CreatedAt
+		if firedAt.After(anchor) {
+			anchor = firedAt
+		}
+		if now.Sub(anchor) < after {
+			return ""
+		}
+		workDir := sm.resolveWorkDirForSession(ctx, sess)
+		if workDir == "" {
+			return ""
+		}
+		commits, err := gitops.GetLogSince(workDir, now.Add(-after), 1)
+		if err != nil {
+			slog.Debug("watchdog failed to read commits", "session_id", sess.ID, "error", err)
+			return ""
+		}
+		if len(commits) == 0 {
+			return fmt.Sprintf("no commit in %s", after)
+		}
+	case registry.WatchdogRepeatedOutput:
+		monitor := sm.monitorFor(sess.ID)
+		if monitor == nil {
+			return ""
+		}
+		entries := monitor.buffer.Last(rule.Repeats)
+		if len(entries) < rule.Repeats || !entries[0].Timestamp.After(firedAt) {
+			return ""
+		}
+		for _, entry := range entries[1:] {
+			if entry.Text != entries[0].Text {
+				return ""
+			}
+		}
+		return fmt.Sprintf("output repeated %d times: %q", rule.Repeats, truncateRunes(entries[0].Text, 120))
+	case registry.WatchdogUnansweredPrompt:
+		if sess.HumanAttached {
+			return ""
+		}
+		monitor := sm.monitorFor(sess.ID)
+		if monitor == nil {
+			return ""
+		}
+		idle := monitor.IdleState()
+		waited := time.Duration(idle.TimeSinceLastOutput) * time.Millisecond
+		if !idle.PromptDetected || waited < after || firedAt.After(now.Add(-waited)) {
+			return ""
+		}
+		return fmt.Sprintf("prompt unanswered for %s", waited.Round(time.Second))
+	}
+	return ""
+}
+
+// applyWatchdogAction carries out rule's action on sess and records it as
+// a session event. Interrupts and nudges are sent in the background so a
+// busy command queue does not hold up the pass; a failed send is recorded
+// as a second event.
+func (sm *Manager) applyWatchdogAction(ctx context.Context, sess *db.Session, rule registry.WatchdogRule, detail string) {
+	var err error
+	switch rule.Action {
+	case registry.WatchdogInterrupt:
+		sm.sendWatchdogCommand(sess.ID, rule, detail, CommandRequest{Op: CommandOpInterrupt})
+	case registry.WatchdogNudge:
+		message := strings.TrimRight(rule.Message, "\n") + "\n"
+		sm.sendWatchdogCommand(sess.ID, rule, detail, CommandRequest{Op: CommandOpSendText, Text: message})
+	case registry.WatchdogTerminate:
+		err = sm.destroySession(ctx, sess.ID, "terminated", ExitReasonWatchdog)
+	}
+	if err != nil {
+		detail = watchdogFailure(sess.ID, rule, detail, err)
+	} else {
+		slog.Info("watchdog rule fired", "session_id", sess.ID, "trigger", rule.Trigger, "action", rule.Action, "detail", detail)
+	}
+	sm.recordWatchdogEvent(ctx, sess.ID, rule, detail)
+}
+
+// sendWatchdogCommand sends req in the background, until Close.
+func (sm *Manager) sendWatchdogCommand(sessionID string, rule registry.WatchdogRule, detail string, req CommandRequest) {
+	sm.goBackground(func(ctx context.Context) {
+		if _, err := sm.EnqueueCommand(ctx, sessionID, req); err != nil {
+			sm.recordWatchdogEvent(context.Background(), sessionID, rule, watchdogFailure(sessionID, rule, detail, err))
+		}
+	})
+}
+
+func watchdogFailure(sessionID string, rule registry.WatchdogRule, detail string, err error) string {
+	slog.Warn("watchdog action failed", "session_id", sessionID, "trigger", rule.Trigger, "action", rule.Action, "error", err)
+	return fmt.Sprintf("%s (%s failed: %v)", detail, rule.Action, err)
+}
+
+func (sm *Manager) recordWatchdogEvent(ctx context.Context, sessionID string, rule registry.WatchdogRule, detail string) {
+	sm.recordSessionEvent(ctx, &db.SessionEvent{
+		SessionID: sessionID,
+		Kind:      SessionEventWatchdog,
+		Rule:      rule.Trigger,
+		Action:    rule.Action,
+		Detail:    detail,
+	})
+}
+
+func (sm *Manager) monitorFor(sessionID string) *Monitor {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.monitors[sessionID].monitor
+}
+
+func (sm *Manager) watchdogFiredAt(sessionID string, index int) time.Time {
+	sm.watchdogMu.Lock()
+	defer sm.watchdogMu.Unlock()
+	return sm.watchdogFired[sessionID][index]
+}
+
+func (sm *Manager) setWatchdogFired(sessionID string, index int, at time.Time) {
+	sm.watchdogMu.Lock()
+	defer sm.watchdogMu.Unlock()
+	if sm.watchdogFired[sessionID] == nil {
+		sm.watchdogFired[sessionID] = make(map[int]time.Time)
+	}
+	sm.watchdogFired[sessionID][index] = at
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
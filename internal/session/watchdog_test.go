@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/db"
+	"github.com/user/agenterm/internal/registry"
+)
+
+func TestWatchdogRulesFireOnceAndRecordEvents(t *testing.T) {
+	ctx := context.Background()
+	database := openSessionTestDB(t)
+	sessionRepo := db.NewSessionRepo(database.SQL())
+	taskRepo := db.NewTaskRepo(database.SQL())
+	projectRepo := db.NewProjectRepo(database.SQL())
+	sess := seedSession(t, sessionRepo, taskRepo, projectRepo, time.Now().UTC().Add(-2*time.Hour))
+
+	reg, err := registry.NewRegistry(filepath.Join(t.TempDir(), "agents"))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	if err := reg.Save(&registry.AgentConfig{ID: "codex", Name: "Codex", Command: "codex", Watchdog: []registry.WatchdogRule{
+		{Trigger: registry.WatchdogMaxWallTime, Roles: []string{"coder"}, AfterSeconds: 3600, Action: registry.WatchdogNotify},
+		{Trigger: registry.WatchdogMaxWallTime, Roles: []string{"reviewer"}, AfterSeconds: 60, Action: registry.WatchdogTerminate},
+		{Trigger: registry.WatchdogRepeatedOutput, Repeats: 3, Action: registry.WatchdogNudge, Message: "You seem stuck; summarize and continue."},
+		{Trigger: registry.WatchdogUnansweredPrompt, AfterSeconds: 60, Action: registry.WatchdogTerminate},
+	}}); err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	backend := newFakeBackend()
+	backend.sessions[sess.ID] = true
+	lifecycle := NewManager(database.SQL(), backend, reg, nil)
+	if err := lifecycle.Start(ctx); err != nil {
+		t.Fatalf("start lifecycle: %v", err)
+	}
+	defer lifecycle.Close()
+
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Retrying request...", "normal", now.Add(time.Duration(i)*time.Millisecond))
+	}
+	lifecycle.watchdogPass(ctx, now)
+	lifecycle.watchdogPass(ctx, now.Add(time.Second))
+
+	events, err := lifecycle.ListSessionEvents(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("ListSessionEvents: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events=%+v want wall time and repeated output once each", events)
+	}
+	if events[0].Rule != registry.WatchdogMaxWallTime || events[0].Action != registry.WatchdogNotify || events[0].Kind != SessionEventWatchdog {
+		t.Fatalf("first event=%+v want max_wall_time notify", events[0])
+	}
+	if events[1].Rule != registry.WatchdogRepeatedOutput || !strings.Contains(events[1].Detail, "Retrying request...") {
+		t.Fatalf("second event=%+v want repeated_output", events[1])
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(strings.Join(backend.sentInputs(), ""), "summarize and continue") {
+		if time.Now().After(deadline) {
+			t.Fatalf("nudge not sent, inputs=%q", backend.sentInputs())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	lifecycle.ObserveParsedOutput(sess.ID, sess.TmuxWindowID, "Allow edit? $", "prompt", now.Add(-5*time.Minute))
+	lifecycle.watchdogPass(ctx, now.Add(2*time.Second))
+
+	got, err := sessionRepo.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if got.Status != "terminated" || got.Exit == nil || got.Exit.Reason != ExitReasonWatchdog {
+		t.Fatalf("session status=%q exit=%+v want terminated by watchdog", got.Status, got.Exit)
+	}
+	events, err = lifecycle.ListSessionEvents(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("ListSessionEvents: %v", err)
+	}
+	if last := events[len(events)-1]; len(events) != 3 || last.Rule != registry.WatchdogUnansweredPrompt || last.Action != registry.WatchdogTerminate {
+		t.Fatalf("events=%+v want unanswered_prompt terminate last", events)
+	}
+
+	if _, err := lifecycle.ListSessionEvents(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("ListSessionEvents(missing) error=%v want not found", err)
+	}
+}
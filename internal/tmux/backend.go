@@ -0,0 +1,558 @@
+// Package tmux implements session.TerminalBackend on top of a tmux server.
+//
+// Every agent session is a window, named after the session ID, inside one
+// tmux session. Because the windows belong to the tmux server rather than to
+// agenterm, they survive server restarts and can be inspected with a plain
+// "tmux attach" (e.g. over SSH) when the browser UI is unavailable.
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/pty"
+	"github.com/user/agenterm/internal/sandbox"
+	"github.com/user/agenterm/internal/vt"
+)
+
+const (
+	defaultCols = 120
+	defaultRows = 30
+
+	// nameOption is a window user option holding the human-readable session
+	// name; it also marks the windows agenterm manages. tmux has no window
+	// creation time, so createdOption records it.
+	nameOption    = "@agenterm_name"
+	createdOption = "@agenterm_created"
+
+	liveCheckInterval = time.Second
+)
+
+// Backend drives agent sessions as windows of a tmux session.
+type Backend struct {
+	session    string
+	socketName string
+
+	createMu sync.Mutex // serialises new-session/new-window
+	mu       sync.Mutex
+	pipes    map[string]*pipe
+	fifoDir  string
+}
+
+// pipe is an active pipe-pane stream for one window.
+type pipe struct {
+	fifo *os.File
+	stop chan struct{}
+	once sync.Once
+}
+
+func (p *pipe) close() {
+	p.once.Do(func() {
+		close(p.stop)
+		_ = p.fifo.Close()
+	})
+}
+
+// NewBackend creates a Backend that keeps agent windows in the tmux session
+// named session. It fails when tmux is not installed.
+func NewBackend(session string) (*Backend, error) {
+	session = strings.TrimSpace(session)
+	if session == "" {
+		return nil, fmt.Errorf("tmux backend: session name is required")
+	}
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil, fmt.Errorf("tmux backend: %w", err)
+	}
+	return &Backend{
+		session: session,
+		pipes:   make(map[string]*pipe),
+	}, nil
+}
+
+// SetSocketName selects a tmux server by socket name (tmux -L). The
+// default server is used when name is empty.
+func (b *Backend) SetSocketName(name string) {
+	b.socketName = strings.TrimSpace(name)
+}
+
+// CreateSession opens a window named id running command. The tmux session
+// is created on first use. Windows inherit the tmux server's environment, so
+// env is applied as the difference from this process's environment: changed
+// variables are passed with -e and removed ones are unset by the shell.
+func (b *Backend) CreateSession(ctx context.Context, id, name, command, workDir string, env []string) (string, error) {
+	if err := validateID(id); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("tmux backend: empty command")
+	}
+
+	b.createMu.Lock()
+	defer b.createMu.Unlock()
+
+	exists, err := b.windowExists(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("tmux backend: session %q already exists", id)
+	}
+	args := []string{"-d", "-P", "-F", "#{window_id}", "-n", id}
+	if workDir != "" {
+		args = append(args, "-c", workDir)
+	}
+	if env != nil {
+		set, unset := environ.Diff(os.Environ(), env)
+		for _, kv := range set {
+			args = append(args, "-e", kv)
+		}
+		if len(unset) > 0 {
+			command = "unset " + strings.Join(unset, " ") + "\n" + command
+		}
+	}
+	var out string
+	_, err = b.run(ctx, "has-session", "-t", "="+b.session)
+	if err != nil && !isNoSession(err) {
+		return "", err
+	}
+	if err != nil {
+		args = append([]string{"new-session", "-s", b.session, "-x", strconv.Itoa(defaultCols), "-y", strconv.Itoa(defaultRows)}, args...)
+		out, err = b.run(ctx, append(args, command)...)
+	} else {
+		args = append([]string{"new-window", "-t", "=" + b.session + ":"}, args...)
+		out, err = b.run(ctx, append(args, command)...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Address the window by its stable id for the remaining setup: the
+	// command may already have exited and a name lookup would then fail.
+	windowID := strings.TrimSpace(out)
+	for _, opt := range [][]string{
+		{"automatic-rename", "off"},
+		{"allow-rename", "off"},
+		{nameOption, name},
+		{createdOption, strconv.FormatInt(time.Now().Unix(), 10)},
+	} {
+		if _, err := b.run(ctx, "set-option", "-w", "-t", windowID, opt[0], opt[1]); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// CreateSandboxedSession is CreateSession with command run through the
+// sandbox helper. The helper is the agenterm binary of this process, which
+// the tmux server must be able to execute.
+func (b *Backend) CreateSandboxedSession(ctx context.Context, id, name, command, workDir string, env []string, policy sandbox.Policy) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("tmux backend: empty command")
+	}
+	if err := sandbox.Supported(); err != nil {
+		return "", err
+	}
+	wrapped, err := sandbox.ShellCommand(command, policy)
+	if err != nil {
+		return "", err
+	}
+	return b.CreateSession(ctx, id, name, wrapped, workDir, env)
+}
+
+// DestroySession kills the session's window.
+func (b *Backend) DestroySession(ctx context.Context, id string) error {
+	b.stopPipe(id)
+	_, err := b.run(ctx, "kill-window", "-t", b.target(id))
+	return err
+}
+
+// SendInput types data into the window verbatim.
+func (b *Backend) SendInput(ctx context.Context, id, data string) error {
+	if data == "" {
+		return nil
+	}
+	_, err := b.run(ctx, "send-keys", "-t", b.target(id), "-l", "--", data)
+	return err
+}
+
+// SendKey sends a named key (e.g. "Enter", "C-c"), translated to tmux's key
+// names.
+func (b *Backend) SendKey(ctx context.Context, id, key string) error {
+	_, err := b.run(ctx, "send-keys", "-t", b.target(id), "--", mapNamedKey(key))
+	return err
+}
+
+// Resize sets the window size.
+func (b *Backend) Resize(ctx context.Context, id string, cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("tmux backend: invalid size %dx%d", cols, rows)
+	}
+	_, err := b.run(ctx, "resize-window", "-t", b.target(id), "-x", strconv.Itoa(cols), "-y", strconv.Itoa(rows))
+	return err
+}
+
+// CaptureOutput returns the last N lines of the pane, including scrollback.
+func (b *Backend) CaptureOutput(ctx context.Context, id string, lines int) ([]string, error) {
+	args := []string{"capture-pane", "-p", "-J", "-t", b.target(id)}
+	if lines > 0 {
+		args = append(args, "-S", "-"+strconv.Itoa(lines))
+	}
+	out, err := b.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	all := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if lines > 0 && lines < len(all) {
+		all = all[len(all)-lines:]
+	}
+	return all, nil
+}
+
+// ProcessID returns the pid of the process running in the session's pane.
+func (b *Backend) ProcessID(ctx context.Context, id string) (int, error) {
+	out, err := b.run(ctx, "display-message", "-p", "-t", b.target(id), "#{pane_pid}")
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("tmux backend: parse pane pid %q: %w", out, err)
+	}
+	return pid, nil
+}
+
+// Screen returns the visible pane as tmux renders it. tmux is itself a
+// terminal emulator, so the pane contents are replayed into a vt.Screen only
+// to produce the snapshot's plain and ANSI forms.
+func (b *Backend) Screen(ctx context.Context, id string) (vt.Snapshot, error) {
+	info, err := b.run(ctx, "display-message", "-p", "-t", b.target(id),
+		"#{pane_width} #{pane_height} #{cursor_x} #{cursor_y} #{cursor_flag} #{alternate_on}\t#{pane_title}")
+	if err != nil {
+		return vt.Snapshot{}, err
+	}
+	fields, title, _ := strings.Cut(strings.TrimRight(info, "\n"), "\t")
+	var cols, rows, curX, curY, curFlag, alt int
+	if _, err := fmt.Sscanf(fields, "%d %d %d %d %d %d", &cols, &rows, &curX, &curY, &curFlag, &alt); err != nil {
+		return vt.Snapshot{}, fmt.Errorf("tmux backend: parse pane info %q: %w", fields, err)
+	}
+	content, err := b.run(ctx, "capture-pane", "-p", "-e", "-t", b.target(id))
+	if err != nil {
+		return vt.Snapshot{}, err
+	}
+
+	screen := vt.New(cols, rows, 1)
+	rendered := strings.ReplaceAll(strings.TrimRight(content, "\n"), "\n", "\x1b[0m\r\n")
+	fmt.Fprintf(screen, "%s\x1b[0m\x1b[%d;%dH", rendered, curY+1, curX+1)
+	if curFlag == 0 {
+		fmt.Fprint(screen, "\x1b[?25l")
+	}
+	snap := screen.Snapshot()
+	snap.AltScreen = alt == 1
+	snap.Title = title
+	return snap, nil
+}
+
+// SessionExists reports whether the session's window is still open. It
+// reports false when tmux cannot be queried.
+func (b *Backend) SessionExists(ctx context.Context, id string) bool {
+	exists, err := b.windowExists(ctx, id)
+	return err == nil && exists
+}
+
+func (b *Backend) windowExists(ctx context.Context, id string) (bool, error) {
+	windows, err := b.listWindows(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, w := range windows {
+		if w.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListSessions returns the windows created by agenterm in the tmux session,
+// or none when tmux cannot be queried.
+func (b *Backend) ListSessions() []pty.SessionInfo {
+	windows, _ := b.listWindows(context.Background())
+	infos := make([]pty.SessionInfo, 0, len(windows))
+	for _, w := range windows {
+		if w.Name == "" {
+			continue // not an agenterm window
+		}
+		infos = append(infos, w)
+	}
+	return infos
+}
+
+// Events streams the window's raw output via tmux pipe-pane. Output written
+// before the call is not replayed; use CaptureOutput for history. The
+// channel ends with an EventClosed once the window disappears.
+func (b *Backend) Events(id string) <-chan pty.Event {
+	ctx := context.Background()
+	if validateID(id) != nil || !b.SessionExists(ctx, id) {
+		return nil
+	}
+	p, err := b.startPipe(ctx, id)
+	if err != nil {
+		return nil
+	}
+
+	out := make(chan pty.Event, 1024)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		buf := make([]byte, 4096)
+		for {
+			n, err := p.fifo.Read(buf)
+			if n > 0 {
+				select {
+				case out <- pty.Event{Type: pty.EventOutput, ID: id, Data: string(buf[:n]), At: time.Now()}:
+				case <-p.stop:
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// The watcher owns out: it closes it only after the reader has exited.
+	go func() {
+		ticker := time.NewTicker(liveCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				<-readerDone
+				close(out)
+				return
+			case <-ticker.C:
+				// A failed query is not a closed window: try again on the
+				// next tick.
+				if exists, err := b.windowExists(ctx, id); err == nil && !exists {
+					b.mu.Lock()
+					if b.pipes[id] == p {
+						delete(b.pipes, id)
+					}
+					b.mu.Unlock()
+					p.close()
+					<-readerDone
+					out <- pty.Event{Type: pty.EventClosed, ID: id}
+					close(out)
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Close stops output streaming. The tmux windows keep running so a later
+// agenterm process, or a human with "tmux attach", can pick them up.
+func (b *Backend) Close() {
+	b.mu.Lock()
+	ids := make([]string, 0, len(b.pipes))
+	for id := range b.pipes {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+	for _, id := range ids {
+		b.stopPipe(id)
+	}
+	b.mu.Lock()
+	if b.fifoDir != "" {
+		_ = os.RemoveAll(b.fifoDir)
+		b.fifoDir = ""
+	}
+	b.mu.Unlock()
+}
+
+// startPipe points the pane's pipe-pane at a fresh FIFO. Any pipe left by a
+// previous agenterm process is replaced.
+func (b *Backend) startPipe(ctx context.Context, id string) (*pipe, error) {
+	b.stopPipe(id)
+
+	b.mu.Lock()
+	if b.fifoDir == "" {
+		dir, err := os.MkdirTemp("", "agenterm-tmux-")
+		if err != nil {
+			b.mu.Unlock()
+			return nil, err
+		}
+		b.fifoDir = dir
+	}
+	path := filepath.Join(b.fifoDir, id+".fifo")
+	b.mu.Unlock()
+
+	_ = os.Remove(path)
+	if err := mkfifo(path); err != nil {
+		return nil, fmt.Errorf("tmux backend: mkfifo: %w", err)
+	}
+	// Opening read-write keeps the open from blocking until tmux connects
+	// and keeps the FIFO readable if the writer restarts.
+	fifo, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("tmux backend: open fifo: %w", err)
+	}
+	if _, err := b.run(ctx, "pipe-pane", "-t", b.target(id), "cat > "+shellQuote(path)); err != nil {
+		_ = fifo.Close()
+		return nil, err
+	}
+
+	p := &pipe{fifo: fifo, stop: make(chan struct{})}
+	b.mu.Lock()
+	b.pipes[id] = p
+	b.mu.Unlock()
+	return p, nil
+}
+
+func (b *Backend) stopPipe(id string) {
+	b.mu.Lock()
+	p := b.pipes[id]
+	delete(b.pipes, id)
+	b.mu.Unlock()
+	if p == nil {
+		return
+	}
+	// pipe-pane without a command closes the pane's pipe.
+	_, _ = b.run(context.Background(), "pipe-pane", "-t", b.target(id))
+	p.close()
+}
+
+// listWindows returns the windows of the backend's tmux session. A missing
+// server or session has no windows; any other tmux failure is an error.
+func (b *Backend) listWindows(ctx context.Context) ([]pty.SessionInfo, error) {
+	out, err := b.run(ctx, "list-windows", "-t", "="+b.session, "-F",
+		"#{window_name}\t#{"+nameOption+"}\t#{"+createdOption+"}\t#{pane_dead}")
+	if err != nil {
+		if isNoSession(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var infos []pty.SessionInfo
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || fields[0] == "" {
+			continue
+		}
+		info := pty.SessionInfo{ID: fields[0], Name: fields[1], Active: fields[3] != "1"}
+		if secs, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			info.CreatedAt = time.Unix(secs, 0)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// target addresses a window by exact name within the backend's session.
+func (b *Backend) target(id string) string {
+	return "=" + b.session + ":=" + id
+}
+
+func (b *Backend) run(ctx context.Context, args ...string) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	subcommand := args[0]
+	if b.socketName != "" {
+		args = append([]string{"-L", b.socketName}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "tmux", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		var exitErr *exec.ExitError
+		if msg == "" || !errors.As(err, &exitErr) {
+			msg = err.Error()
+		}
+		return "", &commandError{subcommand: subcommand, msg: msg}
+	}
+	return string(out), nil
+}
+
+// commandError is a failed tmux command.
+type commandError struct {
+	subcommand string
+	msg        string
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("tmux %s: %s", e.subcommand, e.msg)
+}
+
+// isNoSession reports whether err says the tmux server is not running or
+// the session does not exist, as opposed to tmux failing.
+func isNoSession(err error) bool {
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	for _, marker := range []string{"no server running", "error connecting to", "can't find session", "session not found"} {
+		if strings.Contains(cmdErr.msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return fmt.Errorf("tmux backend: session id is required")
+	}
+	if strings.ContainsAny(id, ":.=/\\ \t\n") {
+		return fmt.Errorf("tmux backend: invalid session id %q", id)
+	}
+	return nil
+}
+
+// mapNamedKey translates the key names accepted by the PTY backend to tmux
+// key names. Unknown names are passed to tmux unchanged.
+func mapNamedKey(key string) string {
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "enter":
+		return "Enter"
+	case "c-m":
+		return "C-m"
+	case "c-c":
+		return "C-c"
+	case "c-d":
+		return "C-d"
+	case "c-z":
+		return "C-z"
+	case "c-l":
+		return "C-l"
+	case "escape", "esc":
+		return "Escape"
+	case "tab":
+		return "Tab"
+	case "backspace":
+		return "BSpace"
+	case "up":
+		return "Up"
+	case "down":
+		return "Down"
+	case "right":
+		return "Right"
+	case "left":
+		return "Left"
+	default:
+		return key
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,194 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/agenterm/internal/environ"
+	"github.com/user/agenterm/internal/pty"
+)
+
+// newTestBackend uses a private tmux server so tests never touch the
+// developer's sessions.
+func newTestBackend(t *testing.T) *Backend {
+	t.Helper()
+	b, err := NewBackend("agenterm-test")
+	if err != nil {
+		t.Skipf("tmux unavailable: %v", err)
+	}
+	socket := fmt.Sprintf("agenterm-test-%d", time.Now().UnixNano())
+	b.SetSocketName(socket)
+	t.Cleanup(func() {
+		b.Close()
+		_ = exec.Command("tmux", "-L", socket, "kill-server").Run()
+	})
+	return b
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestBackendLifecycle(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+
+	id, err := b.CreateSession(ctx, "s1", "Shell One", "cat", t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if id != "s1" {
+		t.Fatalf("id=%q want s1", id)
+	}
+	if _, err := b.CreateSession(ctx, "s2", "Shell Two", "cat", "", nil); err != nil {
+		t.Fatalf("CreateSession second window: %v", err)
+	}
+	// The duplicate check lists windows; wait until tmux lists both so it
+	// does not depend on server timing.
+	waitFor(t, "both windows listed", func() bool { return len(b.ListSessions()) == 2 })
+	if _, err := b.CreateSession(ctx, "s1", "dup", "cat", "", nil); err == nil {
+		t.Fatalf("expected duplicate session error")
+	}
+
+	infos := b.ListSessions()
+	if len(infos) != 2 {
+		t.Fatalf("ListSessions=%+v want 2 windows", infos)
+	}
+	for _, info := range infos {
+		if info.ID == "s1" && (info.Name != "Shell One" || !info.Active || info.CreatedAt.IsZero()) {
+			t.Fatalf("s1 info=%+v", info)
+		}
+	}
+
+	events := b.Events("s1")
+	if events == nil {
+		t.Fatalf("Events returned nil")
+	}
+	if err := b.SendInput(ctx, "s1", "hello-tmux"); err != nil {
+		t.Fatalf("SendInput: %v", err)
+	}
+	if err := b.SendKey(ctx, "s1", "enter"); err != nil {
+		t.Fatalf("SendKey: %v", err)
+	}
+
+	var streamed strings.Builder
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(streamed.String(), "hello-tmux") {
+		select {
+		case evt := <-events:
+			streamed.WriteString(evt.Data)
+		case <-timeout:
+			t.Fatalf("no streamed output; got %q", streamed.String())
+		}
+	}
+
+	waitFor(t, "captured output", func() bool {
+		lines, err := b.CaptureOutput(ctx, "s1", 50)
+		return err == nil && strings.Contains(strings.Join(lines, "\n"), "hello-tmux")
+	})
+
+	if err := b.Resize(ctx, "s1", 100, 40); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if pid, err := b.ProcessID(ctx, "s1"); err != nil || pid <= 0 {
+		t.Fatalf("ProcessID=%d err=%v", pid, err)
+	}
+	screen, err := b.Screen(ctx, "s1")
+	if err != nil {
+		t.Fatalf("Screen: %v", err)
+	}
+	if screen.Cols != 100 || screen.Rows != 40 || !strings.Contains(strings.Join(screen.Lines, "\n"), "hello-tmux") {
+		t.Fatalf("screen=%dx%d lines=%q", screen.Cols, screen.Rows, screen.Lines)
+	}
+
+	if err := b.SendKey(ctx, "s1", "C-d"); err != nil {
+		t.Fatalf("SendKey C-d: %v", err)
+	}
+	timeout = time.After(5 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed without EventClosed")
+			}
+			closed = evt.Type == pty.EventClosed
+		case <-timeout:
+			t.Fatalf("timed out waiting for EventClosed")
+		}
+	}
+	if b.SessionExists(ctx, "s1") {
+		t.Fatalf("s1 should be gone after its command exited")
+	}
+
+	if err := b.DestroySession(ctx, "s2"); err != nil {
+		t.Fatalf("DestroySession: %v", err)
+	}
+	if b.SessionExists(ctx, "s2") {
+		t.Fatalf("s2 should be gone after DestroySession")
+	}
+}
+
+func TestBackendCreateSessionAppliesEnv(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+	t.Setenv("AGENTERM_TMUX_DROP", "inherited")
+
+	env := environ.Build(os.Environ(), environ.Map{
+		"AGENTERM_TMUX_SET":  strPtr("from-layer"),
+		"AGENTERM_TMUX_DROP": nil,
+	})
+	command := `echo "set=$AGENTERM_TMUX_SET drop=${AGENTERM_TMUX_DROP:-none}"; cat`
+	if _, err := b.CreateSession(ctx, "env", "Env", command, "", env); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	waitFor(t, "env output", func() bool {
+		lines, err := b.CaptureOutput(ctx, "env", 50)
+		return err == nil && strings.Contains(strings.Join(lines, "\n"), "set=from-layer drop=none")
+	})
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateIDRejectsTargetSyntax(t *testing.T) {
+	for _, id := range []string{"", "a:b", "a.b", "=a", "a b"} {
+		if err := validateID(id); err == nil {
+			t.Errorf("validateID(%q) accepted", id)
+		}
+	}
+	if err := validateID("3f9a0c"); err != nil {
+		t.Errorf("validateID(hex) error = %v", err)
+	}
+}
+
+func TestBackendDistinguishesMissingServerFromFailures(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+
+	// No server is running on the test socket yet.
+	if exists, err := b.windowExists(ctx, "s1"); err != nil || exists {
+		t.Fatalf("windowExists without server = %v, %v", exists, err)
+	}
+
+	_, err := b.run(ctx, "kill-window", "-t", b.target("missing"))
+	if err == nil || !strings.HasPrefix(err.Error(), "tmux kill-window: ") {
+		t.Fatalf("error = %v, want it named after the subcommand", err)
+	}
+	if _, err := b.CreateSession(ctx, "s1", "Shell One", "cat", "", nil); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := b.run(ctx, "no-such-command"); err == nil || isNoSession(err) {
+		t.Fatalf("unknown command error = %v, want a real failure", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package tmux
+
+import "errors"
+
+// mkfifo is unsupported on Windows; tmux does not run there natively.
+func mkfifo(string) error {
+	return errors.New("named pipes are not supported on windows")
+}
@@ -0,0 +1,355 @@
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogConfig reads usage from a JSON-lines log the agent appends to, one
+// entry per turn. The fields are dotted paths into each entry, e.g.
+// "message.usage.input_tokens".
+type LogConfig struct {
+	// Path is a glob of the log files. A leading ~ is the home directory,
+	// {work_dir} the session's worktree and {work_dir_slug} the worktree
+	// with every character other than letters, digits and - replaced by -.
+	Path         string `yaml:"path" json:"path"`
+	InputTokens  string `yaml:"input_tokens,omitempty" json:"input_tokens,omitempty"`
+	OutputTokens string `yaml:"output_tokens,omitempty" json:"output_tokens,omitempty"`
+	TotalTokens  string `yaml:"total_tokens,omitempty" json:"total_tokens,omitempty"`
+	Cost         string `yaml:"cost,omitempty" json:"cost,omitempty"`
+	// WorkDir, when set, is the field holding the directory the entry was
+	// written from; entries of other directories are skipped.
+	WorkDir string `yaml:"work_dir,omitempty" json:"work_dir,omitempty"`
+	// Timestamp, when set, is the field holding the entry's RFC 3339 time;
+	// entries from before the session started are skipped.
+	Timestamp string `yaml:"timestamp,omitempty" json:"timestamp,omitempty"`
+	// FileWorkDir, when set, is the field of a file's first entry holding
+	// the directory the whole file was written from; files of other
+	// directories are skipped.
+	FileWorkDir string `yaml:"file_work_dir,omitempty" json:"file_work_dir,omitempty"`
+	// ID, when set, is the field identifying a turn. Agents that log one
+	// turn over several entries repeat it; only the first entry counts.
+	ID string `yaml:"id,omitempty" json:"id,omitempty"`
+	// Cumulative marks entries reporting the running total of their file
+	// rather than the usage of one turn.
+	Cumulative bool `yaml:"cumulative,omitempty" json:"cumulative,omitempty"`
+}
+
+// Validate requires a path and at least one amount field.
+func (l LogConfig) Validate() error {
+	if strings.TrimSpace(l.Path) == "" {
+		return errors.New("path is required")
+	}
+	if _, err := filepath.Match(l.Path, ""); err != nil {
+		return fmt.Errorf("invalid path glob: %w", err)
+	}
+	if l.InputTokens == "" && l.OutputTokens == "" && l.TotalTokens == "" && l.Cost == "" {
+		return errors.New("one of input_tokens, output_tokens, total_tokens or cost is required")
+	}
+	return nil
+}
+
+// LogTailer reads the usage a session's agent appends to its log files.
+type LogTailer struct {
+	cfg     Config
+	workDir string
+	since   time.Time
+	offsets map[string]int64
+	// inWorkDir caches whether a file's FileWorkDir is the session's.
+	inWorkDir map[string]bool
+	// last is the latest reading of each file with Cumulative.
+	last map[string]Usage
+	// seen holds the IDs of the turns counted so far.
+	seen map[string]bool
+}
+
+// NewLogTailer returns a tailer of cfg.Log for a session working in workDir
+// that started at since. It returns nil when cfg has no log.
+func NewLogTailer(cfg Config, workDir string, since time.Time) *LogTailer {
+	if cfg.Log == nil {
+		return nil
+	}
+	return &LogTailer{
+		cfg:       cfg,
+		workDir:   workDir,
+		since:     since,
+		offsets:   make(map[string]int64),
+		inWorkDir: make(map[string]bool),
+		last:      make(map[string]Usage),
+		seen:      make(map[string]bool),
+	}
+}
+
+// Poll returns the usage of the entries appended since the last poll.
+func (t *LogTailer) Poll() (Usage, error) {
+	var total Usage
+	if t == nil {
+		return total, nil
+	}
+	files, err := filepath.Glob(t.pattern())
+	if err != nil {
+		return total, err
+	}
+	var errs []error
+	for _, path := range files {
+		u, err := t.read(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total = total.Add(u)
+	}
+	return total, errors.Join(errs...)
+}
+
+func (t *LogTailer) pattern() string {
+	return ExpandPath(t.cfg.Log.Path, t.workDir)
+}
+
+// ExpandPath resolves a leading ~, {work_dir} and {work_dir_slug} in a path
+// pattern.
+func ExpandPath(p, workDir string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = home + p[1:]
+		}
+	}
+	p = strings.ReplaceAll(p, "{work_dir_slug}", slug(workDir))
+	return strings.ReplaceAll(p, "{work_dir}", workDir)
+}
+
+func (t *LogTailer) read(path string) (Usage, error) {
+	var total Usage
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return total, nil
+	}
+	if ok, err := t.fileInWorkDir(path); !ok || err != nil {
+		return total, err
+	}
+	offset, seen := t.offsets[path]
+	if !seen && info.ModTime().Before(t.since) {
+		// Written before the session started: only what is appended
+		// from now on belongs to it.
+		t.offsets[path] = info.Size()
+		if t.cfg.Log.Cumulative {
+			return total, t.seed(path, info.Size())
+		}
+		return total, nil
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		t.offsets[path] = offset
+		return total, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return total, fmt.Errorf("open usage log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return total, fmt.Errorf("seek usage log: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return total, fmt.Errorf("read usage log: %w", err)
+	}
+	// A partly written last line is read on the next poll.
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		t.offsets[path] = offset
+		return total, nil
+	}
+	t.offsets[path] = offset + int64(end) + 1
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		if u, ok := t.entry(path, line); ok {
+			total = total.Add(u)
+		}
+	}
+	return total, nil
+}
+
+// fileInWorkDir reports whether path was written from the session's
+// worktree, as told by FileWorkDir in its first entry. A file without a
+// complete first entry yet is skipped until it has one.
+func (t *LogTailer) fileInWorkDir(path string) (bool, error) {
+	field := t.cfg.Log.FileWorkDir
+	if field == "" {
+		return true, nil
+	}
+	if ok, known := t.inWorkDir[path]; known {
+		return ok, nil
+	}
+	dir, complete, err := FirstEntryField(path, field)
+	if err != nil || !complete {
+		return false, err
+	}
+	ok := dir != "" && filepath.Clean(dir) == filepath.Clean(t.workDir)
+	t.inWorkDir[path] = ok
+	return ok, nil
+}
+
+// FirstEntryField returns the string at the dotted path field of the first
+// JSON line of the file at path. complete is false while that line is not
+// fully written yet.
+func FirstEntryField(path, field string) (value string, complete bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("open usage log: %w", err)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return "", false, nil
+	}
+	var doc any
+	if json.Unmarshal(line, &doc) == nil {
+		value, _ = lookup(doc, field).(string)
+	}
+	return value, true, nil
+}
+
+// seed takes the latest running total of a cumulative file from what was
+// written to it before the session started, so that only the increase
+// counts.
+func (t *LogTailer) seed(path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open usage log: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, size))
+	if err != nil {
+		return fmt.Errorf("read usage log: %w", err)
+	}
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		t.entry(path, line)
+	}
+	return nil
+}
+
+// entry returns the usage of one line of path.
+func (t *LogTailer) entry(path string, line []byte) (Usage, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return Usage{}, false
+	}
+	var doc any
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return Usage{}, false
+	}
+	log := t.cfg.Log
+	if log.WorkDir != "" {
+		dir, _ := lookup(doc, log.WorkDir).(string)
+		if filepath.Clean(dir) != filepath.Clean(t.workDir) {
+			return Usage{}, false
+		}
+	}
+	u, ok := t.amounts(doc)
+	if !ok {
+		return Usage{}, false
+	}
+	if log.Cumulative {
+		prev, seen := t.last[path]
+		t.last[path] = u
+		if seen {
+			if d, ok := u.sub(prev); ok {
+				u = d
+			}
+		}
+	}
+	if log.Timestamp != "" {
+		raw, _ := lookup(doc, log.Timestamp).(string)
+		ts, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil || ts.Before(t.since) {
+			return Usage{}, false
+		}
+	}
+	if log.ID != "" {
+		if id, _ := lookup(doc, log.ID).(string); id != "" {
+			if t.seen[id] {
+				return Usage{}, false
+			}
+			t.seen[id] = true
+		}
+	}
+	return u, !u.IsZero()
+}
+
+// amounts reads and prices the usage fields of an entry.
+func (t *LogTailer) amounts(doc any) (Usage, bool) {
+	log := t.cfg.Log
+	var u Usage
+	var ok bool
+	u.InputTokens, ok = lookupInt(doc, log.InputTokens, ok)
+	u.OutputTokens, ok = lookupInt(doc, log.OutputTokens, ok)
+	u.TotalTokens, ok = lookupInt(doc, log.TotalTokens, ok)
+	hasCost := false
+	if log.Cost != "" {
+		if cost, found := number(lookup(doc, log.Cost)); found {
+			u.CostUSD, hasCost, ok = cost, true, true
+		}
+	}
+	if !ok {
+		return Usage{}, false
+	}
+	return t.cfg.price(u, hasCost), true
+}
+
+func lookupInt(doc any, path string, ok bool) (int64, bool) {
+	if path == "" {
+		return 0, ok
+	}
+	n, found := number(lookup(doc, path))
+	if !found {
+		return 0, ok
+	}
+	return int64(n), true
+}
+
+// lookup follows a dotted path through JSON objects.
+func lookup(doc any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		doc = obj[key]
+	}
+	return doc
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, n >= 0
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil && f >= 0
+	default:
+		return 0, false
+	}
+}
+
+func slug(dir string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, dir)
+}
@@ -0,0 +1,267 @@
+// Package usage extracts token usage and cost from agent output lines and
+// from the usage logs agents write locally.
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Usage is an amount of tokens and money spent.
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	// TotalTokens is InputTokens+OutputTokens, or the total an agent
+	// reports without a split.
+	TotalTokens int64   `json:"total_tokens"`
+	CostUSD     float64 `json:"cost_usd"`
+}
+
+// IsZero reports whether nothing was spent.
+func (u Usage) IsZero() bool {
+	return u.InputTokens == 0 && u.OutputTokens == 0 && u.TotalTokens == 0 && u.CostUSD == 0
+}
+
+// Add returns the sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + o.InputTokens,
+		OutputTokens: u.OutputTokens + o.OutputTokens,
+		TotalTokens:  u.TotalTokens + o.TotalTokens,
+		CostUSD:      u.CostUSD + o.CostUSD,
+	}
+}
+
+// sub returns u-o, or ok=false when some amount went down, which means a
+// cumulative counter was reset.
+func (u Usage) sub(o Usage) (Usage, bool) {
+	d := Usage{
+		InputTokens:  u.InputTokens - o.InputTokens,
+		OutputTokens: u.OutputTokens - o.OutputTokens,
+		TotalTokens:  u.TotalTokens - o.TotalTokens,
+		CostUSD:      u.CostUSD - o.CostUSD,
+	}
+	if d.InputTokens < 0 || d.OutputTokens < 0 || d.TotalTokens < 0 || d.CostUSD < -1e-9 {
+		return Usage{}, false
+	}
+	if d.CostUSD < 0 {
+		d.CostUSD = 0
+	}
+	return d, true
+}
+
+func (u Usage) clampedSub(o Usage) Usage {
+	return Usage{
+		InputTokens:  max(u.InputTokens-o.InputTokens, 0),
+		OutputTokens: max(u.OutputTokens-o.OutputTokens, 0),
+		TotalTokens:  max(u.TotalTokens-o.TotalTokens, 0),
+		CostUSD:      max(u.CostUSD-o.CostUSD, 0),
+	}
+}
+
+// Config tells how an agent reports usage. Patterns match its output; Log
+// reads its local usage log. Prices fill in the cost when only tokens are
+// reported. They are not derived from the agent's cost_tier, a coarse label
+// whose models differ in price several times over.
+type Config struct {
+	Patterns []Pattern  `yaml:"patterns,omitempty" json:"patterns,omitempty"`
+	Log      *LogConfig `yaml:"log,omitempty" json:"log,omitempty"`
+	// InputUSDPerMTok and OutputUSDPerMTok are prices per million tokens.
+	InputUSDPerMTok  float64 `yaml:"input_usd_per_mtok,omitempty" json:"input_usd_per_mtok,omitempty"`
+	OutputUSDPerMTok float64 `yaml:"output_usd_per_mtok,omitempty" json:"output_usd_per_mtok,omitempty"`
+}
+
+// Pattern is a regular expression matched against each output line. Its
+// named groups input, output, total and cost capture the amounts; numbers
+// may use thousands separators and k/M suffixes, costs a leading $.
+type Pattern struct {
+	Regex string `yaml:"regex" json:"regex"`
+	// Cumulative marks lines reporting the session's running total, such
+	// as a status bar, rather than the usage of one turn.
+	Cumulative bool `yaml:"cumulative,omitempty" json:"cumulative,omitempty"`
+}
+
+var patternGroups = []string{"input", "output", "total", "cost"}
+
+// IsZero reports whether c configures no usage source.
+func (c Config) IsZero() bool {
+	return len(c.Patterns) == 0 && c.Log == nil
+}
+
+// Validate checks patterns, the log source and prices.
+func (c Config) Validate() error {
+	for i, p := range c.Patterns {
+		if _, err := p.compile(); err != nil {
+			return fmt.Errorf("pattern %d: %w", i, err)
+		}
+	}
+	if c.Log != nil {
+		if err := c.Log.Validate(); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+	}
+	if c.InputUSDPerMTok < 0 || c.OutputUSDPerMTok < 0 {
+		return errors.New("prices must be >= 0")
+	}
+	return nil
+}
+
+func (p Pattern) compile() (*regexp.Regexp, error) {
+	if strings.TrimSpace(p.Regex) == "" {
+		return nil, errors.New("regex is required")
+	}
+	re, err := regexp.Compile(p.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	named := false
+	for _, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !containsString(patternGroups, name) {
+			return nil, fmt.Errorf("unknown group %q, want one of %s", name, strings.Join(patternGroups, ", "))
+		}
+		named = true
+	}
+	if !named {
+		return nil, fmt.Errorf("regex has none of the groups %s", strings.Join(patternGroups, ", "))
+	}
+	return re, nil
+}
+
+// price fills in the cost of u from token prices when the agent did not
+// report one, and the total when it reported a split.
+func (c Config) price(u Usage, hasCost bool) Usage {
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.InputTokens + u.OutputTokens
+	}
+	if !hasCost {
+		u.CostUSD = (float64(u.InputTokens)*c.InputUSDPerMTok + float64(u.OutputTokens)*c.OutputUSDPerMTok) / 1e6
+	}
+	return u
+}
+
+type compiledPattern struct {
+	re         *regexp.Regexp
+	cumulative bool
+}
+
+// Meter turns a session's output lines into usage. It remembers the last
+// reading of cumulative patterns so that only the increase is counted.
+type Meter struct {
+	cfg      Config
+	patterns []compiledPattern
+	last     []*Usage
+	baseline Usage
+}
+
+// NewMeter compiles the patterns of cfg. baseline is the usage already
+// counted for the session, so cumulative readings after a restart only
+// count what is new.
+func NewMeter(cfg Config, baseline Usage) (*Meter, error) {
+	m := &Meter{cfg: cfg, baseline: baseline}
+	for i, p := range cfg.Patterns {
+		re, err := p.compile()
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i, err)
+		}
+		m.patterns = append(m.patterns, compiledPattern{re: re, cumulative: p.Cumulative})
+	}
+	m.last = make([]*Usage, len(m.patterns))
+	return m, nil
+}
+
+// Observe returns the usage reported by line, if any.
+func (m *Meter) Observe(line string) (Usage, bool) {
+	if m == nil {
+		return Usage{}, false
+	}
+	for i, p := range m.patterns {
+		match := p.re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		var u Usage
+		hasCost := false
+		for j, name := range p.re.SubexpNames() {
+			if name == "" || match[j] == "" {
+				continue
+			}
+			if name == "cost" {
+				cost, err := parseCost(match[j])
+				if err != nil {
+					continue
+				}
+				u.CostUSD, hasCost = cost, true
+				continue
+			}
+			n, err := parseCount(match[j])
+			if err != nil {
+				continue
+			}
+			switch name {
+			case "input":
+				u.InputTokens = n
+			case "output":
+				u.OutputTokens = n
+			case "total":
+				u.TotalTokens = n
+			}
+		}
+		u = m.cfg.price(u, hasCost)
+		if p.cumulative {
+			prev := m.last[i]
+			reading := u
+			m.last[i] = &reading
+			if prev == nil {
+				// The baseline may include amounts of other patterns,
+				// so it only lowers what this reading reports.
+				u = u.clampedSub(m.baseline)
+			} else if d, ok := u.sub(*prev); ok {
+				u = d
+			}
+		}
+		return u, !u.IsZero()
+	}
+	return Usage{}, false
+}
+
+// parseCount parses token counts such as "12,345", "1.2k" or "3M".
+func parseCount(raw string) (int64, error) {
+	s := strings.ReplaceAll(strings.TrimSpace(raw), ",", "")
+	s = strings.ReplaceAll(s, "_", "")
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		mult, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		mult, s = 1e6, s[:len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid token count %q", raw)
+	}
+	return int64(f*mult + 0.5), nil
+}
+
+func parseCost(raw string) (float64, error) {
+	s := strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(raw), ",", ""), "$")
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid cost %q", raw)
+	}
+	return f, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
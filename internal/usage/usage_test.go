@@ -0,0 +1,203 @@
+package usage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMeterObserve(t *testing.T) {
+	cfg := Config{
+		Patterns: []Pattern{
+			{Regex: `Total cost:\s+(?P<cost>\$[\d.]+)`, Cumulative: true},
+			{Regex: `tokens used: (?P<total>[\d,.]+[kM]?)`},
+			{Regex: `in=(?P<input>\d+) out=(?P<output>\d+)`},
+		},
+		InputUSDPerMTok:  3,
+		OutputUSDPerMTok: 15,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	m, err := NewMeter(cfg, Usage{CostUSD: 0.5})
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+
+	cases := []struct {
+		line string
+		ok   bool
+		want Usage
+	}{
+		{"nothing to see", false, Usage{}},
+		{"tokens used: 12,345", true, Usage{TotalTokens: 12345}},
+		{"tokens used: 1.5k", true, Usage{TotalTokens: 1500}},
+		{"in=1000000 out=100000", true, Usage{InputTokens: 1000000, OutputTokens: 100000, TotalTokens: 1100000, CostUSD: 4.5}},
+		// The baseline was already counted before a restart.
+		{"Total cost: $0.75", true, Usage{CostUSD: 0.25}},
+		{"Total cost: $0.75", false, Usage{}},
+		{"Total cost: $1.00", true, Usage{CostUSD: 0.25}},
+		// The counter went down: the agent restarted it.
+		{"Total cost: $0.10", true, Usage{CostUSD: 0.10}},
+	}
+	for _, tc := range cases {
+		got, ok := m.Observe(tc.line)
+		if ok != tc.ok || !closeTo(got, tc.want) {
+			t.Fatalf("Observe(%q)=%+v,%v want %+v,%v", tc.line, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	for _, bad := range []Config{
+		{Patterns: []Pattern{{Regex: `cost (\d+)`}}},
+		{Patterns: []Pattern{{Regex: `(?P<price>\d+)`}}},
+		{Patterns: []Pattern{{Regex: `(`}}},
+		{Log: &LogConfig{Path: "x.jsonl"}},
+		{InputUSDPerMTok: -1},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) expected error", bad)
+		}
+	}
+}
+
+func TestLogTailerPoll(t *testing.T) {
+	dir := t.TempDir()
+	workDir := "/work/proj.one"
+	logDir := filepath.Join(dir, slug(workDir))
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	start := time.Now().UTC()
+	old := filepath.Join(logDir, "old.jsonl")
+	if err := os.WriteFile(old, []byte(`{"cwd":"/work/proj.one","message":{"usage":{"input_tokens":999,"output_tokens":999}}}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	past := start.Add(-time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	cfg := Config{
+		Log: &LogConfig{
+			Path:         filepath.Join(dir, "{work_dir_slug}", "*.jsonl"),
+			InputTokens:  "message.usage.input_tokens",
+			OutputTokens: "message.usage.output_tokens",
+			WorkDir:      "cwd",
+		},
+		InputUSDPerMTok:  1,
+		OutputUSDPerMTok: 2,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	tailer := NewLogTailer(cfg, workDir, start)
+	if u, err := tailer.Poll(); err != nil || !u.IsZero() {
+		t.Fatalf("first Poll=%+v,%v want nothing from before the session", u, err)
+	}
+
+	appendLines(t, old, `{"cwd":"/work/proj.one","message":{"usage":{"input_tokens":100,"output_tokens":10}}}`,
+		`{"cwd":"/elsewhere","message":{"usage":{"input_tokens":5000,"output_tokens":5000}}}`)
+	appendLines(t, filepath.Join(logDir, "new.jsonl"), `not json`, `{"cwd":"/work/proj.one","message":{"usage":{"input_tokens":"400","output_tokens":40}}}`)
+	f, err := os.OpenFile(filepath.Join(logDir, "new.jsonl"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.WriteString(`{"cwd":"/work/proj.one","message":{"usage":{"input_tokens":7`)
+	f.Close()
+
+	u, err := tailer.Poll()
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	want := Usage{InputTokens: 500, OutputTokens: 50, TotalTokens: 550, CostUSD: 0.0006}
+	if !closeTo(u, want) {
+		t.Fatalf("Poll=%+v want %+v", u, want)
+	}
+	if u, _ := tailer.Poll(); !u.IsZero() {
+		t.Fatalf("second Poll=%+v want nothing new", u)
+	}
+}
+
+func TestLogTailerCumulativeFilesAndTurnIDs(t *testing.T) {
+	dir := t.TempDir()
+	workDir := "/work/proj"
+	start := time.Now().UTC()
+	stamp := start.Add(time.Second).Format(time.RFC3339Nano)
+	early := start.Add(-time.Minute).Format(time.RFC3339Nano)
+	meta := func(cwd string) string {
+		return `{"type":"session_meta","payload":{"cwd":"` + cwd + `"}}`
+	}
+	total := func(ts string, in, out int) string {
+		return fmt.Sprintf(`{"timestamp":%q,"payload":{"info":{"total_token_usage":{"input_tokens":%d,"output_tokens":%d}}}}`, ts, in, out)
+	}
+
+	// A resumed rollout: only what it adds to its running total counts.
+	resumed := filepath.Join(dir, "rollout-resumed.jsonl")
+	appendLines(t, resumed, meta(workDir), total(early, 1000, 100))
+	past := start.Add(-time.Hour)
+	if err := os.Chtimes(resumed, past, past); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	cfg := Config{Log: &LogConfig{
+		Path:         filepath.Join(dir, "rollout-*.jsonl"),
+		InputTokens:  "payload.info.total_token_usage.input_tokens",
+		OutputTokens: "payload.info.total_token_usage.output_tokens",
+		Timestamp:    "timestamp",
+		FileWorkDir:  "payload.cwd",
+		Cumulative:   true,
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	tailer := NewLogTailer(cfg, workDir, start)
+	if u, err := tailer.Poll(); err != nil || !u.IsZero() {
+		t.Fatalf("first Poll=%+v,%v want nothing", u, err)
+	}
+	appendLines(t, resumed, `{"timestamp":"x","payload":{"info":null}}`, total(stamp, 1500, 150))
+	appendLines(t, filepath.Join(dir, "rollout-new.jsonl"), meta(workDir), total(stamp, 200, 20), total(stamp, 300, 30))
+	appendLines(t, filepath.Join(dir, "rollout-other.jsonl"), meta("/work/other"), total(stamp, 9000, 900))
+	u, err := tailer.Poll()
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if want := (Usage{InputTokens: 800, OutputTokens: 80, TotalTokens: 880}); !closeTo(u, want) {
+		t.Fatalf("Poll=%+v want %+v", u, want)
+	}
+
+	// One turn logged over several entries counts once.
+	cfg = Config{Log: &LogConfig{
+		Path:         filepath.Join(dir, "*.log"),
+		InputTokens:  "message.usage.input_tokens",
+		OutputTokens: "message.usage.output_tokens",
+		ID:           "message.id",
+	}}
+	tailer = NewLogTailer(cfg, workDir, start)
+	appendLines(t, filepath.Join(dir, "turns.log"),
+		`{"message":{"id":"a","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"message":{"id":"a","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"message":{"id":"b","usage":{"input_tokens":20,"output_tokens":2}}}`)
+	if u, _ := tailer.Poll(); !closeTo(u, Usage{InputTokens: 30, OutputTokens: 3, TotalTokens: 33}) {
+		t.Fatalf("Poll=%+v want each turn once", u)
+	}
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+}
+
+func closeTo(a, b Usage) bool {
+	return a.InputTokens == b.InputTokens && a.OutputTokens == b.OutputTokens && a.TotalTokens == b.TotalTokens && math.Abs(a.CostUSD-b.CostUSD) < 1e-9
+}
@@ -0,0 +1,260 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Color is a terminal color: DefaultColor, a palette index 0-255, or a
+// 24-bit RGB value tagged with colorRGB.
+type Color int32
+
+const (
+	DefaultColor Color = -1
+	colorRGB     Color = 1 << 24
+)
+
+// RGB returns a truecolor Color.
+func RGB(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Attr flags.
+const (
+	AttrBold uint8 = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+// Attr is the rendition of a cell. The zero value is the default rendition;
+// colors are stored offset by one so that zero means "default".
+type Attr struct {
+	FG, BG Color
+	Flags  uint8
+}
+
+// Foreground returns the foreground color, or DefaultColor.
+func (a Attr) Foreground() Color { return a.FG - 1 }
+
+// Background returns the background color, or DefaultColor.
+func (a Attr) Background() Color { return a.BG - 1 }
+
+// Cell is one screen position. A Rune of 0 marks the right half of a wide
+// character.
+type Cell struct {
+	Rune rune
+	Attr Attr
+}
+
+// sgr applies a Select Graphic Rendition sequence to the cursor attributes.
+func (s *Screen) sgr() {
+	params := s.params
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	a := &s.cur.attr
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			*a = Attr{}
+		case p == 1:
+			a.Flags |= AttrBold
+		case p == 2:
+			a.Flags |= AttrDim
+		case p == 3:
+			a.Flags |= AttrItalic
+		case p == 4:
+			a.Flags |= AttrUnderline
+		case p == 5 || p == 6:
+			a.Flags |= AttrBlink
+		case p == 7:
+			a.Flags |= AttrReverse
+		case p == 8:
+			a.Flags |= AttrHidden
+		case p == 9:
+			a.Flags |= AttrStrike
+		case p == 21 || p == 22:
+			a.Flags &^= AttrBold | AttrDim
+		case p == 23:
+			a.Flags &^= AttrItalic
+		case p == 24:
+			a.Flags &^= AttrUnderline
+		case p == 25:
+			a.Flags &^= AttrBlink
+		case p == 27:
+			a.Flags &^= AttrReverse
+		case p == 28:
+			a.Flags &^= AttrHidden
+		case p == 29:
+			a.Flags &^= AttrStrike
+		case p >= 30 && p <= 37:
+			a.FG = Color(p-30) + 1
+		case p == 38 || p == 48:
+			c, used := extendedColor(params[i+1:])
+			i += used
+			if c != DefaultColor {
+				if p == 38 {
+					a.FG = c + 1
+				} else {
+					a.BG = c + 1
+				}
+			}
+		case p == 39:
+			a.FG = 0
+		case p >= 40 && p <= 47:
+			a.BG = Color(p-40) + 1
+		case p == 49:
+			a.BG = 0
+		case p >= 90 && p <= 97:
+			a.FG = Color(p-90+8) + 1
+		case p >= 100 && p <= 107:
+			a.BG = Color(p-100+8) + 1
+		}
+	}
+}
+
+// extendedColor parses the arguments following SGR 38/48 and reports how
+// many parameters it consumed.
+func extendedColor(args []int) (Color, int) {
+	if len(args) == 0 {
+		return DefaultColor, 0
+	}
+	switch args[0] {
+	case 5:
+		if len(args) < 2 {
+			return DefaultColor, len(args)
+		}
+		return Color(clamp(args[1], 0, 255)), 2
+	case 2:
+		if len(args) < 4 {
+			return DefaultColor, len(args)
+		}
+		return RGB(uint8(clamp(args[1], 0, 255)), uint8(clamp(args[2], 0, 255)), uint8(clamp(args[3], 0, 255))), 4
+	}
+	return DefaultColor, 1
+}
+
+// writeSGR renders a as a complete SGR sequence starting from a reset.
+func writeSGR(b *strings.Builder, a Attr) {
+	b.WriteString("\x1b[0")
+	flags := []struct {
+		bit  uint8
+		code string
+	}{
+		{AttrBold, "1"}, {AttrDim, "2"}, {AttrItalic, "3"}, {AttrUnderline, "4"},
+		{AttrBlink, "5"}, {AttrReverse, "7"}, {AttrHidden, "8"}, {AttrStrike, "9"},
+	}
+	for _, f := range flags {
+		if a.Flags&f.bit != 0 {
+			b.WriteByte(';')
+			b.WriteString(f.code)
+		}
+	}
+	writeColor(b, a.Foreground(), 30, 90, "38")
+	writeColor(b, a.Background(), 40, 100, "48")
+	b.WriteByte('m')
+}
+
+func writeColor(b *strings.Builder, c Color, base, brightBase int, extended string) {
+	switch {
+	case c == DefaultColor:
+		return
+	case c&colorRGB != 0:
+		b.WriteString(";" + extended + ";2;")
+		b.WriteString(strconv.Itoa(int(c>>16) & 0xff))
+		b.WriteByte(';')
+		b.WriteString(strconv.Itoa(int(c>>8) & 0xff))
+		b.WriteByte(';')
+		b.WriteString(strconv.Itoa(int(c) & 0xff))
+	case c < 8:
+		b.WriteString(";" + strconv.Itoa(base+int(c)))
+	case c < 16:
+		b.WriteString(";" + strconv.Itoa(brightBase+int(c)-8))
+	default:
+		b.WriteString(";" + extended + ";5;" + strconv.Itoa(int(c)))
+	}
+}
+
+// runeWidth returns the number of columns r occupies: 0 for combining and
+// format characters, 2 for East Asian wide characters and emoji, 1
+// otherwise.
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, rg := range wideRanges {
+		if r < rg[0] {
+			break
+		}
+		if r <= rg[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},
+	{0x231a, 0x231b},
+	{0x2329, 0x232a},
+	{0x23e9, 0x23ec},
+	{0x23f0, 0x23f0},
+	{0x23f3, 0x23f3},
+	{0x25fd, 0x25fe},
+	{0x2614, 0x2615},
+	{0x2648, 0x2653},
+	{0x267f, 0x267f},
+	{0x2693, 0x2693},
+	{0x26a1, 0x26a1},
+	{0x26aa, 0x26ab},
+	{0x26bd, 0x26be},
+	{0x26c4, 0x26c5},
+	{0x26ce, 0x26ce},
+	{0x26d4, 0x26d4},
+	{0x26ea, 0x26ea},
+	{0x26f2, 0x26f3},
+	{0x26f5, 0x26f5},
+	{0x26fa, 0x26fa},
+	{0x26fd, 0x26fd},
+	{0x2705, 0x2705},
+	{0x270a, 0x270b},
+	{0x2728, 0x2728},
+	{0x274c, 0x274c},
+	{0x274e, 0x274e},
+	{0x2753, 0x2755},
+	{0x2757, 0x2757},
+	{0x2795, 0x2797},
+	{0x27b0, 0x27b0},
+	{0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xa960, 0xa97f},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x1f300, 0x1f64f},
+	{0x1f680, 0x1f6ff},
+	{0x1f900, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
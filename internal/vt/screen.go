@@ -0,0 +1,856 @@
+// Package vt is a small VT100/xterm screen emulator. It consumes the raw
+// byte stream of a terminal session and maintains the screen grid, cursor,
+// alternate screen and scrollback, so callers can ask for what a human
+// looking at the terminal would actually see instead of replaying escape
+// sequences.
+//
+// Only the subset of xterm used by shells and full-screen TUIs is
+// interpreted; unknown sequences are consumed and ignored.
+package vt
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultScrollback is the scrollback length used by New when a
+	// non-positive limit is given.
+	DefaultScrollback = 5000
+
+	maxParams    = 32
+	maxOSCLength = 4096
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateOSCEscape
+	stateString // DCS, SOS, PM, APC: consumed until ST
+	stateStringEscape
+)
+
+type line struct {
+	cells   []Cell
+	wrapped bool // the row continues on the next one (soft wrap)
+}
+
+type cursor struct {
+	col, row    int
+	attr        Attr
+	originMode  bool
+	lineDrawing bool
+}
+
+// Screen is a terminal screen emulator. It is safe for concurrent use.
+type Screen struct {
+	mu sync.Mutex
+
+	cols, rows int
+	primary    []line
+	alternate  []line
+	altActive  bool
+	scrollback []line
+	maxScroll  int
+
+	cur           cursor
+	saved         cursor
+	savedAlt      cursor
+	wrapPending   bool
+	top, bottom   int // scroll region, inclusive
+	autowrap      bool
+	insertMode    bool
+	cursorVisible bool
+	tabs          []bool
+	title         string
+	lastRune      rune
+
+	state        parserState
+	params       []int
+	paramStarted bool
+	private      byte
+	intermediate byte
+	osc          []byte
+	utf8Buf      []byte
+}
+
+// New creates a screen of cols x rows keeping up to scrollback lines of
+// history.
+func New(cols, rows, scrollback int) *Screen {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	if scrollback <= 0 {
+		scrollback = DefaultScrollback
+	}
+	s := &Screen{maxScroll: scrollback}
+	s.reset(cols, rows)
+	return s
+}
+
+func (s *Screen) reset(cols, rows int) {
+	s.cols, s.rows = cols, rows
+	s.primary = blankLines(cols, rows, Attr{})
+	s.alternate = blankLines(cols, rows, Attr{})
+	s.altActive = false
+	s.scrollback = nil
+	s.cur = cursor{}
+	s.saved = cursor{}
+	s.savedAlt = cursor{}
+	s.wrapPending = false
+	s.top, s.bottom = 0, rows-1
+	s.autowrap = true
+	s.insertMode = false
+	s.cursorVisible = true
+	s.title = ""
+	s.resetTabs()
+	s.state = stateGround
+}
+
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+func blankLines(cols, rows int, attr Attr) []line {
+	lines := make([]line, rows)
+	for i := range lines {
+		lines[i] = line{cells: blankCells(cols, attr)}
+	}
+	return lines
+}
+
+func blankCells(n int, attr Attr) []Cell {
+	cells := make([]Cell, n)
+	blank := Cell{Rune: ' ', Attr: attr}
+	for i := range cells {
+		cells[i] = blank
+	}
+	return cells
+}
+
+// Write feeds terminal output to the emulator. It never fails.
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range p {
+		s.feed(b)
+	}
+	return len(p), nil
+}
+
+// Resize changes the screen size. Rows that no longer fit above the cursor
+// move to the scrollback; text is truncated, not reflowed.
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cols == s.cols && rows == s.rows {
+		return
+	}
+
+	if s.cur.row >= rows {
+		drop := s.cur.row - rows + 1
+		if s.altActive {
+			s.alternate = s.alternate[drop:]
+		} else {
+			s.pushScrollback(s.primary[:drop])
+			s.primary = s.primary[drop:]
+		}
+		s.cur.row -= drop
+	}
+	s.primary = resizeLines(s.primary, cols, rows)
+	s.alternate = resizeLines(s.alternate, cols, rows)
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.cur.col = clamp(s.cur.col, 0, cols-1)
+	s.cur.row = clamp(s.cur.row, 0, rows-1)
+	s.saved.col = clamp(s.saved.col, 0, cols-1)
+	s.saved.row = clamp(s.saved.row, 0, rows-1)
+	s.savedAlt.col = clamp(s.savedAlt.col, 0, cols-1)
+	s.savedAlt.row = clamp(s.savedAlt.row, 0, rows-1)
+	s.wrapPending = false
+	s.resetTabs()
+}
+
+func resizeLines(lines []line, cols, rows int) []line {
+	out := make([]line, rows)
+	for i := range out {
+		if i < len(lines) {
+			out[i] = line{cells: resizeCells(lines[i].cells, cols), wrapped: lines[i].wrapped}
+		} else {
+			out[i] = line{cells: blankCells(cols, Attr{})}
+		}
+	}
+	return out
+}
+
+func resizeCells(cells []Cell, cols int) []Cell {
+	if len(cells) >= cols {
+		out := append([]Cell(nil), cells[:cols]...)
+		if cols > 0 && out[cols-1].Rune == 0 {
+			out[cols-1] = Cell{Rune: ' '}
+		}
+		return out
+	}
+	return append(append([]Cell(nil), cells...), blankCells(cols-len(cells), Attr{})...)
+}
+
+func (s *Screen) grid() []line {
+	if s.altActive {
+		return s.alternate
+	}
+	return s.primary
+}
+
+func (s *Screen) pushScrollback(lines []line) {
+	for _, l := range lines {
+		s.scrollback = append(s.scrollback, line{cells: append([]Cell(nil), l.cells...), wrapped: l.wrapped})
+	}
+	if over := len(s.scrollback) - s.maxScroll; over > 0 {
+		s.scrollback = append([]line(nil), s.scrollback[over:]...)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Parser
+// ---------------------------------------------------------------------------
+
+func (s *Screen) feed(b byte) {
+	switch s.state {
+	case stateOSC:
+		switch b {
+		case 0x07:
+			s.finishOSC()
+		case 0x1b:
+			s.state = stateOSCEscape
+		default:
+			if len(s.osc) < maxOSCLength {
+				s.osc = append(s.osc, b)
+			}
+		}
+		return
+	case stateOSCEscape:
+		if b == '\\' {
+			s.finishOSC()
+			return
+		}
+		s.state = stateEscape
+		s.feedEscape(b)
+		return
+	case stateString:
+		if b == 0x1b {
+			s.state = stateStringEscape
+		} else if b == 0x07 {
+			s.state = stateGround
+		}
+		return
+	case stateStringEscape:
+		if b == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateString
+		}
+		return
+	}
+
+	if len(s.utf8Buf) > 0 || (b >= 0x80 && s.state == stateGround) {
+		s.feedUTF8(b)
+		return
+	}
+
+	if b < 0x20 || b == 0x7f {
+		s.control(b)
+		return
+	}
+
+	switch s.state {
+	case stateGround:
+		s.print(rune(b))
+	case stateEscape:
+		s.feedEscape(b)
+	case stateEscapeIntermediate:
+		if s.intermediate == '(' && b == '0' {
+			s.cur.lineDrawing = true
+		} else if s.intermediate == '(' {
+			s.cur.lineDrawing = false
+		}
+		s.state = stateGround
+	case stateCSI:
+		s.feedCSI(b)
+	}
+}
+
+func (s *Screen) feedUTF8(b byte) {
+	if len(s.utf8Buf) > 0 && (b < 0x80 || b >= 0xc0) {
+		// Invalid continuation: emit a replacement and reprocess b.
+		s.utf8Buf = s.utf8Buf[:0]
+		s.print(utf8.RuneError)
+		s.feed(b)
+		return
+	}
+	s.utf8Buf = append(s.utf8Buf, b)
+	if !utf8.FullRune(s.utf8Buf) {
+		if len(s.utf8Buf) >= utf8.UTFMax {
+			s.utf8Buf = s.utf8Buf[:0]
+			s.print(utf8.RuneError)
+		}
+		return
+	}
+	r, _ := utf8.DecodeRune(s.utf8Buf)
+	s.utf8Buf = s.utf8Buf[:0]
+	s.print(r)
+}
+
+func (s *Screen) control(b byte) {
+	switch b {
+	case 0x08: // BS
+		if s.cur.col > 0 {
+			s.cur.col--
+		}
+		s.wrapPending = false
+	case 0x09: // HT
+		s.tab(1)
+	case 0x0a, 0x0b, 0x0c: // LF, VT, FF
+		s.index()
+	case 0x0d: // CR
+		s.cur.col = 0
+		s.wrapPending = false
+	case 0x18, 0x1a: // CAN, SUB abort a sequence
+		s.state = stateGround
+	case 0x1b:
+		s.state = stateEscape
+		s.intermediate = 0
+	}
+}
+
+func (s *Screen) feedEscape(b byte) {
+	s.state = stateGround
+	switch b {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+		s.paramStarted = false
+		s.private = 0
+		s.intermediate = 0
+	case ']':
+		s.state = stateOSC
+		s.osc = s.osc[:0]
+	case 'P', 'X', '^', '_':
+		s.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		s.state = stateEscapeIntermediate
+		s.intermediate = b
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.cur.col = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'H':
+		if s.cur.col < s.cols {
+			s.tabs[s.cur.col] = true
+		}
+	case 'c':
+		s.reset(s.cols, s.rows)
+	}
+}
+
+func (s *Screen) feedCSI(b byte) {
+	switch {
+	case b >= '0' && b <= '9':
+		if !s.paramStarted {
+			s.params = append(s.params, 0)
+			s.paramStarted = true
+		}
+		last := len(s.params) - 1
+		if s.params[last] < 100000 {
+			s.params[last] = s.params[last]*10 + int(b-'0')
+		}
+	case b == ';' || b == ':':
+		if !s.paramStarted {
+			s.params = append(s.params, 0)
+		}
+		s.paramStarted = false
+		if len(s.params) >= maxParams {
+			s.state = stateGround
+		}
+	case b >= '<' && b <= '?':
+		s.private = b
+	case b >= 0x20 && b <= 0x2f:
+		s.intermediate = b
+	case b >= 0x40 && b <= 0x7e:
+		s.state = stateGround
+		s.dispatchCSI(b)
+	default:
+		s.state = stateGround
+	}
+}
+
+func (s *Screen) finishOSC() {
+	s.state = stateGround
+	code, text, ok := strings.Cut(string(s.osc), ";")
+	if ok && (code == "0" || code == "2") {
+		s.title = text
+	}
+}
+
+// param returns the i-th CSI parameter, or def when missing or zero.
+func (s *Screen) param(i, def int) int {
+	if i < len(s.params) && s.params[i] > 0 {
+		return s.params[i]
+	}
+	return def
+}
+
+func (s *Screen) dispatchCSI(final byte) {
+	if s.intermediate != 0 {
+		return // e.g. DECSCUSR (CSI Ps SP q); nothing to track
+	}
+	if s.private == '?' {
+		switch final {
+		case 'h':
+			s.setPrivateModes(true)
+		case 'l':
+			s.setPrivateModes(false)
+		}
+		return
+	}
+	if s.private != 0 {
+		return
+	}
+
+	n := s.param(0, 1)
+	switch final {
+	case '@':
+		s.insertBlanks(n)
+	case 'A':
+		s.moveTo(s.cur.col, max(s.cur.row-n, s.scrollTopFor()))
+	case 'B', 'e':
+		s.moveTo(s.cur.col, min(s.cur.row+n, s.scrollBottomFor()))
+	case 'C', 'a':
+		s.moveTo(s.cur.col+n, s.cur.row)
+	case 'D':
+		s.moveTo(s.cur.col-n, s.cur.row)
+	case 'E':
+		s.moveTo(0, min(s.cur.row+n, s.scrollBottomFor()))
+	case 'F':
+		s.moveTo(0, max(s.cur.row-n, s.scrollTopFor()))
+	case 'G', '`':
+		s.moveTo(n-1, s.cur.row)
+	case 'H', 'f':
+		row := s.param(0, 1) - 1
+		col := s.param(1, 1) - 1
+		if s.cur.originMode {
+			row += s.top
+		}
+		s.moveTo(col, row)
+	case 'd':
+		row := n - 1
+		if s.cur.originMode {
+			row += s.top
+		}
+		s.moveTo(s.cur.col, row)
+	case 'I':
+		s.tab(n)
+	case 'Z':
+		s.backTab(n)
+	case 'J':
+		s.eraseDisplay(s.param(0, 0))
+	case 'K':
+		s.eraseLine(s.param(0, 0))
+	case 'L':
+		s.insertLines(n)
+	case 'M':
+		s.deleteLines(n)
+	case 'P':
+		s.deleteChars(n)
+	case 'X':
+		s.eraseChars(n)
+	case 'S':
+		s.scrollUp(s.top, s.bottom, n)
+	case 'T':
+		s.scrollDown(s.top, s.bottom, n)
+	case 'b':
+		if s.lastRune != 0 {
+			for i := 0; i < n && i < s.cols*s.rows; i++ {
+				s.print(s.lastRune)
+			}
+		}
+	case 'g':
+		switch s.param(0, 0) {
+		case 0:
+			if s.cur.col < s.cols {
+				s.tabs[s.cur.col] = false
+			}
+		case 3:
+			s.tabs = make([]bool, s.cols)
+		}
+	case 'h', 'l':
+		for i := range s.params {
+			if s.params[i] == 4 {
+				s.insertMode = final == 'h'
+			}
+		}
+	case 'm':
+		s.sgr()
+	case 'r':
+		top := s.param(0, 1) - 1
+		bottom := s.param(1, s.rows) - 1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, s.scrollTopFor())
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+func (s *Screen) setPrivateModes(on bool) {
+	for _, mode := range s.params {
+		switch mode {
+		case 6:
+			s.cur.originMode = on
+			s.moveTo(0, s.scrollTopFor())
+		case 7:
+			s.autowrap = on
+		case 25:
+			s.cursorVisible = on
+		case 47, 1047:
+			s.switchScreen(on, false)
+		case 1048:
+			if on {
+				s.saveCursor()
+			} else {
+				s.restoreCursor()
+			}
+		case 1049:
+			s.switchScreen(on, true)
+		}
+	}
+}
+
+func (s *Screen) switchScreen(alt bool, saveCursor bool) {
+	if alt == s.altActive {
+		return
+	}
+	if alt {
+		if saveCursor {
+			s.savedAlt = s.cur
+		}
+		s.altActive = true
+		s.alternate = blankLines(s.cols, s.rows, Attr{})
+	} else {
+		s.altActive = false
+		if saveCursor {
+			s.cur = s.savedAlt
+			s.cur.col = clamp(s.cur.col, 0, s.cols-1)
+			s.cur.row = clamp(s.cur.row, 0, s.rows-1)
+		}
+	}
+	s.wrapPending = false
+}
+
+// ---------------------------------------------------------------------------
+// Screen operations
+// ---------------------------------------------------------------------------
+
+func (s *Screen) print(r rune) {
+	if s.cur.lineDrawing && r < 0x80 {
+		if mapped, ok := decSpecialGraphics[r]; ok {
+			r = mapped
+		}
+	}
+	width := runeWidth(r)
+	if width == 0 {
+		return // combining marks are not tracked
+	}
+	if width == 2 && s.cols < 2 {
+		r, width = utf8.RuneError, 1 // a wide character cannot fit
+	}
+	s.lastRune = r
+
+	if s.wrapPending && s.autowrap {
+		s.grid()[s.cur.row].wrapped = true
+		s.cur.col = 0
+		s.index()
+	}
+	s.wrapPending = false
+
+	if width == 2 && s.cur.col == s.cols-1 {
+		if !s.autowrap {
+			return
+		}
+		g := s.grid()
+		g[s.cur.row].cells[s.cur.col] = Cell{Rune: ' ', Attr: s.cur.attr}
+		g[s.cur.row].wrapped = true
+		s.cur.col = 0
+		s.index()
+	}
+
+	cells := s.grid()[s.cur.row].cells
+	if s.insertMode {
+		copy(cells[s.cur.col+width:], cells[s.cur.col:])
+	}
+	s.clearWideAt(cells, s.cur.col)
+	cells[s.cur.col] = Cell{Rune: r, Attr: s.cur.attr}
+	if width == 2 {
+		s.clearWideAt(cells, s.cur.col+1)
+		cells[s.cur.col+1] = Cell{Rune: 0, Attr: s.cur.attr}
+	}
+
+	if s.cur.col+width >= s.cols {
+		s.cur.col = s.cols - 1
+		s.wrapPending = s.autowrap
+	} else {
+		s.cur.col += width
+	}
+}
+
+// clearWideAt blanks the other half of a wide character overlapping col so
+// no orphaned half remains after an overwrite.
+func (s *Screen) clearWideAt(cells []Cell, col int) {
+	if col >= len(cells) {
+		return
+	}
+	if cells[col].Rune == 0 && col > 0 {
+		cells[col-1] = Cell{Rune: ' ', Attr: cells[col-1].Attr}
+	}
+	if col+1 < len(cells) && cells[col+1].Rune == 0 {
+		cells[col+1] = Cell{Rune: ' ', Attr: cells[col+1].Attr}
+	}
+}
+
+func (s *Screen) moveTo(col, row int) {
+	s.cur.col = clamp(col, 0, s.cols-1)
+	s.cur.row = clamp(row, 0, s.rows-1)
+	s.wrapPending = false
+}
+
+func (s *Screen) scrollTopFor() int {
+	if s.cur.row >= s.top {
+		return s.top
+	}
+	return 0
+}
+
+func (s *Screen) scrollBottomFor() int {
+	if s.cur.row <= s.bottom {
+		return s.bottom
+	}
+	return s.rows - 1
+}
+
+func (s *Screen) index() {
+	s.wrapPending = false
+	if s.cur.row == s.bottom {
+		s.scrollUp(s.top, s.bottom, 1)
+		return
+	}
+	if s.cur.row < s.rows-1 {
+		s.cur.row++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	s.wrapPending = false
+	if s.cur.row == s.top {
+		s.scrollDown(s.top, s.bottom, 1)
+		return
+	}
+	if s.cur.row > 0 {
+		s.cur.row--
+	}
+}
+
+func (s *Screen) tab(n int) {
+	for ; n > 0; n-- {
+		col := s.cur.col + 1
+		for col < s.cols-1 && !s.tabs[col] {
+			col++
+		}
+		s.cur.col = min(col, s.cols-1)
+	}
+	s.wrapPending = false
+}
+
+func (s *Screen) backTab(n int) {
+	for ; n > 0; n-- {
+		col := s.cur.col - 1
+		for col > 0 && !s.tabs[col] {
+			col--
+		}
+		s.cur.col = max(col, 0)
+	}
+	s.wrapPending = false
+}
+
+func (s *Screen) blankAttr() Attr {
+	return Attr{BG: s.cur.attr.BG}
+}
+
+func (s *Screen) scrollUp(top, bottom, n int) {
+	g := s.grid()
+	n = min(n, bottom-top+1)
+	if n <= 0 {
+		return
+	}
+	if !s.altActive && top == 0 {
+		s.pushScrollback(g[:n])
+	}
+	copy(g[top:], g[top+n:bottom+1])
+	for i := bottom - n + 1; i <= bottom; i++ {
+		g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+	}
+}
+
+func (s *Screen) scrollDown(top, bottom, n int) {
+	g := s.grid()
+	n = min(n, bottom-top+1)
+	if n <= 0 {
+		return
+	}
+	copy(g[top+n:bottom+1], g[top:bottom+1-n])
+	for i := top; i < top+n; i++ {
+		g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+	}
+}
+
+func (s *Screen) insertLines(n int) {
+	if s.cur.row < s.top || s.cur.row > s.bottom {
+		return
+	}
+	s.scrollDown(s.cur.row, s.bottom, n)
+	s.cur.col = 0
+	s.wrapPending = false
+}
+
+func (s *Screen) deleteLines(n int) {
+	if s.cur.row < s.top || s.cur.row > s.bottom {
+		return
+	}
+	g := s.grid()
+	n = min(n, s.bottom-s.cur.row+1)
+	copy(g[s.cur.row:], g[s.cur.row+n:s.bottom+1])
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+	}
+	s.cur.col = 0
+	s.wrapPending = false
+}
+
+func (s *Screen) insertBlanks(n int) {
+	cells := s.grid()[s.cur.row].cells
+	n = min(n, s.cols-s.cur.col)
+	copy(cells[s.cur.col+n:], cells[s.cur.col:])
+	fillCells(cells[s.cur.col:s.cur.col+n], s.blankAttr())
+	s.wrapPending = false
+}
+
+func (s *Screen) deleteChars(n int) {
+	cells := s.grid()[s.cur.row].cells
+	n = min(n, s.cols-s.cur.col)
+	copy(cells[s.cur.col:], cells[s.cur.col+n:])
+	fillCells(cells[s.cols-n:], s.blankAttr())
+	s.wrapPending = false
+}
+
+func (s *Screen) eraseChars(n int) {
+	cells := s.grid()[s.cur.row].cells
+	end := min(s.cur.col+n, s.cols)
+	fillCells(cells[s.cur.col:end], s.blankAttr())
+	s.wrapPending = false
+}
+
+func (s *Screen) eraseLine(mode int) {
+	l := &s.grid()[s.cur.row]
+	switch mode {
+	case 0:
+		fillCells(l.cells[s.cur.col:], s.blankAttr())
+		l.wrapped = false
+	case 1:
+		fillCells(l.cells[:s.cur.col+1], s.blankAttr())
+	case 2:
+		fillCells(l.cells, s.blankAttr())
+		l.wrapped = false
+	}
+	s.wrapPending = false
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	g := s.grid()
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for i := s.cur.row + 1; i < s.rows; i++ {
+			g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+		}
+	case 1:
+		s.eraseLine(1)
+		for i := 0; i < s.cur.row; i++ {
+			g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+		}
+	case 2:
+		for i := range g {
+			g[i] = line{cells: blankCells(s.cols, s.blankAttr())}
+		}
+	case 3:
+		s.scrollback = nil
+	}
+	s.wrapPending = false
+}
+
+func fillCells(cells []Cell, attr Attr) {
+	for i := range cells {
+		cells[i] = Cell{Rune: ' ', Attr: attr}
+	}
+}
+
+func (s *Screen) saveCursor() {
+	s.saved = s.cur
+}
+
+func (s *Screen) restoreCursor() {
+	s.cur = s.saved
+	s.cur.col = clamp(s.cur.col, 0, s.cols-1)
+	s.cur.row = clamp(s.cur.row, 0, s.rows-1)
+	s.wrapPending = false
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// decSpecialGraphics maps the DEC line-drawing character set (ESC ( 0).
+var decSpecialGraphics = map[rune]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌',
+	'm': '└', 'n': '┼', 'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽',
+	't': '├', 'u': '┤', 'v': '┴', 'w': '┬', 'x': '│', 'y': '≤', 'z': '≥',
+	'{': 'π', '|': '≠', '}': '£', '~': '·',
+}
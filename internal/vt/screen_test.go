@@ -0,0 +1,217 @@
+package vt
+
+import (
+	"strings"
+	"testing"
+)
+
+func feed(s *Screen, text string) {
+	_, _ = s.Write([]byte(text))
+}
+
+func TestPlainTextAndCursor(t *testing.T) {
+	s := New(20, 4, 0)
+	feed(s, "hello\r\nworld")
+	snap := s.Snapshot()
+	if snap.Lines[0] != "hello" || snap.Lines[1] != "world" {
+		t.Fatalf("lines=%q", snap.Lines)
+	}
+	if snap.CursorRow != 1 || snap.CursorCol != 5 {
+		t.Fatalf("cursor=(%d,%d) want (1,5)", snap.CursorRow, snap.CursorCol)
+	}
+}
+
+func TestCarriageReturnRedrawOverwrites(t *testing.T) {
+	s := New(20, 3, 0)
+	// A spinner redrawn in place must leave only its final frame.
+	feed(s, "Working |\rWorking /\rWorking -\x1b[K\rDone\x1b[K")
+	if got := s.Snapshot().Lines[0]; got != "Done" {
+		t.Fatalf("line=%q want Done", got)
+	}
+}
+
+func TestCursorMovementAndErase(t *testing.T) {
+	s := New(10, 5, 0)
+	feed(s, "aaaaaaaaaa\r\nbbbbbbbbbb\r\ncccccccccc")
+	feed(s, "\x1b[2;3H\x1b[K")         // erase rest of row 2 from column 3
+	feed(s, "\x1b[1;5H\x1b[1K")        // erase row 1 through column 5
+	feed(s, "\x1b[3;1H\x1b[2C\x1b[3X") // erase 3 chars at column 3 of row 3
+	lines := s.Snapshot().Lines
+	want := []string{"     aaaaa", "bb", "cc   ccccc", "", ""}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("row %d=%q want %q (all=%q)", i, lines[i], want[i], lines)
+		}
+	}
+}
+
+func TestAutowrapAndScrollback(t *testing.T) {
+	s := New(5, 2, 10)
+	feed(s, "abcdefg\r\nline2\r\nline3")
+	snap := s.Snapshot()
+	if snap.Lines[0] != "line2" || snap.Lines[1] != "line3" {
+		t.Fatalf("screen=%q", snap.Lines)
+	}
+	// Soft-wrapped rows are joined back into one logical line.
+	got := s.History(0)
+	want := []string{"abcdefg", "line2", "line3"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("history=%q want %q", got, want)
+	}
+	if got := s.History(2); strings.Join(got, "|") != "line2|line3" {
+		t.Fatalf("history(2)=%q", got)
+	}
+}
+
+func TestScrollbackLimit(t *testing.T) {
+	s := New(10, 2, 3)
+	for i := 0; i < 20; i++ {
+		feed(s, "x\r\n")
+	}
+	if got := len(s.History(0)); got > 3+2 {
+		t.Fatalf("history has %d lines, scrollback limit not applied", got)
+	}
+}
+
+func TestAltScreenDoesNotLeakIntoPrimary(t *testing.T) {
+	s := New(20, 3, 0)
+	feed(s, "$ vim\r\n")
+	feed(s, "\x1b[?1049h\x1b[H\x1b[2Jeditor view")
+	snap := s.Snapshot()
+	if !snap.AltScreen || snap.Lines[0] != "editor view" {
+		t.Fatalf("alt snapshot=%+v", snap)
+	}
+	feed(s, "\x1b[?1049l")
+	snap = s.Snapshot()
+	if snap.AltScreen || snap.Lines[0] != "$ vim" || snap.Lines[1] != "" {
+		t.Fatalf("primary after alt=%+v", snap)
+	}
+	if snap.CursorRow != 1 || snap.CursorCol != 0 {
+		t.Fatalf("cursor not restored: (%d,%d)", snap.CursorRow, snap.CursorCol)
+	}
+	for _, l := range s.History(0) {
+		if strings.Contains(l, "editor") {
+			t.Fatalf("alt screen content leaked into history: %q", s.History(0))
+		}
+	}
+}
+
+func TestScrollRegionInsertDelete(t *testing.T) {
+	s := New(10, 5, 0)
+	feed(s, "1\r\n2\r\n3\r\n4\r\n5")
+	feed(s, "\x1b[2;4r")   // region rows 2-4
+	feed(s, "\x1b[4;1H\n") // LF at bottom of region scrolls only the region
+	lines := s.Snapshot().Lines
+	if strings.Join(lines, ",") != "1,3,4,,5" {
+		t.Fatalf("after region scroll=%q", lines)
+	}
+	feed(s, "\x1b[2;1H\x1b[L") // insert a line at row 2
+	lines = s.Snapshot().Lines
+	if strings.Join(lines, ",") != "1,,3,4,5" {
+		t.Fatalf("after IL=%q", lines)
+	}
+	feed(s, "\x1b[M") // delete it again
+	lines = s.Snapshot().Lines
+	if strings.Join(lines, ",") != "1,3,4,,5" {
+		t.Fatalf("after DL=%q", lines)
+	}
+	if len(s.History(0)) != 5 {
+		t.Fatalf("region scroll must not feed scrollback: %q", s.History(0))
+	}
+}
+
+func TestInsertAndDeleteChars(t *testing.T) {
+	s := New(10, 1, 0)
+	feed(s, "abcdef\x1b[1;3H\x1b[2@XY")
+	if got := s.Snapshot().Lines[0]; got != "abXYcdef" {
+		t.Fatalf("after ICH=%q", got)
+	}
+	feed(s, "\x1b[1;1H\x1b[2P")
+	if got := s.Snapshot().Lines[0]; got != "XYcdef" {
+		t.Fatalf("after DCH=%q", got)
+	}
+}
+
+func TestUTF8SplitAcrossWritesAndWideRunes(t *testing.T) {
+	s := New(10, 2, 0)
+	text := []byte("é界x")
+	for _, b := range text {
+		_, _ = s.Write([]byte{b})
+	}
+	snap := s.Snapshot()
+	if snap.Lines[0] != "é界x" {
+		t.Fatalf("line=%q", snap.Lines[0])
+	}
+	if snap.CursorCol != 4 {
+		t.Fatalf("cursor col=%d want 4 (wide rune takes two columns)", snap.CursorCol)
+	}
+}
+
+func TestWideRuneOnOneColumnScreen(t *testing.T) {
+	s := New(4, 2, 0)
+	s.Resize(1, 2)
+	_, _ = s.Write([]byte("界"))
+	snap := s.Snapshot()
+	if snap.Lines[0] != "\uFFFD" || snap.CursorCol != 0 {
+		t.Fatalf("line=%q cursor col=%d want a replacement character", snap.Lines[0], snap.CursorCol)
+	}
+}
+
+func TestOSCTitleAndIgnoredSequences(t *testing.T) {
+	s := New(20, 2, 0)
+	feed(s, "\x1b]0;my title\x07\x1bP+q544e\x1b\\\x1b[>4;2m\x1b[?2004hok")
+	snap := s.Snapshot()
+	if snap.Title != "my title" {
+		t.Fatalf("title=%q", snap.Title)
+	}
+	if snap.Lines[0] != "ok" {
+		t.Fatalf("line=%q", snap.Lines[0])
+	}
+}
+
+func TestLineDrawingCharset(t *testing.T) {
+	s := New(10, 1, 0)
+	feed(s, "\x1b(0lqk\x1b(Bx")
+	if got := s.Snapshot().Lines[0]; got != "┌─┐x" {
+		t.Fatalf("line=%q", got)
+	}
+}
+
+func TestResizeKeepsCursorRowVisible(t *testing.T) {
+	s := New(10, 4, 0)
+	feed(s, "a\r\nb\r\nc\r\nd")
+	s.Resize(5, 2)
+	snap := s.Snapshot()
+	if snap.Rows != 2 || snap.Cols != 5 {
+		t.Fatalf("size=%dx%d", snap.Cols, snap.Rows)
+	}
+	if strings.Join(snap.Lines, ",") != "c,d" {
+		t.Fatalf("lines=%q", snap.Lines)
+	}
+	if strings.Join(s.History(0), ",") != "a,b,c,d" {
+		t.Fatalf("history=%q", s.History(0))
+	}
+}
+
+func TestANSIRedrawReproducesScreen(t *testing.T) {
+	src := New(20, 4, 0)
+	feed(src, "\x1b[1;31mred\x1b[0m plain\r\n\x1b[38;5;120mx\x1b[48;2;1;2;3my\x1b[0m\r\n\x1b[?25l")
+	snap := src.Snapshot()
+
+	dst := New(20, 4, 0)
+	feed(dst, "garbage that must be cleared\r\n")
+	feed(dst, snap.ANSI)
+	got := dst.Snapshot()
+	if strings.Join(got.Lines, "|") != strings.Join(snap.Lines, "|") {
+		t.Fatalf("redraw lines=%q want %q", got.Lines, snap.Lines)
+	}
+	if got.CursorRow != snap.CursorRow || got.CursorCol != snap.CursorCol || got.CursorVisible {
+		t.Fatalf("redraw cursor=%+v want %+v", got, snap)
+	}
+	if dst.grid()[0].cells[0].Attr != src.grid()[0].cells[0].Attr {
+		t.Fatalf("attributes not reproduced")
+	}
+	if dst.grid()[1].cells[1].Attr != src.grid()[1].cells[1].Attr {
+		t.Fatalf("truecolor background not reproduced")
+	}
+}
@@ -0,0 +1,148 @@
+package vt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snapshot is the rendered state of a screen at one point in time.
+type Snapshot struct {
+	Cols          int      `json:"cols"`
+	Rows          int      `json:"rows"`
+	CursorRow     int      `json:"cursor_row"`
+	CursorCol     int      `json:"cursor_col"`
+	CursorVisible bool     `json:"cursor_visible"`
+	AltScreen     bool     `json:"alt_screen"`
+	Title         string   `json:"title,omitempty"`
+	Lines         []string `json:"lines"`
+	// ANSI redraws the screen, including colors and cursor position, on a
+	// terminal of the same size.
+	ANSI string `json:"ansi,omitempty"`
+}
+
+// Snapshot returns the visible screen.
+func (s *Screen) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.grid()
+	lines := make([]string, len(g))
+	for i, l := range g {
+		lines[i] = plainText(l.cells)
+	}
+	return Snapshot{
+		Cols:          s.cols,
+		Rows:          s.rows,
+		CursorRow:     s.cur.row,
+		CursorCol:     s.cur.col,
+		CursorVisible: s.cursorVisible,
+		AltScreen:     s.altActive,
+		Title:         s.title,
+		Lines:         lines,
+		ANSI:          s.renderANSI(),
+	}
+}
+
+// Size returns the screen dimensions.
+func (s *Screen) Size() (cols, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cols, s.rows
+}
+
+// History returns up to n lines of scrollback followed by the visible
+// screen, with soft-wrapped rows joined and trailing blank rows dropped.
+// A non-positive n returns everything.
+func (s *Screen) History(n int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := make([]line, 0, len(s.scrollback)+s.rows)
+	all = append(all, s.scrollback...)
+	all = append(all, s.grid()...)
+
+	var out []string
+	var cur strings.Builder
+	for _, l := range all {
+		text := plainText(l.cells)
+		if l.wrapped {
+			// Keep trailing spaces inside a wrapped row; they are content.
+			cur.WriteString(cellText(l.cells))
+			continue
+		}
+		cur.WriteString(text)
+		out = append(out, cur.String())
+		cur.Reset()
+	}
+	if cur.Len() > 0 {
+		out = append(out, strings.TrimRight(cur.String(), " "))
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if n > 0 && len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out
+}
+
+func cellText(cells []Cell) string {
+	var b strings.Builder
+	for _, c := range cells {
+		if c.Rune == 0 {
+			continue
+		}
+		b.WriteRune(c.Rune)
+	}
+	return b.String()
+}
+
+func plainText(cells []Cell) string {
+	return strings.TrimRight(cellText(cells), " ")
+}
+
+// renderANSI draws the visible screen from a cleared terminal. Rows are
+// positioned absolutely so the output never scrolls the receiving terminal.
+func (s *Screen) renderANSI() string {
+	var b strings.Builder
+	b.WriteString("\x1b[0m\x1b[H\x1b[2J")
+	if s.title != "" {
+		b.WriteString("\x1b]2;" + s.title + "\x07")
+	}
+	for row, l := range s.grid() {
+		end := len(l.cells)
+		for end > 0 && l.cells[end-1] == (Cell{Rune: ' '}) {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H", row+1)
+		attr := Attr{}
+		for _, c := range l.cells[:end] {
+			if c.Rune == 0 {
+				continue
+			}
+			if c.Attr != attr {
+				writeSGR(&b, c.Attr)
+				attr = c.Attr
+			}
+			b.WriteRune(c.Rune)
+		}
+		if attr != (Attr{}) {
+			b.WriteString("\x1b[0m")
+		}
+	}
+	if s.cur.attr != (Attr{}) {
+		writeSGR(&b, s.cur.attr)
+	}
+	if s.top != 0 || s.bottom != s.rows-1 {
+		fmt.Fprintf(&b, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+	fmt.Fprintf(&b, "\x1b[%d;%dH", s.cur.row+1, s.cur.col+1)
+	if !s.cursorVisible {
+		b.WriteString("\x1b[?25l")
+	} else {
+		b.WriteString("\x1b[?25h")
+	}
+	return b.String()
+}